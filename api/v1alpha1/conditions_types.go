@@ -17,6 +17,32 @@ limitations under the License.
 package v1alpha1
 
 const (
+	// SuspendedCondition indicates whether the reconciliation
+	// of the CueInstance is suspended.
+	SuspendedCondition string = "Suspended"
+
+	// HealthyCondition indicates whether the health checks
+	// of the CueInstance are passing.
+	HealthyCondition string = "Healthy"
+
+	// ValidationWarningCondition indicates whether the objects of the
+	// CueInstance fail validations or policies in Warn mode.
+	ValidationWarningCondition string = "ValidationWarning"
+
+	// RolledBackCondition indicates whether the objects of the last applied
+	// revision were re-applied after the health checks of a new revision failed.
+	RolledBackCondition string = "RolledBack"
+
+	// SnapshotFailedCondition indicates whether the snapshot of the objects of
+	// the last applied revision could not be stored, which prevents rolling back to it.
+	SnapshotFailedCondition string = "SnapshotFailed"
+)
+
+const (
+	// ResumedReason represents the fact that the
+	// reconciliation has been resumed after a suspension.
+	ResumedReason string = "Resumed"
+
 	// ArtifactFailedReason represents the fact that the
 	// source artifact download failed.
 	ArtifactFailedReason string = "ArtifactFailed"
@@ -28,4 +54,78 @@ const (
 	// PruneFailedReason represents the fact that the
 	// pruning of the Kustomization failed.
 	PruneFailedReason string = "PruneFailed"
+
+	// HealthCheckFailedReason represents the fact that
+	// one of the health checks failed.
+	HealthCheckFailedReason string = "HealthCheckFailed"
+
+	// HookFailedReason represents the fact that
+	// one of the hooks failed.
+	HookFailedReason string = "HookFailed"
+
+	// NamespaceNotAllowedReason represents the fact that
+	// the rendered objects target namespaces which are not allowed.
+	NamespaceNotAllowedReason string = "NamespaceNotAllowed"
+
+	// KindNotAllowedReason represents the fact that
+	// the rendered objects include kinds which are not allowed.
+	KindNotAllowedReason string = "KindNotAllowed"
+
+	// ClusterScopeNotAllowedReason represents the fact that the rendered
+	// objects include cluster-scoped objects which are not allowed.
+	ClusterScopeNotAllowedReason string = "ClusterScopeNotAllowed"
+
+	// PolicyViolationReason represents the fact that
+	// the rendered objects violate the policies of the CueInstance.
+	PolicyViolationReason string = "PolicyViolation"
+
+	// ValidationFailedReason represents the fact that the rendered
+	// objects don't match the OpenAPI schemas of the cluster.
+	ValidationFailedReason string = "ValidationFailed"
+
+	// RetriesExhaustedReason represents the fact that the reconciliation
+	// kept failing with the same error and is retried at a longer interval.
+	RetriesExhaustedReason string = "RetriesExhausted"
+
+	// ApprovalPendingReason represents the fact that the
+	// changes of the reconciliation await the approval of their plan.
+	ApprovalPendingReason string = "ApprovalPending"
+
+	// RolledBackReason represents the fact that the revision was
+	// rolled back after failing its health checks.
+	RolledBackReason string = "RolledBack"
+
+	// ReadOnlyReason represents the fact that the reconciliation
+	// succeeded without changing the cluster, the controller being read-only.
+	ReadOnlyReason string = "ReadOnly"
+
+	// CueVersionUnsupportedReason represents the fact that the CUE version
+	// of the controller doesn't match the version required by the module.
+	CueVersionUnsupportedReason string = "CueVersionUnsupported"
+
+	// RenderedReason represents the fact that the manifests
+	// were committed to Git without being applied.
+	RenderedReason string = "Rendered"
+
+	// SnapshotFailedReason represents the fact that the snapshot
+	// of the applied objects could not be stored.
+	SnapshotFailedReason string = "SnapshotFailed"
 )
+
+// terminalReasons are the reasons of the failures which retrying can't
+// recover from until the spec of the CueInstance or the source revision changes.
+var terminalReasons = map[string]bool{
+	BuildFailedReason:            true,
+	NamespaceNotAllowedReason:    true,
+	KindNotAllowedReason:         true,
+	ClusterScopeNotAllowedReason: true,
+	PolicyViolationReason:        true,
+	RolledBackReason:             true,
+	CueVersionUnsupportedReason:  true,
+}
+
+// IsTerminalReason reports whether a failure with the given reason
+// marks the CueInstance as Stalled.
+func IsTerminalReason(reason string) bool {
+	return terminalReasons[reason]
+}
@@ -22,6 +22,8 @@ import (
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/runtime/dependency"
 
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -33,17 +35,69 @@ const (
 	IgnorePolicy ValidationMode = "Ignore"
 	// AuditPolicy will ignore validation failures and generate an event
 	AuditPolicy ValidationMode = "Audit"
+	// WarnPolicy will apply all objects, reporting validation failures in the
+	// ValidationWarning condition and in events without affecting readiness
+	WarnPolicy ValidationMode = "Warn"
 	// DropPolicy will drop objects which are invalid but continue to reconcile valid objects
 	DropPolicy ValidationMode = "Drop"
 	// FailPolicy will fail the entire reconcile if any validation errors are encountered
 	FailPolicy ValidationMode = "Fail"
 )
 
+// BuildMode is the layout of the value exported by the CUE instance.
+type BuildMode string
+
+const (
+	// StreamBuildMode exports each expression as a YAML document,
+	// or a document per item when the expression is a list.
+	StreamBuildMode BuildMode = "Stream"
+	// MapBuildMode exports the Kubernetes objects found in the values of
+	// nested structs, such as objects keyed by kind and name, in the
+	// lexical order of their keys.
+	MapBuildMode BuildMode = "Map"
+)
+
+const (
+	// ForceRequestAnnotation is the annotation used for requesting a single
+	// reconciliation during which objects with immutable field changes are recreated.
+	ForceRequestAnnotation = "reconcile.fluxcd.io/forceAt"
+
+	// ApprovalAnnotation is the annotation used for approving the plan of a
+	// CueInstance with gated applies, its value must be the ID of the plan.
+	ApprovalAnnotation = "cue.contrib.flux.io/approve"
+
+	// RollbackAnnotation is the annotation used for rolling back a CueInstance
+	// to a revision of its history, which is applied instead of the source
+	// revision for as long as the annotation is set.
+	RollbackAnnotation = "cue.contrib.flux.io/rollbackTo"
+)
+
 const (
 	CueInstanceKind           = "CueInstance"
 	CueInstanceFinalizer      = "finalizers.fluxcd.io"
 	MaxConditionMessageLength = 20000
 	DisabledValue             = "disabled"
+	// IfNotPresentValue is the value of the ssa annotation of the objects
+	// which are only applied when they don't exist in the cluster.
+	IfNotPresentValue = "IfNotPresent"
+)
+
+const (
+	// AllowedKindsAnnotation lists, on a Namespace, the kinds the CueInstances
+	// of the namespace may apply, in the form 'Kind.group' or 'Kind' for the
+	// core group, separated by commas. Shell patterns such as '*.apps' are supported.
+	AllowedKindsAnnotation = "cue.contrib.flux.io/allowed-kinds"
+	// DeniedKindsAnnotation lists, on a Namespace, the kinds the CueInstances
+	// of the namespace may not apply, in the same form as AllowedKindsAnnotation.
+	DeniedKindsAnnotation = "cue.contrib.flux.io/denied-kinds"
+	// ValidationModeAnnotation overrides, on a rendered object, the validation
+	// mode and the action of the policies which the object fails, e.g. 'Audit'
+	// exempts a nonconforming object and 'Fail' enforces them for it.
+	ValidationModeAnnotation = "cue.contrib.flux.io/validation"
+	// ManagedAnnotation set to 'false' on a live object makes the controller
+	// leave it untouched, neither applying nor pruning it although it is part
+	// of the rendered objects, e.g. during an emergency manual override.
+	ManagedAnnotation = "cue.contrib.flux.io/managed"
 )
 
 // CueInstanceSpec defines the desired state of CueInstance
@@ -70,6 +124,31 @@ type CueInstanceSpec struct {
 	// +optional
 	Package string `json:"package,omitempty"`
 
+	// CueVersionConstraint is a semver range the CUE version embedded in the
+	// controller must satisfy, e.g. '>=0.4.0 <0.5.0', so that upgrading the
+	// controller doesn't silently change the evaluation of the instance.
+	// +optional
+	CueVersionConstraint string `json:"cueVersionConstraint,omitempty"`
+
+	// Components lists the paths, relative to the module root, of additional
+	// CUE packages unified in order on top of the package built from Path,
+	// e.g. to toggle optional features per environment.
+	// +optional
+	Components []string `json:"components,omitempty"`
+
+	// Overlays lists the paths, relative to the module root, of CUE packages
+	// or of CUE, YAML and JSON files whose values are unified in order over
+	// the value of the CUE instance before it is exported, e.g. to patch a
+	// shared base with the values of an environment.
+	// +optional
+	Overlays []string `json:"overlays,omitempty"`
+
+	// DataFiles loads the YAML, JSON and TOML files of the source as data
+	// into the CUE instance, so that they may be validated and referenced
+	// by the package.
+	// +optional
+	DataFiles []DataFile `json:"dataFiles,omitempty"`
+
 	// Tags that will be injected into the CUE instance.
 	// +optional
 	Tags []TagVar `json:"tags,omitempty"`
@@ -78,55 +157,346 @@ type CueInstanceSpec struct {
 	// +optional
 	TagVars []TagVar `json:"tagVars,omitempty"`
 
+	// ValuesFrom sources tag variables from the outputs other CueInstances
+	// write to their spec.writeOutputsTo destination. The CueInstance is only
+	// reconciled once the referenced CueInstances are ready, and is reconciled
+	// again whenever their outputs change. The tag variables of TagVars take
+	// precedence over the ones sourced from the outputs, and the ones sourced
+	// from outputs written to Secrets are redacted.
+	// +optional
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+
+	// Matrix renders the CUE instance once per combination of the values
+	// of the listed tags, the objects of all the variants are applied
+	// under the inventory of the CueInstance.
+	// +optional
+	Matrix []MatrixDimension `json:"matrix,omitempty"`
+
+	// Profile selects a named bundle of tags and tag variables defined in a
+	// ProfileConfig in the namespace of the CueInstance or, when not found
+	// there, in the namespace of the controller. The tags and tag variables
+	// listed in the CueInstance take precedence over the ones of the profile.
+	// +optional
+	Profile string `json:"profile,omitempty"`
+
 	// The CUE expression(s) to execute.
 	// +optional
 	Exprs []string `json:"expressions,omitempty"`
 
+	// ExprsFrom loads additional CUE expressions from a ConfigMap key in the
+	// namespace of the CueInstance, one expression per line. The loaded
+	// expressions are executed after the ones listed in Exprs.
+	// +optional
+	ExprsFrom *ExpressionsSource `json:"expressionsFrom,omitempty"`
+
+	// OutputExpr is the CUE path of the value containing the Kubernetes
+	// objects to apply when no expressions are specified, '.' selects the
+	// package root. Defaults to 'objects' when the instance defines it,
+	// otherwise to the package root, which must be an object or a list of
+	// objects. A package root without regular fields only applies the data
+	// files of the instance.
+	// +optional
+	OutputExpr string `json:"outputExpr,omitempty"`
+
+	// WriteOutputsTo writes the values of CUE expressions to the keys of a
+	// Secret or ConfigMap in the namespace of the CueInstance, e.g. generated
+	// passwords or computed endpoints consumed by other workloads. The outputs
+	// are written once the objects have been applied and are ready, they are
+	// not evaluated for matrix builds.
+	// +optional
+	WriteOutputsTo *OutputsDestination `json:"writeOutputsTo,omitempty"`
+
+	// Publish pushes the manifests of every applied revision to an OCI
+	// repository, as a Flux artifact tagged with the revision, so that other
+	// clusters and tools can consume the applied objects and audits have an
+	// immutable record of them. The data of the Secrets is masked.
+	// +optional
+	Publish *PublishOptions `json:"publish,omitempty"`
+
+	// RenderTo commits the manifests of every reconciled revision to a path
+	// of a Git repository branch, for review-based GitOps flows and disaster
+	// recovery. The data of the Secrets is masked. Requires the git binary
+	// in the controller image.
+	// +optional
+	RenderTo *GitRenderOptions `json:"renderTo,omitempty"`
+
+	// Build fine-tunes the evaluation of the CUE instance.
+	// +optional
+	Build *BuildOptions `json:"build,omitempty"`
+
+	// Extract overrides the limits enforced by the controller
+	// when extracting the source artifact.
+	// +optional
+	Extract *ExtractOptions `json:"extract,omitempty"`
+
 	// Dependencies that must be ready before the CUE instance is reconciled.
 	// +optional
-	DependsOn []dependency.CrossNamespaceDependencyReference `json:"dependsOn,omitempty"`
+	DependsOn []DependencyReference `json:"dependsOn,omitempty"`
 
 	// Prune enables garbage collection.
 	// +required
 	Prune bool `json:"prune"`
 
+	// PruneOptions fine-tune the garbage collection.
+	// +optional
+	PruneOptions *PruneOptions `json:"pruneOptions,omitempty"`
+
+	// AllowedNamespaces restricts the namespaces the rendered objects may
+	// target, as a list of names or shell patterns such as 'team-*'.
+	// Rendering a namespaced object or a Namespace outside of the allowed
+	// namespaces fails the reconciliation. The namespaces allowed by
+	// the controller, if any, apply in addition.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// NamePrefix is prepended to the names of the rendered objects, except
+	// Namespaces and CustomResourceDefinitions. The references to the renamed
+	// objects from workloads, RBAC bindings, autoscalers and ingresses are
+	// updated accordingly.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	NamePrefix string `json:"namePrefix,omitempty"`
+
+	// NameSuffix is appended to the names of the rendered objects, following
+	// the same rules as NamePrefix.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	NameSuffix string `json:"nameSuffix,omitempty"`
+
+	// CreateNamespace instructs the controller to create the namespaces
+	// of the rendered objects which are not part of the rendered objects.
+	// The namespaces are applied before any other object and are garbage
+	// collected together with the other objects when Prune is enabled.
+	// +optional
+	CreateNamespace bool `json:"createNamespace,omitempty"`
+
 	// The interval at which to retry a previously failed reconciliation.
 	// When not specified, the controller uses the CueInstanceSpec.Interval
 	// value to retry failures.
 	// +optional
 	RetryInterval *metav1.Duration `json:"retryInterval,omitempty"`
 
+	// A list of resources to be included in the health assessment.
+	// Jobs are considered healthy only once they have completed.
+	// +optional
+	HealthChecks []meta.NamespacedObjectKindReference `json:"healthChecks,omitempty"`
+
+	// Wait instructs the controller to check the health of all the reconciled resources.
+	// When enabled, the HealthChecks are ignored. Defaults to false.
+	// +optional
+	Wait bool `json:"wait,omitempty"`
+
+	// RollbackOnFailure re-applies the objects of the last applied revision
+	// when the health checks of a new revision fail, the new revision is then
+	// not applied again until its objects or the spec of the CueInstance change.
+	// +optional
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+
+	// HistoryLimit is the number of applied revisions kept in the history
+	// with a snapshot of their objects, to which the CueInstance can be
+	// rolled back through the rollback annotation. Defaults to none, or
+	// to the last applied revision when RollbackOnFailure is enabled.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HistoryLimit int `json:"historyLimit,omitempty"`
+
+	// Hooks are Jobs run at specific points of the reconciliation.
+	// +optional
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// ProgressiveDelivery enables the integration with a progressive
+	// delivery operator for the rendered Deployments.
+	// +optional
+	ProgressiveDelivery *ProgressiveDelivery `json:"progressiveDelivery,omitempty"`
+
 	// Timeout for validation, apply and health checking operations.
 	// Defaults to 'Interval' duration.
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// FinalizationTimeout is the maximum duration for which the garbage collection
+	// of a deleted CueInstance is retried, after which the remaining objects are
+	// orphaned and reported. When not specified, it is retried until it succeeds.
+	// +optional
+	FinalizationTimeout *metav1.Duration `json:"finalizationTimeout,omitempty"`
+
 	// This flag tells the controller to suspend subsequent cue executions,
 	// it does not apply to already started executions. Defaults to false.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
 
+	// Priority of the reconciliations of this CueInstance when the controller
+	// is busy, those of higher priority are started first. Only honored when
+	// the controller runs with a priority queue. Defaults to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
 	// The name of the Kubernetes service account to impersonate
 	// when reconciling this CueInstance.
 	// +optional
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
 
+	// ConflictPolicy determines how the field conflicts with other field
+	// managers are resolved when applying the objects.
+	// Defaults to taking the ownership of the conflicting fields.
+	// +optional
+	ConflictPolicy *ConflictPolicy `json:"conflictPolicy,omitempty"`
+
+	// AdoptionPolicy determines how the objects which exist in the cluster
+	// without being managed by a CueInstance, such as the objects created
+	// with kubectl or Helm, are taken over. Defaults to applying over them
+	// without migrating the ownership of their fields.
+	// +optional
+	AdoptionPolicy *AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// IgnorePaths lists the fields whose live values are kept by the applies,
+	// so that fields owned by other controllers, such as the replicas of an
+	// autoscaled Deployment, are neither changed nor reported as drifted.
+	// +optional
+	IgnorePaths []IgnoreRule `json:"ignorePaths,omitempty"`
+
+	// CRDs determines how the CustomResourceDefinitions of the rendered objects
+	// are applied, 'Create' only creates the missing CRDs, 'CreateReplace'
+	// creates and updates them and 'Skip' leaves them untouched.
+	// Defaults to 'CreateReplace'.
+	// +kubebuilder:validation:Enum=Create;CreateReplace;Skip
+	// +optional
+	CRDs CRDsPolicy `json:"crds,omitempty"`
+
+	// FieldManager is appended to the server-side apply field manager of the
+	// controller, as in 'cue-controller/<fieldManager>', so that the managed
+	// fields of the applied objects can be attributed to a tenant.
+	// Defaults to the field manager of the controller.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern="^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$"
+	// +optional
+	FieldManager string `json:"fieldManager,omitempty"`
+
 	// The KubeConfig for reconciling the CueInstance on a remote cluster.
 	// When specified, KubeConfig takes precedence over ServiceAccountName.
 	// +optional
 	KubeConfig *KubeConfig `json:"kubeConfig,omitempty"`
 
+	// KubeConfigs for reconciling the CueInstance on multiple remote clusters.
+	// The CUE instance is built once and applied to each of the clusters.
+	// When specified, KubeConfigs takes precedence over KubeConfig.
+	// +optional
+	KubeConfigs []KubeConfig `json:"kubeConfigs,omitempty"`
+
+	// ClusterSelector selects KubeConfig secrets in the namespace of the CueInstance
+	// by label, the CueInstance is applied to each of the selected clusters in
+	// addition to the ones listed in KubeConfigs. Secrets which start matching the
+	// selector are picked up automatically.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// ClusterGroups orders the rollout to the targeted clusters: the groups are
+	// reconciled in order, and the rollout halts when a group fails to become
+	// ready, e.g. canary clusters first then the rest of the fleet. The targeted
+	// clusters which don't belong to any group are reconciled last.
+	// +optional
+	ClusterGroups []ClusterGroup `json:"clusterGroups,omitempty"`
+
+	// Approval gates the applies on the approval of the planned changes:
+	// the changes are computed with a dry-run and recorded in the status,
+	// and are only applied once the plan is approved.
+	// +optional
+	Approval *ApprovalPolicy `json:"approval,omitempty"`
+
 	// Force instructs the controller to recreate resources
 	// when patching fails due to an immutable field change.
 	// +kubebuilder:default:=false
 	// +optional
 	Force bool `json:"force,omitempty"`
 
+	// StrictFields fails the reconciliation when the rendered objects contain
+	// fields unknown to the schemas of the cluster, which the API server would
+	// otherwise drop silently, e.g. a misspelled field of a custom resource.
+	// +optional
+	StrictFields bool `json:"strictFields,omitempty"`
+
+	// SensitivePaths lists the dot separated paths of the fields of the objects
+	// whose values are masked in the diffs, events and validation errors, in
+	// addition to the data of the Secrets. A '*' matches any field or list item,
+	// e.g. 'spec.values.*.password'.
+	// +optional
+	SensitivePaths []string `json:"sensitivePaths,omitempty"`
+
 	// TODO(maybe): this could be an array of validations
 	// in which case the policy may need to apply to all resources
 	// would allow for greater flexibility
 	// +optional
 	Validate *Validation `json:"validate,omitempty"`
+
+	// Policies are CEL rules evaluated against each of the rendered
+	// objects before they are applied.
+	// +optional
+	Policies []ObjectPolicy `json:"policies,omitempty"`
+
+	// RegoPolicies evaluates the rendered objects against the OPA Rego
+	// policies of the source artifact before they are applied.
+	// +optional
+	RegoPolicies *RegoPolicies `json:"regoPolicies,omitempty"`
+}
+
+// ObjectPolicy is a CEL rule the rendered objects must comply with.
+type ObjectPolicy struct {
+	// Name of the policy, used in the messages reporting the violations.
+	// +required
+	Name string `json:"name"`
+
+	// Rule is a CEL expression returning true when the rendered object,
+	// available as 'object', complies with the policy, e.g.
+	// 'object.kind != "Service" || object.spec.type != "LoadBalancer"'.
+	// +optional
+	Rule string `json:"rule,omitempty"`
+
+	// RuleFrom loads the rule from a ConfigMap key in the namespace
+	// of the CueInstance, it takes precedence over Rule.
+	// +optional
+	RuleFrom *ExpressionsSource `json:"ruleFrom,omitempty"`
+
+	// Target restricts the policy to the selected objects.
+	// +optional
+	Target *Selector `json:"target,omitempty"`
+
+	// Message describing the violations, defaults to the rule.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Action taken when an object violates the policy: Audit emits an
+	// event, Warn also reports the violation in the ValidationWarning
+	// condition, Drop emits an event and skips the object, Fail fails the
+	// reconciliation.
+	// +kubebuilder:validation:Enum=Audit;Warn;Drop;Fail
+	// +kubebuilder:default:="Fail"
+	// +optional
+	Action ValidationMode `json:"action,omitempty"`
+}
+
+// RegoPolicies are OPA Rego policies loaded from the source artifact, written
+// in the manner of conftest: each rendered object is the input of the 'deny',
+// 'violation' and 'warn' rules, and of the rules prefixed with 'deny_',
+// 'violation_' and 'warn_', which return the messages of the violations.
+type RegoPolicies struct {
+	// Path of the directory holding the .rego files, relative to the root
+	// of the source artifact.
+	// +required
+	Path string `json:"path"`
+
+	// Namespaces are the Rego packages of the evaluated rules.
+	// Defaults to 'main'.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Action taken for the objects which violate the deny rules: Audit emits
+	// an event, Warn also reports the violation in the ValidationWarning
+	// condition, Drop emits an event and skips the object, Fail fails the
+	// reconciliation. The warnings are always reported as events.
+	// +kubebuilder:validation:Enum=Audit;Warn;Drop;Fail
+	// +kubebuilder:default:="Fail"
+	// +optional
+	Action ValidationMode `json:"action,omitempty"`
 }
 
 // TagVar is a tag variable with a required name and optional value
@@ -136,6 +506,243 @@ type TagVar struct {
 
 	// +optional
 	Value string `json:"value,omitempty"`
+
+	// ValueFrom sources the value from a key of a ConfigMap or Secret, or from
+	// an ImagePolicy, in the namespace of the CueInstance. When the reference is optional
+	// and cannot be resolved, Value is used instead. Either Kind, Name and Key,
+	// or ImagePolicyRef must be set.
+	// +optional
+	ValueFrom *TagVarSource `json:"valueFrom,omitempty"`
+
+	// Sensitive redacts the value from the build errors, the validation
+	// messages and the conditions. The values sourced from Secrets are
+	// always redacted.
+	// +optional
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// IsSensitive reports whether the value of the tag must be redacted.
+func (t TagVar) IsSensitive() bool {
+	return t.Sensitive || (t.ValueFrom != nil && t.ValueFrom.Kind == "Secret")
+}
+
+// DataFile selects the data files loaded into the CUE instance.
+type DataFile struct {
+	// Glob matching the files, relative to the module root, e.g. 'config/*.yaml'.
+	// +required
+	Glob string `json:"glob"`
+
+	// Path is the CUE path at which the files are placed, each of them under
+	// a field named after the file without its extension, e.g. the contents
+	// of 'config/prod.yaml' are placed at 'config.prod' for the path 'config'.
+	// +required
+	Path string `json:"path"`
+}
+
+// ValuesReference is a reference to the outputs of a CueInstance.
+type ValuesReference struct {
+	// Name of the CueInstance.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the CueInstance, defaults to the namespace of the referring CueInstance.
+	// The CueInstance and its outputs are read with the service account of the
+	// referring CueInstance, and must be in its namespace when cross-namespace
+	// references are blocked.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Keys maps the keys of the outputs to tag variables. When omitted,
+	// all the outputs are sourced as tag variables named after their keys.
+	// +optional
+	Keys []ValuesKey `json:"keys,omitempty"`
+}
+
+// ValuesKey maps a key of the outputs to a tag variable.
+type ValuesKey struct {
+	// Key of the outputs.
+	// +required
+	Key string `json:"key"`
+
+	// TagVar is the name of the tag variable, defaults to the key.
+	// +optional
+	TagVar string `json:"tagVar,omitempty"`
+}
+
+// OutputsDestination is the Secret or ConfigMap the outputs are written to.
+type OutputsDestination struct {
+	// Kind of the destination, valid values are ('Secret', 'ConfigMap').
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the destination, in the namespace of the CueInstance.
+	// The destination is created and owned by the CueInstance, an existing
+	// destination not controlled by the CueInstance is not overwritten.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +required
+	Name string `json:"name"`
+
+	// Outputs maps the keys of the destination to CUE expressions.
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	Outputs []Output `json:"outputs"`
+}
+
+// GitRenderOptions defines the Git repository the manifests are committed to.
+type GitRenderOptions struct {
+	// URL of the Git repository, over HTTPS or SSH.
+	// +kubebuilder:validation:Pattern="^(https|ssh)://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// Branch the manifests are committed to, it is created when missing.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern="^[^-]"
+	// +required
+	Branch string `json:"branch"`
+
+	// Path of the directory of the manifests within the repository,
+	// defaults to '<namespace>/<name>'. Absolute paths and '..' segments
+	// are rejected.
+	// +kubebuilder:validation:Pattern=`^([^./][^/]*|\.[^./][^/]*|\.\.[^/]+|\.)(/([^./][^/]*|\.[^./][^/]*|\.\.[^/]+|\.)?)*$`
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// SecretRef references a Secret, in the namespace of the CueInstance,
+	// holding the 'username' and 'password' of the HTTPS repositories, or
+	// the 'identity' private key and 'known_hosts' of the SSH repositories.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// SkipApply only commits the manifests, without applying them to the
+	// clusters nor garbage collecting the objects previously applied.
+	// +optional
+	SkipApply bool `json:"skipApply,omitempty"`
+}
+
+// RenderedCommit is a commit of the manifests to the Git repository.
+type RenderedCommit struct {
+	// Commit is the SHA of the commit holding the manifests.
+	// +required
+	Commit string `json:"commit"`
+
+	// Revision of the source the manifests were rendered from.
+	// +required
+	Revision string `json:"revision"`
+
+	// Checksum is the SHA256 digest of the rendered object set.
+	// +required
+	Checksum string `json:"checksum"`
+}
+
+// PublishedArtifact is an artifact pushed to the OCI repository.
+type PublishedArtifact struct {
+	// URL of the artifact, including its tag.
+	// +required
+	URL string `json:"url"`
+
+	// Digest of the artifact manifest.
+	// +required
+	Digest string `json:"digest"`
+
+	// Revision of the source the manifests were rendered from.
+	// +required
+	Revision string `json:"revision"`
+
+	// Checksum is the SHA256 digest of the published object set.
+	// +required
+	Checksum string `json:"checksum"`
+}
+
+// PublishOptions defines the OCI repository the manifests are pushed to.
+type PublishOptions struct {
+	// URL of the OCI repository, e.g. 'oci://ghcr.io/org/manifests/app'.
+	// +kubebuilder:validation:Pattern="^oci://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// SecretRef references a Secret of type 'kubernetes.io/dockerconfigjson',
+	// in the namespace of the CueInstance, holding the registry credentials.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows pushing to a registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// Output is a CUE expression written to a key of the outputs destination.
+type Output struct {
+	// Key of the destination the value is written to.
+	// +required
+	Key string `json:"key"`
+
+	// Expr is the CUE path of the value, which must be concrete. Strings are
+	// written as they are, the other values are encoded to JSON.
+	// +required
+	Expr string `json:"expr"`
+}
+
+// ExpressionsSource is a reference to a ConfigMap key holding CUE expressions.
+type ExpressionsSource struct {
+	// Name of the ConfigMap. Should reside in the same namespace as the
+	// referring resource.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +required
+	Name string `json:"name"`
+
+	// Key of the expressions in the ConfigMap.
+	// +required
+	Key string `json:"key"`
+}
+
+// TagVarSource is a reference to a key of a ConfigMap or Secret,
+// or to the latest image selected by an ImagePolicy.
+type TagVarSource struct {
+	// Kind of the values referent, valid values are ('Secret', 'ConfigMap').
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the values referent. Should reside in the same namespace as the
+	// referring resource.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Key of the value in the referent.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// ImagePolicyRef sources the value from the latest image selected by a
+	// Flux ImagePolicy in the namespace of the CueInstance, the CueInstance
+	// is reconciled again whenever the policy selects a new image.
+	// +optional
+	ImagePolicyRef *ImagePolicyReference `json:"imagePolicyRef,omitempty"`
+
+	// Optional indicates whether the referenced resource must exist, or whether to
+	// tolerate its absence. If true and the referenced resource or key is absent,
+	// the tag takes its default value and the reconciliation continues.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+// ImagePolicyReference is a reference to a Flux ImagePolicy.
+type ImagePolicyReference struct {
+	// Name of the ImagePolicy.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +required
+	Name string `json:"name"`
+
+	// Part of the latest image used as the value, either the whole 'Image'
+	// reference or only its 'Tag'. Defaults to 'Image'.
+	// +kubebuilder:validation:Enum=Image;Tag
+	// +optional
+	Part string `json:"part,omitempty"`
 }
 
 type Validation struct {
@@ -143,14 +750,272 @@ type Validation struct {
 	// +optional
 	Mode ValidationMode `json:"mode,omitempty"`
 
+	// Schema is the CUE path of the schema within the instance, or the location
+	// of a remote schema, either an HTTPS URL of a CUE file or an 'oci://'
+	// reference of an artifact containing one. The path of the schema within a
+	// remote file may follow the first '#', e.g. 'https://example.com/k8s.cue##Deployment'.
 	// +required
 	Schema string `json:"schema"`
 
+	// Checksum pins the SHA256 digest of a remote schema, in the form 'sha256:<hex>',
+	// the validation fails when the fetched schema does not match it.
+	// +kubebuilder:validation:Pattern="^sha256:[a-f0-9]{64}$"
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
 	// +kubebuilder:default:="yaml"
 	// +optional
 	Type string `json:"type,omitempty"`
 }
 
+// MatrixDimension is a tag whose values are iterated by a matrix build.
+type MatrixDimension struct {
+	// Name of the tag.
+	// +required
+	Name string `json:"name"`
+
+	// Values of the tag, the instance is rendered once for each of them.
+	// +kubebuilder:validation:MinItems=1
+	// +required
+	Values []string `json:"values"`
+}
+
+// BuildOptions fine-tune the evaluation of the CUE instance.
+type BuildOptions struct {
+	// RequireConcrete fails the build when a field of the exported value
+	// is incomplete or resolved by a default value, listing the offending paths.
+	// +optional
+	RequireConcrete bool `json:"requireConcrete,omitempty"`
+
+	// Mode is the layout of the exported value, either a stream of
+	// documents or a struct of objects keyed by name.
+	// +kubebuilder:validation:Enum=Stream;Map
+	// +kubebuilder:default:="Stream"
+	// +optional
+	Mode BuildMode `json:"mode,omitempty"`
+}
+
+// SymlinkPolicy determines how the symbolic links of the source artifact are extracted.
+type SymlinkPolicy string
+
+const (
+	// RejectSymlinks fails the extraction of artifacts containing symbolic links.
+	RejectSymlinks SymlinkPolicy = "Reject"
+	// SkipSymlinks extracts the artifacts without their symbolic links.
+	SkipSymlinks SymlinkPolicy = "Skip"
+	// AllowSymlinks extracts the symbolic links which point inside the artifact.
+	AllowSymlinks SymlinkPolicy = "Allow"
+)
+
+// ExtractOptions override the limits of the source artifact extraction.
+type ExtractOptions struct {
+	// MaxSize is the maximum total size of the extracted files, e.g. '2Gi'.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+
+	// MaxFiles is the maximum number of extracted files.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxFiles *int `json:"maxFiles,omitempty"`
+
+	// Symlinks determines how the symbolic links are extracted.
+	// +kubebuilder:validation:Enum=Reject;Skip;Allow
+	// +optional
+	Symlinks SymlinkPolicy `json:"symlinks,omitempty"`
+}
+
+// PruneOptions fine-tune the garbage collection of the CueInstance.
+type PruneOptions struct {
+	// OnChangeOnly skips the garbage collection of reconciliations which
+	// neither change the source revision, the spec nor the rendered objects.
+	// +optional
+	OnChangeOnly bool `json:"onChangeOnly,omitempty"`
+
+	// ExcludeClusterScoped excludes the cluster-scoped objects, such as
+	// shared CRDs and ClusterRoles, from the garbage collection.
+	// +optional
+	ExcludeClusterScoped bool `json:"excludeClusterScoped,omitempty"`
+
+	// Wait makes the garbage collection wait for the deleted objects to
+	// disappear, e.g. once their finalizers have run, before it succeeds.
+	// +optional
+	Wait bool `json:"wait,omitempty"`
+
+	// Timeout is the maximum duration of the wait for the deleted objects,
+	// defaults to the timeout of the CueInstance.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ClusterGroup is a group of the targeted clusters rolled out together.
+type ClusterGroup struct {
+	// Name of the group, e.g. 'canary'.
+	// +required
+	Name string `json:"name"`
+
+	// Clusters lists the names of the KubeConfig secrets of the clusters of the group.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+
+	// Selector selects the clusters of the group by the labels of their KubeConfig secrets.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ApprovalPolicy defines how the plans of the CueInstance are approved.
+type ApprovalPolicy struct {
+	// AutoApproveSemver is a semver range, the revisions of the tags
+	// matching it are applied without approval, e.g. '>=1.0.0 <2.0.0'.
+	// +optional
+	AutoApproveSemver string `json:"autoApproveSemver,omitempty"`
+}
+
+// IgnoreRule excludes the fields of the selected objects from the apply.
+type IgnoreRule struct {
+	// Paths are the JSON pointers of the ignored fields, e.g. '/spec/replicas'.
+	// +required
+	Paths []string `json:"paths"`
+
+	// Target selects the objects the rule applies to, defaults to all objects.
+	// +optional
+	Target *Selector `json:"target,omitempty"`
+}
+
+// CRDsPolicy determines how the CustomResourceDefinitions are applied.
+type CRDsPolicy string
+
+const (
+	// CreateCRDs creates the CRDs which don't exist and never updates them.
+	CreateCRDs CRDsPolicy = "Create"
+	// CreateReplaceCRDs creates the CRDs which don't exist and updates the existing ones.
+	CreateReplaceCRDs CRDsPolicy = "CreateReplace"
+	// SkipCRDs neither creates nor updates the CRDs.
+	SkipCRDs CRDsPolicy = "Skip"
+)
+
+// ConflictResolution is the resolution of the server-side apply field conflicts.
+type ConflictResolution string
+
+const (
+	// ForceConflictResolution takes the ownership of the conflicting fields.
+	ForceConflictResolution ConflictResolution = "Force"
+	// FailConflictResolution fails the apply of the objects with conflicting fields.
+	FailConflictResolution ConflictResolution = "Fail"
+)
+
+// ConflictPolicy determines how the server-side apply field conflicts are resolved.
+type ConflictPolicy struct {
+	// Default is the resolution of the objects which do not match any rule.
+	// +kubebuilder:validation:Enum=Force;Fail
+	// +kubebuilder:default:="Force"
+	// +optional
+	Default ConflictResolution `json:"default,omitempty"`
+
+	// Rules override the default resolution for the objects matching
+	// their target, the first matching rule applies.
+	// +optional
+	Rules []ConflictRule `json:"rules,omitempty"`
+}
+
+// ConflictRule sets the conflict resolution of the objects matching the target.
+type ConflictRule struct {
+	// Target selects the objects the rule applies to.
+	// +required
+	Target Selector `json:"target"`
+
+	// Resolution of the field conflicts of the selected objects.
+	// +kubebuilder:validation:Enum=Force;Fail
+	// +required
+	Resolution ConflictResolution `json:"resolution"`
+}
+
+// AdoptionMode is the handling of the pre-existing unmanaged objects.
+type AdoptionMode string
+
+const (
+	// AdoptAdoptionMode takes the ownership of the pre-existing objects.
+	AdoptAdoptionMode AdoptionMode = "Adopt"
+	// FailAdoptionMode fails the apply when rendered objects already exist.
+	FailAdoptionMode AdoptionMode = "Fail"
+)
+
+// AdoptionPolicy determines how the pre-existing unmanaged objects are taken over.
+type AdoptionPolicy struct {
+	// Mode is either 'Adopt', to take the ownership of the pre-existing
+	// objects, or 'Fail', to fail the apply when they exist.
+	// +kubebuilder:validation:Enum=Adopt;Fail
+	// +kubebuilder:default:="Adopt"
+	// +optional
+	Mode AdoptionMode `json:"mode,omitempty"`
+
+	// FieldManagers lists the prefixes of the field managers whose fields
+	// are transferred to the controller when an object is adopted.
+	// Defaults to 'kubectl', 'before-first-apply' and 'helm'.
+	// +optional
+	FieldManagers []string `json:"fieldManagers,omitempty"`
+}
+
+// Hooks defines the Jobs run during the reconciliation.
+type Hooks struct {
+	// PreApply hooks are run before the objects are applied, whenever
+	// the rendered objects change. A failed hook fails the reconciliation.
+	// +optional
+	PreApply []Hook `json:"preApply,omitempty"`
+
+	// PostApply hooks are run after the objects have been applied and
+	// passed the health checks, whenever the rendered objects change.
+	// +optional
+	PostApply []Hook `json:"postApply,omitempty"`
+}
+
+// Hook selects rendered Jobs which are run as a hook instead of being applied
+// with the rest of the objects. The Jobs are recreated for every run and
+// the hook succeeds once all of them have completed.
+type Hook struct {
+	// Name of the hook.
+	// +required
+	Name string `json:"name"`
+
+	// Selector matches the labels of the rendered Jobs run by this hook.
+	// +required
+	Selector metav1.LabelSelector `json:"selector"`
+}
+
+// ProgressiveDelivery configures the integration with a progressive delivery operator.
+// The rendered Deployments are annotated with the source revision and the
+// promotion gate of the controller can be used to confirm promotions.
+type ProgressiveDelivery struct {
+	// Provider is the progressive delivery operator, defaults to 'flagger'.
+	// +kubebuilder:validation:Enum=flagger
+	// +kubebuilder:default:=flagger
+	// +optional
+	Provider string `json:"provider,omitempty"`
+}
+
+// PruneOnChangeOnly reports whether the garbage collection is skipped
+// for reconciliations which do not change anything.
+func (in CueInstance) PruneOnChangeOnly() bool {
+	return in.Spec.PruneOptions != nil && in.Spec.PruneOptions.OnChangeOnly
+}
+
+// PruneExcludesClusterScoped reports whether the cluster-scoped
+// objects are excluded from the garbage collection.
+func (in CueInstance) PruneExcludesClusterScoped() bool {
+	return in.Spec.PruneOptions != nil && in.Spec.PruneOptions.ExcludeClusterScoped
+}
+
+// PruneWait reports whether the garbage collection waits for the deleted
+// objects to disappear, and the maximum duration of the wait.
+func (in CueInstance) PruneWait() (bool, time.Duration) {
+	if in.Spec.PruneOptions == nil || !in.Spec.PruneOptions.Wait {
+		return false, 0
+	}
+	if in.Spec.PruneOptions.Timeout != nil {
+		return true, in.Spec.PruneOptions.Timeout.Duration
+	}
+	return true, in.GetTimeout()
+}
+
 // GetTimeout returns the timeout
 func (in CueInstance) GetTimeout() time.Duration {
 	duration := in.Spec.Interval.Duration - 30*time.Second
@@ -175,6 +1040,18 @@ type KubeConfig struct {
 	// the CueInstance.
 	// +required
 	SecretRef meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// QPS is the maximum queries-per-second of the requests sent to the
+	// cluster, defaults to the --remote-kube-api-qps flag of the controller.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	QPS int32 `json:"qps,omitempty"`
+
+	// Burst is the maximum burst of the requests sent to the cluster,
+	// defaults to the --remote-kube-api-burst flag of the controller.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
 }
 
 // GetRetryInterval returns the retry interval
@@ -185,12 +1062,62 @@ func (in CueInstance) GetRetryInterval() time.Duration {
 	return in.Spec.Interval.Duration
 }
 
-// GetDependsOn returns the list of dependencies across-namespaces.
+// FinalizationTimedOut reports whether the finalization timeout
+// of the deleted CueInstance has been exceeded at the given time.
+func (in CueInstance) FinalizationTimedOut(now time.Time) bool {
+	if in.Spec.FinalizationTimeout == nil || in.DeletionTimestamp.IsZero() {
+		return false
+	}
+	return now.Sub(in.DeletionTimestamp.Time) > in.Spec.FinalizationTimeout.Duration
+}
+
+// GetDependsOn returns the list of CueInstance dependencies across-namespaces,
+// the dependencies on remote clusters are left out.
 func (in CueInstance) GetDependsOn() (types.NamespacedName, []dependency.CrossNamespaceDependencyReference) {
+	deps := make([]dependency.CrossNamespaceDependencyReference, 0, len(in.Spec.DependsOn))
+	for _, d := range in.Spec.DependsOn {
+		if !d.IsCueInstance() || d.IsRemote() {
+			continue
+		}
+		deps = append(deps, d.CrossNamespaceDependencyReference)
+	}
 	return types.NamespacedName{
 		Namespace: in.Namespace,
 		Name:      in.Name,
-	}, in.Spec.DependsOn
+	}, deps
+}
+
+// RollbackRequested returns the revision of the history the CueInstance
+// is rolled back to, and whether the rollback annotation is set.
+func (in CueInstance) RollbackRequested() (string, bool) {
+	v, ok := in.GetAnnotations()[RollbackAnnotation]
+	return v, ok && v != ""
+}
+
+// PlanApproved reports whether the plan with the given ID has been
+// approved through the approval annotation.
+func (in CueInstance) PlanApproved(id string) bool {
+	return id != "" && in.GetAnnotations()[ApprovalAnnotation] == id
+}
+
+// GetFieldManager returns the server-side apply field manager of the objects
+// applied for the CueInstance, that is the given field manager of the
+// controller suffixed with the field manager of the spec, if any.
+func (in CueInstance) GetFieldManager(controller string) string {
+	if in.Spec.FieldManager == "" {
+		return controller
+	}
+	return controller + "/" + in.Spec.FieldManager
+}
+
+// ForceRequested returns the value of the force request annotation and
+// whether it has not been handled yet.
+func (in CueInstance) ForceRequested() (string, bool) {
+	v, ok := in.GetAnnotations()[ForceRequestAnnotation]
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, v != in.Status.LastHandledForceAt
 }
 
 // GetStatusConditions returns a pointer to the Status.Conditions slice.
@@ -198,20 +1125,41 @@ func (in *CueInstance) GetStatusConditions() *[]metav1.Condition {
 	return &in.Status.Conditions
 }
 
-// CueInstanceProgressing resets the conditions of the given CueInstance to a single
-// ReadyCondition with status ConditionUnknown.
+// CueInstanceProgressing marks the given CueInstance as Reconciling, with a
+// ReadyCondition of status ConditionUnknown, and clears its Stalled condition.
 func CueInstanceProgressing(k CueInstance, message string) CueInstance {
-	meta.SetResourceCondition(&k, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, message)
+	setCondition(&k, meta.ReconcilingCondition, metav1.ConditionTrue, meta.ProgressingReason, message)
+	setCondition(&k, meta.ReadyCondition, metav1.ConditionUnknown, meta.ProgressingReason, message)
+	apimeta.RemoveStatusCondition(&k.Status.Conditions, meta.StalledCondition)
 	return k
 }
 
 // SetCueInstanceReadiness sets the ReadyCondition, ObservedGeneration, and LastAttemptedRevision, on the CueInstance.
+// The Reconciling condition is removed, and a failure with a terminal reason marks the CueInstance as Stalled.
 func SetCueInstanceReadiness(k *CueInstance, status metav1.ConditionStatus, reason, message string, revision string) {
-	meta.SetResourceCondition(k, meta.ReadyCondition, status, reason, trimString(message, MaxConditionMessageLength))
+	message = trimString(message, MaxConditionMessageLength)
+	setCondition(k, meta.ReadyCondition, status, reason, message)
+	apimeta.RemoveStatusCondition(&k.Status.Conditions, meta.ReconcilingCondition)
+	if status == metav1.ConditionFalse && IsTerminalReason(reason) {
+		setCondition(k, meta.StalledCondition, metav1.ConditionTrue, reason, message)
+	} else {
+		apimeta.RemoveStatusCondition(&k.Status.Conditions, meta.StalledCondition)
+	}
 	k.Status.ObservedGeneration = k.Generation
 	k.Status.LastAttemptedRevision = revision
 }
 
+// setCondition sets the given condition for the current generation of the CueInstance.
+func setCondition(k *CueInstance, condition string, status metav1.ConditionStatus, reason, message string) {
+	apimeta.SetStatusCondition(k.GetStatusConditions(), metav1.Condition{
+		Type:               condition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: k.Generation,
+	})
+}
+
 // CueInstanceNotReady registers a failed apply attempt of the given CueInstance.
 func CueInstanceNotReady(k CueInstance, revision, reason, message string) CueInstance {
 	SetCueInstanceReadiness(&k, metav1.ConditionFalse, reason, trimString(message, MaxConditionMessageLength), revision)
@@ -259,9 +1207,241 @@ type CueInstanceStatus struct {
 	// +optional
 	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
 
+	// LastHandledForceAt holds the value of the most recent
+	// force request annotation, so a change can be detected.
+	// +optional
+	LastHandledForceAt string `json:"lastHandledForceAt,omitempty"`
+
+	// LastAppliedChecksum is the SHA256 digest of the object set rendered
+	// from the last successfully applied revision.
+	// +optional
+	LastAppliedChecksum string `json:"lastAppliedChecksum,omitempty"`
+
+	// LastPublished is the artifact the manifests of the last
+	// applied revision were pushed to.
+	// +optional
+	LastPublished *PublishedArtifact `json:"lastPublished,omitempty"`
+
+	// LastRendered is the commit of the manifests of the last
+	// revision rendered to Git.
+	// +optional
+	LastRendered *RenderedCommit `json:"lastRendered,omitempty"`
+
+	// OutputsChecksum is the SHA256 digest of the outputs last
+	// written to the spec.writeOutputsTo destination.
+	// +optional
+	OutputsChecksum string `json:"outputsChecksum,omitempty"`
+
+	// History lists the last applied revisions, most recent first.
+	// +optional
+	History []HistoryEntry `json:"history,omitempty"`
+
+	// RolledBackChecksum is the SHA256 digest of the object set
+	// rolled back after failing its health checks.
+	// +optional
+	RolledBackChecksum string `json:"rolledBackChecksum,omitempty"`
+
+	// ConsecutiveFailures is the number of consecutive reconciliations
+	// which failed with the same reason and message.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// LastGarbageCollection lists the objects removed by the most recent garbage collection.
+	// +optional
+	LastGarbageCollection *GarbageCollectionReport `json:"lastGarbageCollection,omitempty"`
+
+	// LastApplySummary counts the objects created, configured, left unchanged,
+	// skipped and pruned by the last reconciliation which applied objects.
+	// When fanning out to multiple clusters, the counts are summed up.
+	// +optional
+	LastApplySummary *ApplySummary `json:"lastApplySummary,omitempty"`
+
+	// LastPhaseDurations are the durations of the phases of the last reconciliation.
+	// +optional
+	LastPhaseDurations *PhaseDurations `json:"lastPhaseDurations,omitempty"`
+
+	// BuildErrors lists the CUE errors of the last failed build.
+	// +optional
+	BuildErrors []BuildError `json:"buildErrors,omitempty"`
+
+	// PendingChanges lists the changes the reconciliation would have made
+	// to the clusters when the controller runs in read-only mode.
+	// +optional
+	PendingChanges []PendingChange `json:"pendingChanges,omitempty"`
+
+	// Plan holds the changes awaiting approval when the applies are gated.
+	// +optional
+	Plan *Plan `json:"plan,omitempty"`
+
+	// Variants contains the build status of each of the variants
+	// rendered by spec.matrix.
+	// +optional
+	Variants []VariantStatus `json:"variants,omitempty"`
+
+	// Clusters contains the reconciliation status of each of the clusters
+	// targeted through KubeConfigs.
+	// +optional
+	Clusters []ClusterStatus `json:"clusters,omitempty"`
+
 	// Inventory contains the list of Kubernetes resource object references that have been successfully applied.
 	// +optional
 	Inventory *ResourceInventory `json:"inventory,omitempty"`
+
+	// InventoryHealth summarises the kstatus of the objects in the inventory
+	// as of the last reconciliation.
+	// +optional
+	InventoryHealth *InventoryHealth `json:"inventoryHealth,omitempty"`
+
+	// RetainedObjects lists the inventory objects with garbage collection
+	// disabled, which are left in place when they are removed from the
+	// source and when the CueInstance is deleted.
+	// +optional
+	RetainedObjects []ResourceRef `json:"retainedObjects,omitempty"`
+}
+
+// PhaseDurations are the durations of the phases of a reconciliation,
+// the phases which were not reached are omitted. When fanning out to
+// multiple clusters, the durations of the per-cluster phases are summed up.
+type PhaseDurations struct {
+	// Fetch is the time spent downloading and extracting the source artifact.
+	// +optional
+	Fetch *metav1.Duration `json:"fetch,omitempty"`
+
+	// Build is the time spent building the CUE instance, excluding validation.
+	// +optional
+	Build *metav1.Duration `json:"build,omitempty"`
+
+	// Validate is the time spent validating the build output against the schema.
+	// +optional
+	Validate *metav1.Duration `json:"validate,omitempty"`
+
+	// Apply is the time spent applying the objects, including the hooks.
+	// +optional
+	Apply *metav1.Duration `json:"apply,omitempty"`
+
+	// Prune is the time spent garbage collecting stale objects.
+	// +optional
+	Prune *metav1.Duration `json:"prune,omitempty"`
+
+	// Health is the time spent checking the health of the objects.
+	// +optional
+	Health *metav1.Duration `json:"health,omitempty"`
+}
+
+// BuildError is an error reported by CUE while building the instance.
+type BuildError struct {
+	// Message is the error message, without the path and position.
+	Message string `json:"message"`
+
+	// Path is the CUE path of the value the error refers to.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Position is the location of the error in the source,
+	// in the form 'file:line:column' relative to the module root.
+	// +optional
+	Position string `json:"position,omitempty"`
+}
+
+// PendingChange is a change to an object which was not made because
+// the controller runs in read-only mode or the plan awaits approval.
+type PendingChange struct {
+	// Subject is the object in the form 'Kind/namespace/name'.
+	Subject string `json:"subject"`
+
+	// Action is the change, one of 'created', 'configured' or 'deleted'.
+	Action string `json:"action"`
+
+	// Cluster is the name of the KubeConfig secret of the cluster,
+	// empty for the cluster of the controller.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// HistoryEntry is a revision applied by the CueInstance.
+type HistoryEntry struct {
+	// Revision is the source revision of the applied objects.
+	Revision string `json:"revision"`
+
+	// Checksum is the SHA256 digest of the applied object set.
+	Checksum string `json:"checksum"`
+
+	// AppliedAt is the time at which the revision was first applied.
+	AppliedAt metav1.Time `json:"appliedAt"`
+
+	// Snapshot is the name of the Secret holding the applied objects.
+	Snapshot string `json:"snapshot"`
+}
+
+// Plan is a set of changes awaiting approval.
+type Plan struct {
+	// ID identifies the plan, the approval annotation must be set to it.
+	ID string `json:"id"`
+
+	// Revision is the source revision of the planned changes.
+	Revision string `json:"revision"`
+
+	// Changes lists the changes made to the clusters once the plan is approved.
+	// +optional
+	Changes []PendingChange `json:"changes,omitempty"`
+
+	// ConfigMapRef references the ConfigMap holding the rendered objects
+	// and the diffs of the drifted objects of the plan.
+	// +optional
+	ConfigMapRef *meta.LocalObjectReference `json:"configMapRef,omitempty"`
+}
+
+// VariantStatus is the build status of one of the variants of a matrix build.
+type VariantStatus struct {
+	// Name identifies the variant by its tag values, e.g. 'region=eu-west-1'.
+	Name string `json:"name"`
+
+	// Ready reports whether the variant was built successfully.
+	Ready bool `json:"ready"`
+
+	// Objects is the number of objects rendered by the variant.
+	// +optional
+	Objects int `json:"objects,omitempty"`
+
+	// Message of the build failure of the variant.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterStatus is the reconciliation status of one of the targeted clusters.
+type ClusterStatus struct {
+	// Name is the name of the KubeConfig secret of the cluster.
+	Name string `json:"name"`
+
+	// Ready reports whether the last reconciliation succeeded on the cluster.
+	Ready bool `json:"ready"`
+
+	// Reason of the last reconciliation failure on the cluster.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message of the last reconciliation failure on the cluster.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastAppliedRevision is the last revision successfully applied to the cluster.
+	// +optional
+	LastAppliedRevision string `json:"lastAppliedRevision,omitempty"`
+
+	// LastAppliedChecksum is the digest of the object set
+	// last successfully applied to the cluster.
+	// +optional
+	LastAppliedChecksum string `json:"lastAppliedChecksum,omitempty"`
+}
+
+// GetClusterStatus returns the status of the given cluster, or nil if not found.
+func (in CueInstanceStatus) GetClusterStatus(name string) *ClusterStatus {
+	for i := range in.Clusters {
+		if in.Clusters[i].Name == name {
+			return &in.Clusters[i]
+		}
+	}
+	return nil
 }
 
 //+kubebuilder:object:root=true
@@ -1,5 +1,12 @@
 package v1alpha1
 
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 // ResourceInventory contains a list of Kubernetes resource object references that have been applied by a Kustomization.
 type ResourceInventory struct {
 	// Entries of Kubernetes resource object references.
@@ -14,4 +21,163 @@ type ResourceRef struct {
 
 	// Version is the API version of the Kubernetes resource object's kind.
 	Version string `json:"v"`
+
+	// Cluster is the name of the KubeConfig secret used to apply the Kubernetes
+	// resource object, empty for the cluster the controller runs in.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// Object returns the Kubernetes resource object referenced by the entry.
+func (r ResourceRef) Object() (InventoryObject, error) {
+	// the name may contain underscores transcoded from colons, e.g. for
+	// RBAC objects, so the fields are parsed from both ends
+	fields := strings.SplitN(r.ID, "_", 2)
+	if len(fields) != 2 {
+		return InventoryObject{}, fmt.Errorf("invalid inventory entry ID '%s'", r.ID)
+	}
+	namespace, rest := fields[0], fields[1]
+
+	i := strings.LastIndex(rest, "_")
+	if i == -1 {
+		return InventoryObject{}, fmt.Errorf("invalid inventory entry ID '%s'", r.ID)
+	}
+	kind, rest := rest[i+1:], rest[:i]
+
+	i = strings.LastIndex(rest, "_")
+	if i == -1 {
+		return InventoryObject{}, fmt.Errorf("invalid inventory entry ID '%s'", r.ID)
+	}
+	group, name := rest[i+1:], strings.ReplaceAll(rest[:i], "__", ":")
+	if name == "" || kind == "" || strings.Contains(name, "_") {
+		return InventoryObject{}, fmt.Errorf("invalid inventory entry ID '%s'", r.ID)
+	}
+
+	apiVersion := r.Version
+	if group != "" {
+		apiVersion = group + "/" + r.Version
+	}
+	return InventoryObject{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+		Cluster:    r.Cluster,
+	}, nil
+}
+
+// Objects returns the Kubernetes resource objects referenced by the inventory.
+func (inv *ResourceInventory) Objects() ([]InventoryObject, error) {
+	if inv == nil {
+		return nil, nil
+	}
+	objects := make([]InventoryObject, 0, len(inv.Entries))
+	for _, entry := range inv.Entries {
+		obj, err := entry.Object()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// InventoryObject identifies a Kubernetes resource object of the inventory.
+type InventoryObject struct {
+	// APIVersion of the object, e.g. 'apps/v1'.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object.
+	Kind string `json:"kind"`
+
+	// Namespace of the object, empty for cluster-scoped objects.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the object.
+	Name string `json:"name"`
+
+	// Cluster is the name of the KubeConfig secret used to apply the object,
+	// empty for the cluster the controller runs in.
+	// +optional
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// GarbageCollectionReport lists the Kubernetes resource objects removed by a garbage collection.
+type GarbageCollectionReport struct {
+	// Revision is the source revision at which the objects were pruned.
+	Revision string `json:"revision"`
+
+	// Time is the time at which the objects were pruned.
+	Time metav1.Time `json:"time"`
+
+	// Entries of the pruned Kubernetes resource object references.
+	Entries []ResourceRef `json:"entries"`
+}
+
+// ApplySummary counts the objects by the action taken on them by a reconciliation.
+type ApplySummary struct {
+	// Revision is the source revision applied by the reconciliation.
+	Revision string `json:"revision"`
+
+	// Created is the number of objects created.
+	Created int `json:"created"`
+
+	// Configured is the number of objects configured.
+	Configured int `json:"configured"`
+
+	// Unchanged is the number of objects left unchanged.
+	Unchanged int `json:"unchanged"`
+
+	// Skipped is the number of objects not applied, according to their apply mode.
+	Skipped int `json:"skipped"`
+
+	// Pruned is the number of objects removed by the garbage collection.
+	Pruned int `json:"pruned"`
+}
+
+// InventoryHealth summarises the kstatus of the Kubernetes resource objects in the inventory.
+type InventoryHealth struct {
+	// Total is the number of objects in the inventory.
+	Total int `json:"total"`
+
+	// Current is the number of objects whose status is Current.
+	Current int `json:"current"`
+
+	// Percentage of the objects whose status is Current.
+	Percentage int `json:"percentage"`
+
+	// Failing lists the objects whose status is not Current,
+	// truncated to the first 50 objects.
+	// +optional
+	Failing []ObjectHealth `json:"failing,omitempty"`
+
+	// Objects lists the objects of the inventory with their status,
+	// truncated to the first 1000 objects.
+	// +optional
+	Objects []ManagedObject `json:"objects,omitempty"`
+}
+
+// ObjectHealth is the kstatus of a Kubernetes resource object.
+type ObjectHealth struct {
+	ResourceRef `json:",inline"`
+
+	// Status is the kstatus of the object.
+	Status string `json:"status"`
+
+	// Message describing the status of the object.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ManagedObject is a Kubernetes resource object of the inventory with its kstatus.
+type ManagedObject struct {
+	InventoryObject `json:",inline"`
+
+	// Status is the kstatus of the object.
+	Status string `json:"status"`
+
+	// Message describing the status of the object.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
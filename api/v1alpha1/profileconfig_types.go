@@ -0,0 +1,79 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const ProfileConfigKind = "ProfileConfig"
+
+// ProfileConfigSpec defines the tag profiles which can be selected
+// by the CueInstances through spec.profile.
+type ProfileConfigSpec struct {
+	// Profiles is the list of named bundles of tags and tag variables.
+	// +optional
+	Profiles []Profile `json:"profiles,omitempty"`
+}
+
+// Profile is a named bundle of tags and tag variables.
+type Profile struct {
+	// Name of the profile.
+	// +required
+	Name string `json:"name"`
+
+	// Tags that will be injected into the CUE instances using the profile.
+	// +optional
+	Tags []TagVar `json:"tags,omitempty"`
+
+	// TagVars that will be available to the CUE instances using the profile.
+	// +optional
+	TagVars []TagVar `json:"tagVars,omitempty"`
+}
+
+// GetProfile returns the profile with the given name, or nil if not found.
+func (in ProfileConfig) GetProfile(name string) *Profile {
+	for i := range in.Spec.Profiles {
+		if in.Spec.Profiles[i].Name == name {
+			return &in.Spec.Profiles[i]
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:object:root=true
+
+// ProfileConfig is the Schema for the profileconfigs API
+type ProfileConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ProfileConfigSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ProfileConfigList contains a list of ProfileConfig
+type ProfileConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ProfileConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ProfileConfig{}, &ProfileConfigList{})
+}
@@ -1,18 +1,27 @@
 package v1alpha1
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/fluxcd/pkg/runtime/dependency"
+)
+
+// DirectorySourceKind is the kind of the sources read from a directory of
+// the controller filesystem, for development and air-gapped environments.
+const DirectorySourceKind = "Directory"
 
 type CrossNamespaceSourceReference struct {
 	// API version of the referent.
 	// +optional
 	APIVersion string `json:"apiVersion,omitempty"`
 
-	// Kind of the referent.
-	// +kubebuilder:validation:Enum=GitRepository;Bucket
+	// Kind of the referent, the Directory kind refers to a directory, relative
+	// to the local source root of the controller, when local sources are enabled.
+	// +kubebuilder:validation:Enum=GitRepository;Bucket;Directory
 	// +required
 	Kind string `json:"kind"`
 
-	// Name of the referent.
+	// Name of the referent, or path of the directory.
 	// +required
 	Name string `json:"name"`
 
@@ -27,3 +36,68 @@ func (s *CrossNamespaceSourceReference) String() string {
 	}
 	return fmt.Sprintf("%s/%s", s.Kind, s.Name)
 }
+
+// DependencyReference contains enough information to let you locate the
+// dependency of a CueInstance and decide whether it is ready.
+type DependencyReference struct {
+	dependency.CrossNamespaceDependencyReference `json:",inline"`
+
+	// API version of the referent, defaults to the CueInstance API version
+	// when the kind is omitted.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the referent, defaults to CueInstance. The objects of other
+	// kinds are read with the service account of the CueInstance, which must
+	// be allowed to get them, and must be in its namespace when
+	// cross-namespace references are blocked.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Check determines when a dependency which is not a CueInstance is
+	// considered ready, 'Exists' only requires the object to exist while
+	// 'Ready' requires the object to be reconciled according to kstatus.
+	// Defaults to 'Ready'.
+	// +kubebuilder:validation:Enum=Exists;Ready
+	// +optional
+	Check DependencyCheck `json:"check,omitempty"`
+
+	// ReadyExpr is a CEL expression evaluated against the status of the
+	// dependency, the dependency is considered ready when the expression
+	// returns true, e.g. 'status.lastAppliedRevision == "main/8d1b5a3"'.
+	// When omitted the Ready condition of the dependency is used. The
+	// dependency is read with the service account of the CueInstance, and
+	// must be in its namespace when cross-namespace references are blocked.
+	// +optional
+	ReadyExpr string `json:"readyExpr,omitempty"`
+
+	// KubeConfig references the remote cluster on which the dependency is
+	// looked up, e.g. a prerequisite of a spoke cluster managed from a hub.
+	// When omitted, the dependency is looked up on the cluster of the controller.
+	// +optional
+	KubeConfig *KubeConfig `json:"kubeConfig,omitempty"`
+}
+
+// DependencyCheck is the readiness check performed on a dependency.
+type DependencyCheck string
+
+const (
+	// DependencyExistsCheck requires the dependency to exist.
+	DependencyExistsCheck DependencyCheck = "Exists"
+	// DependencyReadyCheck requires the dependency to be ready.
+	DependencyReadyCheck DependencyCheck = "Ready"
+)
+
+// IsRemote reports whether the dependency is looked up on a remote cluster.
+func (in DependencyReference) IsRemote() bool {
+	return in.KubeConfig != nil && in.KubeConfig.SecretRef.Name != ""
+}
+
+// IsCueInstance reports whether the dependency refers to a CueInstance.
+func (in DependencyReference) IsCueInstance() bool {
+	if in.Kind == "" {
+		return true
+	}
+	return in.Kind == CueInstanceKind &&
+		(in.APIVersion == "" || in.APIVersion == GroupVersion.String())
+}
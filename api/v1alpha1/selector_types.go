@@ -0,0 +1,37 @@
+package v1alpha1
+
+// Selector specifies a set of Kubernetes resource objects, the empty
+// fields match any object.
+type Selector struct {
+	// Group is the API group to select objects from.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version of the API group to select objects from.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Kind of the API group to select objects from.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Namespace to select objects from.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name to match objects with.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// AnnotationSelector is a string that follows the label selection expression
+	// https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#api
+	// It matches with the object annotations.
+	// +optional
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
+
+	// LabelSelector is a string that follows the label selection expression
+	// https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#api
+	// It matches with the object labels.
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const ValidationReportKind = "ValidationReport"
+
+// ValidationResultType is the outcome of the validation of an object.
+type ValidationResultType string
+
+const (
+	// PassResult is the result of the objects passing all the validations.
+	PassResult ValidationResultType = "Pass"
+	// FailResult is the result of the validations failing the reconciliation.
+	FailResult ValidationResultType = "Fail"
+	// DropResult is the result of the validations dropping the object.
+	DropResult ValidationResultType = "Drop"
+	// WarnResult is the result of the failed validations in Warn mode.
+	WarnResult ValidationResultType = "Warn"
+	// AuditResult is the result of the failed validations in Audit mode.
+	AuditResult ValidationResultType = "Audit"
+)
+
+// ValidationReportSpec summarizes the validation of the objects of a
+// CueInstance for a source revision.
+type ValidationReportSpec struct {
+	// Revision is the source revision of the validated objects.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// Summary counts the results by type.
+	// +optional
+	Summary ValidationSummary `json:"summary"`
+
+	// Results of the validations, the objects passing all of them are listed
+	// with a Pass result.
+	// +optional
+	Results []ValidationResult `json:"results,omitempty"`
+}
+
+// ValidationSummary counts the validation results by type.
+type ValidationSummary struct {
+	Pass  int `json:"pass"`
+	Fail  int `json:"fail"`
+	Drop  int `json:"drop"`
+	Warn  int `json:"warn"`
+	Audit int `json:"audit"`
+}
+
+// ValidationResult is the result of a validation of an object,
+// or of a CUE expression or data file for the schema validation.
+type ValidationResult struct {
+	// Subject of the validation, in the format '<kind>/<namespace>/<name>'
+	// for the objects.
+	// +required
+	Subject string `json:"subject"`
+
+	// Source of the validation: 'schema', 'rego' or 'policy/<name>'.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Result of the validation.
+	// +required
+	Result ValidationResultType `json:"result"`
+
+	// Message describing the failed validation.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Revision",type="string",JSONPath=".spec.revision"
+//+kubebuilder:printcolumn:name="Pass",type="integer",JSONPath=".spec.summary.pass"
+//+kubebuilder:printcolumn:name="Fail",type="integer",JSONPath=".spec.summary.fail"
+//+kubebuilder:printcolumn:name="Drop",type="integer",JSONPath=".spec.summary.drop"
+//+kubebuilder:printcolumn:name="Warn",type="integer",JSONPath=".spec.summary.warn"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ValidationReport is the Schema for the validationreports API, it is written
+// by the controller for each CueInstance and shares its name.
+type ValidationReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ValidationReportSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ValidationReportList contains a list of ValidationReport
+type ValidationReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ValidationReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ValidationReport{}, &ValidationReportList{})
+}
@@ -22,11 +22,167 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"github.com/fluxcd/pkg/runtime/dependency"
+	"github.com/fluxcd/pkg/apis/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdoptionPolicy) DeepCopyInto(out *AdoptionPolicy) {
+	*out = *in
+	if in.FieldManagers != nil {
+		in, out := &in.FieldManagers, &out.FieldManagers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdoptionPolicy.
+func (in *AdoptionPolicy) DeepCopy() *AdoptionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AdoptionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApplySummary) DeepCopyInto(out *ApplySummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApplySummary.
+func (in *ApplySummary) DeepCopy() *ApplySummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ApplySummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalPolicy) DeepCopyInto(out *ApprovalPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalPolicy.
+func (in *ApprovalPolicy) DeepCopy() *ApprovalPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildError) DeepCopyInto(out *BuildError) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildError.
+func (in *BuildError) DeepCopy() *BuildError {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildError)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildOptions) DeepCopyInto(out *BuildOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildOptions.
+func (in *BuildOptions) DeepCopy() *BuildOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGroup) DeepCopyInto(out *ClusterGroup) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGroup.
+func (in *ClusterGroup) DeepCopy() *ClusterGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
+func (in *ClusterStatus) DeepCopy() *ClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConflictPolicy) DeepCopyInto(out *ConflictPolicy) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]ConflictRule, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConflictPolicy.
+func (in *ConflictPolicy) DeepCopy() *ConflictPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ConflictPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConflictRule) DeepCopyInto(out *ConflictRule) {
+	*out = *in
+	out.Target = in.Target
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConflictRule.
+func (in *ConflictRule) DeepCopy() *ConflictRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ConflictRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CrossNamespaceSourceReference) DeepCopyInto(out *CrossNamespaceSourceReference) {
 	*out = *in
@@ -106,24 +262,99 @@ func (in *CueInstanceSpec) DeepCopyInto(out *CueInstanceSpec) {
 	*out = *in
 	out.Interval = in.Interval
 	out.SourceRef = in.SourceRef
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Overlays != nil {
+		in, out := &in.Overlays, &out.Overlays
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DataFiles != nil {
+		in, out := &in.DataFiles, &out.DataFiles
+		*out = make([]DataFile, len(*in))
+		copy(*out, *in)
+	}
 	if in.Tags != nil {
 		in, out := &in.Tags, &out.Tags
 		*out = make([]TagVar, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.TagVars != nil {
 		in, out := &in.TagVars, &out.TagVars
 		*out = make([]TagVar, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Matrix != nil {
+		in, out := &in.Matrix, &out.Matrix
+		*out = make([]MatrixDimension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Exprs != nil {
 		in, out := &in.Exprs, &out.Exprs
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExprsFrom != nil {
+		in, out := &in.ExprsFrom, &out.ExprsFrom
+		*out = new(ExpressionsSource)
+		**out = **in
+	}
+	if in.WriteOutputsTo != nil {
+		in, out := &in.WriteOutputsTo, &out.WriteOutputsTo
+		*out = new(OutputsDestination)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Publish != nil {
+		in, out := &in.Publish, &out.Publish
+		*out = new(PublishOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RenderTo != nil {
+		in, out := &in.RenderTo, &out.RenderTo
+		*out = new(GitRenderOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Build != nil {
+		in, out := &in.Build, &out.Build
+		*out = new(BuildOptions)
+		**out = **in
+	}
+	if in.Extract != nil {
+		in, out := &in.Extract, &out.Extract
+		*out = new(ExtractOptions)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.DependsOn != nil {
 		in, out := &in.DependsOn, &out.DependsOn
-		*out = make([]dependency.CrossNamespaceDependencyReference, len(*in))
+		*out = make([]DependencyReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PruneOptions != nil {
+		in, out := &in.PruneOptions, &out.PruneOptions
+		*out = new(PruneOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 	if in.RetryInterval != nil {
@@ -131,21 +362,97 @@ func (in *CueInstanceSpec) DeepCopyInto(out *CueInstanceSpec) {
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.HealthChecks != nil {
+		in, out := &in.HealthChecks, &out.HealthChecks
+		*out = make([]meta.NamespacedObjectKindReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(Hooks)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProgressiveDelivery != nil {
+		in, out := &in.ProgressiveDelivery, &out.ProgressiveDelivery
+		*out = new(ProgressiveDelivery)
+		**out = **in
+	}
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.FinalizationTimeout != nil {
+		in, out := &in.FinalizationTimeout, &out.FinalizationTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ConflictPolicy != nil {
+		in, out := &in.ConflictPolicy, &out.ConflictPolicy
+		*out = new(ConflictPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdoptionPolicy != nil {
+		in, out := &in.AdoptionPolicy, &out.AdoptionPolicy
+		*out = new(AdoptionPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IgnorePaths != nil {
+		in, out := &in.IgnorePaths, &out.IgnorePaths
+		*out = make([]IgnoreRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.KubeConfig != nil {
 		in, out := &in.KubeConfig, &out.KubeConfig
 		*out = new(KubeConfig)
 		**out = **in
 	}
+	if in.KubeConfigs != nil {
+		in, out := &in.KubeConfigs, &out.KubeConfigs
+		*out = make([]KubeConfig, len(*in))
+		copy(*out, *in)
+	}
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterGroups != nil {
+		in, out := &in.ClusterGroups, &out.ClusterGroups
+		*out = make([]ClusterGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalPolicy)
+		**out = **in
+	}
+	if in.SensitivePaths != nil {
+		in, out := &in.SensitivePaths, &out.SensitivePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Validate != nil {
 		in, out := &in.Validate, &out.Validate
 		*out = new(Validation)
 		**out = **in
 	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]ObjectPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RegoPolicies != nil {
+		in, out := &in.RegoPolicies, &out.RegoPolicies
+		*out = new(RegoPolicies)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CueInstanceSpec.
@@ -169,11 +476,78 @@ func (in *CueInstanceStatus) DeepCopyInto(out *CueInstanceStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.LastPublished != nil {
+		in, out := &in.LastPublished, &out.LastPublished
+		*out = new(PublishedArtifact)
+		**out = **in
+	}
+	if in.LastRendered != nil {
+		in, out := &in.LastRendered, &out.LastRendered
+		*out = new(RenderedCommit)
+		**out = **in
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]HistoryEntry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastGarbageCollection != nil {
+		in, out := &in.LastGarbageCollection, &out.LastGarbageCollection
+		*out = new(GarbageCollectionReport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastApplySummary != nil {
+		in, out := &in.LastApplySummary, &out.LastApplySummary
+		*out = new(ApplySummary)
+		**out = **in
+	}
+	if in.LastPhaseDurations != nil {
+		in, out := &in.LastPhaseDurations, &out.LastPhaseDurations
+		*out = new(PhaseDurations)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BuildErrors != nil {
+		in, out := &in.BuildErrors, &out.BuildErrors
+		*out = make([]BuildError, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingChanges != nil {
+		in, out := &in.PendingChanges, &out.PendingChanges
+		*out = make([]PendingChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(Plan)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Variants != nil {
+		in, out := &in.Variants, &out.Variants
+		*out = make([]VariantStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterStatus, len(*in))
+		copy(*out, *in)
+	}
 	if in.Inventory != nil {
 		in, out := &in.Inventory, &out.Inventory
 		*out = new(ResourceInventory)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.InventoryHealth != nil {
+		in, out := &in.InventoryHealth, &out.InventoryHealth
+		*out = new(InventoryHealth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetainedObjects != nil {
+		in, out := &in.RetainedObjects, &out.RetainedObjects
+		*out = make([]ResourceRef, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CueInstanceStatus.
@@ -187,82 +561,950 @@ func (in *CueInstanceStatus) DeepCopy() *CueInstanceStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *KubeConfig) DeepCopyInto(out *KubeConfig) {
+func (in *DataFile) DeepCopyInto(out *DataFile) {
 	*out = *in
-	out.SecretRef = in.SecretRef
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeConfig.
-func (in *KubeConfig) DeepCopy() *KubeConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataFile.
+func (in *DataFile) DeepCopy() *DataFile {
 	if in == nil {
 		return nil
 	}
-	out := new(KubeConfig)
+	out := new(DataFile)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceInventory) DeepCopyInto(out *ResourceInventory) {
+func (in *DependencyReference) DeepCopyInto(out *DependencyReference) {
 	*out = *in
-	if in.Entries != nil {
-		in, out := &in.Entries, &out.Entries
-		*out = make([]ResourceRef, len(*in))
-		copy(*out, *in)
+	out.CrossNamespaceDependencyReference = in.CrossNamespaceDependencyReference
+	if in.KubeConfig != nil {
+		in, out := &in.KubeConfig, &out.KubeConfig
+		*out = new(KubeConfig)
+		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceInventory.
-func (in *ResourceInventory) DeepCopy() *ResourceInventory {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DependencyReference.
+func (in *DependencyReference) DeepCopy() *DependencyReference {
 	if in == nil {
 		return nil
 	}
-	out := new(ResourceInventory)
+	out := new(DependencyReference)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceRef) DeepCopyInto(out *ResourceRef) {
+func (in *ExpressionsSource) DeepCopyInto(out *ExpressionsSource) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRef.
-func (in *ResourceRef) DeepCopy() *ResourceRef {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExpressionsSource.
+func (in *ExpressionsSource) DeepCopy() *ExpressionsSource {
 	if in == nil {
 		return nil
 	}
-	out := new(ResourceRef)
+	out := new(ExpressionsSource)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TagVar) DeepCopyInto(out *TagVar) {
+func (in *ExtractOptions) DeepCopyInto(out *ExtractOptions) {
 	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxFiles != nil {
+		in, out := &in.MaxFiles, &out.MaxFiles
+		*out = new(int)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagVar.
-func (in *TagVar) DeepCopy() *TagVar {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtractOptions.
+func (in *ExtractOptions) DeepCopy() *ExtractOptions {
 	if in == nil {
 		return nil
 	}
-	out := new(TagVar)
+	out := new(ExtractOptions)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Validation) DeepCopyInto(out *Validation) {
+func (in *GarbageCollectionReport) DeepCopyInto(out *GarbageCollectionReport) {
 	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = make([]ResourceRef, len(*in))
+		copy(*out, *in)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Validation.
-func (in *Validation) DeepCopy() *Validation {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GarbageCollectionReport.
+func (in *GarbageCollectionReport) DeepCopy() *GarbageCollectionReport {
 	if in == nil {
 		return nil
 	}
-	out := new(Validation)
+	out := new(GarbageCollectionReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitRenderOptions) DeepCopyInto(out *GitRenderOptions) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitRenderOptions.
+func (in *GitRenderOptions) DeepCopy() *GitRenderOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(GitRenderOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HistoryEntry) DeepCopyInto(out *HistoryEntry) {
+	*out = *in
+	in.AppliedAt.DeepCopyInto(&out.AppliedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HistoryEntry.
+func (in *HistoryEntry) DeepCopy() *HistoryEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(HistoryEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Hook) DeepCopyInto(out *Hook) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Hook.
+func (in *Hook) DeepCopy() *Hook {
+	if in == nil {
+		return nil
+	}
+	out := new(Hook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Hooks) DeepCopyInto(out *Hooks) {
+	*out = *in
+	if in.PreApply != nil {
+		in, out := &in.PreApply, &out.PreApply
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PostApply != nil {
+		in, out := &in.PostApply, &out.PostApply
+		*out = make([]Hook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Hooks.
+func (in *Hooks) DeepCopy() *Hooks {
+	if in == nil {
+		return nil
+	}
+	out := new(Hooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IgnoreRule) DeepCopyInto(out *IgnoreRule) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(Selector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IgnoreRule.
+func (in *IgnoreRule) DeepCopy() *IgnoreRule {
+	if in == nil {
+		return nil
+	}
+	out := new(IgnoreRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePolicyReference) DeepCopyInto(out *ImagePolicyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePolicyReference.
+func (in *ImagePolicyReference) DeepCopy() *ImagePolicyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePolicyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryHealth) DeepCopyInto(out *InventoryHealth) {
+	*out = *in
+	if in.Failing != nil {
+		in, out := &in.Failing, &out.Failing
+		*out = make([]ObjectHealth, len(*in))
+		copy(*out, *in)
+	}
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]ManagedObject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryHealth.
+func (in *InventoryHealth) DeepCopy() *InventoryHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryObject) DeepCopyInto(out *InventoryObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryObject.
+func (in *InventoryObject) DeepCopy() *InventoryObject {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeConfig) DeepCopyInto(out *KubeConfig) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeConfig.
+func (in *KubeConfig) DeepCopy() *KubeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedObject) DeepCopyInto(out *ManagedObject) {
+	*out = *in
+	out.InventoryObject = in.InventoryObject
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedObject.
+func (in *ManagedObject) DeepCopy() *ManagedObject {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MatrixDimension) DeepCopyInto(out *MatrixDimension) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MatrixDimension.
+func (in *MatrixDimension) DeepCopy() *MatrixDimension {
+	if in == nil {
+		return nil
+	}
+	out := new(MatrixDimension)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectHealth) DeepCopyInto(out *ObjectHealth) {
+	*out = *in
+	out.ResourceRef = in.ResourceRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectHealth.
+func (in *ObjectHealth) DeepCopy() *ObjectHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObjectPolicy) DeepCopyInto(out *ObjectPolicy) {
+	*out = *in
+	if in.RuleFrom != nil {
+		in, out := &in.RuleFrom, &out.RuleFrom
+		*out = new(ExpressionsSource)
+		**out = **in
+	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(Selector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObjectPolicy.
+func (in *ObjectPolicy) DeepCopy() *ObjectPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ObjectPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Output) DeepCopyInto(out *Output) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
+func (in *Output) DeepCopy() *Output {
+	if in == nil {
+		return nil
+	}
+	out := new(Output)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputsDestination) DeepCopyInto(out *OutputsDestination) {
+	*out = *in
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]Output, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputsDestination.
+func (in *OutputsDestination) DeepCopy() *OutputsDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputsDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PendingChange) DeepCopyInto(out *PendingChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PendingChange.
+func (in *PendingChange) DeepCopy() *PendingChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PendingChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhaseDurations) DeepCopyInto(out *PhaseDurations) {
+	*out = *in
+	if in.Fetch != nil {
+		in, out := &in.Fetch, &out.Fetch
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Build != nil {
+		in, out := &in.Build, &out.Build
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Validate != nil {
+		in, out := &in.Validate, &out.Validate
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Apply != nil {
+		in, out := &in.Apply, &out.Apply
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Prune != nil {
+		in, out := &in.Prune, &out.Prune
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhaseDurations.
+func (in *PhaseDurations) DeepCopy() *PhaseDurations {
+	if in == nil {
+		return nil
+	}
+	out := new(PhaseDurations)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Plan) DeepCopyInto(out *Plan) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]PendingChange, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Plan.
+func (in *Plan) DeepCopy() *Plan {
+	if in == nil {
+		return nil
+	}
+	out := new(Plan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Profile) DeepCopyInto(out *Profile) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]TagVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TagVars != nil {
+		in, out := &in.TagVars, &out.TagVars
+		*out = make([]TagVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Profile.
+func (in *Profile) DeepCopy() *Profile {
+	if in == nil {
+		return nil
+	}
+	out := new(Profile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileConfig) DeepCopyInto(out *ProfileConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileConfig.
+func (in *ProfileConfig) DeepCopy() *ProfileConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ProfileConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileConfigList) DeepCopyInto(out *ProfileConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ProfileConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileConfigList.
+func (in *ProfileConfigList) DeepCopy() *ProfileConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ProfileConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProfileConfigSpec) DeepCopyInto(out *ProfileConfigSpec) {
+	*out = *in
+	if in.Profiles != nil {
+		in, out := &in.Profiles, &out.Profiles
+		*out = make([]Profile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProfileConfigSpec.
+func (in *ProfileConfigSpec) DeepCopy() *ProfileConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProfileConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgressiveDelivery) DeepCopyInto(out *ProgressiveDelivery) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgressiveDelivery.
+func (in *ProgressiveDelivery) DeepCopy() *ProgressiveDelivery {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgressiveDelivery)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PruneOptions) DeepCopyInto(out *PruneOptions) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PruneOptions.
+func (in *PruneOptions) DeepCopy() *PruneOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PruneOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublishOptions) DeepCopyInto(out *PublishOptions) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublishOptions.
+func (in *PublishOptions) DeepCopy() *PublishOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PublishOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublishedArtifact) DeepCopyInto(out *PublishedArtifact) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublishedArtifact.
+func (in *PublishedArtifact) DeepCopy() *PublishedArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(PublishedArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegoPolicies) DeepCopyInto(out *RegoPolicies) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegoPolicies.
+func (in *RegoPolicies) DeepCopy() *RegoPolicies {
+	if in == nil {
+		return nil
+	}
+	out := new(RegoPolicies)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenderedCommit) DeepCopyInto(out *RenderedCommit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenderedCommit.
+func (in *RenderedCommit) DeepCopy() *RenderedCommit {
+	if in == nil {
+		return nil
+	}
+	out := new(RenderedCommit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceInventory) DeepCopyInto(out *ResourceInventory) {
+	*out = *in
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = make([]ResourceRef, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceInventory.
+func (in *ResourceInventory) DeepCopy() *ResourceInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceRef) DeepCopyInto(out *ResourceRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRef.
+func (in *ResourceRef) DeepCopy() *ResourceRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Selector) DeepCopyInto(out *Selector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Selector.
+func (in *Selector) DeepCopy() *Selector {
+	if in == nil {
+		return nil
+	}
+	out := new(Selector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagVar) DeepCopyInto(out *TagVar) {
+	*out = *in
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(TagVarSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagVar.
+func (in *TagVar) DeepCopy() *TagVar {
+	if in == nil {
+		return nil
+	}
+	out := new(TagVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagVarSource) DeepCopyInto(out *TagVarSource) {
+	*out = *in
+	if in.ImagePolicyRef != nil {
+		in, out := &in.ImagePolicyRef, &out.ImagePolicyRef
+		*out = new(ImagePolicyReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagVarSource.
+func (in *TagVarSource) DeepCopy() *TagVarSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TagVarSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Validation) DeepCopyInto(out *Validation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Validation.
+func (in *Validation) DeepCopy() *Validation {
+	if in == nil {
+		return nil
+	}
+	out := new(Validation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationReport) DeepCopyInto(out *ValidationReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationReport.
+func (in *ValidationReport) DeepCopy() *ValidationReport {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ValidationReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationReportList) DeepCopyInto(out *ValidationReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ValidationReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationReportList.
+func (in *ValidationReportList) DeepCopy() *ValidationReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ValidationReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationReportSpec) DeepCopyInto(out *ValidationReportSpec) {
+	*out = *in
+	out.Summary = in.Summary
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ValidationResult, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationReportSpec.
+func (in *ValidationReportSpec) DeepCopy() *ValidationReportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationReportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationResult) DeepCopyInto(out *ValidationResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationResult.
+func (in *ValidationResult) DeepCopy() *ValidationResult {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValidationSummary) DeepCopyInto(out *ValidationSummary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValidationSummary.
+func (in *ValidationSummary) DeepCopy() *ValidationSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(ValidationSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesKey) DeepCopyInto(out *ValuesKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesKey.
+func (in *ValuesKey) DeepCopy() *ValuesKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesReference) DeepCopyInto(out *ValuesReference) {
+	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]ValuesKey, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesReference.
+func (in *ValuesReference) DeepCopy() *ValuesReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VariantStatus) DeepCopyInto(out *VariantStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VariantStatus.
+func (in *VariantStatus) DeepCopy() *VariantStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VariantStatus)
 	in.DeepCopyInto(out)
 	return out
 }
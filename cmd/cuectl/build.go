@@ -0,0 +1,243 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"github.com/phoban01/cue-flux-controller/controllers"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build a CueInstance from a local source",
+	Long: `The build command renders a CueInstance against a local copy of its source
+and prints the manifests the controller would apply.`,
+	Example: `  # Print the objects of a CueInstance using a local checkout of its GitRepository
+  cuectl build --file ./cueinstance.yaml --path ./repo
+
+  # Provide the values of the tags sourced from ConfigMaps and Secrets
+  cuectl build --file ./cueinstance.yaml --path ./repo --tag env=staging`,
+	RunE: buildCmdRun,
+}
+
+// sourceFlags are the flags used to render a CueInstance locally.
+type sourceFlags struct {
+	file            string
+	path            string
+	revision        string
+	tags            []string
+	expressionsFile string
+	profileFile     string
+}
+
+func (f *sourceFlags) bind(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.file, "file", "f", "", "path to the CueInstance YAML")
+	cmd.Flags().StringVar(&f.path, "path", ".", "path to the local copy of the CueInstance source")
+	cmd.Flags().StringVar(&f.revision, "revision", "", "source revision used to annotate the rendered objects")
+	cmd.Flags().StringArrayVar(&f.tags, "tag", nil, "value of a tag or tag variable in the form 'name=value', can be repeated")
+	cmd.Flags().StringVar(&f.expressionsFile, "expressions-file", "",
+		"path to a file holding the expressions referenced by spec.expressionsFrom")
+	cmd.Flags().StringVar(&f.profileFile, "profile-file", "",
+		"path to the ProfileConfig YAML defining the profile referenced by spec.profile")
+}
+
+var buildArgs sourceFlags
+
+func init() {
+	buildArgs.bind(buildCmd)
+	rootCmd.AddCommand(buildCmd)
+}
+
+func buildCmdRun(cmd *cobra.Command, args []string) error {
+	_, objects, err := buildArgs.render()
+	if err != nil {
+		return err
+	}
+
+	out, err := ssa.ObjectsToYAML(objects)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(cmd.OutOrStdout(), out)
+	return err
+}
+
+// render loads the CueInstance and returns the objects built from the local source.
+func (f *sourceFlags) render() (*cuev1alpha1.CueInstance, []*unstructured.Unstructured, error) {
+	if f.file == "" {
+		return nil, nil, fmt.Errorf("--file is required")
+	}
+
+	cueInstance, err := loadCueInstance(f.file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := f.resolveSpec(&cueInstance.Spec); err != nil {
+		return nil, nil, err
+	}
+
+	path, err := filepath.Abs(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := securejoin.SecureJoin(path, cueInstance.Spec.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(root); err != nil {
+		return nil, nil, fmt.Errorf("cueInstance module root path not found: %w", err)
+	}
+
+	dir, err := securejoin.SecureJoin(root, cueInstance.Spec.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, nil, fmt.Errorf("cueInstance path not found: %w", err)
+	}
+
+	req := controllers.BuildRequest{
+		Root: root,
+		Dir:  dir,
+		Spec: cueInstance.Spec,
+	}
+
+	if v := cueInstance.Spec.Validate; v != nil && controllers.IsRemoteSchema(v.Schema) {
+		req.Schema, err = controllers.FetchSchema(context.Background(), nil, v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	objects, err := controllers.RenderInstance(req, *cueInstance, f.revision)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build failed: %w", err)
+	}
+
+	return cueInstance, objects, nil
+}
+
+// resolveSpec fills in the values the controller would read from the cluster.
+func (f *sourceFlags) resolveSpec(spec *cuev1alpha1.CueInstanceSpec) error {
+	if spec.Profile != "" {
+		if f.profileFile == "" {
+			return fmt.Errorf("tags are sourced from profile '%s', set its ProfileConfig with --profile-file", spec.Profile)
+		}
+		config, err := loadProfileConfig(f.profileFile)
+		if err != nil {
+			return err
+		}
+		profile := config.GetProfile(spec.Profile)
+		if profile == nil {
+			return fmt.Errorf("profile '%s' not found in ProfileConfig '%s'", spec.Profile, config.GetName())
+		}
+		controllers.MergeProfile(spec, *profile)
+	}
+
+	values := make(map[string]string, len(f.tags))
+	for _, t := range f.tags {
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid tag '%s', expected 'name=value'", t)
+		}
+		values[parts[0]] = parts[1]
+	}
+
+	for _, tags := range [][]cuev1alpha1.TagVar{spec.Tags, spec.TagVars} {
+		for i, t := range tags {
+			if value, ok := values[t.Name]; ok {
+				tags[i].Value = value
+				continue
+			}
+			if t.ValueFrom != nil && !t.ValueFrom.Optional {
+				kind, name := t.ValueFrom.Kind, t.ValueFrom.Name
+				if t.ValueFrom.ImagePolicyRef != nil {
+					kind, name = "ImagePolicy", t.ValueFrom.ImagePolicyRef.Name
+				}
+				return fmt.Errorf("tag '%s' is sourced from %s '%s', set its value with --tag",
+					t.Name, kind, name)
+			}
+		}
+	}
+
+	if spec.ExprsFrom != nil {
+		if f.expressionsFile == "" {
+			return fmt.Errorf("expressions are sourced from ConfigMap '%s', set them with --expressions-file", spec.ExprsFrom.Name)
+		}
+		data, err := os.ReadFile(f.expressionsFile)
+		if err != nil {
+			return err
+		}
+		spec.Exprs = append(spec.Exprs, controllers.ParseExpressions(string(data))...)
+		spec.ExprsFrom = nil
+	}
+
+	return nil
+}
+
+// loadCueInstance reads a CueInstance from a YAML file.
+func loadCueInstance(file string) (*cuev1alpha1.CueInstance, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var cueInstance cuev1alpha1.CueInstance
+	if err := yaml.Unmarshal(data, &cueInstance); err != nil {
+		return nil, fmt.Errorf("unable to decode CueInstance: %w", err)
+	}
+
+	if cueInstance.Kind != cuev1alpha1.CueInstanceKind {
+		return nil, fmt.Errorf("expected kind %s, got '%s'", cuev1alpha1.CueInstanceKind, cueInstance.Kind)
+	}
+
+	return &cueInstance, nil
+}
+
+// loadProfileConfig reads a ProfileConfig from a YAML file.
+func loadProfileConfig(file string) (*cuev1alpha1.ProfileConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config cuev1alpha1.ProfileConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode ProfileConfig: %w", err)
+	}
+
+	if config.Kind != cuev1alpha1.ProfileConfigKind {
+		return nil, fmt.Errorf("expected kind %s, got '%s'", cuev1alpha1.ProfileConfigKind, config.Kind)
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testCueInstance = `apiVersion: cue.contrib.flux.io/v1alpha1
+kind: CueInstance
+metadata:
+  name: podinfo
+  namespace: flux-system
+spec:
+  interval: 5m
+  prune: true
+  createNamespace: true
+  expressions:
+  - out
+  tags:
+  - name: name
+    value: podinfo
+  - name: namespace
+    valueFrom:
+      kind: ConfigMap
+      name: settings
+      key: namespace
+  sourceRef:
+    kind: GitRepository
+    name: app
+`
+
+func TestBuildCmd(t *testing.T) {
+	g := NewWithT(t)
+
+	file := filepath.Join(t.TempDir(), "cueinstance.yaml")
+	g.Expect(os.WriteFile(file, []byte(testCueInstance), 0o644)).To(Succeed())
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		buildArgs = sourceFlags{}
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs(append([]string{"build", "--file", file, "--path", "../../controllers/testdata/app"}, args...))
+		err := rootCmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run()
+	g.Expect(err).To(MatchError(ContainSubstring("set its value with --tag")))
+
+	out, err := run("--tag", "namespace=apps")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(out).To(ContainSubstring("kind: Namespace"))
+	g.Expect(out).To(ContainSubstring("kind: Deployment"))
+	g.Expect(out).To(ContainSubstring("namespace: apps"))
+	g.Expect(out).To(ContainSubstring("cue.contrib.flux.io/name: podinfo"))
+}
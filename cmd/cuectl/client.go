@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// controllerName is the default field manager used by the controller for server-side apply.
+const controllerName = "cue-controller"
+
+type kubeFlags struct {
+	kubeconfig string
+	context    string
+	timeout    time.Duration
+}
+
+var kubeArgs kubeFlags
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&kubeArgs.kubeconfig, "kubeconfig", "",
+		"path to the kubeconfig file, defaults to the KUBECONFIG environment variable or ~/.kube/config")
+	rootCmd.PersistentFlags().StringVar(&kubeArgs.context, "context", "", "kubernetes context to use")
+	rootCmd.PersistentFlags().DurationVar(&kubeArgs.timeout, "timeout", time.Minute, "timeout for operations against the cluster")
+}
+
+// clientConfig returns the kubeconfig selected by the kube flags.
+func clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeArgs.kubeconfig
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: kubeArgs.context,
+	})
+}
+
+// currentNamespace returns the namespace of the selected context, 'default' when unset.
+func currentNamespace() string {
+	namespace, _, err := clientConfig().Namespace()
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// newKubeClient returns a client for the cluster selected by the kube flags.
+func newKubeClient() (client.Client, error) {
+	cfg, err := clientConfig().ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := sourcev1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := cuev1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
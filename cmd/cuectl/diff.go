@@ -0,0 +1,133 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"github.com/phoban01/cue-flux-controller/controllers"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Diff a locally built CueInstance against the cluster",
+	Long: `The diff command renders a CueInstance against a local copy of its source,
+performs a server-side apply dry-run against the current cluster and prints
+the differences between the live and the rendered objects.`,
+	Example: `  # Preview the changes of a CueInstance before merging them
+  cuectl diff --file ./cueinstance.yaml --path ./repo`,
+	RunE: diffCmdRun,
+}
+
+var (
+	diffArgs         sourceFlags
+	diffFieldManager string
+)
+
+func init() {
+	diffArgs.bind(diffCmd)
+	diffCmd.Flags().StringVar(&diffFieldManager, "field-manager", controllerName,
+		"field manager of the controller, suffixed with the fieldManager of the CueInstance")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func diffCmdRun(cmd *cobra.Command, args []string) error {
+	cueInstance, objects, err := diffArgs.render()
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeArgs.timeout)
+	defer cancel()
+
+	resourceManager := ssa.NewResourceManager(kubeClient, nil, ssa.Owner{
+		Field: cueInstance.GetFieldManager(diffFieldManager),
+		Group: cuev1alpha1.GroupVersion.Group,
+	})
+
+	diffOpts := ssa.DefaultDiffOptions()
+	diffOpts.Exclusions = controllers.ApplyExclusions()
+
+	out := cmd.OutOrStdout()
+	changed := 0
+	for _, obj := range objects {
+		change, live, merged, err := resourceManager.Diff(ctx, obj, diffOpts)
+		if err != nil {
+			return err
+		}
+
+		// existing create-once objects are never updated by the controller
+		if controllers.IsCreateOnce(obj) && ssa.Action(change.Action) != ssa.CreatedAction {
+			continue
+		}
+
+		switch ssa.Action(change.Action) {
+		case ssa.CreatedAction:
+			changed++
+			fmt.Fprintf(out, "► %s created\n", change.Subject)
+		case ssa.ConfiguredAction:
+			changed++
+			fmt.Fprintf(out, "► %s drifted\n", change.Subject)
+			live = controllers.MaskSensitiveData(live, cueInstance.Spec.SensitivePaths)
+			merged = controllers.MaskSensitiveData(merged, cueInstance.Spec.SensitivePaths)
+			if err := writeDiff(out, change.Subject, live, merged); err != nil {
+				return err
+			}
+		}
+	}
+
+	if changed == 0 {
+		fmt.Fprintf(out, "no changes for %s/%s\n", cueInstance.GetNamespace(), cueInstance.GetName())
+	}
+
+	return nil
+}
+
+// writeDiff writes the unified diff between the YAML
+// representations of the live and the merged object.
+func writeDiff(w io.Writer, subject string, live, merged *unstructured.Unstructured) error {
+	from, err := yaml.Marshal(live.Object)
+	if err != nil {
+		return err
+	}
+	to, err := yaml.Marshal(merged.Object)
+	if err != nil {
+		return err
+	}
+
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from)),
+		B:        difflib.SplitLines(string(to)),
+		FromFile: subject + " (live)",
+		ToFile:   subject + " (merged)",
+		Context:  3,
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWriteDiff(t *testing.T) {
+	g := NewWithT(t)
+
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "default"},
+		"data":       map[string]interface{}{"env": "staging", "region": "eu-west-1"},
+	}}
+	merged := live.DeepCopy()
+	g.Expect(unstructured.SetNestedField(merged.Object, "production", "data", "env")).To(Succeed())
+
+	var out bytes.Buffer
+	g.Expect(writeDiff(&out, "ConfigMap/default/settings", live, merged)).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("--- ConfigMap/default/settings (live)"))
+	g.Expect(out.String()).To(ContainSubstring("-  env: staging"))
+	g.Expect(out.String()).To(ContainSubstring("+  env: production"))
+	g.Expect(out.String()).NotTo(ContainSubstring("-  region"))
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect [name]",
+	Short: "Show the state of a CueInstance",
+	Long: `The inspect command shows a CueInstance together with its source, the revisions
+it applied and attempted, the objects of its inventory with their live status,
+its recent events and the errors of its last reconciliation.`,
+	Example: `  # Inspect a CueInstance
+  cuectl inspect podinfo --namespace flux-system
+
+  # Inspect a CueInstance with the kubectl plugin
+  kubectl cueinstance inspect podinfo -n flux-system`,
+	Args: cobra.ExactArgs(1),
+	RunE: inspectCmdRun,
+}
+
+type inspectFlags struct {
+	namespace string
+	events    int
+}
+
+var inspectArgs inspectFlags
+
+func init() {
+	inspectCmd.Flags().StringVarP(&inspectArgs.namespace, "namespace", "n", "",
+		"namespace of the CueInstance, defaults to the namespace of the current context")
+	inspectCmd.Flags().IntVar(&inspectArgs.events, "events", 10, "maximum number of recent events shown")
+	rootCmd.AddCommand(inspectCmd)
+}
+
+// inspectedSource is implemented by the source kinds shown by the inspect command.
+type inspectedSource interface {
+	GetArtifact() *sourcev1.Artifact
+	GetStatusConditions() *[]metav1.Condition
+}
+
+// inspection is the state of a CueInstance shown by the inspect command.
+type inspection struct {
+	cueInstance *cuev1alpha1.CueInstance
+	source      inspectedSource
+	objects     []cuev1alpha1.ManagedObject
+	events      []corev1.Event
+}
+
+func inspectCmdRun(cmd *cobra.Command, args []string) error {
+	namespace := inspectArgs.namespace
+	if namespace == "" {
+		namespace = currentNamespace()
+	}
+
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeArgs.timeout)
+	defer cancel()
+
+	in, err := inspectCueInstance(ctx, kubeClient, types.NamespacedName{Namespace: namespace, Name: args[0]}, inspectArgs.events)
+	if err != nil {
+		return err
+	}
+	return printInspection(cmd.OutOrStdout(), in)
+}
+
+// inspectCueInstance collects the state of the CueInstance, its source,
+// the live status of its objects and its most recent events.
+func inspectCueInstance(ctx context.Context, kubeClient client.Client, key types.NamespacedName, maxEvents int) (*inspection, error) {
+	var cueInstance cuev1alpha1.CueInstance
+	if err := kubeClient.Get(ctx, key, &cueInstance); err != nil {
+		return nil, fmt.Errorf("unable to get CueInstance '%s': %w", key, err)
+	}
+	in := &inspection{cueInstance: &cueInstance}
+
+	switch cueInstance.Spec.SourceRef.Kind {
+	case sourcev1.GitRepositoryKind:
+		var source sourcev1.GitRepository
+		if err := kubeClient.Get(ctx, sourceKey(cueInstance), &source); err == nil {
+			in.source = &source
+		}
+	case sourcev1.BucketKind:
+		var source sourcev1.Bucket
+		if err := kubeClient.Get(ctx, sourceKey(cueInstance), &source); err == nil {
+			in.source = &source
+		}
+	}
+
+	objects, err := cueInstance.Status.Inventory.Objects()
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		in.objects = append(in.objects, liveStatus(ctx, kubeClient, obj, cueInstance.Status.InventoryHealth))
+	}
+
+	events, err := recentEvents(ctx, kubeClient, cueInstance, maxEvents)
+	if err != nil {
+		return nil, err
+	}
+	in.events = events
+
+	return in, nil
+}
+
+// liveStatus computes the kstatus of an object of the inventory. The objects
+// of remote clusters are reported with the status recorded by the controller.
+func liveStatus(ctx context.Context, kubeClient client.Client, obj cuev1alpha1.InventoryObject, recorded *cuev1alpha1.InventoryHealth) cuev1alpha1.ManagedObject {
+	result := cuev1alpha1.ManagedObject{InventoryObject: obj, Status: status.UnknownStatus.String()}
+
+	if obj.Cluster != "" {
+		if recorded != nil {
+			for _, o := range recorded.Objects {
+				if o.InventoryObject == obj {
+					return o
+				}
+			}
+		}
+		result.Message = "remote cluster, not reported by the controller"
+		return result
+	}
+
+	gv, err := schema.ParseGroupVersion(obj.APIVersion)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gv.WithKind(obj.Kind))
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, live); err != nil {
+		if apierrors.IsNotFound(err) {
+			result.Status = status.NotFoundStatus.String()
+		}
+		result.Message = err.Error()
+		return result
+	}
+
+	res, err := status.Compute(live)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Status = res.Status.String()
+	result.Message = res.Message
+	return result
+}
+
+// recentEvents returns the most recent events of the CueInstance, oldest first.
+func recentEvents(ctx context.Context, kubeClient client.Client, cueInstance cuev1alpha1.CueInstance, max int) ([]corev1.Event, error) {
+	var list corev1.EventList
+	if err := kubeClient.List(ctx, &list, client.InNamespace(cueInstance.GetNamespace())); err != nil {
+		return nil, fmt.Errorf("unable to list events: %w", err)
+	}
+
+	var events []corev1.Event
+	for _, e := range list.Items {
+		if e.InvolvedObject.Kind == cuev1alpha1.CueInstanceKind && e.InvolvedObject.Name == cueInstance.GetName() {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	if max >= 0 && len(events) > max {
+		events = events[len(events)-max:]
+	}
+	return events, nil
+}
+
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	default:
+		return e.CreationTimestamp.Time
+	}
+}
+
+func printInspection(w io.Writer, in *inspection) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	cueInstance := in.cueInstance
+
+	fmt.Fprintf(tw, "CueInstance:\t%s\n", cueInstance.GetName())
+	fmt.Fprintf(tw, "Namespace:\t%s\n", cueInstance.GetNamespace())
+	if cueInstance.Spec.Suspend {
+		fmt.Fprintf(tw, "Suspended:\ttrue\n")
+	}
+	fmt.Fprintf(tw, "Applied revision:\t%s\n", cueInstance.Status.LastAppliedRevision)
+	if attempted := cueInstance.Status.LastAttemptedRevision; attempted != cueInstance.Status.LastAppliedRevision {
+		fmt.Fprintf(tw, "Attempted revision:\t%s\n", attempted)
+	}
+	writeReadyStatus(tw, cueInstance.Status.Conditions)
+	fmt.Fprintln(tw, "---")
+
+	fmt.Fprintf(tw, "Source:\t%s/%s\n", cueInstance.Spec.SourceRef.Kind, cueInstance.Spec.SourceRef.Name)
+	fmt.Fprintf(tw, "Namespace:\t%s\n", sourceKey(*cueInstance).Namespace)
+	if in.source != nil {
+		if artifact := in.source.GetArtifact(); artifact != nil {
+			fmt.Fprintf(tw, "Revision:\t%s\n", artifact.Revision)
+		}
+		writeReadyStatus(tw, *in.source.GetStatusConditions())
+	} else if cueInstance.Spec.SourceRef.Kind != cuev1alpha1.DirectorySourceKind {
+		fmt.Fprintf(tw, "Status:\tnot found\n")
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if errs := cueInstance.Status.BuildErrors; len(errs) > 0 {
+		fmt.Fprintln(w, "\nBuild errors:")
+		for _, e := range errs {
+			switch {
+			case e.Position != "" && e.Path != "":
+				fmt.Fprintf(w, "  %s: %s: %s\n", e.Position, e.Path, e.Message)
+			case e.Position != "":
+				fmt.Fprintf(w, "  %s: %s\n", e.Position, e.Message)
+			default:
+				fmt.Fprintf(w, "  %s\n", e.Message)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nInventory (%d objects):\n", len(in.objects))
+	if len(in.objects) > 0 {
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  KIND\tNAMESPACE\tNAME\tCLUSTER\tSTATUS\tMESSAGE")
+		for _, o := range in.objects {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", o.Kind, o.Namespace, o.Name, o.Cluster, o.Status, o.Message)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "\nEvents:\n")
+	if len(in.events) == 0 {
+		fmt.Fprintln(w, "  <none>")
+		return nil
+	}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TIME\tTYPE\tREASON\tMESSAGE")
+	for _, e := range in.events {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", eventTime(e).UTC().Format("2006-01-02T15:04:05Z"), e.Type, e.Reason, e.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestInspectCueInstance(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(sourcev1.AddToScheme(scheme)).To(Succeed())
+
+	ref := func(gvk schema.GroupVersionKind, name, cluster string) cuev1alpha1.ResourceRef {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		u.SetName(name)
+		u.SetNamespace("apps")
+		return cuev1alpha1.ResourceRef{ID: object.UnstructuredToObjMetadata(u).String(), Version: "v1", Cluster: cluster}
+	}
+
+	remote := cuev1alpha1.ManagedObject{
+		InventoryObject: cuev1alpha1.InventoryObject{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "apps", Name: "backend", Cluster: "staging"},
+		Status:          "Current",
+		Message:         "Deployment is available. Replicas: 1",
+	}
+	cueInstance := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux-system"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			SourceRef: cuev1alpha1.CrossNamespaceSourceReference{Kind: sourcev1.GitRepositoryKind, Name: "podinfo"},
+		},
+		Status: cuev1alpha1.CueInstanceStatus{
+			LastAppliedRevision:   "main/8d1b5a3",
+			LastAttemptedRevision: "main/2a4f9c1",
+			BuildErrors: []cuev1alpha1.BuildError{
+				{Message: "conflicting values 1 and 2", Path: "deployment.spec.replicas", Position: "app.cue:12:3"},
+			},
+			Inventory: &cuev1alpha1.ResourceInventory{
+				Entries: []cuev1alpha1.ResourceRef{
+					ref(corev1.SchemeGroupVersion.WithKind("ConfigMap"), "frontend", ""),
+					ref(appsv1.SchemeGroupVersion.WithKind("Deployment"), "missing", ""),
+					ref(appsv1.SchemeGroupVersion.WithKind("Deployment"), "backend", "staging"),
+				},
+			},
+			InventoryHealth: &cuev1alpha1.InventoryHealth{Objects: []cuev1alpha1.ManagedObject{remote}},
+		},
+	}
+	source := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux-system"},
+		Status: sourcev1.GitRepositoryStatus{
+			Artifact: &sourcev1.Artifact{Revision: "main/2a4f9c1"},
+		},
+	}
+	frontend := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "apps"},
+	}
+
+	event := func(name, reason string, at time.Time, kind string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "flux-system"},
+			InvolvedObject: corev1.ObjectReference{Kind: kind, Name: "podinfo", Namespace: "flux-system"},
+			Reason:         reason,
+			Type:           corev1.EventTypeNormal,
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+	now := time.Now()
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		cueInstance, source, frontend,
+		event("first", "Progressing", now.Add(-3*time.Minute), cuev1alpha1.CueInstanceKind),
+		event("second", "ReconciliationSucceeded", now.Add(-time.Minute), cuev1alpha1.CueInstanceKind),
+		event("third", "BuildFailed", now.Add(-2*time.Minute), cuev1alpha1.CueInstanceKind),
+		event("other", "NewArtifact", now, sourcev1.GitRepositoryKind),
+	).Build()
+
+	in, err := inspectCueInstance(context.TODO(), kubeClient, types.NamespacedName{Namespace: "flux-system", Name: "podinfo"}, 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(in.source).NotTo(BeNil())
+
+	g.Expect(in.objects).To(HaveLen(3))
+	g.Expect(in.objects[0].Name).To(Equal("frontend"))
+	g.Expect(in.objects[0].Status).To(Equal("Current"))
+	g.Expect(in.objects[1].Name).To(Equal("missing"))
+	g.Expect(in.objects[1].Status).To(Equal("NotFound"))
+	g.Expect(in.objects[2]).To(Equal(remote))
+
+	g.Expect(in.events).To(HaveLen(2))
+	g.Expect(in.events[0].Reason).To(Equal("BuildFailed"))
+	g.Expect(in.events[1].Reason).To(Equal("ReconciliationSucceeded"))
+
+	var out bytes.Buffer
+	g.Expect(printInspection(&out, in)).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("Attempted revision: main/2a4f9c1"))
+	g.Expect(out.String()).To(ContainSubstring("Revision:  main/2a4f9c1"))
+	g.Expect(out.String()).To(ContainSubstring("app.cue:12:3: deployment.spec.replicas: conflicting values 1 and 2"))
+	g.Expect(out.String()).To(ContainSubstring("Inventory (3 objects):"))
+	g.Expect(out.String()).To(ContainSubstring("ReconciliationSucceeded"))
+	g.Expect(out.String()).NotTo(ContainSubstring("NewArtifact"))
+
+	_, err = inspectCueInstance(context.TODO(), kubeClient, types.NamespacedName{Namespace: "flux-system", Name: "unknown"}, 2)
+	g.Expect(err).To(MatchError(ContainSubstring("unable to get CueInstance")))
+}
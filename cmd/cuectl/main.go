@@ -0,0 +1,52 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The kustomization type decoded by the migrate command embeds the object
+// metadata, skip the package so that controller-gen doesn't generate a CRD
+// for it.
+// +kubebuilder:skip
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// pluginName is the name of the binary when installed as a kubectl plugin,
+// kubectl runs it for the "kubectl cueinstance" commands.
+const pluginName = "kubectl-cueinstance"
+
+var rootCmd = &cobra.Command{
+	Use:           "cuectl",
+	Short:         "Command line utility for working with CueInstances",
+	Long:          "The cuectl command renders and inspects CueInstances outside of the cluster.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+func main() {
+	if strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") == pluginName {
+		rootCmd.Use = pluginName
+	}
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
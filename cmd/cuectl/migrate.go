@@ -0,0 +1,261 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/dependency"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Convert a Flux Kustomization into a CueInstance",
+	Long: `The migrate command converts a Flux Kustomization into an equivalent CueInstance
+and generates a CUE package scaffold at the path of the Kustomization. The
+post-build substitutions become CUE tags declared in the generated package.`,
+	Example: `  # Convert a Kustomization and generate the CUE package in a local checkout
+  cuectl migrate --file ./clusters/prod/apps.yaml --path ./repo > ./clusters/prod/apps-cue.yaml`,
+	RunE: migrateCmdRun,
+}
+
+type migrateFlags struct {
+	file string
+	path string
+}
+
+var migrateArgs migrateFlags
+
+func init() {
+	migrateCmd.Flags().StringVarP(&migrateArgs.file, "file", "f", "", "path to the Kustomization YAML")
+	migrateCmd.Flags().StringVar(&migrateArgs.path, "path", ".", "path to the local copy of the Kustomization source")
+	rootCmd.AddCommand(migrateCmd)
+}
+
+// kustomization contains the fields of a Flux Kustomization that can be migrated.
+type kustomization struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Interval           metav1.Duration                                `json:"interval"`
+		RetryInterval      *metav1.Duration                               `json:"retryInterval,omitempty"`
+		Timeout            *metav1.Duration                               `json:"timeout,omitempty"`
+		Path               string                                         `json:"path,omitempty"`
+		Prune              bool                                           `json:"prune"`
+		Suspend            bool                                           `json:"suspend,omitempty"`
+		Force              bool                                           `json:"force,omitempty"`
+		Wait               bool                                           `json:"wait,omitempty"`
+		ServiceAccountName string                                         `json:"serviceAccountName,omitempty"`
+		TargetNamespace    string                                         `json:"targetNamespace,omitempty"`
+		SourceRef          cuev1alpha1.CrossNamespaceSourceReference      `json:"sourceRef"`
+		DependsOn          []dependency.CrossNamespaceDependencyReference `json:"dependsOn,omitempty"`
+		HealthChecks       []meta.NamespacedObjectKindReference           `json:"healthChecks,omitempty"`
+		KubeConfig         *cuev1alpha1.KubeConfig                        `json:"kubeConfig,omitempty"`
+		PostBuild          *struct {
+			Substitute     map[string]string `json:"substitute,omitempty"`
+			SubstituteFrom []struct {
+				Kind     string `json:"kind"`
+				Name     string `json:"name"`
+				Optional bool   `json:"optional,omitempty"`
+			} `json:"substituteFrom,omitempty"`
+		} `json:"postBuild,omitempty"`
+	} `json:"spec"`
+}
+
+func migrateCmdRun(cmd *cobra.Command, args []string) error {
+	if migrateArgs.file == "" {
+		return fmt.Errorf("--file is required")
+	}
+
+	data, err := os.ReadFile(migrateArgs.file)
+	if err != nil {
+		return err
+	}
+
+	var ks kustomization
+	if err := yaml.Unmarshal(data, &ks); err != nil {
+		return fmt.Errorf("unable to decode Kustomization: %w", err)
+	}
+	if ks.Kind != "Kustomization" || !strings.HasPrefix(ks.APIVersion, "kustomize.toolkit.fluxcd.io/") {
+		return fmt.Errorf("expected a Flux Kustomization, got %s '%s'", ks.APIVersion, ks.Kind)
+	}
+
+	cueInstance, pkg, warnings := migrateKustomization(ks)
+
+	dir, err := securejoin.SecureJoin(migrateArgs.path, ks.Spec.Path)
+	if err != nil {
+		return err
+	}
+	if err := writePackage(dir, cueInstance.Spec.Package, pkg); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "kustomization.yaml")); err == nil {
+		warnings = append(warnings, fmt.Sprintf("%s contains a kustomization.yaml, remove it as the YAML files are applied as they are",
+			dir))
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cueInstance)
+	if err != nil {
+		return err
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj, "status")
+
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(cmd.OutOrStdout(), "---\n"+string(out))
+
+	for _, w := range warnings {
+		fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", w)
+	}
+	return nil
+}
+
+// migrateKustomization returns the CueInstance equivalent to the Kustomization,
+// the CUE package declaring its tags and the settings which could not be migrated.
+func migrateKustomization(ks kustomization) (*cuev1alpha1.CueInstance, []byte, []string) {
+	var warnings []string
+
+	cueInstance := &cuev1alpha1.CueInstance{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: cuev1alpha1.GroupVersion.String(),
+			Kind:       cuev1alpha1.CueInstanceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ks.GetName(),
+			Namespace: ks.GetNamespace(),
+		},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Interval:           ks.Spec.Interval,
+			RetryInterval:      ks.Spec.RetryInterval,
+			Timeout:            ks.Spec.Timeout,
+			SourceRef:          ks.Spec.SourceRef,
+			Root:               ks.Spec.Path,
+			Package:            packageName(ks.GetName()),
+			Exprs:              []string{"out"},
+			Prune:              ks.Spec.Prune,
+			Suspend:            ks.Spec.Suspend,
+			Force:              ks.Spec.Force,
+			Wait:               ks.Spec.Wait,
+			ServiceAccountName: ks.Spec.ServiceAccountName,
+			HealthChecks:       ks.Spec.HealthChecks,
+			KubeConfig:         ks.Spec.KubeConfig,
+		},
+	}
+
+	for _, d := range ks.Spec.DependsOn {
+		cueInstance.Spec.DependsOn = append(cueInstance.Spec.DependsOn, cuev1alpha1.DependencyReference{
+			CrossNamespaceDependencyReference: d,
+			APIVersion:                        ks.APIVersion,
+			Kind:                              "Kustomization",
+			Check:                             cuev1alpha1.DependencyReadyCheck,
+		})
+	}
+
+	if ks.Spec.TargetNamespace != "" {
+		warnings = append(warnings, fmt.Sprintf("targetNamespace '%s' is not supported, set the namespace in the CUE package",
+			ks.Spec.TargetNamespace))
+	}
+
+	var vars []string
+	if pb := ks.Spec.PostBuild; pb != nil {
+		for name := range pb.Substitute {
+			vars = append(vars, name)
+		}
+		sort.Strings(vars)
+		for _, name := range vars {
+			cueInstance.Spec.Tags = append(cueInstance.Spec.Tags, cuev1alpha1.TagVar{
+				Name:  name,
+				Value: pb.Substitute[name],
+			})
+		}
+		for _, ref := range pb.SubstituteFrom {
+			warnings = append(warnings, fmt.Sprintf("substitutions from %s '%s' must be declared as tags with valueFrom",
+				ref.Kind, ref.Name))
+		}
+	}
+
+	var pkg bytes.Buffer
+	fmt.Fprintf(&pkg, "package %s\n\n", cueInstance.Spec.Package)
+	fmt.Fprintf(&pkg, "// Generated from the Kustomization %s/%s.\n", ks.GetNamespace(), ks.GetName())
+	fmt.Fprint(&pkg, "// The YAML files of this directory are applied as they are, move their\n")
+	fmt.Fprint(&pkg, "// objects into out to render them from CUE.\n\n")
+	if len(vars) > 0 {
+		fmt.Fprint(&pkg, "vars: {\n")
+		for _, name := range vars {
+			fmt.Fprintf(&pkg, "\t%s: string @tag(%s)\n", name, name)
+		}
+		fmt.Fprint(&pkg, "}\n\n")
+	}
+	fmt.Fprint(&pkg, "out: [...]\n")
+
+	return cueInstance, pkg.Bytes(), warnings
+}
+
+var invalidPackageChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// packageName returns a valid CUE package name for the given object name.
+func packageName(name string) string {
+	pkg := invalidPackageChars.ReplaceAllString(name, "_")
+	if pkg == "" || (pkg[0] >= '0' && pkg[0] <= '9') {
+		pkg = "pkg_" + pkg
+	}
+	return pkg
+}
+
+// writePackage writes the generated CUE package to dir,
+// initialising a CUE module when dir does not contain one.
+func writePackage(dir, name string, pkg []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, name+".cue")
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("%s already exists", file)
+	}
+	if err := os.WriteFile(file, pkg, 0o644); err != nil {
+		return err
+	}
+
+	modDir := filepath.Join(dir, "cue.mod")
+	if _, err := os.Stat(modDir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(modDir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(modDir, "module.cue"), []byte(fmt.Sprintf("module: %q\n", name+".local")), 0o644)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const testKustomization = `apiVersion: kustomize.toolkit.fluxcd.io/v1beta2
+kind: Kustomization
+metadata:
+  name: apps
+  namespace: flux-system
+spec:
+  interval: 10m
+  path: ./deploy/apps
+  prune: true
+  targetNamespace: apps
+  sourceRef:
+    kind: GitRepository
+    name: fleet
+  dependsOn:
+  - name: infra
+  healthChecks:
+  - apiVersion: apps/v1
+    kind: Deployment
+    name: podinfo
+    namespace: apps
+  postBuild:
+    substitute:
+      cluster_name: prod
+    substituteFrom:
+    - kind: ConfigMap
+      name: cluster-vars
+`
+
+func TestMigrateCmd(t *testing.T) {
+	g := NewWithT(t)
+
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "kustomization.yaml")
+	g.Expect(os.WriteFile(file, []byte(testKustomization), 0o644)).To(Succeed())
+
+	var out, errOut bytes.Buffer
+	migrateArgs = migrateFlags{}
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&errOut)
+	rootCmd.SetArgs([]string{"migrate", "--file", file, "--path", tmpDir})
+	g.Expect(rootCmd.Execute()).To(Succeed())
+
+	g.Expect(out.String()).To(ContainSubstring("kind: CueInstance"))
+	g.Expect(out.String()).To(ContainSubstring("root: ./deploy/apps"))
+	g.Expect(out.String()).NotTo(ContainSubstring("status:"))
+	g.Expect(errOut.String()).To(ContainSubstring("targetNamespace 'apps' is not supported"))
+	g.Expect(errOut.String()).To(ContainSubstring("ConfigMap 'cluster-vars'"))
+
+	pkg, err := os.ReadFile(filepath.Join(tmpDir, "deploy", "apps", "apps.cue"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(pkg)).To(ContainSubstring("cluster_name: string @tag(cluster_name)"))
+	g.Expect(filepath.Join(tmpDir, "deploy", "apps", "cue.mod", "module.cue")).To(BeAnExistingFile())
+
+	t.Run("builds the generated package", func(t *testing.T) {
+		g := NewWithT(t)
+
+		instance := filepath.Join(tmpDir, "cueinstance.yaml")
+		g.Expect(os.WriteFile(instance, out.Bytes(), 0o644)).To(Succeed())
+
+		// the YAML files of the Kustomization are applied as they are
+		configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n"
+		g.Expect(os.WriteFile(filepath.Join(tmpDir, "deploy", "apps", "settings.yaml"), []byte(configMap), 0o644)).To(Succeed())
+
+		buildArgs = sourceFlags{file: instance, path: tmpDir}
+		_, objects, err := buildArgs.render()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetName()).To(Equal("settings"))
+	})
+
+	t.Run("refuses to overwrite the package", func(t *testing.T) {
+		g := NewWithT(t)
+		rootCmd.SetArgs([]string{"migrate", "--file", file, "--path", tmpDir})
+		g.Expect(rootCmd.Execute()).To(MatchError(ContainSubstring("already exists")))
+	})
+}
+
+func TestMigrateKustomization(t *testing.T) {
+	g := NewWithT(t)
+
+	var ks kustomization
+	ks.Name = "1-apps"
+	ks.APIVersion = "kustomize.toolkit.fluxcd.io/v1beta2"
+
+	cueInstance, _, warnings := migrateKustomization(ks)
+	g.Expect(cueInstance.Spec.Package).To(Equal("pkg_1_apps"))
+	g.Expect(cueInstance.Spec.Tags).To(BeEmpty())
+	g.Expect(warnings).To(BeEmpty())
+	g.Expect(cueInstance.Spec.DependsOn).To(BeEmpty())
+	g.Expect(cueInstance.Kind).To(Equal(cuev1alpha1.CueInstanceKind))
+}
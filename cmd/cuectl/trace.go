@@ -0,0 +1,195 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/ssa"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/spf13/cobra"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"github.com/phoban01/cue-flux-controller/controllers"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace [name]",
+	Short: "Trace an object to the CueInstance managing it",
+	Long: `The trace command shows the CueInstance which applied a cluster object,
+together with the revision it was applied at and the source it was built from.`,
+	Example: `  # Trace a Deployment to its CueInstance and source
+  cuectl trace podinfo --kind Deployment --api-version apps/v1 --namespace apps`,
+	Args: cobra.ExactArgs(1),
+	RunE: traceCmdRun,
+}
+
+type traceFlags struct {
+	kind       string
+	apiVersion string
+	namespace  string
+}
+
+var traceArgs traceFlags
+
+func init() {
+	traceCmd.Flags().StringVar(&traceArgs.kind, "kind", "", "kind of the object")
+	traceCmd.Flags().StringVar(&traceArgs.apiVersion, "api-version", "", "API version of the object")
+	traceCmd.Flags().StringVarP(&traceArgs.namespace, "namespace", "n", "", "namespace of the object, empty for cluster scoped objects")
+	rootCmd.AddCommand(traceCmd)
+}
+
+func traceCmdRun(cmd *cobra.Command, args []string) error {
+	if traceArgs.kind == "" || traceArgs.apiVersion == "" {
+		return fmt.Errorf("--kind and --api-version are required")
+	}
+
+	gv, err := schema.ParseGroupVersion(traceArgs.apiVersion)
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeArgs.timeout)
+	defer cancel()
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gv.WithKind(traceArgs.kind))
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: traceArgs.namespace, Name: args[0]}, obj); err != nil {
+		return fmt.Errorf("unable to get %s '%s': %w", traceArgs.kind, args[0], err)
+	}
+
+	cueInstance, err := findCueInstance(ctx, kubeClient, obj)
+	if err != nil {
+		return err
+	}
+
+	var source *sourcev1.GitRepository
+	if cueInstance.Spec.SourceRef.Kind == sourcev1.GitRepositoryKind {
+		source = &sourcev1.GitRepository{}
+		if err := kubeClient.Get(ctx, sourceKey(*cueInstance), source); err != nil {
+			return fmt.Errorf("unable to get source: %w", err)
+		}
+	}
+
+	return printTrace(cmd.OutOrStdout(), obj, cueInstance, source)
+}
+
+// findCueInstance returns the CueInstance managing the object, it is looked
+// up from the owner labels set by the controller and otherwise from the
+// inventories of the CueInstances.
+func findCueInstance(ctx context.Context, kubeClient client.Client, obj *unstructured.Unstructured) (*cuev1alpha1.CueInstance, error) {
+	labels := obj.GetLabels()
+	name := labels[cuev1alpha1.GroupVersion.Group+"/name"]
+	namespace := labels[cuev1alpha1.GroupVersion.Group+"/namespace"]
+	if name != "" && namespace != "" {
+		var cueInstance cuev1alpha1.CueInstance
+		if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &cueInstance); err != nil {
+			return nil, fmt.Errorf("unable to get CueInstance '%s/%s': %w", namespace, name, err)
+		}
+		return &cueInstance, nil
+	}
+
+	id := object.UnstructuredToObjMetadata(obj).String()
+
+	var list cuev1alpha1.CueInstanceList
+	if err := kubeClient.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	for i, cueInstance := range list.Items {
+		if cueInstance.Status.Inventory == nil {
+			continue
+		}
+		for _, entry := range cueInstance.Status.Inventory.Entries {
+			if entry.ID == id && entry.Cluster == "" {
+				return &list.Items[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%s '%s' is not managed by a CueInstance", obj.GetKind(), obj.GetName())
+}
+
+func sourceKey(cueInstance cuev1alpha1.CueInstance) types.NamespacedName {
+	namespace := cueInstance.Spec.SourceRef.Namespace
+	if namespace == "" {
+		namespace = cueInstance.GetNamespace()
+	}
+	return types.NamespacedName{Namespace: namespace, Name: cueInstance.Spec.SourceRef.Name}
+}
+
+func printTrace(w io.Writer, obj *unstructured.Unstructured, cueInstance *cuev1alpha1.CueInstance, source *sourcev1.GitRepository) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(tw, "Object:\t%s/%s\n", obj.GetKind(), obj.GetName())
+	if obj.GetNamespace() != "" {
+		fmt.Fprintf(tw, "Namespace:\t%s\n", obj.GetNamespace())
+	}
+	if ssa.AnyInMetadata(obj, controllers.PruneExclusions()) {
+		fmt.Fprintf(tw, "Prune:\tdisabled, retained when removed from the source or on deletion\n")
+	}
+	fmt.Fprintln(tw, "---")
+
+	fmt.Fprintf(tw, "CueInstance:\t%s\n", cueInstance.GetName())
+	fmt.Fprintf(tw, "Namespace:\t%s\n", cueInstance.GetNamespace())
+	if cueInstance.Spec.Root != "" {
+		fmt.Fprintf(tw, "Root:\t%s\n", cueInstance.Spec.Root)
+	}
+	if cueInstance.Spec.Path != "" {
+		fmt.Fprintf(tw, "Path:\t%s\n", cueInstance.Spec.Path)
+	}
+	fmt.Fprintf(tw, "Revision:\t%s\n", cueInstance.Status.LastAppliedRevision)
+	writeReadyStatus(tw, cueInstance.Status.Conditions)
+	fmt.Fprintln(tw, "---")
+
+	fmt.Fprintf(tw, "%s:\t%s\n", cueInstance.Spec.SourceRef.Kind, cueInstance.Spec.SourceRef.Name)
+	fmt.Fprintf(tw, "Namespace:\t%s\n", sourceKey(*cueInstance).Namespace)
+	if source != nil {
+		fmt.Fprintf(tw, "URL:\t%s\n", source.Spec.URL)
+		if artifact := source.GetArtifact(); artifact != nil {
+			fmt.Fprintf(tw, "Revision:\t%s\n", artifact.Revision)
+		}
+		writeReadyStatus(tw, source.Status.Conditions)
+	}
+
+	return tw.Flush()
+}
+
+func writeReadyStatus(w io.Writer, conditions []metav1.Condition) {
+	ready := apimeta.FindStatusCondition(conditions, meta.ReadyCondition)
+	if ready == nil {
+		fmt.Fprintf(w, "Status:\tUnknown\n")
+		return
+	}
+	fmt.Fprintf(w, "Status:\t%s at %s\n", ready.Reason, ready.LastTransitionTime.UTC().Format("2006-01-02T15:04:05Z"))
+	fmt.Fprintf(w, "Message:\t%s\n", ready.Message)
+}
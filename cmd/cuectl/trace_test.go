@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestFindCueInstance(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	deployment := func(name string, labels map[string]string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+		u.SetName(name)
+		u.SetNamespace("apps")
+		u.SetLabels(labels)
+		return u
+	}
+
+	labelled := deployment("podinfo", map[string]string{
+		"cue.contrib.flux.io/name":      "podinfo",
+		"cue.contrib.flux.io/namespace": "flux-system",
+	})
+	unlabelled := deployment("frontend", nil)
+	unmanaged := deployment("backend", nil)
+
+	byLabels := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "flux-system"},
+	}
+	byInventory := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "flux-system"},
+		Status: cuev1alpha1.CueInstanceStatus{
+			LastAppliedRevision: "main/8d1b5a3",
+			Inventory: &cuev1alpha1.ResourceInventory{
+				Entries: []cuev1alpha1.ResourceRef{
+					{ID: object.UnstructuredToObjMetadata(unlabelled).String(), Version: "v1"},
+					{ID: object.UnstructuredToObjMetadata(unmanaged).String(), Version: "v1", Cluster: "staging"},
+				},
+			},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(byLabels, byInventory).Build()
+
+	found, err := findCueInstance(context.TODO(), kubeClient, labelled)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found.GetName()).To(Equal("podinfo"))
+
+	found, err = findCueInstance(context.TODO(), kubeClient, unlabelled)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found.GetName()).To(Equal("frontend"))
+
+	_, err = findCueInstance(context.TODO(), kubeClient, unmanaged)
+	g.Expect(err).To(MatchError(ContainSubstring("not managed by a CueInstance")))
+
+	var out bytes.Buffer
+	g.Expect(printTrace(&out, unlabelled, found, nil)).To(Succeed())
+	g.Expect(out.String()).To(ContainSubstring("CueInstance: frontend"))
+	g.Expect(out.String()).To(ContainSubstring("Revision:    main/8d1b5a3"))
+	g.Expect(out.String()).NotTo(ContainSubstring("Prune:"))
+
+	out.Reset()
+	unlabelled.SetAnnotations(map[string]string{cuev1alpha1.GroupVersion.Group + "/prune": cuev1alpha1.DisabledValue})
+	g.Expect(printTrace(&out, unlabelled, found, nil)).To(Succeed())
+	g.Expect(out.String()).To(MatchRegexp(`Prune:\s+disabled`))
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// defaultAdoptedFieldManagers are the prefixes of the field managers of the
+// objects created with kubectl or Helm.
+var defaultAdoptedFieldManagers = []string{"kubectl", "before-first-apply", "helm"}
+
+// adoptionCleanup returns the cleanup applied to the adopted objects: the fields
+// of the managers of the policy are transferred to the controller and the
+// last-applied-configuration annotation of kubectl is removed.
+func adoptionCleanup(policy *cuev1alpha1.AdoptionPolicy) ssa.ApplyCleanupOptions {
+	prefixes := policy.FieldManagers
+	if len(prefixes) == 0 {
+		prefixes = defaultAdoptedFieldManagers
+	}
+
+	var managers []ssa.FieldManager
+	for _, prefix := range prefixes {
+		managers = append(managers,
+			ssa.FieldManager{Name: prefix, OperationType: metav1.ManagedFieldsOperationApply},
+			ssa.FieldManager{Name: prefix, OperationType: metav1.ManagedFieldsOperationUpdate},
+		)
+	}
+
+	return ssa.ApplyCleanupOptions{
+		Annotations:   []string{corev1.LastAppliedConfigAnnotation},
+		FieldManagers: managers,
+	}
+}
+
+// isManagedObject returns true if the object carries the owner labels of a CueInstance.
+func isManagedObject(obj *unstructured.Unstructured) bool {
+	_, ok := obj.GetLabels()[fmt.Sprintf("%s/name", cuev1alpha1.GroupVersion.Group)]
+	return ok
+}
+
+// unmanagedObjects returns the objects which already exist in the cluster
+// without being managed by a CueInstance.
+func unmanagedObjects(ctx context.Context, kubeClient client.Client, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	var result []*unstructured.Unstructured
+	for _, obj := range objects {
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+		if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", ssa.FmtUnstructured(obj), err)
+		}
+		if !isManagedObject(existing) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// adopt takes over the objects which exist in the cluster without being
+// managed by a CueInstance, according to the adoption policy of the instance.
+// The adopted objects are applied with the migration of their field managers
+// and returned with their change set, so that they can be left out of the
+// subsequent apply.
+func (r *CueInstanceReconciler) adopt(ctx context.Context, manager *ssa.ResourceManager, cueInstance cuev1alpha1.CueInstance, revision string,
+	objects []*unstructured.Unstructured, applyOpts ssa.ApplyOptions) ([]*unstructured.Unstructured, *ssa.ChangeSet, error) {
+	policy := cueInstance.Spec.AdoptionPolicy
+	if policy == nil {
+		return nil, nil, nil
+	}
+
+	unmanaged, err := unmanagedObjects(ctx, manager.Client(), objects)
+	if err != nil || len(unmanaged) == 0 {
+		return nil, nil, err
+	}
+
+	var names []string
+	for _, obj := range unmanaged {
+		names = append(names, ssa.FmtUnstructured(obj))
+	}
+
+	if policy.Mode == cuev1alpha1.FailAdoptionMode {
+		return nil, nil, fmt.Errorf("%d objects already exist and are not managed by a CueInstance:\n%s",
+			len(unmanaged), strings.Join(names, "\n"))
+	}
+
+	applyOpts.Cleanup = adoptionCleanup(policy)
+	changeSet, err := manager.ApplyAll(ctx, unmanaged, applyOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("adoption failed: %w", err)
+	}
+
+	ctrl.LoggerFrom(ctx).Info("adopted existing objects", "objects", names)
+	r.event(ctx, cueInstance, revision, events.EventSeverityInfo,
+		fmt.Sprintf("adopted %d existing objects:\n%s", len(unmanaged), strings.Join(names, "\n")), nil)
+
+	return unmanaged, changeSet, nil
+}
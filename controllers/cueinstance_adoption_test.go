@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestUnmanagedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "created-with-kubectl"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "managed",
+			Labels: map[string]string{cuev1alpha1.GroupVersion.Group + "/name": "app"}}},
+	).Build()
+
+	unmanaged := newTestObject("v1", "ConfigMap", "created-with-kubectl")
+	managed := newTestObject("v1", "ConfigMap", "managed")
+	missing := newTestObject("v1", "ConfigMap", "missing")
+
+	result, err := unmanagedObjects(context.TODO(), kubeClient, []*unstructured.Unstructured{unmanaged, managed, missing})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(ConsistOf(unmanaged))
+}
+
+func TestAdoptionCleanup(t *testing.T) {
+	g := NewWithT(t)
+
+	cleanup := adoptionCleanup(&cuev1alpha1.AdoptionPolicy{})
+	g.Expect(cleanup.Annotations).To(ConsistOf(corev1.LastAppliedConfigAnnotation))
+	g.Expect(cleanup.FieldManagers).To(HaveLen(2 * len(defaultAdoptedFieldManagers)))
+
+	cleanup = adoptionCleanup(&cuev1alpha1.AdoptionPolicy{FieldManagers: []string{"terraform"}})
+	g.Expect(cleanup.FieldManagers).To(HaveLen(2))
+	for _, manager := range cleanup.FieldManagers {
+		g.Expect(manager.Name).To(Equal("terraform"))
+	}
+}
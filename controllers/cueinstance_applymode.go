@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// IsCreateOnce reports whether the object is only applied when it doesn't
+// exist in the cluster, as requested by the IfNotPresent ssa annotation.
+func IsCreateOnce(obj *unstructured.Unstructured) bool {
+	return obj.GetAnnotations()[fmt.Sprintf("%s/ssa", cuev1alpha1.GroupVersion.Group)] == cuev1alpha1.IfNotPresentValue
+}
+
+// applyMode determines whether an object is applied.
+type applyMode int
+
+const (
+	// applyAlways creates and updates the object.
+	applyAlways applyMode = iota
+	// applyIfNotPresent only creates the object when it doesn't exist.
+	applyIfNotPresent
+	// applyNever leaves the object untouched, existing objects are kept in the inventory.
+	applyNever
+)
+
+// objectApplyMode returns the apply mode of the object according to its
+// annotations and the CRD policy of the CueInstance.
+func objectApplyMode(cueInstance cuev1alpha1.CueInstance, obj *unstructured.Unstructured) applyMode {
+	if ssa.IsClusterDefinition(obj) && obj.GetKind() == "CustomResourceDefinition" {
+		switch cueInstance.Spec.CRDs {
+		case cuev1alpha1.CreateCRDs:
+			return applyIfNotPresent
+		case cuev1alpha1.SkipCRDs:
+			return applyNever
+		}
+	}
+	if IsCreateOnce(obj) {
+		return applyIfNotPresent
+	}
+	return applyAlways
+}
+
+// selectObjectsToApply returns the objects which must be applied and the
+// change set entries of the existing objects which are left untouched.
+func selectObjectsToApply(ctx context.Context,
+	kubeClient client.Client,
+	objects []*unstructured.Unstructured,
+	modeOf func(*unstructured.Unstructured) applyMode,
+) ([]*unstructured.Unstructured, []ssa.ChangeSetEntry, error) {
+	var (
+		toApply []*unstructured.Unstructured
+		skipped []ssa.ChangeSetEntry
+	)
+	for _, obj := range objects {
+		mode := modeOf(obj)
+		if mode == applyAlways {
+			toApply = append(toApply, obj)
+			continue
+		}
+
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+		// the kinds defined by CRDs which are not established yet have no objects
+		if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			if mode == applyIfNotPresent {
+				toApply = append(toApply, obj)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s query failed: %w", ssa.FmtUnstructured(obj), err)
+		}
+
+		skipped = append(skipped, ssa.ChangeSetEntry{
+			ObjMetadata:  object.UnstructuredToObjMetadata(obj),
+			GroupVersion: obj.GroupVersionKind().Version,
+			Subject:      ssa.FmtUnstructured(obj),
+			Action:       string(ssa.UnchangedAction),
+		})
+	}
+	return toApply, skipped, nil
+}
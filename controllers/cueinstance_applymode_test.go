@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSelectObjectsToApply(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bootstrap"}},
+	).Build()
+
+	createOnce := map[string]string{cuev1alpha1.GroupVersion.Group + "/ssa": cuev1alpha1.IfNotPresentValue}
+	existing := newTestObject("v1", "Secret", "bootstrap")
+	existing.SetAnnotations(createOnce)
+	missing := newTestObject("v1", "Secret", "generated")
+	missing.SetAnnotations(createOnce)
+	regular := newTestObject("v1", "ConfigMap", "bootstrap")
+
+	modeOf := func(obj *unstructured.Unstructured) applyMode {
+		return objectApplyMode(cuev1alpha1.CueInstance{}, obj)
+	}
+	toApply, skipped, err := selectObjectsToApply(context.TODO(), kubeClient, []*unstructured.Unstructured{existing, missing, regular}, modeOf)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(toApply).To(Equal([]*unstructured.Unstructured{missing, regular}))
+	g.Expect(skipped).To(HaveLen(1))
+	g.Expect(skipped[0].Subject).To(Equal("Secret/default/bootstrap"))
+	g.Expect(skipped[0].Action).To(Equal(string(ssa.UnchangedAction)))
+	g.Expect(skipped[0].GroupVersion).To(Equal("v1"))
+}
+
+func TestObjectApplyMode(t *testing.T) {
+	crd := newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com")
+	crd.SetNamespace("")
+	secret := newTestObject("v1", "Secret", "bootstrap")
+
+	tests := []struct {
+		name string
+		crds cuev1alpha1.CRDsPolicy
+		obj  *unstructured.Unstructured
+		want applyMode
+	}{
+		{name: "default policy", obj: crd, want: applyAlways},
+		{name: "create replace", crds: cuev1alpha1.CreateReplaceCRDs, obj: crd, want: applyAlways},
+		{name: "create", crds: cuev1alpha1.CreateCRDs, obj: crd, want: applyIfNotPresent},
+		{name: "skip", crds: cuev1alpha1.SkipCRDs, obj: crd, want: applyNever},
+		{name: "other kinds", crds: cuev1alpha1.SkipCRDs, obj: secret, want: applyAlways},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			cueInstance := cuev1alpha1.CueInstance{Spec: cuev1alpha1.CueInstanceSpec{CRDs: tt.crds}}
+			g.Expect(objectApplyMode(cueInstance, tt.obj)).To(Equal(tt.want))
+		})
+	}
+
+	t.Run("skipped objects which don't exist are left out", func(t *testing.T) {
+		g := NewWithT(t)
+		kubeClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		toApply, skipped, err := selectObjectsToApply(context.TODO(), kubeClient, []*unstructured.Unstructured{secret},
+			func(*unstructured.Unstructured) applyMode { return applyNever })
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(toApply).To(BeEmpty())
+		g.Expect(skipped).To(BeEmpty())
+	})
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// planID identifies the changes planned for a generation of the CueInstance
+// and the objects rendered from a revision, so that an approval is not
+// carried over to a different spec, revision or object set.
+func planID(generation int64, revision, checksum string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s/%s", generation, revision, checksum)))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// approvalRequired reports whether the changes of the revision must wait for
+// the approval of the plan before being applied. The plans of the revisions
+// whose tag matches the auto-approve semver range are approved on creation.
+func approvalRequired(cueInstance cuev1alpha1.CueInstance, id, revision string) (bool, error) {
+	policy := cueInstance.Spec.Approval
+	if policy == nil || cueInstance.PlanApproved(id) {
+		return false, nil
+	}
+
+	if policy.AutoApproveSemver != "" {
+		constraint, err := semver.NewConstraint(policy.AutoApproveSemver)
+		if err != nil {
+			return false, fmt.Errorf("invalid auto-approve semver range '%s': %w", policy.AutoApproveSemver, err)
+		}
+		tag := strings.SplitN(revision, "/", 2)[0]
+		if v, err := semver.NewVersion(tag); err == nil && constraint.Check(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// planMessage describes the plan and how to approve it.
+func planMessage(plan cuev1alpha1.Plan) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan %s of revision %s awaits approval, annotate with %s=%s to apply %d changes:",
+		plan.ID, plan.Revision, cuev1alpha1.ApprovalAnnotation, plan.ID, len(plan.Changes))
+	for _, c := range plan.Changes {
+		b.WriteString("\n")
+		if c.Cluster != "" {
+			fmt.Fprintf(&b, "cluster '%s': ", c.Cluster)
+		}
+		fmt.Fprintf(&b, "%s %s", c.Subject, c.Action)
+	}
+	return b.String()
+}
+
+// ApprovalPredicate triggers an update event when the
+// approval annotation of an object changes.
+type ApprovalPredicate struct {
+	predicate.Funcs
+}
+
+func (ApprovalPredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+
+	val, ok := e.ObjectNew.GetAnnotations()[cuev1alpha1.ApprovalAnnotation]
+	if !ok {
+		return false
+	}
+
+	return val != e.ObjectOld.GetAnnotations()[cuev1alpha1.ApprovalAnnotation]
+}
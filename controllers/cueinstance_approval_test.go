@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestApprovalRequired(t *testing.T) {
+	g := NewWithT(t)
+
+	id := planID(1, "main/abc", "digest")
+	g.Expect(planID(2, "main/abc", "digest")).NotTo(Equal(id))
+	g.Expect(planID(1, "main/def", "digest")).NotTo(Equal(id))
+	g.Expect(planID(1, "main/abc", "other")).NotTo(Equal(id))
+
+	cueInstance := cuev1alpha1.CueInstance{}
+	g.Expect(approvalRequired(cueInstance, id, "main/abc")).To(BeFalse())
+
+	cueInstance.Spec.Approval = &cuev1alpha1.ApprovalPolicy{}
+	g.Expect(approvalRequired(cueInstance, id, "main/abc")).To(BeTrue())
+
+	// approvals of other plans are not carried over
+	cueInstance.SetAnnotations(map[string]string{cuev1alpha1.ApprovalAnnotation: planID(1, "main/xyz", "digest")})
+	g.Expect(approvalRequired(cueInstance, id, "main/abc")).To(BeTrue())
+	cueInstance.SetAnnotations(map[string]string{cuev1alpha1.ApprovalAnnotation: id})
+	g.Expect(approvalRequired(cueInstance, id, "main/abc")).To(BeFalse())
+
+	cueInstance.SetAnnotations(nil)
+	cueInstance.Spec.Approval.AutoApproveSemver = ">=1.0.0 <2.0.0"
+	g.Expect(approvalRequired(cueInstance, id, "v1.4.2/abc")).To(BeFalse())
+	g.Expect(approvalRequired(cueInstance, id, "v2.0.0/abc")).To(BeTrue())
+	g.Expect(approvalRequired(cueInstance, id, "main/abc")).To(BeTrue())
+
+	cueInstance.Spec.Approval.AutoApproveSemver = "not a range"
+	_, err := approvalRequired(cueInstance, id, "v1.4.2/abc")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestPlanMessage(t *testing.T) {
+	g := NewWithT(t)
+
+	msg := planMessage(cuev1alpha1.Plan{
+		ID:       "0123abcd",
+		Revision: "main/abc",
+		Changes: []cuev1alpha1.PendingChange{
+			{Subject: "ConfigMap/default/settings", Action: "configured"},
+			{Subject: "Deployment/default/app", Action: "deleted", Cluster: "staging"},
+		},
+	})
+	g.Expect(msg).To(Equal("Plan 0123abcd of revision main/abc awaits approval, " +
+		"annotate with cue.contrib.flux.io/approve=0123abcd to apply 2 changes:\n" +
+		"ConfigMap/default/settings configured\n" +
+		"cluster 'staging': Deployment/default/app deleted"))
+}
+
+func TestApprovalPredicate(t *testing.T) {
+	g := NewWithT(t)
+
+	object := func(approval string) *cuev1alpha1.CueInstance {
+		obj := &cuev1alpha1.CueInstance{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+		if approval != "" {
+			obj.SetAnnotations(map[string]string{cuev1alpha1.ApprovalAnnotation: approval})
+		}
+		return obj
+	}
+
+	p := ApprovalPredicate{}
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object(""), ObjectNew: object("0123abcd")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object("0123abcd"), ObjectNew: object("4567ef01")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object("0123abcd"), ObjectNew: object("0123abcd")})).To(BeFalse())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object(""), ObjectNew: object("")})).To(BeFalse())
+}
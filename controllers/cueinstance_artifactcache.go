@@ -0,0 +1,185 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+)
+
+// artifactCacheExt is the extension of the cached artifacts.
+const artifactCacheExt = ".tar.gz"
+
+var checksumRegexp = regexp.MustCompile(`^[a-f0-9]+$`)
+
+// ArtifactCacheOptions configure the cache of the downloaded artifacts, which
+// include the CUE modules vendored in their cue.mod directory.
+type ArtifactCacheOptions struct {
+	// Dir is the directory of the cache, e.g. the mount path of a persistent
+	// volume so that the cache survives the restarts of the controller.
+	// The cache is disabled when empty.
+	Dir string
+
+	// MaxSize is the total size in bytes above which the least recently
+	// used artifacts are evicted, zero never evicts them.
+	MaxSize int64
+}
+
+// artifactCache stores the verified artifacts on disk, keyed by their checksum.
+type artifactCache struct {
+	mu   sync.Mutex
+	opts ArtifactCacheOptions
+}
+
+// newArtifactCache returns the artifact cache, nil when it is disabled.
+func newArtifactCache(opts ArtifactCacheOptions) (*artifactCache, error) {
+	if opts.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create the artifact cache directory: %w", err)
+	}
+	return &artifactCache{opts: opts}, nil
+}
+
+func (c *artifactCache) path(checksum string) (string, bool) {
+	// the checksum is part of the file name, reject anything but hex digits
+	if !checksumRegexp.MatchString(checksum) {
+		return "", false
+	}
+	return filepath.Join(c.opts.Dir, checksum+artifactCacheExt), true
+}
+
+// get returns the cached data of the artifact, the entries which don't match
+// the checksum of the artifact anymore are removed.
+func (c *artifactCache) get(artifact *sourcev1.Artifact) (*bytes.Buffer, bool) {
+	if c == nil {
+		return nil, false
+	}
+	path, ok := c.path(artifact.Checksum)
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	if err := verifyArtifact(artifact, data); err != nil {
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	// the modification time records the last use for the eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return bytes.NewBuffer(data), true
+}
+
+// put stores the verified data of the artifact and evicts the least recently
+// used artifacts above the maximum size of the cache.
+func (c *artifactCache) put(artifact *sourcev1.Artifact, data []byte) error {
+	if c == nil {
+		return nil
+	}
+	path, ok := c.path(artifact.Checksum)
+	if !ok {
+		return nil
+	}
+
+	// write to a temporary file first so that a partial artifact is never cached
+	tmp, err := os.CreateTemp(c.opts.Dir, ".artifact-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evict()
+}
+
+// evict removes the least recently used artifacts until the total size
+// of the cache is within its maximum size.
+func (c *artifactCache) evict() error {
+	if c.opts.MaxSize <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(c.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), artifactCacheExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cached{
+			path:    filepath.Join(c.opts.Dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if total <= c.opts.MaxSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	. "github.com/onsi/gomega"
+)
+
+func TestArtifactCache(t *testing.T) {
+	g := NewWithT(t)
+
+	newArtifact := func(data string) *sourcev1.Artifact {
+		return &sourcev1.Artifact{Checksum: fmt.Sprintf("%x", sha256.Sum256([]byte(data)))}
+	}
+
+	disabled, err := newArtifactCache(ArtifactCacheOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(disabled.put(newArtifact("data"), []byte("data"))).To(Succeed())
+	_, ok := disabled.get(newArtifact("data"))
+	g.Expect(ok).To(BeFalse())
+
+	dir := t.TempDir()
+	cache, err := newArtifactCache(ArtifactCacheOptions{Dir: dir, MaxSize: 10})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	first, second, third := newArtifact("first"), newArtifact("second"), newArtifact("third")
+	g.Expect(cache.put(first, []byte("first"))).To(Succeed())
+
+	buf, ok := cache.get(first)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(buf.String()).To(Equal("first"))
+
+	t.Run("the least recently used artifacts are evicted", func(t *testing.T) {
+		g := NewWithT(t)
+
+		past := time.Now().Add(-time.Hour)
+		g.Expect(os.Chtimes(filepath.Join(dir, first.Checksum+artifactCacheExt), past, past)).To(Succeed())
+		g.Expect(cache.put(second, []byte("second"))).To(Succeed())
+		g.Expect(cache.put(third, []byte("third"))).To(Succeed())
+
+		_, ok := cache.get(first)
+		g.Expect(ok).To(BeFalse())
+		_, ok = cache.get(third)
+		g.Expect(ok).To(BeTrue())
+	})
+
+	t.Run("corrupted artifacts are removed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		path := filepath.Join(dir, third.Checksum+artifactCacheExt)
+		g.Expect(os.WriteFile(path, []byte("tampered"), 0o600)).To(Succeed())
+		_, ok := cache.get(third)
+		g.Expect(ok).To(BeFalse())
+		g.Expect(path).NotTo(BeAnExistingFile())
+	})
+
+	t.Run("invalid checksums are not cached", func(t *testing.T) {
+		g := NewWithT(t)
+
+		artifact := &sourcev1.Artifact{Checksum: "../escape"}
+		g.Expect(cache.put(artifact, []byte("data"))).To(Succeed())
+		g.Expect(filepath.Join(dir, "..", "escape"+artifactCacheExt)).NotTo(BeAnExistingFile())
+	})
+}
@@ -0,0 +1,717 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/load"
+	"cuelang.org/go/encoding/yaml"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// BuildRequest contains everything required to build a CUE instance
+// from an extracted artifact.
+type BuildRequest struct {
+	// Root is the absolute path of the CUE module root.
+	Root string `json:"root"`
+
+	// Dir is the absolute path of the directory from which the instance is built.
+	Dir string `json:"dir"`
+
+	// Spec is the spec of the CueInstance being built.
+	Spec cuev1alpha1.CueInstanceSpec `json:"spec"`
+
+	// Schema is the source of the remote validation schema, if any.
+	Schema string `json:"schema,omitempty"`
+}
+
+// BuildResult contains the output of a CUE instance build.
+type BuildResult struct {
+	// Manifests is the multi-doc YAML stream of the rendered objects.
+	Manifests []byte `json:"manifests,omitempty"`
+
+	// Validation contains the messages of the validation failures
+	// encountered during the build.
+	Validation []ValidationMessage `json:"validation,omitempty"`
+
+	// ValidationDuration is the time spent validating the build output.
+	ValidationDuration time.Duration `json:"validationDuration,omitempty"`
+
+	// Errors is the structured list of the errors which failed the build.
+	Errors []cuev1alpha1.BuildError `json:"errors,omitempty"`
+
+	// Variants is the build status of the variants of a matrix build.
+	Variants []cuev1alpha1.VariantStatus `json:"variants,omitempty"`
+
+	// Outputs holds the values of the outputs keyed by destination key.
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// ValidationMessage is a validation failure recorded during a build
+// together with the mode that was in effect when it was recorded.
+type ValidationMessage struct {
+	Mode    cuev1alpha1.ValidationMode `json:"mode"`
+	Message string                     `json:"message"`
+	// Subject is the CUE expression or data file which failed the validation.
+	Subject string `json:"subject,omitempty"`
+}
+
+func (r *CueInstanceReconciler) build(ctx context.Context,
+	revision, root, dir string,
+	instance *cuev1alpha1.CueInstance,
+) (*BuildResult, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	profiled, err := r.applyProfile(ctx, *instance)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := r.resolveTags(ctx, profiled)
+	if err != nil {
+		return nil, err
+	}
+
+	spec.TagVars, err = r.resolveValuesFrom(ctx, profiled, spec.TagVars)
+	if err != nil {
+		return nil, err
+	}
+
+	spec.Exprs, err = r.resolveExprs(ctx, instance.GetNamespace(), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	req := BuildRequest{
+		Root: root,
+		Dir:  dir,
+		Spec: spec,
+	}
+
+	if spec.Validate != nil && IsRemoteSchema(spec.Validate.Schema) {
+		req.Schema, err = r.fetchSchema(ctx, spec.Validate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	build := buildInstance
+	if r.Sandbox.Enabled {
+		build = func(req BuildRequest) (*BuildResult, error) {
+			return r.buildInSandbox(ctx, req, instance.GetTimeout())
+		}
+	}
+	result, err := buildMatrix(req, limitBuilds(ctx, r.buildSlots, build))
+
+	// replay the validation failures recorded during the build
+	if result != nil {
+		for _, v := range result.Validation {
+			if v.Mode == cuev1alpha1.IgnorePolicy {
+				log.Info(v.Message)
+				continue
+			}
+			r.event(ctx, *instance, revision, events.EventSeverityInfo, v.Message, nil)
+		}
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// limitBuilds returns build waiting for one of the slots before running, so
+// that excess builds queue instead of exhausting the memory of the controller.
+// The builds are unlimited when there are no slots.
+func limitBuilds(ctx context.Context, slots chan struct{}, build func(BuildRequest) (*BuildResult, error)) func(BuildRequest) (*BuildResult, error) {
+	if slots == nil {
+		return build
+	}
+	return func(req BuildRequest) (*BuildResult, error) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a build slot: %w", ctx.Err())
+		}
+		return build(req)
+	}
+}
+
+// buildInstance loads and evaluates the CUE instance described by req
+// and returns the rendered manifests.
+// The returned result is non-nil even when an error is returned,
+// so that validation failures and build errors can be reported.
+func buildInstance(req BuildRequest) (result *BuildResult, err error) {
+	cctx := cuecontext.New()
+	spec := req.Spec
+	result = &BuildResult{}
+
+	// the values of the sensitive tags, of the Secrets and of the
+	// sensitive fields are redacted from the errors and validation messages
+	sensitive := sensitiveTagValues(spec)
+
+	defer func() {
+		if err != nil {
+			result.Errors = buildErrors(err, req.Root)
+			err = withErrorPositions(err, result.Errors)
+			if len(sensitive) > 0 {
+				for i := range result.Errors {
+					result.Errors[i].Message = redactValues(result.Errors[i].Message, sensitive)
+				}
+				err = &positionedError{msg: redactValues(err.Error(), sensitive), err: err}
+			}
+		}
+	}()
+
+	tags := make([]string, 0, len(spec.Tags))
+	for _, t := range spec.Tags {
+		if t.Value != "" || t.ValueFrom != nil {
+			tags = append(tags, fmt.Sprintf("%s=%s", t.Name, t.Value))
+		} else {
+			tags = append(tags, t.Name)
+		}
+	}
+
+	tagVars := make(map[string]load.TagVar, len(spec.TagVars))
+	for _, t := range spec.TagVars {
+		value := t.Value
+		tagVars[t.Name] = load.TagVar{
+			Func: func() (ast.Expr, error) {
+				return ast.NewString(value), nil
+			},
+		}
+	}
+
+	cfg := &load.Config{
+		ModuleRoot: req.Root,
+		Dir:        req.Dir,
+		DataFiles:  true, //TODO: this could be configurable
+		Tags:       tags,
+		TagVars:    tagVars,
+	}
+
+	if spec.Package != "" {
+		cfg.Package = spec.Package
+	}
+
+	// the components are loaded along with the base package
+	// so that the tags may be declared by any of them
+	args, err := componentArgs(req)
+	if err != nil {
+		return result, err
+	}
+
+	ix := load.Instances(args, cfg)
+	if len(ix) == 0 {
+		return result, fmt.Errorf("no instances found")
+	}
+
+	inst := ix[0]
+	if inst.Err != nil {
+		return result, inst.Err
+	}
+
+	for i, component := range ix[1:] {
+		if err := addComponent(inst, component); err != nil {
+			return result, fmt.Errorf("component '%s': %w", spec.Components[i], err)
+		}
+	}
+
+	if err := embedFiles(inst, req.Root); err != nil {
+		return result, err
+	}
+
+	value := cctx.BuildInstance(inst)
+	value, err = applyDataFiles(cctx, req, value)
+	if err != nil {
+		return result, err
+	}
+	value, err = applyOverlays(cctx, req, value)
+	if err != nil {
+		return result, err
+	}
+	sensitive = append(sensitive, sensitiveValues(value, spec.SensitivePaths)...)
+	if value.Err() != nil {
+		// report all the errors of the instance rather than the first one
+		if err := value.Validate(cue.All()); err != nil {
+			return result, err
+		}
+		return result, value.Err()
+	}
+
+	shouldValidate := spec.Validate != nil
+	var schema cue.Value
+	if shouldValidate {
+		schema, err = validationSchema(cctx, value, spec.Validate.Schema, req.Schema)
+		if err != nil {
+			return result, err
+		}
+	}
+	requireConcreteValues := spec.Build != nil && spec.Build.RequireConcrete
+
+	encode := cueEncodeYAML
+	mapMode := spec.Build != nil && spec.Build.Mode == cuev1alpha1.MapBuildMode
+	if mapMode {
+		encode = cueEncodeObjectMap
+	}
+
+	// timed runs the validation f and records its duration
+	timed := func(f func() error) error {
+		start := time.Now()
+		defer func() { result.ValidationDuration += time.Since(start) }()
+		return f()
+	}
+
+	// validationFailed records msg and reports whether the build should
+	// continue (true) or fail (false) according to the validation mode.
+	validationFailed := func(mode cuev1alpha1.ValidationMode, subject, msg string) bool {
+		result.Validation = append(result.Validation, ValidationMessage{
+			Mode:    mode,
+			Message: redactValues(msg, sensitive),
+			Subject: subject,
+		})
+		return mode != cuev1alpha1.FailPolicy
+	}
+
+	// objectMode returns the validation mode of v, which objects may
+	// override with the validation mode annotation.
+	objectMode := func(v cue.Value) (cuev1alpha1.ValidationMode, error) {
+		annotation, _ := v.LookupPath(cue.MakePath(
+			cue.Str("metadata"), cue.Str("annotations"), cue.Str(cuev1alpha1.ValidationModeAnnotation),
+		)).String()
+		return validationModeOverride(annotation, spec.Validate.Mode)
+	}
+
+	if spec.WriteOutputsTo != nil {
+		result.Outputs, err = evalOutputs(value, spec.WriteOutputsTo.Outputs)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	exprs := spec.Exprs
+	if len(exprs) == 0 {
+		output, err := outputExpr(value, spec.OutputExpr)
+		if err != nil {
+			return result, err
+		}
+		if output != "" {
+			exprs = []string{output}
+		}
+	}
+
+	var out bytes.Buffer
+	if len(exprs) > 0 {
+		for _, e := range exprs {
+			expr := lookupExpr(value, e)
+
+			if requireConcreteValues {
+				if err := requireConcrete(expr); err != nil {
+					return result, fmt.Errorf("expression '%s' is not concrete: %w", e, err)
+				}
+			}
+
+			data, err := encode(expr)
+			if err != nil {
+				return result, err
+			}
+
+			if shouldValidate && spec.Validate.Type == "cue" {
+				if err := timed(func() error { return schema.Unify(expr).Validate() }); err != nil {
+					mode, modeErr := objectMode(expr)
+					if modeErr != nil {
+						return result, fmt.Errorf("expression '%s': %w", e, modeErr)
+					}
+					err = fmt.Errorf("cue expression validation failed: %w", err)
+					if !validationFailed(mode, fmt.Sprintf("expression '%s'", e), err.Error()) {
+						return result, err
+					}
+					if mode == cuev1alpha1.DropPolicy {
+						continue
+					}
+				}
+			}
+
+			_, err = out.Write(data)
+			if err != nil {
+				return result, err
+			}
+		}
+	} else if ok, err := renderRoot(value, mapMode); err != nil {
+		return result, err
+	} else if ok {
+		if requireConcreteValues {
+			if err := requireConcrete(value); err != nil {
+				return result, fmt.Errorf("instance is not concrete: %w", err)
+			}
+		}
+
+		data, err := encode(value)
+		if err != nil {
+			return result, err
+		}
+
+		valid := true
+
+		if shouldValidate && spec.Validate.Type == "cue" {
+			if err := timed(func() error { return schema.Unify(value).Validate() }); err != nil {
+				err = fmt.Errorf("cue validation failed: %w", err)
+				if !validationFailed(spec.Validate.Mode, "instance", err.Error()) {
+					return result, err
+				}
+				if spec.Validate.Mode == cuev1alpha1.DropPolicy {
+					valid = false
+				}
+			}
+		}
+
+		if valid {
+			_, err = out.Write(data)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// validateYAML validates a data file document against the schema
+	// and reports whether it should be included in the output.
+	validateYAML := func(filename string, doc cue.Value, data []byte) (bool, error) {
+		if !shouldValidate || spec.Validate.Type != "yaml" {
+			return true, nil
+		}
+		if err := timed(func() error { return yaml.Validate(data, schema) }); err != nil {
+			mode, modeErr := objectMode(doc)
+			if modeErr != nil {
+				return false, modeErr
+			}
+			err = fmt.Errorf("yaml validation failed: %w", err)
+			if rel, relErr := filepath.Rel(req.Root, filename); relErr == nil {
+				filename = rel
+			}
+			if !validationFailed(mode, fmt.Sprintf("file '%s'", filename), err.Error()) {
+				return false, err
+			}
+			return mode != cuev1alpha1.DropPolicy, nil
+		}
+		return true, nil
+	}
+
+	for _, of := range inst.OrphanedFiles {
+		if of.Encoding == "yaml" {
+			data, err := yaml.Extract(of.Filename, nil)
+			if err != nil {
+				return result, err
+			}
+			f := cctx.BuildFile(data)
+			switch f.Kind() {
+			case cue.ListKind:
+				l, err := f.List()
+				if err != nil {
+					return result, err
+				}
+				for l.Next() {
+					data, err := yaml.Encode(l.Value())
+					if err != nil {
+						return result, err
+					}
+					ok, err := validateYAML(of.Filename, l.Value(), data)
+					if err != nil {
+						return result, err
+					}
+					if !ok {
+						continue
+					}
+					out.Write(data)
+					out.Write([]byte("\n---\n"))
+				}
+			case cue.StructKind:
+				data, err := yaml.Encode(f)
+				if err != nil {
+					return result, err
+				}
+				ok, err := validateYAML(of.Filename, f, data)
+				if err != nil {
+					return result, err
+				}
+				if !ok {
+					continue
+				}
+				out.Write(data)
+				out.Write([]byte("\n---\n"))
+			}
+		}
+	}
+
+	// an empty set would garbage collect every object of the inventory
+	if out.Len() == 0 {
+		return result, fmt.Errorf("the build produced no objects")
+	}
+
+	result.Manifests = out.Bytes()
+	return result, nil
+}
+
+// checksumObjects returns the SHA256 digest of the given object set.
+// The digest does not depend on the order in which the objects were rendered.
+func checksumObjects(objects []*unstructured.Unstructured) (string, error) {
+	sorted := make([]*unstructured.Unstructured, len(objects))
+	copy(sorted, objects)
+	sort.Sort(ssa.SortableUnstructureds(sorted))
+
+	hasher := sha256.New()
+	for _, obj := range sorted {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return "", err
+		}
+		hasher.Write(data)
+		hasher.Write([]byte("\n"))
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+func cueEncodeYAML(value cue.Value) ([]byte, error) {
+	var (
+		err  error
+		data []byte
+	)
+	switch value.Kind() {
+	case cue.ListKind, cue.StructKind:
+		// report all the errors of the value rather than the first one
+		if err := value.Validate(cue.Concrete(true), cue.All()); err != nil {
+			return nil, err
+		}
+	}
+	switch value.Kind() {
+	case cue.ListKind:
+		items, err := value.List()
+		if err != nil {
+			return nil, err
+		}
+		data, err = yaml.EncodeStream(items)
+		if err != nil {
+			return nil, err
+		}
+	case cue.StructKind:
+		data, err = yaml.Encode(value)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	data = append(data, []byte("\n---\n")...)
+	return data, nil
+}
+
+// defaultOutputExpr is the path of the output objects used
+// when neither the expressions nor the output expression are set.
+const defaultOutputExpr = "objects"
+
+// outputExpr returns the expression exporting the objects of value when
+// no expressions are specified, or an empty string if there is none.
+func outputExpr(value cue.Value, expr string) (string, error) {
+	if expr == "" {
+		if value.LookupPath(cue.ParsePath(defaultOutputExpr)).Exists() {
+			return defaultOutputExpr, nil
+		}
+		return "", nil
+	}
+	if !lookupExpr(value, expr).Exists() {
+		return "", fmt.Errorf("output expression '%s' not found", expr)
+	}
+	return expr, nil
+}
+
+// renderRoot reports whether the package root is rendered when the instance
+// defines neither expressions nor the objects field. The root of the objects
+// map is always rendered, otherwise the root must be an object or a list of
+// objects, or have no regular fields when only its data files are applied.
+func renderRoot(value cue.Value, mapMode bool) (bool, error) {
+	if mapMode {
+		return true, nil
+	}
+	switch value.Kind() {
+	case cue.ListKind:
+		return true, nil
+	case cue.StructKind:
+		if value.LookupPath(cue.ParsePath("apiVersion")).Exists() && value.LookupPath(cue.ParsePath("kind")).Exists() {
+			return true, nil
+		}
+		iter, err := value.Fields()
+		if err != nil {
+			return false, err
+		}
+		if !iter.Next() {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("no %s field and root value is not an object list", defaultOutputExpr)
+}
+
+// lookupExpr returns the value at the path of the expression,
+// '.' refers to the value itself.
+func lookupExpr(value cue.Value, expr string) cue.Value {
+	if expr == "." {
+		return value
+	}
+	return value.LookupPath(cue.ParsePath(expr))
+}
+
+// cueEncodeObjectMap encodes the Kubernetes objects found in the values of the
+// nested structs and lists of value, visiting the struct fields in the lexical
+// order of their keys.
+func cueEncodeObjectMap(value cue.Value) ([]byte, error) {
+	var out bytes.Buffer
+	if err := encodeObjects(value, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodeObjects(value cue.Value, out *bytes.Buffer) error {
+	switch value.Kind() {
+	case cue.StructKind:
+		if value.LookupPath(cue.ParsePath("apiVersion")).Exists() && value.LookupPath(cue.ParsePath("kind")).Exists() {
+			data, err := cueEncodeYAML(value)
+			if err != nil {
+				return err
+			}
+			out.Write(data)
+			return nil
+		}
+
+		iter, err := value.Fields()
+		if err != nil {
+			return err
+		}
+		fields := map[string]cue.Value{}
+		var keys []string
+		for iter.Next() {
+			key := iter.Selector().String()
+			fields[key] = iter.Value()
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := encodeObjects(fields[key], out); err != nil {
+				return err
+			}
+		}
+	case cue.ListKind:
+		iter, err := value.List()
+		if err != nil {
+			return err
+		}
+		for iter.Next() {
+			if err := encodeObjects(iter.Value(), out); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := value.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s: value is not a Kubernetes object", value.Path())
+	}
+	return nil
+}
+
+// componentArgs returns the arguments loading the package of the build
+// directory followed by the components, as paths relative to the build directory.
+func componentArgs(req BuildRequest) ([]string, error) {
+	if len(req.Spec.Components) == 0 {
+		return []string{}, nil
+	}
+
+	args := make([]string, 0, len(req.Spec.Components)+1)
+	args = append(args, ".")
+	for _, c := range req.Spec.Components {
+		dir, err := securejoin.SecureJoin(req.Root, c)
+		if err != nil {
+			return nil, fmt.Errorf("component '%s': %w", c, err)
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("component '%s' not found", c)
+		}
+		rel, err := filepath.Rel(req.Dir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("component '%s': %w", c, err)
+		}
+		if !strings.HasPrefix(rel, "..") {
+			rel = "./" + rel
+		}
+		args = append(args, filepath.ToSlash(rel))
+	}
+	return args, nil
+}
+
+// addComponent adds the files and imports of the component to the instance,
+// so that the component is evaluated as part of the package of the instance.
+func addComponent(inst, component *build.Instance) error {
+	if component.Err != nil {
+		return component.Err
+	}
+
+	// the files of the parent directories may be loaded by both
+	files := make(map[string]bool, len(inst.Files))
+	for _, f := range inst.Files {
+		files[f.Filename] = true
+	}
+	for _, f := range component.Files {
+		if files[f.Filename] {
+			continue
+		}
+		if err := inst.AddSyntax(f); err != nil {
+			return err
+		}
+	}
+
+	imports := make(map[string]bool, len(inst.Imports))
+	for _, imp := range inst.Imports {
+		imports[imp.ImportPath] = true
+	}
+	for _, imp := range component.Imports {
+		if !imports[imp.ImportPath] {
+			imports[imp.ImportPath] = true
+			inst.Imports = append(inst.Imports, imp)
+		}
+	}
+	return nil
+}
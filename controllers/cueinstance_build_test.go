@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -96,3 +100,593 @@ func TestCueInstanceReconciler_BuildInstance(t *testing.T) {
 		Namespace: deployNamespace,
 	}, deployment)).To(Succeed())
 }
+
+// writeCueModule writes a CUE module with the given app.cue contents
+// to a temporary directory and returns its path.
+func writeCueModule(t *testing.T, app string) string {
+	g := NewWithT(t)
+
+	root := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(root, "cue.mod"), 0o755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(root, "cue.mod", "module.cue"), []byte(`module: "example.com/app"`), 0o644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(root, "app.cue"), []byte(app), 0o644)).To(Succeed())
+	return root
+}
+
+func TestBuildInstance_MapMode(t *testing.T) {
+	g := NewWithT(t)
+
+	root := writeCueModule(t, `package app
+
+out: {
+	service: [Name=string]: {
+		apiVersion: "v1"
+		kind:       "Service"
+		metadata: name: Name
+	}
+	deployment: [Name=string]: {
+		apiVersion: "apps/v1"
+		kind:       "Deployment"
+		metadata: name: Name
+	}
+
+	service: frontend: {}
+	deployment: frontend: {}
+	deployment: backend: {}
+}
+`)
+
+	req := BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Exprs: []string{"out"},
+			Build: &cuev1alpha1.BuildOptions{Mode: cuev1alpha1.MapBuildMode},
+		},
+	}
+
+	result, err := buildInstance(req)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var ids []string
+	for _, obj := range objects {
+		ids = append(ids, obj.GetKind()+"/"+obj.GetName())
+	}
+	g.Expect(ids).To(Equal([]string{"Deployment/backend", "Deployment/frontend", "Service/frontend"}))
+
+	t.Run("rejects values which are not objects", func(t *testing.T) {
+		g := NewWithT(t)
+
+		req.Root = writeCueModule(t, `package app
+
+out: replicas: 3
+`)
+		req.Dir = req.Root
+		_, err := buildInstance(req)
+		g.Expect(err).To(MatchError(ContainSubstring("out.replicas: value is not a Kubernetes object")))
+	})
+
+	t.Run("renders the root value without expressions", func(t *testing.T) {
+		g := NewWithT(t)
+
+		req.Root = writeCueModule(t, `package app
+
+deployment: frontend: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: "frontend"
+}
+`)
+		req.Dir = req.Root
+		req.Spec.Exprs = nil
+		result, err := buildInstance(req)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetName()).To(Equal("frontend"))
+	})
+
+	t.Run("fails when no objects are rendered", func(t *testing.T) {
+		g := NewWithT(t)
+
+		req.Root = writeCueModule(t, `package app
+
+out: {}
+`)
+		req.Dir = req.Root
+		req.Spec.Exprs = []string{"out"}
+		_, err := buildInstance(req)
+		g.Expect(err).To(MatchError(ContainSubstring("the build produced no objects")))
+	})
+}
+
+func TestBuildInstance_OutputExpr(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+inputs: name: "app"
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: inputs.name
+}]
+
+custom: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "custom"
+}]
+`)
+
+	tests := []struct {
+		name       string
+		outputExpr string
+		exprs      []string
+		want       []string
+		wantErr    string
+	}{
+		{name: "defaults to objects", want: []string{"app"}},
+		{name: "custom output expression", outputExpr: "custom", want: []string{"custom"}},
+		{name: "expressions take precedence", outputExpr: "custom", exprs: []string{"objects"}, want: []string{"app"}},
+		{name: "missing output expression", outputExpr: "outputs", wantErr: "output expression 'outputs' not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := buildInstance(BuildRequest{
+				Root: root,
+				Dir:  root,
+				Spec: cuev1alpha1.CueInstanceSpec{
+					Exprs:      tt.exprs,
+					OutputExpr: tt.outputExpr,
+				},
+			})
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+			g.Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, obj := range objects {
+				names = append(names, obj.GetName())
+			}
+			g.Expect(names).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestBuildInstance_RootDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "object root",
+			app: `package app
+
+apiVersion: "v1"
+kind:       "ConfigMap"
+metadata: name: "root"
+`,
+			want: []string{"root"},
+		},
+		{
+			name: "object list root",
+			app: `package app
+
+[{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "first"
+}, {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "second"
+}]
+`,
+			want: []string{"first", "second"},
+		},
+		{
+			name: "root without regular fields",
+			app: `package app
+
+#ConfigMap: kind: "ConfigMap"
+`,
+			data: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: data\n",
+			want: []string{"data"},
+		},
+		{
+			name: "root with other fields",
+			app: `package app
+
+inputs: name: "app"
+`,
+			wantErr: "no objects field and root value is not an object list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			root := writeCueModule(t, tt.app)
+			if tt.data != "" {
+				g.Expect(os.WriteFile(filepath.Join(root, "data.yaml"), []byte(tt.data), 0o644)).To(Succeed())
+			}
+			result, err := buildInstance(BuildRequest{Root: root, Dir: root})
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+			g.Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, obj := range objects {
+				names = append(names, obj.GetName())
+			}
+			g.Expect(names).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestBuildInstance_ValidationModeAnnotation(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+#Deployment: spec: replicas: <=3
+
+legacy: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: {
+		name: "legacy"
+		annotations: "cue.contrib.flux.io/validation": "Audit"
+	}
+	spec: replicas: 5
+}
+
+app: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: "app"
+	spec: replicas: 5
+}
+
+typo: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: {
+		name: "typo"
+		annotations: "cue.contrib.flux.io/validation": "Skip"
+	}
+	spec: replicas: 5
+}
+`)
+
+	build := func(exprs ...string) (*BuildResult, error) {
+		return buildInstance(BuildRequest{
+			Root: root,
+			Dir:  root,
+			Spec: cuev1alpha1.CueInstanceSpec{
+				Exprs: exprs,
+				Validate: &cuev1alpha1.Validation{
+					Mode:   cuev1alpha1.DropPolicy,
+					Schema: "#Deployment",
+					Type:   "cue",
+				},
+			},
+		})
+	}
+
+	t.Run("overrides the validation mode", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := build("legacy", "app")
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetName()).To(Equal("legacy"))
+
+		var modes []cuev1alpha1.ValidationMode
+		for _, v := range result.Validation {
+			modes = append(modes, v.Mode)
+		}
+		g.Expect(modes).To(Equal([]cuev1alpha1.ValidationMode{cuev1alpha1.AuditPolicy, cuev1alpha1.DropPolicy}))
+	})
+
+	t.Run("rejects invalid modes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build("typo")
+		g.Expect(err).To(MatchError(ContainSubstring("invalid cue.contrib.flux.io/validation annotation 'Skip'")))
+	})
+}
+
+func TestBuildInstance_Components(t *testing.T) {
+	root := writeCueModule(t, `package app
+`)
+	files := map[string]string{
+		"base/app.cue": `package app
+
+resources: app: {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+}
+
+objects: [ for r in resources {r}]
+`,
+		"components/monitoring/monitoring.cue": `package app
+
+resources: monitor: {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "monitor"
+}
+`,
+		"components/env/env.cue": `package app
+
+environment: string @tag(env)
+
+resources: app: data: env: environment
+`,
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		NewWithT(t).Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		NewWithT(t).Expect(os.WriteFile(path, []byte(data), 0o644)).To(Succeed())
+	}
+
+	build := func(components ...string) (*BuildResult, error) {
+		return buildInstance(BuildRequest{
+			Root: root,
+			Dir:  filepath.Join(root, "base"),
+			Spec: cuev1alpha1.CueInstanceSpec{
+				Path:       "base",
+				Components: components,
+				Tags:       []cuev1alpha1.TagVar{{Name: "env", Value: "prod"}},
+			},
+		})
+	}
+
+	t.Run("unifies the components in order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := build("components/monitoring", "components/env")
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(2))
+		g.Expect(objects[0].GetName()).To(Equal("app"))
+		g.Expect(objects[0].Object["data"]).To(Equal(map[string]interface{}{"env": "prod"}))
+		g.Expect(objects[1].GetName()).To(Equal("monitor"))
+	})
+
+	t.Run("rejects missing components", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build("components/ingress")
+		g.Expect(err).To(MatchError("component 'components/ingress' not found"))
+	})
+}
+
+func TestBuildInstance_Overlays(t *testing.T) {
+	root := writeCueModule(t, `package app
+`)
+	files := map[string]string{
+		"base/app.cue": `package app
+
+values: {
+	replicas: *1 | int
+	image:    string | *"app:v1"
+}
+
+objects: [{
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: "app"
+	spec: replicas: values.replicas
+	spec: template: spec: containers: [{name: "app", image: values.image}]
+}]
+`,
+		"overlays/prod/prod.cue": `package prod
+
+values: replicas: 3
+`,
+		"overlays/prod/image.yaml": `values:
+  image: app:v2
+`,
+		"overlays/conflict.json": `{"values": {"replicas": 5}}`,
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		NewWithT(t).Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		NewWithT(t).Expect(os.WriteFile(path, []byte(data), 0o644)).To(Succeed())
+	}
+
+	build := func(overlays ...string) (*BuildResult, error) {
+		return buildInstance(BuildRequest{
+			Root: root,
+			Dir:  filepath.Join(root, "base"),
+			Spec: cuev1alpha1.CueInstanceSpec{
+				Path:     "base",
+				Overlays: overlays,
+			},
+		})
+	}
+
+	t.Run("unifies the overlays over the instance", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := build("overlays/prod", "overlays/prod/image.yaml")
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+
+		replicas, _, _ := unstructured.NestedInt64(objects[0].Object, "spec", "replicas")
+		g.Expect(replicas).To(Equal(int64(3)))
+		containers, _, _ := unstructured.NestedSlice(objects[0].Object, "spec", "template", "spec", "containers")
+		g.Expect(containers).To(HaveLen(1))
+		g.Expect(containers[0]).To(HaveKeyWithValue("image", "app:v2"))
+	})
+
+	t.Run("fails on conflicting overlays", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build("overlays/prod", "overlays/conflict.json")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("replicas"))
+	})
+
+	t.Run("rejects missing overlays", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build("overlays/staging")
+		g.Expect(err).To(MatchError("overlay 'overlays/staging' not found"))
+	})
+}
+
+func TestBuildInstance_DataFiles(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+#Env: {
+	replicas: int & <=5
+	region:   string
+}
+
+envs: [string]: #Env
+
+objects: [ for envName, env in envs {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: envName
+	data: region: env.region
+}]
+`)
+	files := map[string]string{
+		"envs/prod.yaml":    "replicas: 3\nregion: eu-west-1\n",
+		"envs/staging.json": `{"replicas": 1, "region": "us-east-1"}`,
+		"envs/dev.toml":     "replicas = 1\nregion = \"local\"\n",
+		"invalid/prod.yaml": "replicas: 10\nregion: eu-west-1\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		NewWithT(t).Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		NewWithT(t).Expect(os.WriteFile(path, []byte(data), 0o644)).To(Succeed())
+	}
+
+	build := func(dataFiles ...cuev1alpha1.DataFile) (*BuildResult, error) {
+		return buildInstance(BuildRequest{
+			Root: root,
+			Dir:  root,
+			Spec: cuev1alpha1.CueInstanceSpec{DataFiles: dataFiles},
+		})
+	}
+
+	t.Run("places the files under the path", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := build(cuev1alpha1.DataFile{Glob: "envs/*", Path: "envs"})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		regions := map[string]interface{}{}
+		for _, obj := range objects {
+			regions[obj.GetName()] = obj.Object["data"].(map[string]interface{})["region"]
+		}
+		g.Expect(regions).To(Equal(map[string]interface{}{
+			"dev":     "local",
+			"prod":    "eu-west-1",
+			"staging": "us-east-1",
+		}))
+	})
+
+	t.Run("validates the files against the package", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build(cuev1alpha1.DataFile{Glob: "invalid/*.yaml", Path: "envs"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("envs.prod.replicas"))
+	})
+
+	t.Run("rejects duplicate names", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build(cuev1alpha1.DataFile{Glob: "*/prod.yaml", Path: "envs"})
+		g.Expect(err).To(MatchError("data files 'envs/prod.yaml' and 'invalid/prod.yaml' have the same name"))
+	})
+
+	t.Run("rejects globs outside of the module", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := build(cuev1alpha1.DataFile{Glob: "../*.yaml", Path: "envs"})
+		g.Expect(err).To(MatchError(ContainSubstring("must be relative to the module root")))
+
+		_, err = build(cuev1alpha1.DataFile{Glob: "missing/*.yaml", Path: "envs"})
+		g.Expect(err).To(MatchError("no data files match 'missing/*.yaml'"))
+	})
+}
+
+func TestLimitBuilds(t *testing.T) {
+	g := NewWithT(t)
+
+	running, maxRunning := 0, 0
+	var mu sync.Mutex
+	build := func(BuildRequest) (*BuildResult, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &BuildResult{}, nil
+	}
+
+	slots := make(chan struct{}, 2)
+	limited := limitBuilds(context.TODO(), slots, build)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := limited(BuildRequest{})
+			g.Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+	wg.Wait()
+	g.Expect(maxRunning).To(BeNumerically("<=", 2))
+
+	t.Run("waiting builds are cancelled with their context", func(t *testing.T) {
+		g := NewWithT(t)
+
+		full := make(chan struct{}, 1)
+		full <- struct{}{}
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		_, err := limitBuilds(ctx, full, build)(BuildRequest{})
+		g.Expect(err).To(MatchError(ContainSubstring("waiting for a build slot")))
+	})
+}
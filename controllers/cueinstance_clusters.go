@@ -0,0 +1,188 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// isFanOut reports whether the CueInstance targets a list of clusters.
+func isFanOut(cueInstance cuev1alpha1.CueInstance) bool {
+	return len(cueInstance.Spec.KubeConfigs) > 0 || cueInstance.Spec.ClusterSelector != nil
+}
+
+// targetClusters returns the names of the clusters targeted by the CueInstance,
+// the clusters listed in spec.kubeConfigs come first followed by the clusters
+// selected by spec.clusterSelector in alphabetical order.
+func (r *CueInstanceReconciler) targetClusters(ctx context.Context, cueInstance cuev1alpha1.CueInstance) ([]string, error) {
+	if !isFanOut(cueInstance) {
+		return []string{clusterName(cueInstance)}, nil
+	}
+
+	seen := map[string]bool{}
+	clusters := make([]string, 0, len(cueInstance.Spec.KubeConfigs))
+	for _, kc := range cueInstance.Spec.KubeConfigs {
+		if !seen[kc.SecretRef.Name] {
+			seen[kc.SecretRef.Name] = true
+			clusters = append(clusters, kc.SecretRef.Name)
+		}
+	}
+
+	if cueInstance.Spec.ClusterSelector == nil {
+		return clusters, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(cueInstance.Spec.ClusterSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster selector: %w", err)
+	}
+
+	secrets := &metav1.PartialObjectMetadataList{}
+	secrets.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+	if err := r.List(ctx, secrets,
+		client.InNamespace(cueInstance.GetNamespace()),
+		client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		return nil, fmt.Errorf("unable to list KubeConfig secrets: %w", err)
+	}
+
+	selected := make([]string, 0, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		if !seen[secret.GetName()] {
+			seen[secret.GetName()] = true
+			selected = append(selected, secret.GetName())
+		}
+	}
+	sort.Strings(selected)
+
+	return append(clusters, selected...), nil
+}
+
+// clusterRollout is the order in which the targeted clusters are reconciled.
+type clusterRollout struct {
+	// clusters are sorted by group
+	clusters []string
+	// group holds the index of the group of each cluster
+	group map[string]int
+	// names holds the names of the groups
+	names []string
+}
+
+// orderClusters sorts the targeted clusters by the cluster groups of the
+// CueInstance, a cluster belongs to the first group selecting it and the
+// clusters which don't belong to any group form a last group.
+func (r *CueInstanceReconciler) orderClusters(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	clusters []string,
+) (clusterRollout, error) {
+	groups := cueInstance.Spec.ClusterGroups
+	if len(groups) == 0 {
+		return clusterRollout{clusters: clusters}, nil
+	}
+
+	// fetch the labels of the KubeConfig secrets once for the selectors
+	var clusterLabels map[string]labels.Set
+	for _, group := range groups {
+		if group.Selector == nil || clusterLabels != nil {
+			continue
+		}
+		secrets := &metav1.PartialObjectMetadataList{}
+		secrets.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+		if err := r.List(ctx, secrets, client.InNamespace(cueInstance.GetNamespace())); err != nil {
+			return clusterRollout{}, fmt.Errorf("unable to list KubeConfig secrets: %w", err)
+		}
+		clusterLabels = make(map[string]labels.Set, len(secrets.Items))
+		for _, secret := range secrets.Items {
+			clusterLabels[secret.GetName()] = secret.GetLabels()
+		}
+	}
+
+	rollout := clusterRollout{group: make(map[string]int, len(clusters))}
+	for i, group := range groups {
+		rollout.names = append(rollout.names, group.Name)
+
+		var selector labels.Selector
+		if group.Selector != nil {
+			var err error
+			selector, err = metav1.LabelSelectorAsSelector(group.Selector)
+			if err != nil {
+				return clusterRollout{}, fmt.Errorf("invalid selector of cluster group '%s': %w", group.Name, err)
+			}
+		}
+
+		members := make(map[string]bool, len(group.Clusters))
+		for _, cluster := range group.Clusters {
+			members[cluster] = true
+		}
+
+		for _, cluster := range clusters {
+			if _, ok := rollout.group[cluster]; ok {
+				continue
+			}
+			if members[cluster] || (selector != nil && selector.Matches(clusterLabels[cluster])) {
+				rollout.group[cluster] = i
+				rollout.clusters = append(rollout.clusters, cluster)
+			}
+		}
+	}
+
+	for _, cluster := range clusters {
+		if _, ok := rollout.group[cluster]; !ok {
+			rollout.group[cluster] = len(groups)
+			rollout.clusters = append(rollout.clusters, cluster)
+		}
+	}
+	rollout.names = append(rollout.names, "remaining")
+	return rollout, nil
+}
+
+// halted reports whether the rollout to the cluster is halted by the failure of a previous group.
+func (c clusterRollout) halted(cluster string, failedGroup int) bool {
+	return failedGroup >= 0 && c.group[cluster] > failedGroup
+}
+
+// requestsForKubeConfigSecret enqueues the CueInstances whose
+// cluster selector matches the labels of the given secret.
+func (r *CueInstanceReconciler) requestsForKubeConfigSecret(obj client.Object) []reconcile.Request {
+	var list cuev1alpha1.CueInstanceList
+	if err := r.List(context.Background(), &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, cueInstance := range list.Items {
+		if cueInstance.Spec.ClusterSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(cueInstance.Spec.ClusterSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cueInstance)})
+	}
+	return reqs
+}
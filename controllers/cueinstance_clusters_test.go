@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTargetClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	secret := func(name, namespace string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		}
+	}
+	fleet := map[string]string{"fleet": "prod"}
+
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&instance,
+			secret("us-west", "default", fleet),
+			secret("ap-south", "default", fleet),
+			secret("eu-west", "default", fleet),
+			secret("dev", "default", map[string]string{"fleet": "dev"}),
+			secret("other", "other", fleet),
+		).Build(),
+	}
+
+	kubeConfig := func(name string) cuev1alpha1.KubeConfig {
+		return cuev1alpha1.KubeConfig{SecretRef: meta.LocalObjectReference{Name: name}}
+	}
+
+	g.Expect(r.targetClusters(context.TODO(), instance)).To(Equal([]string{""}))
+
+	kc := kubeConfig("staging")
+	instance.Spec.KubeConfig = &kc
+	g.Expect(r.targetClusters(context.TODO(), instance)).To(Equal([]string{"staging"}))
+
+	instance.Spec.KubeConfigs = []cuev1alpha1.KubeConfig{kubeConfig("eu-west"), kubeConfig("us-east")}
+	g.Expect(r.targetClusters(context.TODO(), instance)).To(Equal([]string{"eu-west", "us-east"}))
+
+	instance.Spec.ClusterSelector = &metav1.LabelSelector{MatchLabels: fleet}
+	g.Expect(r.targetClusters(context.TODO(), instance)).To(Equal([]string{"eu-west", "us-east", "ap-south", "us-west"}))
+
+	instance.Spec.KubeConfigs = nil
+	g.Expect(r.targetClusters(context.TODO(), instance)).To(Equal([]string{"ap-south", "eu-west", "us-west"}))
+
+	t.Run("enqueues instances selecting a secret", func(t *testing.T) {
+		g := NewWithT(t)
+
+		selecting := instance.DeepCopy()
+		g.Expect(r.Update(context.TODO(), selecting)).To(Succeed())
+
+		g.Expect(r.requestsForKubeConfigSecret(secret("new", "default", fleet))).To(HaveLen(1))
+		g.Expect(r.requestsForKubeConfigSecret(secret("new", "default", nil))).To(BeEmpty())
+		g.Expect(r.requestsForKubeConfigSecret(secret("new", "other", fleet))).To(BeEmpty())
+	})
+}
+
+func TestOrderClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	secret := func(name string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		}
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			secret("us-west", map[string]string{"region": "us"}),
+			secret("us-east", map[string]string{"region": "us"}),
+			secret("eu-west", map[string]string{"region": "eu"}),
+			secret("dev", nil),
+		).Build(),
+	}
+
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	}
+	clusters := []string{"dev", "eu-west", "us-east", "us-west"}
+
+	rollout, err := r.orderClusters(context.TODO(), instance, clusters)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rollout.clusters).To(Equal(clusters))
+	g.Expect(rollout.halted("us-west", -1)).To(BeFalse())
+
+	instance.Spec.ClusterGroups = []cuev1alpha1.ClusterGroup{
+		{Name: "canary", Clusters: []string{"us-west"}},
+		{Name: "us", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "us"}}},
+		{Name: "eu", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"region": "eu"}}},
+	}
+	rollout, err = r.orderClusters(context.TODO(), instance, clusters)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rollout.clusters).To(Equal([]string{"us-west", "us-east", "eu-west", "dev"}))
+	g.Expect(rollout.group).To(Equal(map[string]int{"us-west": 0, "us-east": 1, "eu-west": 2, "dev": 3}))
+	g.Expect(rollout.names).To(Equal([]string{"canary", "us", "eu", "remaining"}))
+
+	// the failure of the canary halts the rollout to the other groups
+	g.Expect(rollout.halted("us-west", 0)).To(BeFalse())
+	g.Expect(rollout.halted("us-east", 0)).To(BeTrue())
+	g.Expect(rollout.halted("dev", 0)).To(BeTrue())
+	g.Expect(rollout.halted("dev", -1)).To(BeFalse())
+
+	instance.Spec.ClusterGroups = []cuev1alpha1.ClusterGroup{
+		{Name: "invalid", Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "region", Operator: "Unknown"}}}},
+	}
+	_, err = r.orderClusters(context.TODO(), instance, clusters)
+	g.Expect(err).To(MatchError(ContainSubstring("invalid selector of cluster group 'invalid'")))
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+// concreteError reports a field which is not concrete.
+// It implements the CUE error interface so that its path and
+// position are recorded in the build errors.
+type concreteError struct {
+	pos  token.Pos
+	path []string
+	msg  string
+}
+
+func (e *concreteError) Position() token.Pos          { return e.pos }
+func (e *concreteError) InputPositions() []token.Pos  { return nil }
+func (e *concreteError) Path() []string               { return e.path }
+func (e *concreteError) Msg() (string, []interface{}) { return e.msg, nil }
+
+func (e *concreteError) Error() string {
+	return fmt.Sprintf("%s: %s", strings.Join(e.path, "."), e.msg)
+}
+
+// requireConcrete returns an error listing the regular fields of value
+// which are incomplete or resolved by a default value.
+func requireConcrete(value cue.Value) error {
+	var errs cueerrors.Error
+	walkConcrete(value, func(v cue.Value, msg string) {
+		var path []string
+		for _, sel := range v.Path().Selectors() {
+			path = append(path, sel.String())
+		}
+		errs = cueerrors.Append(errs, &concreteError{pos: v.Pos(), path: path, msg: msg})
+	})
+	if errs == nil {
+		return nil
+	}
+	return errs
+}
+
+func walkConcrete(v cue.Value, report func(v cue.Value, msg string)) {
+	if _, ok := v.Default(); ok {
+		report(v, "value resolved by a default")
+		return
+	}
+
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		iter, err := v.Fields()
+		if err != nil {
+			report(v, err.Error())
+			return
+		}
+		for iter.Next() {
+			walkConcrete(iter.Value(), report)
+		}
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			report(v, err.Error())
+			return
+		}
+		for iter.Next() {
+			walkConcrete(iter.Value(), report)
+		}
+	default:
+		if !v.IsConcrete() {
+			report(v, fmt.Sprintf("incomplete value %v", v))
+		}
+	}
+}
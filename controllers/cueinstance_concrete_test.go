@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestRequireConcrete(t *testing.T) {
+	g := NewWithT(t)
+
+	root := writeCueModule(t, `package app
+
+out: {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+	data: {
+		level: string | *"info"
+		mode:  "debug"
+	}
+}
+`)
+
+	req := BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{Exprs: []string{"out"}},
+	}
+
+	result, err := buildInstance(req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(result.Manifests)).To(ContainSubstring("level: info"))
+
+	req.Spec.Build = &cuev1alpha1.BuildOptions{RequireConcrete: true}
+	result, err = buildInstance(req)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("expression 'out' is not concrete"))
+	g.Expect(result.Errors).To(HaveLen(1))
+	g.Expect(result.Errors[0].Path).To(Equal("out.data.level"))
+	g.Expect(result.Errors[0].Position).To(HavePrefix("app.cue:8:"))
+}
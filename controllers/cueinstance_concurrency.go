@@ -0,0 +1,105 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyConcurrently applies the objects with up to workers concurrent
+// server-side applies. The objects are applied in tiers following the
+// reconcile order of their kinds, e.g. all the ServiceAccounts before the
+// Deployments, and the objects of a tier are split among the workers.
+func applyConcurrently(ctx context.Context,
+	manager *ssa.ResourceManager,
+	objects []*unstructured.Unstructured,
+	opts ssa.ApplyOptions,
+	workers int,
+) (*ssa.ChangeSet, error) {
+	if workers <= 1 {
+		return manager.ApplyAll(ctx, objects, opts)
+	}
+
+	changeSet := ssa.NewChangeSet()
+	for _, tier := range applyTiers(objects) {
+		batches := splitBatches(tier, workers)
+		results := make([]*ssa.ChangeSet, len(batches))
+
+		g, gctx := errgroup.WithContext(ctx)
+		for i, batch := range batches {
+			i, batch := i, batch
+			g.Go(func() error {
+				cs, err := manager.ApplyAll(gctx, batch, opts)
+				results[i] = cs
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+
+		for _, cs := range results {
+			changeSet.Append(cs.Entries)
+		}
+	}
+	return changeSet, nil
+}
+
+// applyTiers sorts the objects and groups them by the position of their
+// kind in the reconcile order, the kinds which are not listed form a
+// single tier between the first and the last kinds.
+func applyTiers(objects []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	order := make(map[string]int, len(ssa.ReconcileOrder.First)+len(ssa.ReconcileOrder.Last))
+	for i, kind := range ssa.ReconcileOrder.First {
+		order[kind] = i - len(ssa.ReconcileOrder.First)
+	}
+	for i, kind := range ssa.ReconcileOrder.Last {
+		order[kind] = i + 1
+	}
+
+	sorted := make([]*unstructured.Unstructured, len(objects))
+	copy(sorted, objects)
+	sort.Sort(ssa.SortableUnstructureds(sorted))
+
+	var tiers [][]*unstructured.Unstructured
+	for i, obj := range sorted {
+		if i == 0 || order[obj.GetKind()] != order[sorted[i-1].GetKind()] {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], obj)
+	}
+	return tiers
+}
+
+// splitBatches splits the objects into at most n contiguous batches of similar size.
+func splitBatches(objects []*unstructured.Unstructured, n int) [][]*unstructured.Unstructured {
+	if n > len(objects) {
+		n = len(objects)
+	}
+
+	batches := make([][]*unstructured.Unstructured, 0, n)
+	for i := 0; i < n; i++ {
+		start, end := i*len(objects)/n, (i+1)*len(objects)/n
+		batches = append(batches, objects[start:end])
+	}
+	return batches
+}
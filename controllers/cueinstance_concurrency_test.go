@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyTiers(t *testing.T) {
+	g := NewWithT(t)
+
+	objects := []*unstructured.Unstructured{
+		newTestObject("apps/v1", "Deployment", "b"),
+		newTestObject("v1", "ServiceAccount", "app"),
+		newTestObject("example.com/v1", "Widget", "w"),
+		newTestObject("apps/v1", "Deployment", "a"),
+		newTestObject("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "hook"),
+		newTestObject("autoscaling/v2", "HorizontalPodAutoscaler", "a"),
+	}
+
+	var tiers [][]string
+	for _, tier := range applyTiers(objects) {
+		var ids []string
+		for _, obj := range tier {
+			ids = append(ids, obj.GetKind()+"/"+obj.GetName())
+		}
+		tiers = append(tiers, ids)
+	}
+	g.Expect(tiers).To(Equal([][]string{
+		{"ServiceAccount/app"},
+		{"Deployment/a", "Deployment/b"},
+		{"HorizontalPodAutoscaler/a", "Widget/w"},
+		{"ValidatingWebhookConfiguration/hook"},
+	}))
+}
+
+func TestSplitBatches(t *testing.T) {
+	objects := make([]*unstructured.Unstructured, 5)
+	for i := range objects {
+		objects[i] = newTestObject("v1", "ConfigMap", string(rune('a'+i)))
+	}
+
+	tests := []struct {
+		workers int
+		want    []int
+	}{
+		{workers: 1, want: []int{5}},
+		{workers: 2, want: []int{2, 3}},
+		{workers: 4, want: []int{1, 1, 1, 2}},
+		{workers: 8, want: []int{1, 1, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		g := NewWithT(t)
+
+		var sizes []int
+		var names []string
+		for _, batch := range splitBatches(objects, tt.workers) {
+			sizes = append(sizes, len(batch))
+			for _, obj := range batch {
+				names = append(names, obj.GetName())
+			}
+		}
+		g.Expect(sizes).To(Equal(tt.want), "workers: %d", tt.workers)
+		g.Expect(names).To(Equal([]string{"a", "b", "c", "d", "e"}))
+	}
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcilingAndStalledConditions(t *testing.T) {
+	g := NewWithT(t)
+
+	cueInstance := cuev1alpha1.CueInstance{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	conditionStatus := func(condition string) metav1.ConditionStatus {
+		c := apimeta.FindStatusCondition(cueInstance.Status.Conditions, condition)
+		if c == nil {
+			return ""
+		}
+		g.Expect(c.ObservedGeneration).To(Equal(cueInstance.Generation))
+		return c.Status
+	}
+
+	cueInstance = cuev1alpha1.CueInstanceProgressing(cueInstance, "reconciliation in progress")
+	g.Expect(conditionStatus(meta.ReconcilingCondition)).To(Equal(metav1.ConditionTrue))
+	g.Expect(conditionStatus(meta.ReadyCondition)).To(Equal(metav1.ConditionUnknown))
+	g.Expect(cueInstance.Status.ObservedGeneration).To(BeZero())
+
+	// terminal failures stall the reconciliation
+	cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/abc", cuev1alpha1.BuildFailedReason, "invalid value")
+	g.Expect(conditionStatus(meta.ReconcilingCondition)).To(BeEmpty())
+	g.Expect(conditionStatus(meta.ReadyCondition)).To(Equal(metav1.ConditionFalse))
+	g.Expect(conditionStatus(meta.StalledCondition)).To(Equal(metav1.ConditionTrue))
+	g.Expect(apimeta.FindStatusCondition(cueInstance.Status.Conditions, meta.StalledCondition).Reason).
+		To(Equal(cuev1alpha1.BuildFailedReason))
+	g.Expect(cueInstance.Status.ObservedGeneration).To(Equal(int64(2)))
+
+	// a new attempt clears the Stalled condition
+	cueInstance.Generation = 3
+	cueInstance = cuev1alpha1.CueInstanceProgressing(cueInstance, "reconciliation in progress")
+	g.Expect(conditionStatus(meta.StalledCondition)).To(BeEmpty())
+	g.Expect(cueInstance.Status.ObservedGeneration).To(Equal(int64(2)))
+
+	// transient failures are retried without stalling
+	cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/abc", cuev1alpha1.ArtifactFailedReason, "timeout")
+	g.Expect(conditionStatus(meta.ReadyCondition)).To(Equal(metav1.ConditionFalse))
+	g.Expect(conditionStatus(meta.StalledCondition)).To(BeEmpty())
+	g.Expect(conditionStatus(meta.ReconcilingCondition)).To(BeEmpty())
+
+	cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/abc", cuev1alpha1.PolicyViolationReason, "denied")
+	g.Expect(conditionStatus(meta.StalledCondition)).To(Equal(metav1.ConditionTrue))
+
+	cueInstance = cuev1alpha1.CueInstanceReadyInventory(cueInstance, NewInventory(), "main/def",
+		meta.ReconciliationSucceededReason, "Applied revision: main/def")
+	g.Expect(conditionStatus(meta.ReadyCondition)).To(Equal(metav1.ConditionTrue))
+	g.Expect(conditionStatus(meta.StalledCondition)).To(BeEmpty())
+	g.Expect(cueInstance.Status.ObservedGeneration).To(Equal(int64(3)))
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// conflictResolution returns the resolution of the field conflicts of the object.
+func conflictResolution(policy *cuev1alpha1.ConflictPolicy, obj *unstructured.Unstructured) (cuev1alpha1.ConflictResolution, error) {
+	if policy == nil {
+		return cuev1alpha1.ForceConflictResolution, nil
+	}
+
+	for _, rule := range policy.Rules {
+		ok, err := selectorMatches(rule.Target, obj)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return rule.Resolution, nil
+		}
+	}
+
+	if policy.Default == "" {
+		return cuev1alpha1.ForceConflictResolution, nil
+	}
+	return policy.Default, nil
+}
+
+// checkConflicts performs a server-side apply dry-run, without forcing the
+// ownership of the conflicting fields, of the objects whose conflicts must fail
+// the apply. Errors other than conflicts are left to be reported by the apply.
+func checkConflicts(ctx context.Context, kubeClient client.Client, fieldManager string, policy *cuev1alpha1.ConflictPolicy, objects []*unstructured.Unstructured) error {
+	if policy == nil {
+		return nil
+	}
+
+	var conflicts []string
+	for _, obj := range objects {
+		resolution, err := conflictResolution(policy, obj)
+		if err != nil {
+			return err
+		}
+		if resolution != cuev1alpha1.FailConflictResolution {
+			continue
+		}
+
+		// the objects opted out of management are not applied
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), existing); err == nil && ssa.AnyInMetadata(existing, ApplyExclusions()) {
+			continue
+		}
+
+		err = kubeClient.Patch(ctx, obj.DeepCopy(), client.Apply, client.DryRunAll, client.FieldOwner(fieldManager))
+		if apierrors.IsConflict(err) {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s", ssa.FmtUnstructured(obj), err))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("field conflicts detected:\n%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
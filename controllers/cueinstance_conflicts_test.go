@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestConflictResolution(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := newTestObject("apps/v1", "Deployment", "frontend")
+	service := newTestObject("v1", "Service", "frontend")
+
+	resolution, err := conflictResolution(nil, deployment)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolution).To(Equal(cuev1alpha1.ForceConflictResolution))
+
+	policy := &cuev1alpha1.ConflictPolicy{
+		Rules: []cuev1alpha1.ConflictRule{
+			{Target: cuev1alpha1.Selector{Kind: "Deployment"}, Resolution: cuev1alpha1.FailConflictResolution},
+		},
+	}
+	resolution, err = conflictResolution(policy, deployment)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolution).To(Equal(cuev1alpha1.FailConflictResolution))
+
+	resolution, err = conflictResolution(policy, service)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolution).To(Equal(cuev1alpha1.ForceConflictResolution))
+
+	policy.Default = cuev1alpha1.FailConflictResolution
+	policy.Rules[0].Resolution = cuev1alpha1.ForceConflictResolution
+	resolution, err = conflictResolution(policy, service)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolution).To(Equal(cuev1alpha1.FailConflictResolution))
+}
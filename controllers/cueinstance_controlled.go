@@ -0,0 +1,76 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// localClient returns the client of the cluster of the controller impersonating
+// the service account of the CueInstance, which writes the objects it controls.
+func (r *CueInstanceReconciler) localClient(ctx context.Context, cueInstance cuev1alpha1.CueInstance) (client.Client, error) {
+	impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount, r.ClientOptions)
+	kubeClient, _, err := impersonation.GetClientForCluster(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kube client: %w", err)
+	}
+	return kubeClient, nil
+}
+
+// createOrUpdateControlled creates or updates the object with the mutate function
+// and sets the CueInstance as its controller. An existing object which is not
+// controlled by the CueInstance is left untouched and an error is returned.
+func createOrUpdateControlled(ctx context.Context,
+	kubeClient client.Client,
+	scheme *runtime.Scheme,
+	cueInstance *cuev1alpha1.CueInstance,
+	obj client.Object,
+	mutate func() error,
+) (controllerutil.OperationResult, error) {
+	return controllerutil.CreateOrUpdate(ctx, kubeClient, obj, func() error {
+		if obj.GetResourceVersion() != "" && !metav1.IsControlledBy(obj, cueInstance) {
+			return errNotControlled(obj)
+		}
+		if err := mutate(); err != nil {
+			return err
+		}
+		return controllerutil.SetControllerReference(cueInstance, obj, scheme)
+	})
+}
+
+// deleteControlled deletes the object when it is controlled by the CueInstance.
+func deleteControlled(ctx context.Context, kubeClient client.Client, cueInstance *cuev1alpha1.CueInstance, obj client.Object) error {
+	if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, cueInstance) {
+		return errNotControlled(obj)
+	}
+	return client.IgnoreNotFound(kubeClient.Delete(ctx, obj))
+}
+
+func errNotControlled(obj client.Object) error {
+	return fmt.Errorf("'%s/%s' already exists and is not controlled by the CueInstance", obj.GetNamespace(), obj.GetName())
+}
@@ -17,24 +17,15 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha1"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"sort"
 	"strings"
 	"time"
 
-	"cuelang.org/go/cue"
-	"cuelang.org/go/cue/ast"
-	"cuelang.org/go/cue/cuecontext"
-	"cuelang.org/go/cue/load"
-	"cuelang.org/go/encoding/yaml"
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/runtime/acl"
@@ -42,8 +33,8 @@ import (
 	"github.com/fluxcd/pkg/runtime/metrics"
 	"github.com/fluxcd/pkg/runtime/predicates"
 	"github.com/fluxcd/pkg/ssa"
-	"github.com/fluxcd/pkg/untar"
 	"github.com/hashicorp/go-retryablehttp"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -71,17 +62,74 @@ import (
 // CueInstanceReconciler reconciles a CueInstance object
 type CueInstanceReconciler struct {
 	client.Client
+	// APIReader reads from the API server without the cache of the manager,
+	// for the objects of arbitrary kinds the controller doesn't watch.
+	APIReader             client.Reader
 	httpClient            *retryablehttp.Client
+	buildSlots            chan struct{}
+	artifactCache         *artifactCache
+	schemaCache           *schemaCache
+	openAPICache          *openAPICache
 	requeueDependency     time.Duration
+	intervalJitter        int
+	eventFilter           *eventFilter
+	priorityGate          *priorityGate
 	Scheme                *runtime.Scheme
 	EventRecorder         kuberecorder.EventRecorder
 	ExternalEventRecorder *events.Recorder
 	MetricsRecorder       *metrics.Recorder
+	Metrics               *Metrics
 	StatusPoller          *polling.StatusPoller
 	ControllerName        string
+	// FieldManager is the server-side apply field manager of the applied
+	// objects, it defaults to the controller name.
+	FieldManager          string
 	statusManager         string
 	NoCrossNamespaceRefs  bool
 	DefaultServiceAccount string
+	// ClientOptions holds the rate limits of the clients impersonating
+	// service accounts and of the clients of the remote clusters.
+	ClientOptions ClientOptions
+	// AllowedNamespaces restricts the namespaces the objects of
+	// all the CueInstances may target, as a list of shell patterns.
+	AllowedNamespaces []string
+	// ClusterScopedNamespaces restricts the namespaces of the CueInstances
+	// which may apply cluster-scoped objects, as a list of shell patterns.
+	ClusterScopedNamespaces []string
+	// KindPolicy restricts the kinds of the objects of all the CueInstances.
+	KindPolicy KindPolicy
+	// ReadOnly makes the controller build the CueInstances and report the
+	// changes they would make without ever mutating the clusters.
+	ReadOnly bool
+	// ValidationReports makes the controller write a ValidationReport
+	// with the validation results of each CueInstance.
+	ValidationReports bool
+	// ClientSideValidation makes the controller validate the objects against
+	// the OpenAPI schemas of the clusters before they are dry-run.
+	ClientSideValidation bool
+	// ApplyConcurrency is the maximum number of objects of a CueInstance
+	// applied concurrently, following the reconcile order of their kinds.
+	ApplyConcurrency int
+	// MaxConcurrentBuilds is the maximum number of CUE builds run at once by
+	// all the reconciliations, the others wait for a slot. Zero is unlimited.
+	MaxConcurrentBuilds int
+	// ApplyChunkSize is the number of objects of a CueInstance applied before
+	// the progress is reported in its status, zero applies all of them at once.
+	ApplyChunkSize int
+	// ProfileNamespace is the namespace of the ProfileConfigs
+	// available to the CueInstances of all namespaces.
+	ProfileNamespace string
+	Sandbox          SandboxOptions
+	// Extract holds the default limits of the artifact extraction.
+	Extract ExtractOptions
+	// PruneProtection lists the objects the garbage collection never deletes.
+	PruneProtection PruneProtection
+	// StallAfterFailures is the number of consecutive identical failures after
+	// which a CueInstance is marked as Stalled, zero never stalls them.
+	StallAfterFailures int
+	// LocalSourceRoot is the directory of the Directory sources,
+	// they are disabled when empty.
+	LocalSourceRoot string
 }
 
 // CueInstanceReconcilerOptions options
@@ -89,15 +137,33 @@ type CueInstanceReconcilerOptions struct {
 	MaxConcurrentReconciles   int
 	HTTPRetry                 int
 	DependencyRequeueInterval time.Duration
+	// IntervalJitterPercentage is the maximum percentage by which
+	// the reconcile intervals are randomly shifted.
+	IntervalJitterPercentage int
+	EventFilter              EventFilterOptions
+	ArtifactDownload         ArtifactDownloadOptions
+	ArtifactCache            ArtifactCacheOptions
+	// WatchImagePolicies reconciles the CueInstances whose tags are sourced
+	// from ImagePolicies when a new image is selected, it requires the Flux
+	// image automation CRDs to be installed.
+	WatchImagePolicies bool
+	// PriorityQueueSize is the number of reconciliations started ahead of
+	// the free workers and held until one of them is available, so that they
+	// run by order of priority. Zero disables the priorities.
+	PriorityQueueSize int
 }
 
 //+kubebuilder:rbac:groups=cue.contrib.flux.io,resources=cueinstances,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=cue.contrib.flux.io,resources=cueinstances/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cue.contrib.flux.io,resources=cueinstances/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cue.contrib.flux.io,resources=profileconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cue.contrib.flux.io,resources=validationreports,verbs=get;list;watch;create;update;patch;delete
 
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=buckets;gitrepositories,verbs=get;list;watch
 // +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=buckets/status;gitrepositories/status,verbs=get
+// +kubebuilder:rbac:groups=image.toolkit.fluxcd.io,resources=imagepolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=configmaps;secrets;serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // SetupWithManager sets up the controller with the Manager.
@@ -105,6 +171,7 @@ type CueInstanceReconcilerOptions struct {
 func (r *CueInstanceReconciler) SetupWithManager(mgr ctrl.Manager, opts CueInstanceReconcilerOptions) error {
 	const (
 		gitRepositoryIndexKey string = ".metadata.gitRepository"
+		bucketIndexKey        string = ".metadata.bucket"
 	)
 
 	// Index the CueInstance by the GitRepository references they (may) point at.
@@ -113,29 +180,116 @@ func (r *CueInstanceReconciler) SetupWithManager(mgr ctrl.Manager, opts CueInsta
 		return fmt.Errorf("failed setting index fields: %w", err)
 	}
 
+	// Index the CueInstance by the Bucket references they (may) point at.
+	if err := mgr.GetCache().IndexField(context.TODO(), &cuev1alpha1.CueInstance{}, bucketIndexKey,
+		r.indexBy(sourcev1.BucketKind)); err != nil {
+		return fmt.Errorf("failed setting index fields: %w", err)
+	}
+
+	// Index the CueInstance by the Secrets and ConfigMaps they reference.
+	if err := mgr.GetCache().IndexField(context.TODO(), &cuev1alpha1.CueInstance{}, secretIndexKey,
+		r.indexSecretRefs); err != nil {
+		return fmt.Errorf("failed setting index fields: %w", err)
+	}
+	if err := mgr.GetCache().IndexField(context.TODO(), &cuev1alpha1.CueInstance{}, configMapIndexKey,
+		r.indexConfigMapRefs); err != nil {
+		return fmt.Errorf("failed setting index fields: %w", err)
+	}
+
+	// Index the CueInstance by the CueInstances their values are sourced from.
+	if err := mgr.GetCache().IndexField(context.TODO(), &cuev1alpha1.CueInstance{}, valuesFromIndexKey,
+		r.indexValuesFrom); err != nil {
+		return fmt.Errorf("failed setting index fields: %w", err)
+	}
+
+	// Index the CueInstance by the ImagePolicies their tags are sourced from.
+	if opts.WatchImagePolicies {
+		if err := mgr.GetCache().IndexField(context.TODO(), &cuev1alpha1.CueInstance{}, imagePolicyIndexKey,
+			r.indexImagePolicyRefs); err != nil {
+			return fmt.Errorf("failed setting index fields: %w", err)
+		}
+	}
+
 	r.requeueDependency = opts.DependencyRequeueInterval
+	r.intervalJitter = opts.IntervalJitterPercentage
+	r.eventFilter = newEventFilter(opts.EventFilter)
 
 	r.statusManager = fmt.Sprintf("gotk-%s", r.ControllerName)
 
 	// Configure the retryable http client used for fetching artifacts.
-	// By default it retries 10 times within a 3.5 minutes window.
-	httpClient := retryablehttp.NewClient()
-	httpClient.RetryWaitMin = 5 * time.Second
-	httpClient.RetryWaitMax = 30 * time.Second
-	httpClient.RetryMax = opts.HTTPRetry
-	httpClient.Logger = nil
+	httpClient, err := newArtifactHTTPClient(opts.HTTPRetry, opts.ArtifactDownload)
+	if err != nil {
+		return err
+	}
 	r.httpClient = httpClient
+	if r.MaxConcurrentBuilds > 0 {
+		r.buildSlots = make(chan struct{}, r.MaxConcurrentBuilds)
+	}
+	if r.artifactCache, err = newArtifactCache(opts.ArtifactCache); err != nil {
+		return err
+	}
+	r.schemaCache = newSchemaCache()
+	r.openAPICache = newOpenAPICache()
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&cuev1alpha1.CueInstance{}, builder.WithPredicates(
-			predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{}),
+			predicate.Or(
+				predicate.GenerationChangedPredicate{},
+				predicates.ReconcileRequestedPredicate{},
+				ForceRequestedPredicate{},
+				ApprovalPredicate{},
+				RollbackRequestedPredicate{},
+			),
 		)).
 		Watches(
 			&source.Kind{Type: &sourcev1.GitRepository{}},
 			handler.EnqueueRequestsFromMapFunc(r.requestsForRevisionChangeOf(gitRepositoryIndexKey)),
 			builder.WithPredicates(SourceRevisionChangePredicate{}),
 		).
-		WithOptions(controller.Options{MaxConcurrentReconciles: opts.MaxConcurrentReconciles}).
+		Watches(
+			&source.Kind{Type: &sourcev1.Bucket{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForRevisionChangeOf(bucketIndexKey)),
+			builder.WithPredicates(SourceRevisionChangePredicate{}),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForKubeConfigSecret),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForReferenceOf(secretIndexKey)),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForReferenceOf(configMapIndexKey)),
+			builder.OnlyMetadata,
+		).
+		Watches(
+			&source.Kind{Type: &cuev1alpha1.ProfileConfig{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForProfileConfig),
+		).
+		Watches(
+			&source.Kind{Type: &cuev1alpha1.CueInstance{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForOutputsOf),
+			builder.WithPredicates(OutputsChangePredicate{}),
+		)
+	if opts.WatchImagePolicies {
+		b = b.Watches(
+			&source.Kind{Type: newImagePolicy()},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForReferenceOf(imagePolicyIndexKey)),
+			builder.WithPredicates(ImagePolicyChangePredicate{}),
+		)
+	}
+	workers := opts.MaxConcurrentReconciles
+	if opts.PriorityQueueSize > 0 {
+		// dequeue more instances than can be reconciled concurrently,
+		// the gate then admits them by priority
+		r.priorityGate = newPriorityGate(workers)
+		workers += opts.PriorityQueueSize
+	}
+	return b.WithOptions(controller.Options{MaxConcurrentReconciles: workers}).
 		Complete(r)
 }
 
@@ -146,14 +300,26 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	var cueInstance cuev1alpha1.CueInstance
 	if err := r.Get(ctx, req.NamespacedName, &cueInstance); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.eventFilter.forget(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// wait for a free worker, the instances of higher priority first
+	if r.priorityGate != nil {
+		release, err := r.priorityGate.acquire(ctx, cueInstance.Spec.Priority)
+		if err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+		defer release()
+	}
+
 	// Record suspended status metric
 	defer r.recordSuspension(ctx, cueInstance)
 
-	// Add our finalizer if it does not exist
-	if !controllerutil.ContainsFinalizer(&cueInstance, cuev1alpha1.CueInstanceFinalizer) {
+	// Add our finalizer if it does not exist, a read-only controller never garbage collects
+	if !r.ReadOnly && !controllerutil.ContainsFinalizer(&cueInstance, cuev1alpha1.CueInstanceFinalizer) {
 		patch := client.MergeFrom(cueInstance.DeepCopy())
 		controllerutil.AddFinalizer(&cueInstance, cuev1alpha1.CueInstanceFinalizer)
 		if err := r.Patch(ctx, &cueInstance, patch); err != nil {
@@ -167,6 +333,14 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return r.finalize(ctx, cueInstance)
 	}
 
+	// Record suspend and resume transitions.
+	if r.recordSuspendTransition(ctx, &cueInstance) {
+		if err := r.patchStatus(ctx, req, cueInstance.Status); err != nil {
+			log.Error(err, "unable to update status for suspension")
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
 	// Return early if the CueInstance is suspended.
 	if cueInstance.Spec.Suspend {
 		log.Info("Reconciliation is suspended for this object")
@@ -185,7 +359,7 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			r.recordReadiness(ctx, cueInstance)
 			log.Info(msg)
 			// do not requeue immediately, when the source is created the watcher should trigger a reconciliation
-			return ctrl.Result{RequeueAfter: cueInstance.GetRetryInterval()}, nil
+			return ctrl.Result{RequeueAfter: withJitter(cueInstance.GetRetryInterval(), r.intervalJitter)}, nil
 		}
 
 		// retry on transient errors
@@ -203,12 +377,12 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		r.recordReadiness(ctx, cueInstance)
 		log.Info(msg)
 		// do not requeue immediately, when the artifact is created the watcher should trigger a reconciliation
-		return ctrl.Result{RequeueAfter: cueInstance.GetRetryInterval()}, nil
+		return ctrl.Result{RequeueAfter: withJitter(cueInstance.GetRetryInterval(), r.intervalJitter)}, nil
 	}
 
 	// check dependencies
-	if len(cueInstance.Spec.DependsOn) > 0 {
-		if err := r.checkDependencies(source, cueInstance); err != nil {
+	if len(cueInstance.Spec.DependsOn) > 0 || len(cueInstance.Spec.ValuesFrom) > 0 {
+		if err := r.checkDependencies(ctx, source, cueInstance); err != nil {
 			cueInstance = cuev1alpha1.CueInstanceNotReady(
 				cueInstance, source.GetArtifact().Revision, meta.DependencyNotReadyReason, err.Error())
 			if err := r.patchStatus(ctx, req, cueInstance.Status); err != nil {
@@ -236,6 +410,7 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// set the reconciliation status to progressing
+	lastReady := apimeta.FindStatusCondition(cueInstance.Status.Conditions, meta.ReadyCondition).DeepCopy()
 	cueInstance = cuev1alpha1.CueInstanceProgressing(cueInstance, "reconciliation in progress")
 	if err := r.patchStatus(ctx, req, cueInstance.Status); err != nil {
 		return ctrl.Result{Requeue: true}, err
@@ -244,32 +419,48 @@ func (r *CueInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// reconcile cueInstance by applying the latest revision
 	reconciledCueInstance, reconcileErr := r.reconcile(ctx, *cueInstance.DeepCopy(), source)
+	r.recordFailures(&reconciledCueInstance, lastReady, reconcileErr)
 	if err := r.patchStatus(ctx, req, reconciledCueInstance.Status); err != nil {
 		return ctrl.Result{Requeue: true}, err
 	}
 	r.recordReadiness(ctx, reconciledCueInstance)
+	r.recordInventory(ctx, reconciledCueInstance)
 
-	// broadcast the reconciliation failure and requeue at the specified retry interval
+	// broadcast the reconciliation failure and requeue at the specified retry interval,
+	// policy violations and stalled reconciliations are not retried before the next interval
 	if reconcileErr != nil {
+		retryInterval := cueInstance.GetRetryInterval()
+		if errors.Is(reconcileErr, errPolicyViolation) ||
+			apimeta.IsStatusConditionTrue(reconciledCueInstance.Status.Conditions, meta.StalledCondition) {
+			retryInterval = cueInstance.Spec.Interval.Duration
+		}
 		log.Error(reconcileErr, fmt.Sprintf("Reconciliation failed after %s, next try in %s",
 			time.Since(reconcileStart).String(),
-			cueInstance.GetRetryInterval().String()),
+			retryInterval.String()),
 			"revision",
 			source.GetArtifact().Revision)
-		r.event(ctx, reconciledCueInstance, source.GetArtifact().Revision, events.EventSeverityError,
-			reconcileErr.Error(), nil)
-		return ctrl.Result{RequeueAfter: cueInstance.GetRetryInterval()}, nil
+		r.resultEvent(ctx, reconciledCueInstance, source.GetArtifact().Revision, events.EventSeverityError,
+			reconcileErr.Error(), commitStatusMetadata(reconciledCueInstance, reconcileErr.Error()))
+		return ctrl.Result{RequeueAfter: withJitter(retryInterval, r.intervalJitter)}, nil
 	}
 
 	// broadcast the reconciliation result and requeue at the specified interval
 	msg := fmt.Sprintf("Reconciliation finished in %s, next run in %s",
 		time.Since(reconcileStart).String(),
 		cueInstance.Spec.Interval.Duration.String())
+	if s := reconciledCueInstance.Status.LastApplySummary; s != nil && s.Revision == source.GetArtifact().Revision {
+		msg = fmt.Sprintf("%s: %s", msg, applySummaryMessage(*s))
+	}
 	log.Info(msg, "revision", source.GetArtifact().Revision)
-	r.event(ctx, reconciledCueInstance, source.GetArtifact().Revision, events.EventSeverityInfo,
-		msg, map[string]string{"commit_status": "update"})
+	summary := msg
+	if c := apimeta.FindStatusCondition(reconciledCueInstance.Status.Conditions, meta.ReadyCondition); c != nil {
+		summary = c.Message
+	}
+	metadata := commitStatusMetadata(reconciledCueInstance, summary)
+	metadata["checksum"] = reconciledCueInstance.Status.LastAppliedChecksum
+	r.resultEvent(ctx, reconciledCueInstance, source.GetArtifact().Revision, events.EventSeverityInfo, msg, metadata)
 
-	return ctrl.Result{RequeueAfter: cueInstance.Spec.Interval.Duration}, nil
+	return ctrl.Result{RequeueAfter: withJitter(cueInstance.Spec.Interval.Duration, r.intervalJitter)}, nil
 }
 
 func (r *CueInstanceReconciler) reconcile(
@@ -281,8 +472,42 @@ func (r *CueInstanceReconciler) reconcile(
 		cueInstance.Status.SetLastHandledReconcileRequest(v)
 	}
 
+	// recreate objects with immutable field changes if configured,
+	// or if a one-shot force apply has been requested, the request
+	// is handled once the objects have been applied with it
+	_, forceRequested := cueInstance.ForceRequested()
+	force := cueInstance.Spec.Force || forceRequested
+
 	revision := source.GetArtifact().Revision
 
+	// record the durations of the reconciliation phases
+	durations := &cuev1alpha1.PhaseDurations{}
+	cueInstance.Status.LastPhaseDurations = durations
+
+	// apply the snapshot of the revision of the history requested
+	// for a rollback instead of the objects rendered from the source
+	if target, ok := cueInstance.RollbackRequested(); ok {
+		snap, err := r.historySnapshot(ctx, cueInstance, target)
+		if err != nil {
+			return cuev1alpha1.CueInstanceNotReady(
+				cueInstance,
+				revision,
+				meta.ReconciliationFailedReason,
+				err.Error(),
+			), err
+		}
+		// the snapshot was rendered under the policies of its revision
+		if reason, err := r.checkObjectPlacement(ctx, cueInstance, snap.objects); err != nil {
+			return cuev1alpha1.CueInstanceNotReady(
+				cueInstance,
+				revision,
+				reason,
+				err.Error(),
+			), err
+		}
+		return r.reconcileObjects(ctx, cueInstance, snap.revision, snap.checksum, snap.objects, force)
+	}
+
 	// create tmp dir
 	tmpDir, err := os.MkdirTemp("", cueInstance.Name)
 	if err != nil {
@@ -297,7 +522,9 @@ func (r *CueInstanceReconciler) reconcile(
 	defer os.RemoveAll(tmpDir)
 
 	// download artifact and extract files
-	err = r.download(source.GetArtifact(), tmpDir)
+	fetchStart := time.Now()
+	err = r.download(ctx, source.GetArtifact(), tmpDir, r.Extract.withOverrides(cueInstance.Spec.Extract))
+	addPhaseDuration(&durations.Fetch, time.Since(fetchStart))
 	if err != nil {
 		return cuev1alpha1.CueInstanceNotReady(
 			cueInstance,
@@ -348,22 +575,42 @@ func (r *CueInstanceReconciler) reconcile(
 		), err
 	}
 
-	// setup a Kubernetes client
-	// setup the Kubernetes client for impersonation
-	impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount)
-	kubeClient, statusPoller, err := impersonation.GetClient(ctx)
-	if err != nil {
+	// refuse to build with a CUE version which may evaluate the module differently
+	if err := checkModuleCueVersion(moduleRootPath, cueInstance.Spec.CueVersionConstraint); err != nil {
 		return cuev1alpha1.CueInstanceNotReady(
 			cueInstance,
 			revision,
-			meta.ReconciliationFailedReason,
+			cuev1alpha1.CueVersionUnsupportedReason,
 			err.Error(),
-		), fmt.Errorf("failed to build kube client: %w", err)
+		), err
 	}
 
 	// build the cueInstance
-	resources, err := r.build(ctx, revision, moduleRootPath, dirPath, &cueInstance)
+	buildStart := time.Now()
+	buildResult, err := r.build(ctx, revision, moduleRootPath, dirPath, &cueInstance)
+	buildDuration := time.Since(buildStart)
+	if buildResult != nil && buildResult.ValidationDuration > 0 {
+		buildDuration -= buildResult.ValidationDuration
+		addPhaseDuration(&durations.Validate, buildResult.ValidationDuration)
+	}
+	addPhaseDuration(&durations.Build, buildDuration)
+	cueInstance.Status.Variants = nil
+	report := &validationReport{}
+	defer r.recordValidation(ctx, cueInstance, report)
+	if buildResult != nil {
+		cueInstance.Status.Variants = buildResult.Variants
+		for _, v := range buildResult.Validation {
+			report.add(v.Subject, "schema", v.Mode, v.Message)
+		}
+	}
 	if err != nil {
+		cueInstance.Status.BuildErrors = nil
+		if buildResult != nil {
+			cueInstance.Status.BuildErrors = buildResult.Errors
+		}
+		if len(report.results) > 0 {
+			r.writeValidationReport(ctx, cueInstance, revision, report, nil)
+		}
 		return cuev1alpha1.CueInstanceNotReady(
 			cueInstance,
 			revision,
@@ -372,8 +619,17 @@ func (r *CueInstanceReconciler) reconcile(
 		), err
 	}
 
+	cueInstance.Status.BuildErrors = nil
+
+	var warnings []string
+	for _, v := range buildResult.Validation {
+		if v.Mode == cuev1alpha1.WarnPolicy {
+			warnings = append(warnings, v.Message)
+		}
+	}
+
 	// convert the build result into Kubernetes unstructured objects
-	objects, err := ssa.ReadObjects(bytes.NewReader(resources))
+	objects, err := readObjects(cueInstance, buildResult.Manifests)
 	if err != nil {
 		return cuev1alpha1.CueInstanceNotReady(
 			cueInstance,
@@ -383,43 +639,154 @@ func (r *CueInstanceReconciler) reconcile(
 		), err
 	}
 
-	// create a snapshot of the current inventory
-	oldStatus := cueInstance.Status.DeepCopy()
+	// evaluate the policies of the CueInstance against the objects
+	kept, policyWarnings, err := r.enforceObjectPolicies(ctx, cueInstance, revision, objects, report)
+	if err != nil {
+		r.writeValidationReport(ctx, cueInstance, revision, report, objects)
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			cuev1alpha1.PolicyViolationReason,
+			err.Error(),
+		), err
+	}
+	objects = kept
+	warnings = append(warnings, policyWarnings...)
 
-	// create the server-side apply manager
-	resourceManager := ssa.NewResourceManager(kubeClient, statusPoller, ssa.Owner{
-		Field: r.ControllerName,
-		Group: cuev1alpha1.GroupVersion.Group,
-	})
-	resourceManager.SetOwnerLabels(objects, cueInstance.GetName(), cueInstance.GetNamespace())
+	// evaluate the rego policies of the source against the objects
+	kept, regoWarnings, err := r.enforceRegoPolicies(ctx, cueInstance, revision, tmpDir, objects, report)
+	if err != nil {
+		r.writeValidationReport(ctx, cueInstance, revision, report, objects)
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			cuev1alpha1.PolicyViolationReason,
+			err.Error(),
+		), err
+	}
 
-	// validate and apply resources in stages
-	_, changeSet, err := r.apply(ctx, resourceManager, cueInstance, revision, objects)
+	objects = kept
+	warnings = append(warnings, regoWarnings...)
+	setValidationWarningCondition(&cueInstance, warnings)
+	r.writeValidationReport(ctx, cueInstance, revision, report, objects)
+
+	// enforce the namespaces, kinds and scopes the objects are allowed to have
+	if reason, err := r.checkObjectPlacement(ctx, cueInstance, objects); err != nil {
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			reason,
+			err.Error(),
+		), err
+	}
+
+	// compute the digest of the rendered object set
+	checksum, err := checksumObjects(objects)
 	if err != nil {
 		return cuev1alpha1.CueInstanceNotReady(
 			cueInstance,
 			revision,
+			cuev1alpha1.BuildFailedReason,
+			err.Error(),
+		), err
+	}
+
+	// the objects rolled back after failing their health checks
+	// are not applied again until they or the spec change
+	if rolledBack(cueInstance, checksum) {
+		err := fmt.Errorf("revision %s was rolled back after failing its health checks, waiting for a new revision", revision)
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			cuev1alpha1.RolledBackReason,
+			err.Error(),
+		), err
+	}
+
+	// commit the manifests to Git instead of applying them
+	if renderTo := cueInstance.Spec.RenderTo; renderTo != nil && renderTo.SkipApply && !r.ReadOnly {
+		rendered, err := r.renderToGit(ctx, cueInstance, revision, checksum, objects)
+		if err != nil {
+			return cuev1alpha1.CueInstanceNotReady(
+				cueInstance,
+				revision,
+				meta.ReconciliationFailedReason,
+				err.Error(),
+			), err
+		}
+		cueInstance.Status.LastRendered = rendered
+		cuev1alpha1.SetCueInstanceReadiness(&cueInstance, metav1.ConditionTrue, cuev1alpha1.RenderedReason,
+			fmt.Sprintf("Rendered revision %s to commit %s", revision, rendered.Commit), revision)
+		return cueInstance, nil
+	}
+
+	reconciled, err := r.reconcileObjects(ctx, cueInstance, revision, checksum, objects, force)
+	if err != nil || r.ReadOnly || !apimeta.IsStatusConditionTrue(reconciled.Status.Conditions, meta.ReadyCondition) {
+		return reconciled, err
+	}
+
+	// write the outputs once the objects are applied and ready
+	outputsChecksum, err := r.writeOutputs(ctx, reconciled, revision, buildResult.Outputs)
+	if err != nil {
+		return cuev1alpha1.CueInstanceNotReady(
+			reconciled,
+			revision,
 			meta.ReconciliationFailedReason,
 			err.Error(),
 		), err
 	}
+	reconciled.Status.OutputsChecksum = outputsChecksum
 
-	// create an inventory of objects to be reconciled
-	newInventory := NewInventory()
-	err = AddObjectsToInventory(newInventory, changeSet)
+	// publish the manifests of the applied revision
+	published, err := r.publish(ctx, reconciled, revision, checksum, objects)
 	if err != nil {
 		return cuev1alpha1.CueInstanceNotReady(
-			cueInstance,
+			reconciled,
 			revision,
 			meta.ReconciliationFailedReason,
 			err.Error(),
 		), err
 	}
+	reconciled.Status.LastPublished = published
 
-	// detect stale objects which are subject to garbage collection
-	var staleObjects []*unstructured.Unstructured
-	if oldStatus.Inventory != nil {
-		diffObjects, err := DiffInventory(oldStatus.Inventory, newInventory)
+	// commit the manifests of the applied revision to Git
+	rendered, err := r.renderToGit(ctx, reconciled, revision, checksum, objects)
+	if err != nil {
+		return cuev1alpha1.CueInstanceNotReady(
+			reconciled,
+			revision,
+			meta.ReconciliationFailedReason,
+			err.Error(),
+		), err
+	}
+	reconciled.Status.LastRendered = rendered
+	return reconciled, nil
+}
+
+// reconcileObjects applies the objects rendered from the revision to the
+// targeted clusters, garbage collects the stale objects and runs the health checks.
+func (r *CueInstanceReconciler) reconcileObjects(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision, checksum string,
+	objects []*unstructured.Unstructured,
+	force bool,
+) (cuev1alpha1.CueInstance, error) {
+	// load the snapshot of the last applied revision to roll back to
+	var lastSnapshot *snapshot
+	if cueInstance.Spec.RollbackOnFailure && !r.ReadOnly && cueInstance.Status.LastAppliedChecksum != "" {
+		var err error
+		lastSnapshot, err = r.readSnapshot(ctx, cueInstance, snapshotName(cueInstance, cueInstance.Status.LastAppliedChecksum))
+		if err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "unable to read the snapshot, rollbacks are disabled")
+		}
+	}
+
+	// gate the applies on the approval of their plan
+	id := planID(cueInstance.Generation, revision, checksum)
+	gated := false
+	if !r.ReadOnly {
+		var err error
+		gated, err = approvalRequired(cueInstance, id, revision)
 		if err != nil {
 			return cuev1alpha1.CueInstanceNotReady(
 				cueInstance,
@@ -428,285 +795,603 @@ func (r *CueInstanceReconciler) reconcile(
 				err.Error(),
 			), err
 		}
+	}
 
-		// TODO: remove this workaround after kustomize-controller 0.18 release
-		// skip objects that were wrongly marked as namespaced
-		// https://github.com/fluxcd/kustomize-controller/issues/466
-		newObjects, _ := ListObjectsInInventory(newInventory)
-		for _, obj := range diffObjects {
-			preserve := false
-			if obj.GetNamespace() != "" {
-				for _, newObj := range newObjects {
-					if newObj.GetNamespace() == "" &&
-						obj.GetKind() == newObj.GetKind() &&
-						obj.GetAPIVersion() == newObj.GetAPIVersion() &&
-						obj.GetName() == newObj.GetName() {
-						preserve = true
-						break
-					}
-				}
+	// create a snapshot of the current inventory
+	oldStatus := cueInstance.Status.DeepCopy()
+
+	// setup the Kubernetes client for impersonation
+	impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount, r.ClientOptions)
+
+	// apply the objects to each of the targeted clusters
+	clusters, err := r.targetClusters(ctx, cueInstance)
+	if err != nil {
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			meta.ReconciliationFailedReason,
+			err.Error(),
+		), err
+	}
+	fanOut := isFanOut(cueInstance)
+
+	// roll out to the cluster groups in order
+	rollout, err := r.orderClusters(ctx, cueInstance, clusters)
+	if err != nil {
+		return cuev1alpha1.CueInstanceNotReady(
+			cueInstance,
+			revision,
+			meta.ReconciliationFailedReason,
+			err.Error(),
+		), err
+	}
+	failedGroup := -1
+	var halted int
+
+	newInventory := NewInventory()
+	clusterStatuses := make([]cuev1alpha1.ClusterStatus, 0, len(clusters))
+	var pendingChanges []cuev1alpha1.PendingChange
+	var (
+		failures         []string
+		failedReason     string
+		failedResult     *clusterResult
+		healthErrors     []string
+		healthChecked    bool
+		objectsHealth    *cuev1alpha1.InventoryHealth
+		awaitingApproval bool
+		planDiff         strings.Builder
+		rolledBackOn     []string
+		pruned           int
+		driftDetected    int
+		driftCorrected   int
+		applySummary     *cuev1alpha1.ApplySummary
+		applied          bool
+	)
+	for _, cluster := range rollout.clusters {
+		// leave the clusters of the next groups untouched once a group has failed
+		if rollout.halted(cluster, failedGroup) {
+			halted++
+			if oldStatus.Inventory != nil {
+				newInventory.Entries = append(newInventory.Entries, FilterInventory(oldStatus.Inventory, cluster).Entries...)
 			}
-			if !preserve {
-				staleObjects = append(staleObjects, obj)
+			status := cuev1alpha1.ClusterStatus{Name: cluster}
+			if prev := oldStatus.GetClusterStatus(cluster); prev != nil {
+				status = *prev
 			}
+			status.Ready = false
+			status.Reason = meta.DependencyNotReadyReason
+			status.Message = fmt.Sprintf("Rollout halted, cluster group '%s' is not ready", rollout.names[failedGroup])
+			clusterStatuses = append(clusterStatuses, status)
+			continue
 		}
+
+		lastAppliedChecksum := oldStatus.LastAppliedChecksum
+		if fanOut {
+			lastAppliedChecksum = ""
+			if cs := oldStatus.GetClusterStatus(cluster); cs != nil {
+				lastAppliedChecksum = cs.LastAppliedChecksum
+			}
+		}
+
+		result := r.reconcileCluster(ctx, impersonation, &cueInstance, clusterReconcile{
+			cluster:             cluster,
+			revision:            revision,
+			checksum:            checksum,
+			lastAppliedChecksum: lastAppliedChecksum,
+			objects:             objects,
+			oldInventory:        oldStatus.Inventory,
+			force:               force,
+			planOnly:            gated,
+			snapshot:            lastSnapshot,
+		})
+
+		// keep the previous inventory of the cluster when nothing was applied
+		if result.inventory != nil {
+			applied = true
+			newInventory.Entries = append(newInventory.Entries, result.inventory.Entries...)
+		} else if oldStatus.Inventory != nil {
+			newInventory.Entries = append(newInventory.Entries, FilterInventory(oldStatus.Inventory, cluster).Entries...)
+		}
+
+		if result.objectsHealth != nil {
+			objectsHealth = mergeInventoryHealth(objectsHealth, result.objectsHealth)
+		}
+
+		planDiff.WriteString(result.planDiff)
+		pruned += result.pruned
+		driftDetected += result.driftDetected
+		driftCorrected += result.driftCorrected
+		applySummary = addApplySummary(applySummary, result.summary)
+		if result.rolledBack {
+			rolledBackOn = append(rolledBackOn, cluster)
+		}
+		for _, c := range result.pendingChanges {
+			if len(pendingChanges) < maxPendingChanges {
+				pendingChanges = append(pendingChanges, c)
+			}
+		}
+
+		if result.healthChecked {
+			healthChecked = true
+			if result.healthErr != nil {
+				healthErrors = append(healthErrors, clusterMessage(fanOut, cluster, result.healthErr.Error()))
+			}
+		}
+
+		status := cuev1alpha1.ClusterStatus{Name: cluster}
+		if prev := oldStatus.GetClusterStatus(cluster); prev != nil {
+			status = *prev
+		}
+		if result.err != nil {
+			status.Ready = false
+			status.Reason = result.reason
+			status.Message = result.err.Error()
+			failures = append(failures, clusterMessage(fanOut, cluster, result.err.Error()))
+			if failedGroup < 0 {
+				failedGroup = rollout.group[cluster]
+			}
+			if failedResult == nil {
+				failedReason = result.reason
+				failedResult = &result
+			}
+		} else if r.ReadOnly {
+			status.Ready = true
+			status.Reason = cuev1alpha1.ReadOnlyReason
+			status.Message = fmt.Sprintf("Dry-run of revision: %s", revision)
+		} else if result.awaitingApproval {
+			awaitingApproval = true
+			status.Ready = false
+			status.Reason = cuev1alpha1.ApprovalPendingReason
+			status.Message = fmt.Sprintf("Plan %s of revision %s awaits approval", id, revision)
+		} else {
+			status.Ready = true
+			status.Reason = meta.ReconciliationSucceededReason
+			status.Message = fmt.Sprintf("Applied revision: %s", revision)
+			status.LastAppliedRevision = revision
+			status.LastAppliedChecksum = checksum
+		}
+		clusterStatuses = append(clusterStatuses, status)
 	}
 
-	// run garbage collection for stale objects that do not have pruning disabled
-	if _, err := r.prune(ctx, resourceManager, cueInstance, revision, staleObjects); err != nil {
+	// the one-shot force request is used up by the first apply made with it
+	if v, ok := cueInstance.ForceRequested(); ok && force && applied {
+		cueInstance.Status.LastHandledForceAt = v
+	}
+
+	// run garbage collection for the objects left on clusters which are no longer targeted
+	if oldStatus.Inventory != nil && !r.ReadOnly {
+		r.pruneDetachedClusters(ctx, impersonation, &cueInstance, revision, oldStatus.Inventory, clusters)
+	}
+	r.recordObjectChanges(ctx, cueInstance, pruned, driftDetected, driftCorrected)
+	if applySummary != nil {
+		cueInstance.Status.LastApplySummary = applySummary
+	}
+
+	if fanOut {
+		cueInstance.Status.Clusters = clusterStatuses
+	} else {
+		cueInstance.Status.Clusters = nil
+	}
+
+	if objectsHealth != nil {
+		cueInstance.Status.InventoryHealth = objectsHealth
+	}
+	cueInstance.Status.RetainedObjects = retainedObjects(newInventory, objects)
+	cueInstance.Status.PendingChanges = pendingChanges
+	cueInstance.Status.Plan = nil
+
+	if healthChecked {
+		var healthErr error
+		if len(healthErrors) > 0 {
+			healthErr = errors.New(strings.Join(healthErrors, "; "))
+		}
+		setHealthyCondition(&cueInstance, healthErr)
+	}
+
+	if len(rolledBackOn) > 0 {
+		if !fanOut {
+			rolledBackOn = nil
+		}
+		setRolledBackCondition(&cueInstance, lastSnapshot.revision, revision, rolledBackOn)
+		cueInstance.Status.RolledBackChecksum = checksum
+		msg := apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.RolledBackCondition).Message
+		ctrl.LoggerFrom(ctx).Info(msg)
+		r.event(ctx, cueInstance, revision, events.EventSeverityInfo, msg, nil)
+	}
+
+	if len(failures) > 0 {
+		if !fanOut {
+			// nothing was applied, keep the inventory untouched
+			if failedResult.inventory == nil {
+				return cuev1alpha1.CueInstanceNotReady(
+					cueInstance,
+					revision,
+					failedReason,
+					failedResult.err.Error(),
+				), failedResult.err
+			}
+			return cuev1alpha1.CueInstanceNotReadyInventory(
+				cueInstance,
+				newInventory,
+				revision,
+				failedReason,
+				failedResult.err.Error(),
+			), failedResult.err
+		}
+
+		msg := strings.Join(failures, "; ")
+		if halted > 0 {
+			msg = fmt.Sprintf("%s; rollout halted on %d clusters after cluster group '%s'",
+				msg, halted, rollout.names[failedGroup])
+		}
+		err := fmt.Errorf("reconciliation failed on %d of %d clusters: %s",
+			len(failures), len(clusters), msg)
 		return cuev1alpha1.CueInstanceNotReadyInventory(
 			cueInstance,
 			newInventory,
 			revision,
-			cuev1alpha1.PruneFailedReason,
+			failedReason,
 			err.Error(),
 		), err
 	}
 
+	if awaitingApproval {
+		plan := cuev1alpha1.Plan{ID: id, Revision: revision, Changes: pendingChanges}
+		r.writePlan(ctx, cueInstance, &plan, objects, planDiff.String())
+		cueInstance.Status.Plan = &plan
+		cueInstance.Status.PendingChanges = nil
+		cueInstance.Status.Inventory = newInventory
+		cuev1alpha1.SetCueInstanceReadiness(&cueInstance, metav1.ConditionFalse, cuev1alpha1.ApprovalPendingReason,
+			fmt.Sprintf("Plan %s of revision %s awaits approval: %d changes", id, revision, len(pendingChanges)), revision)
+		r.event(ctx, cueInstance, revision, events.EventSeverityInfo, planMessage(plan), map[string]string{"plan": id})
+		return cueInstance, nil
+	}
+
+	// the plan has been applied or is no longer needed
+	r.deletePlan(ctx, cueInstance, oldStatus.Plan)
+
+	if r.ReadOnly {
+		cuev1alpha1.SetCueInstanceReadiness(&cueInstance, metav1.ConditionTrue, cuev1alpha1.ReadOnlyReason,
+			fmt.Sprintf("Dry-run of revision %s: %d pending changes", revision, len(pendingChanges)), revision)
+		return cueInstance, nil
+	}
+
+	cueInstance.Status.LastAppliedChecksum = checksum
+
+	// record the objects to roll back to if the next revision fails
+	apimeta.RemoveStatusCondition(&cueInstance.Status.Conditions, cuev1alpha1.RolledBackCondition)
+	cueInstance.Status.RolledBackChecksum = ""
+	r.recordHistory(ctx, &cueInstance, snapshot{revision: revision, checksum: checksum, objects: objects})
+
 	return cuev1alpha1.CueInstanceReadyInventory(
 		cueInstance,
 		newInventory,
 		revision,
 		meta.ReconciliationSucceededReason,
 		fmt.Sprintf("Applied revision: %s", revision),
-	), err
+	), nil
 }
 
-func (r *CueInstanceReconciler) build(ctx context.Context,
-	revision, root, dir string,
-	instance *cuev1alpha1.CueInstance,
-) ([]byte, error) {
-	log := ctrl.LoggerFrom(ctx)
-	cctx := cuecontext.New()
+// clusterReconcile holds the input of the reconciliation of a single cluster.
+type clusterReconcile struct {
+	cluster             string
+	revision            string
+	checksum            string
+	lastAppliedChecksum string
+	objects             []*unstructured.Unstructured
+	oldInventory        *cuev1alpha1.ResourceInventory
+	force               bool
+	// planOnly computes the changes without applying them
+	// unless there are none, the plan awaiting approval
+	planOnly bool
+	// snapshot holds the objects to roll back to, if any
+	snapshot *snapshot
+}
 
-	tags := make([]string, 0, len(instance.Spec.Tags))
-	for _, t := range instance.Spec.Tags {
-		if t.Value != "" {
-			tags = append(tags, fmt.Sprintf("%s=%s", t.Name, t.Value))
-		} else {
-			tags = append(tags, t.Name)
-		}
+// clusterResult holds the outcome of the reconciliation of a single cluster.
+type clusterResult struct {
+	// inventory is nil when no objects were applied
+	inventory     *cuev1alpha1.ResourceInventory
+	healthChecked bool
+	healthErr     error
+	// objectsHealth is nil when no objects were applied
+	objectsHealth *cuev1alpha1.InventoryHealth
+	reason        string
+	err           error
+	// pendingChanges are the changes not made in read-only mode
+	// or while the plan awaits approval
+	pendingChanges   []cuev1alpha1.PendingChange
+	awaitingApproval bool
+	// planDiff holds the diffs of the drifted objects awaiting approval
+	planDiff string
+	// rolledBack is set when the snapshot was re-applied
+	rolledBack bool
+	// summary is nil when no objects were applied
+	summary *cuev1alpha1.ApplySummary
+	// pruned is the number of garbage collected objects
+	pruned int
+	// driftDetected and driftCorrected are the numbers of drifted
+	// objects found and re-applied by a no-op reconciliation
+	driftDetected  int
+	driftCorrected int
+}
+
+func clusterFailed(inventory *cuev1alpha1.ResourceInventory, reason string, err error) clusterResult {
+	return clusterResult{inventory: inventory, reason: reason, err: err}
+}
+
+// reconcileCluster applies the rendered objects to a single cluster,
+// garbage collects the stale objects, runs the health checks and the hooks.
+func (r *CueInstanceReconciler) reconcileCluster(ctx context.Context,
+	impersonation *CueInstanceImpersonation,
+	cueInstance *cuev1alpha1.CueInstance,
+	in clusterReconcile,
+) clusterResult {
+	revision, cluster := in.revision, in.cluster
+
+	// setup a Kubernetes client
+	kubeClient, statusPoller, err := impersonation.GetClientForCluster(ctx, cluster)
+	if err != nil {
+		return clusterFailed(nil, meta.ReconciliationFailedReason, fmt.Errorf("failed to build kube client: %w", err))
 	}
 
-	tagVars := make(map[string]load.TagVar, len(instance.Spec.TagVars))
-	for _, t := range instance.Spec.TagVars {
-		tagVars[t.Name] = load.TagVar{
-			Func: func() (ast.Expr, error) {
-				return ast.NewString(t.Value), nil
-			},
+	// each cluster gets its own copy of the objects as they are mutated during apply
+	objects := make([]*unstructured.Unstructured, len(in.objects))
+	for i, obj := range in.objects {
+		objects[i] = obj.DeepCopy()
+	}
+
+	// leave the fields owned by other controllers untouched
+	if err := preserveIgnoredPaths(ctx, r.uncachedReader(kubeClient), objects, cueInstance.Spec.IgnorePaths); err != nil {
+		return clusterFailed(nil, meta.ReconciliationFailedReason, err)
+	}
+
+	// create the server-side apply manager
+	resourceManager := ssa.NewResourceManager(kubeClient, statusPoller, r.resourceOwner(*cueInstance))
+	resourceManager.SetOwnerLabels(objects, cueInstance.GetName(), cueInstance.GetNamespace())
+
+	// annotate the Deployments for progressive delivery
+	if cueInstance.Spec.ProgressiveDelivery != nil {
+		if err := setCanaryMetadata(objects, revision); err != nil {
+			return clusterFailed(nil, cuev1alpha1.BuildFailedReason, err)
 		}
 	}
 
-	cfg := &load.Config{
-		ModuleRoot: root,
-		Dir:        dir,
-		DataFiles:  true, //TODO: this could be configurable
-		Tags:       tags,
-		TagVars:    tagVars,
+	// validate the objects against the OpenAPI schemas of the cluster
+	if err := r.validateClientSide(ctx, impersonation, cluster, objects); err != nil {
+		return clusterFailed(nil, cuev1alpha1.ValidationFailedReason, err)
 	}
 
-	if instance.Spec.Package != "" {
-		cfg.Package = instance.Spec.Package
+	// reject the fields unknown to the schemas of the cluster
+	if cueInstance.Spec.StrictFields {
+		if err := checkUnknownFields(ctx, kubeClient, r.resourceOwner(*cueInstance).Field, objects); err != nil {
+			return clusterFailed(nil, cuev1alpha1.ValidationFailedReason, err)
+		}
 	}
 
-	ix := load.Instances([]string{}, cfg)
-	if len(ix) == 0 {
-		return nil, fmt.Errorf("no instances found")
+	// set aside the Jobs run by the hooks
+	var preApplyHooks, postApplyHooks []hookJobs
+	if hooks := cueInstance.Spec.Hooks; hooks != nil {
+		preApplyHooks, objects, err = selectHookJobs(hooks.PreApply, objects)
+		if err == nil {
+			postApplyHooks, objects, err = selectHookJobs(hooks.PostApply, objects)
+		}
+		if err != nil {
+			return clusterFailed(nil, cuev1alpha1.HookFailedReason, err)
+		}
 	}
 
-	inst := ix[0]
-	if inst.Err != nil {
-		return nil, inst.Err
+	durations := cueInstance.Status.LastPhaseDurations
+	applyStart := time.Now()
+
+	// report the changes without applying them in read-only mode,
+	// or while the plan of the changes awaits approval
+	if r.ReadOnly || in.planOnly {
+		var diffs strings.Builder
+		var w io.Writer
+		if in.planOnly {
+			w = &diffs
+		}
+		changes, err := r.dryRunCluster(ctx, resourceManager, *cueInstance, in, objects, w)
+		if err != nil {
+			addPhaseDuration(&durations.Apply, time.Since(applyStart))
+			return clusterFailed(nil, meta.ReconciliationFailedReason, err)
+		}
+		if r.ReadOnly || len(changes) > 0 {
+			addPhaseDuration(&durations.Apply, time.Since(applyStart))
+			result := clusterResult{pendingChanges: changes, awaitingApproval: in.planOnly, planDiff: diffs.String()}
+			if isNoOpReconcile(*cueInstance, in) {
+				result.driftDetected = driftedChanges(changes)
+			}
+			return result
+		}
 	}
 
-	value := cctx.BuildInstance(inst)
-	if value.Err() != nil {
-		return nil, value.Err()
+	// run the pre-apply hooks when the rendered objects have changed
+	if in.checksum != in.lastAppliedChecksum {
+		if err := r.runHooks(ctx, resourceManager, kubeClient, *cueInstance, revision, preApplyHooks); err != nil {
+			return clusterFailed(nil, cuev1alpha1.HookFailedReason, err)
+		}
 	}
 
-	shouldValidate := instance.Spec.Validate != nil
+	// validate and apply resources in stages
+	summary, changeSet, err := r.apply(ctx, resourceManager, *cueInstance, revision, objects, in.force)
+	addPhaseDuration(&durations.Apply, time.Since(applyStart))
+	if err != nil {
+		return clusterFailed(nil, meta.ReconciliationFailedReason, err)
+	}
 
-	var result bytes.Buffer
-	if len(instance.Spec.Exprs) > 0 {
-		for _, e := range instance.Spec.Exprs {
-			expr := value.LookupPath(cue.ParsePath(e))
+	// the objects changed by the apply of the last applied objects have drifted
+	var drifted int
+	if isNoOpReconcile(*cueInstance, in) {
+		drifted = driftedObjects(changeSet)
+	}
 
-			data, err := cueEncodeYAML(expr)
-			if err != nil {
-				return nil, err
-			}
+	// create an inventory of objects to be reconciled
+	newInventory := NewInventory()
+	err = AddObjectsToInventory(newInventory, changeSet, cluster)
+	if err != nil {
+		return clusterFailed(nil, meta.ReconciliationFailedReason, err)
+	}
+	addHookJobsToInventory(newInventory, preApplyHooks, cluster)
+	addHookJobsToInventory(newInventory, postApplyHooks, cluster)
 
-			if shouldValidate && instance.Spec.Validate.Type == "cue" {
-				schema := value.LookupPath(cue.ParsePath(instance.Spec.Validate.Schema))
-				schema.Unify(expr)
-				if err := schema.Unify(expr).Validate(); err != nil {
-					msg := fmt.Sprintf("cue expression validation failed: %s", err)
-					switch instance.Spec.Validate.Mode {
-					case cuev1alpha1.FailPolicy:
-						r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-						return nil, fmt.Errorf(msg)
-					case cuev1alpha1.DropPolicy:
-						r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-						continue
-					case cuev1alpha1.AuditPolicy:
-						r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-						break
-					case cuev1alpha1.IgnorePolicy:
-						log.Info(msg)
-						break
-					}
-				}
-			}
+	// detect stale objects which are subject to garbage collection
+	pruneStart := time.Now()
+	var staleObjects []*unstructured.Unstructured
+	if in.oldInventory != nil && !(cueInstance.PruneOnChangeOnly() && isNoOpReconcile(*cueInstance, in)) {
+		diffObjects, err := DiffInventory(FilterInventory(in.oldInventory, cluster), newInventory)
+		if err != nil {
+			return clusterFailed(nil, meta.ReconciliationFailedReason, err)
+		}
 
-			_, err = result.Write(data)
-			if err != nil {
-				return nil, err
+		// TODO: remove this workaround after kustomize-controller 0.18 release
+		// skip objects that were wrongly marked as namespaced
+		// https://github.com/fluxcd/kustomize-controller/issues/466
+		newObjects, _ := ListObjectsInInventory(newInventory)
+		clusterScoped := make(map[string]bool)
+		for _, newObj := range newObjects {
+			if newObj.GetNamespace() == "" {
+				clusterScoped[newObj.GetAPIVersion()+"/"+newObj.GetKind()+"/"+newObj.GetName()] = true
 			}
 		}
-	} else {
-		data, err := cueEncodeYAML(value)
-		if err != nil {
-			return nil, err
-		}
-
-		valid := false
-
-		if shouldValidate && instance.Spec.Validate.Type == "cue" {
-			schema := value.LookupPath(cue.ParsePath(instance.Spec.Validate.Schema))
-			if err := schema.Unify(value).Validate(); err != nil {
-				msg := fmt.Sprintf("cue validation failed: %s", err)
-				switch instance.Spec.Validate.Mode {
-				case cuev1alpha1.FailPolicy:
-					r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-					return nil, fmt.Errorf(msg)
-				case cuev1alpha1.DropPolicy:
-					r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-					valid = false
-				case cuev1alpha1.AuditPolicy:
-					r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-				case cuev1alpha1.IgnorePolicy:
-					log.Info(msg)
-				}
+		for _, obj := range diffObjects {
+			if obj.GetNamespace() != "" && clusterScoped[obj.GetAPIVersion()+"/"+obj.GetKind()+"/"+obj.GetName()] {
+				continue
 			}
+			staleObjects = append(staleObjects, obj)
+		}
+	}
+
+	// run garbage collection for stale objects that do not have pruning disabled
+	pruned, err := r.prune(ctx, resourceManager, cueInstance, revision, cluster, staleObjects)
+	addPhaseDuration(&durations.Prune, time.Since(pruneStart))
+	if err != nil {
+		return clusterFailed(newInventory, cuev1alpha1.PruneFailedReason, err)
+	}
+	var prunedObjects int
+	if pruned {
+		prunedObjects = len(cueInstance.Status.LastGarbageCollection.Entries)
+	}
+	summary.Pruned = prunedObjects
+
+	// run the health checks for the applied objects
+	healthStart := time.Now()
+	healthChecked, healthErr := r.checkHealth(ctx, kubeClient, *cueInstance, changeSet)
+
+	// compute the status of every object in the inventory
+	objectsHealth := inventoryHealth(ctx, kubeClient, newInventory)
+	addPhaseDuration(&durations.Health, time.Since(healthStart))
+
+	if healthErr != nil {
+		result := clusterResult{
+			inventory:      newInventory,
+			healthChecked:  healthChecked,
+			healthErr:      healthErr,
+			objectsHealth:  objectsHealth,
+			reason:         cuev1alpha1.HealthCheckFailedReason,
+			err:            healthErr,
+			pruned:         prunedObjects,
+			driftDetected:  drifted,
+			driftCorrected: drifted,
+			summary:        summary,
 		}
 
-		if valid {
-			_, err = result.Write(data)
+		// re-apply the objects of the last applied revision
+		if canRollback(*cueInstance, in) {
+			inventory, err := r.rollback(ctx, resourceManager, cueInstance, in, newInventory)
+			if inventory != nil {
+				result.inventory = inventory
+				result.objectsHealth = inventoryHealth(ctx, kubeClient, inventory)
+			}
 			if err != nil {
-				return nil, err
+				result.err = fmt.Errorf("%w, rollback to revision %s failed: %s", healthErr, in.snapshot.revision, err)
+			} else {
+				result.rolledBack = true
 			}
 		}
+		return result
 	}
 
-	for _, of := range inst.OrphanedFiles {
-		if of.Encoding == "yaml" {
-			data, err := yaml.Extract(of.Filename, nil)
-			if err != nil {
-				return nil, err
-			}
-			f := cctx.BuildFile(data)
-			switch f.Kind() {
-			case cue.ListKind:
-				l, err := f.List()
-				if err != nil {
-					return nil, err
-				}
-				for l.Next() {
-					data, err := yaml.Encode(l.Value())
-					if err != nil {
-						return nil, err
-					}
-					if shouldValidate && instance.Spec.Validate.Type == "yaml" {
-						schema := value.LookupPath(cue.ParsePath(instance.Spec.Validate.Schema))
-						if err := yaml.Validate(data, schema); err != nil {
-							msg := fmt.Sprintf("yaml validation failed: %s", err)
-							switch instance.Spec.Validate.Mode {
-							case cuev1alpha1.FailPolicy:
-								r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-								return nil, fmt.Errorf(msg)
-							case cuev1alpha1.DropPolicy:
-								r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-								continue
-							case cuev1alpha1.AuditPolicy:
-								r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-								break
-							case cuev1alpha1.IgnorePolicy:
-								log.Info(msg)
-							}
-						}
-					}
-					result.Write(data)
-					result.Write([]byte("\n---\n"))
-				}
-			case cue.StructKind:
-				data, err := yaml.Encode(f)
-				if err != nil {
-					return nil, err
-				}
-				if shouldValidate && instance.Spec.Validate.Type == "yaml" {
-					schema := value.LookupPath(cue.ParsePath(instance.Spec.Validate.Schema))
-					if err := yaml.Validate(data, schema); err != nil {
-						msg := fmt.Sprintf("yaml validation failed: %s", err)
-						switch instance.Spec.Validate.Mode {
-						case cuev1alpha1.FailPolicy:
-							r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-							return nil, fmt.Errorf(msg)
-						case cuev1alpha1.DropPolicy:
-							r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-							continue
-						case cuev1alpha1.AuditPolicy:
-							r.event(ctx, *instance, revision, events.EventSeverityInfo, msg, nil)
-						case cuev1alpha1.IgnorePolicy:
-							log.Info(msg)
-						}
-					}
-				}
-				result.Write(data)
-				result.Write([]byte("\n---\n"))
+	// run the post-apply hooks when the rendered objects have changed
+	if in.checksum != in.lastAppliedChecksum {
+		hooksStart := time.Now()
+		err := r.runHooks(ctx, resourceManager, kubeClient, *cueInstance, revision, postApplyHooks)
+		addPhaseDuration(&durations.Apply, time.Since(hooksStart))
+		if err != nil {
+			return clusterResult{
+				inventory:      newInventory,
+				healthChecked:  healthChecked,
+				objectsHealth:  objectsHealth,
+				reason:         cuev1alpha1.HookFailedReason,
+				err:            err,
+				pruned:         prunedObjects,
+				driftDetected:  drifted,
+				driftCorrected: drifted,
+				summary:        summary,
 			}
 		}
 	}
 
-	return result.Bytes(), nil
+	return clusterResult{
+		inventory:      newInventory,
+		healthChecked:  healthChecked,
+		objectsHealth:  objectsHealth,
+		pruned:         prunedObjects,
+		driftDetected:  drifted,
+		driftCorrected: drifted,
+		summary:        summary,
+	}
 }
 
-func cueEncodeYAML(value cue.Value) ([]byte, error) {
-	var (
-		err  error
-		data []byte
-	)
-	switch value.Kind() {
-	case cue.ListKind:
-		items, err := value.List()
-		if err != nil {
-			return nil, err
-		}
-		data, err = yaml.EncodeStream(items)
-		if err != nil {
-			return nil, err
-		}
-	case cue.StructKind:
-		data, err = yaml.Encode(value)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, nil
+// isNoOpReconcile reports whether the reconciliation of the cluster applies the
+// same spec, revision and objects as the last successful reconciliation.
+func isNoOpReconcile(cueInstance cuev1alpha1.CueInstance, in clusterReconcile) bool {
+	return cueInstance.Generation == cueInstance.Status.ObservedGeneration &&
+		in.revision == cueInstance.Status.LastAppliedRevision &&
+		in.checksum == in.lastAppliedChecksum
+}
+
+// clusterMessage prefixes msg with the cluster name when fanning out.
+func clusterMessage(fanOut bool, cluster, msg string) string {
+	if !fanOut {
+		return msg
 	}
-	data = append(data, []byte("\n---\n")...)
-	return data, nil
+	return fmt.Sprintf("cluster '%s': %s", cluster, msg)
 }
 
-func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.ResourceManager, cueInstance cuev1alpha1.CueInstance, revision string, objects []*unstructured.Unstructured) (bool, *ssa.ChangeSet, error) {
+// apply applies the objects in stages and returns the summary of the actions
+// taken on them, along with the change set of all the objects.
+func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.ResourceManager, cueInstance cuev1alpha1.CueInstance, revision string, objects []*unstructured.Unstructured, force bool) (*cuev1alpha1.ApplySummary, *ssa.ChangeSet, error) {
 	log := ctrl.LoggerFrom(ctx)
 
 	if err := ssa.SetNativeKindsDefaults(objects); err != nil {
-		return false, nil, err
+		return nil, nil, err
+	}
+
+	// the kinds defined by these CRDs may not be served yet when their objects are applied
+	crds := crdKinds(objects)
+
+	// leave the existing create-once objects and the skipped CRDs untouched
+	objects, skipped, err := selectObjectsToApply(ctx, manager.Client(), objects, func(obj *unstructured.Unstructured) applyMode {
+		return objectApplyMode(cueInstance, obj)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkConflicts(ctx, manager.Client(), r.resourceOwner(cueInstance).Field, cueInstance.Spec.ConflictPolicy, objects); err != nil {
+		return nil, nil, err
 	}
 
 	applyOpts := ssa.DefaultApplyOptions()
-	applyOpts.Exclusions = map[string]string{
-		fmt.Sprintf("%s/reconcile", cuev1alpha1.GroupVersion.Group): cuev1alpha1.DisabledValue,
+	applyOpts.Force = force
+	applyOpts.Exclusions = ApplyExclusions()
+
+	// take over the existing objects which are not managed by a CueInstance
+	adopted, adoptSet, err := r.adopt(ctx, manager, cueInstance, revision, objects, applyOpts)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// contains only CRDs and Namespaces
@@ -717,8 +1402,29 @@ func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.Resource
 
 	// contains the objects' metadata after apply
 	resultSet := ssa.NewChangeSet()
+	resultSet.Append(skipped)
+
+	var changeSetLog strings.Builder
+
+	if adoptSet != nil {
+		resultSet.Append(adoptSet.Entries)
+		for _, change := range adoptSet.Entries {
+			if change.Action != string(ssa.UnchangedAction) {
+				changeSetLog.WriteString(change.String() + "\n")
+			}
+		}
+	}
+
+	// the adopted objects have already been applied
+	skip := make(map[*unstructured.Unstructured]bool, len(adopted))
+	for _, u := range adopted {
+		skip[u] = true
+	}
 
 	for _, u := range objects {
+		if skip[u] {
+			continue
+		}
 		if ssa.IsClusterDefinition(u) {
 			stageOne = append(stageOne, u)
 		} else {
@@ -726,13 +1432,11 @@ func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.Resource
 		}
 	}
 
-	var changeSetLog strings.Builder
-
 	// validate, apply and wait for CRDs and Namespaces to register
 	if len(stageOne) > 0 {
 		changeSet, err := manager.ApplyAll(ctx, stageOne, applyOpts)
 		if err != nil {
-			return false, nil, err
+			return nil, nil, err
 		}
 		resultSet.Append(changeSet.Entries)
 
@@ -749,16 +1453,33 @@ func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.Resource
 			Interval: 2 * time.Second,
 			Timeout:  cueInstance.GetTimeout(),
 		}); err != nil {
-			return false, nil, err
+			return nil, nil, err
 		}
 	}
 
 	// sort by kind, validate and apply all the others objects
 	sort.Sort(ssa.SortableUnstructureds(stageTwo))
 	if len(stageTwo) > 0 {
-		changeSet, err := manager.ApplyAll(ctx, stageTwo, applyOpts)
+		// apply large instances in chunks and report the progress after each of them
+		changeSet, err := applyInChunks(stageTwo, r.ApplyChunkSize,
+			func(chunk []*unstructured.Unstructured) (*ssa.ChangeSet, error) {
+				return retryOnPendingCRDs(ctx, manager.Client(), crds, 2*time.Second, cueInstance.GetTimeout(),
+					func() (*ssa.ChangeSet, error) {
+						return applyConcurrently(ctx, manager, chunk, applyOpts, r.ApplyConcurrency)
+					})
+			},
+			func(applied, total int) {
+				r.reportApplyProgress(ctx, cueInstance, applied, total)
+			})
 		if err != nil {
-			return false, nil, fmt.Errorf("%w\n%s", err, changeSetLog.String())
+			if changeSet != nil {
+				for _, change := range changeSet.Entries {
+					if change.Action != string(ssa.UnchangedAction) {
+						changeSetLog.WriteString(change.String() + "\n")
+					}
+				}
+			}
+			return nil, nil, fmt.Errorf("%w\n%s", err, changeSetLog.String())
 		}
 		resultSet.Append(changeSet.Entries)
 
@@ -778,130 +1499,167 @@ func (r *CueInstanceReconciler) apply(ctx context.Context, manager *ssa.Resource
 		r.event(ctx, cueInstance, revision, events.EventSeverityInfo, applyLog, nil)
 	}
 
-	return applyLog != "", resultSet, nil
+	return newApplySummary(revision, resultSet, len(skipped)), resultSet, nil
 }
 
-func (r *CueInstanceReconciler) checkDependencies(source sourcev1.Source, cueInstance cuev1alpha1.CueInstance) error {
+func (r *CueInstanceReconciler) checkDependencies(ctx context.Context, source sourcev1.Source, cueInstance cuev1alpha1.CueInstance) error {
 	for _, d := range cueInstance.Spec.DependsOn {
 		if d.Namespace == "" {
 			d.Namespace = cueInstance.GetNamespace()
 		}
-		dName := types.NamespacedName(d)
+
+		if err := r.checkDependencyAccess(cueInstance, d); err != nil {
+			return err
+		}
+
+		reader, err := r.dependencyReader(ctx, cueInstance, d)
+		if err != nil {
+			return err
+		}
+
+		dName := types.NamespacedName(d.CrossNamespaceDependencyReference)
+		if !d.IsCueInstance() {
+			if err := r.checkObjectDependency(ctx, reader, d); err != nil {
+				return err
+			}
+			continue
+		}
+		ref := dependencyName(d, dName.String())
+
 		var k cuev1alpha1.CueInstance
-		err := r.Get(context.Background(), dName, &k)
+		err = reader.Get(ctx, dName, &k)
 		if err != nil {
-			return fmt.Errorf("unable to get '%s' dependency: %w", dName, err)
+			return fmt.Errorf("unable to get '%s' dependency: %w", ref, err)
 		}
 
 		if len(k.Status.Conditions) == 0 || k.Generation != k.Status.ObservedGeneration {
-			return fmt.Errorf("dependency '%s' is not ready", dName)
+			return fmt.Errorf("dependency '%s' is not ready", ref)
+		}
+
+		if d.ReadyExpr != "" {
+			ready, err := evalReadyExpr(d.ReadyExpr, &k)
+			if err != nil {
+				return fmt.Errorf("dependency '%s': %w", ref, err)
+			}
+			if !ready {
+				return fmt.Errorf("dependency '%s' does not meet the ready expression", ref)
+			}
+			continue
 		}
 
 		if !apimeta.IsStatusConditionTrue(k.Status.Conditions, meta.ReadyCondition) {
-			return fmt.Errorf("dependency '%s' is not ready", dName)
+			return fmt.Errorf("dependency '%s' is not ready", ref)
 		}
 
+		// the sources of a remote CueInstance are not those of the local cluster
+		if d.IsRemote() {
+			continue
+		}
 		if k.Spec.SourceRef.Name == cueInstance.Spec.SourceRef.Name && k.Spec.SourceRef.Namespace == cueInstance.Spec.SourceRef.Namespace && k.Spec.SourceRef.Kind == cueInstance.Spec.SourceRef.Kind && source.GetArtifact().Revision != k.Status.LastAppliedRevision {
-			return fmt.Errorf("dependency '%s' is not updated yet", dName)
+			return fmt.Errorf("dependency '%s' is not updated yet", ref)
 		}
 	}
 
-	return nil
+	return r.checkValuesFrom(ctx, cueInstance)
 }
 
-func (r *CueInstanceReconciler) download(artifact *sourcev1.Artifact, tmpDir string) error {
-	artifactURL := artifact.URL
-	if hostname := os.Getenv("SOURCE_CONTROLLER_LOCALHOST"); hostname != "" {
-		u, err := url.Parse(artifactURL)
-		if err != nil {
-			return err
-		}
-		u.Host = hostname
-		artifactURL = u.String()
-	}
-
-	req, err := retryablehttp.NewRequest(http.MethodGet, artifactURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create a new request: %w", err)
+// resourceOwner returns the server-side apply owner of the objects applied for the CueInstance.
+func (r *CueInstanceReconciler) resourceOwner(cueInstance cuev1alpha1.CueInstance) ssa.Owner {
+	field := r.ControllerName
+	if r.FieldManager != "" {
+		field = r.FieldManager
 	}
-
-	resp, err := r.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to download artifact, error: %w", err)
+	return ssa.Owner{
+		Field: cueInstance.GetFieldManager(field),
+		Group: cuev1alpha1.GroupVersion.Group,
 	}
-	defer resp.Body.Close()
+}
 
-	// check response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download artifact from %s, status: %s", artifactURL, resp.Status)
+func (r *CueInstanceReconciler) prune(ctx context.Context, manager *ssa.ResourceManager, cueInstance *cuev1alpha1.CueInstance, revision, cluster string, objects []*unstructured.Unstructured) (bool, error) {
+	if !cueInstance.Spec.Prune {
+		return false, nil
 	}
 
-	var buf bytes.Buffer
-
-	// verify checksum matches origin
-	if err := r.verifyArtifact(artifact, &buf, resp.Body); err != nil {
-		return err
-	}
+	log := ctrl.LoggerFrom(ctx)
 
-	// extract
-	if _, err = untar.Untar(&buf, tmpDir); err != nil {
-		return fmt.Errorf("failed to untar artifact, error: %w", err)
+	if retained := filterRetained(cueInstance.Status.RetainedObjects, cluster, objects); len(retained) > 0 {
+		msg := fmt.Sprintf("retaining stale objects with garbage collection disabled: \n%s", ssa.FmtUnstructuredList(retained))
+		log.Info(msg)
+		r.event(ctx, *cueInstance, revision, events.EventSeverityInfo, msg, nil)
 	}
 
-	return nil
-}
+	objects = r.excludeFromPrune(ctx, *cueInstance, revision, objects)
 
-func (r *CueInstanceReconciler) verifyArtifact(artifact *sourcev1.Artifact, buf *bytes.Buffer, reader io.Reader) error {
-	hasher := sha256.New()
+	opts := ssa.DeleteOptions{
+		PropagationPolicy: metav1.DeletePropagationBackground,
+		Inclusions:        manager.GetOwnerLabels(cueInstance.Name, cueInstance.Namespace),
+		Exclusions:        PruneExclusions(),
+	}
 
-	// for backwards compatibility with source-controller v0.17.2 and older
-	if len(artifact.Checksum) == 40 {
-		hasher = sha1.New()
+	changeSet, err := deleteInReverseOrder(ctx, manager.Client(), r.uncachedReader(manager.Client()), objects, opts, 2*time.Second, cueInstance.GetTimeout())
+	if err != nil {
+		return false, err
 	}
 
-	// compute checksum
-	mw := io.MultiWriter(hasher, buf)
-	if _, err := io.Copy(mw, reader); err != nil {
-		return err
+	// report the pruned objects only if the prune operation resulted in changes
+	report := newGarbageCollectionReport(changeSet, revision)
+	if report != nil {
+		cueInstance.Status.LastGarbageCollection = report
+		msg := garbageCollectionMessage(changeSet, revision)
+		log.Info(msg)
+		r.event(ctx, *cueInstance, revision, events.EventSeverityInfo, msg, nil)
 	}
 
-	if checksum := fmt.Sprintf("%x", hasher.Sum(nil)); checksum != artifact.Checksum {
-		return fmt.Errorf("failed to verify artifact: computed checksum '%s' doesn't match advertised '%s'",
-			checksum, artifact.Checksum)
+	// wait for the deleted objects to disappear before the garbage collection succeeds
+	if wait, timeout := cueInstance.PruneWait(); wait {
+		if err := waitForDeletion(ctx, r.uncachedReader(manager.Client()), deletedObjects(objects, changeSet), 2*time.Second, timeout); err != nil {
+			return report != nil, err
+		}
 	}
 
-	return nil
+	return report != nil, nil
 }
 
-func (r *CueInstanceReconciler) prune(ctx context.Context, manager *ssa.ResourceManager, cueInstance cuev1alpha1.CueInstance, revision string, objects []*unstructured.Unstructured) (bool, error) {
-	if !cueInstance.Spec.Prune {
-		return false, nil
-	}
-
+// pruneDetachedClusters deletes the inventory objects which were applied to
+// clusters which are no longer targeted, e.g. after spec.kubeConfig has changed.
+// The objects of clusters which can't be reached are reported as orphaned.
+func (r *CueInstanceReconciler) pruneDetachedClusters(ctx context.Context,
+	impersonation *CueInstanceImpersonation,
+	cueInstance *cuev1alpha1.CueInstance,
+	revision string,
+	inventory *cuev1alpha1.ResourceInventory,
+	targets []string,
+) {
 	log := ctrl.LoggerFrom(ctx)
 
-	opts := ssa.DeleteOptions{
-		PropagationPolicy: metav1.DeletePropagationBackground,
-		Inclusions:        manager.GetOwnerLabels(cueInstance.Name, cueInstance.Namespace),
-		Exclusions: map[string]string{
-			fmt.Sprintf("%s/prune", cuev1alpha1.GroupVersion.Group):     cuev1alpha1.DisabledValue,
-			fmt.Sprintf("%s/reconcile", cuev1alpha1.GroupVersion.Group): cuev1alpha1.DisabledValue,
-		},
+	targeted := make(map[string]bool, len(targets))
+	for _, cluster := range targets {
+		targeted[cluster] = true
 	}
 
-	changeSet, err := manager.DeleteAll(ctx, objects, opts)
-	if err != nil {
-		return false, err
-	}
+	for _, cluster := range ListClustersInInventory(inventory) {
+		if targeted[cluster] {
+			continue
+		}
 
-	// emit event only if the prune operation resulted in changes
-	if changeSet != nil && len(changeSet.Entries) > 0 {
-		log.Info(fmt.Sprintf("garbage collection completed: %s", changeSet.String()))
-		r.event(ctx, cueInstance, revision, events.EventSeverityInfo, changeSet.String(), nil)
-		return true, nil
-	}
+		objects, err := ListObjectsInInventory(FilterInventory(inventory, cluster))
+		if err != nil {
+			log.Error(err, "unable to list inventory objects", "cluster", cluster)
+			continue
+		}
 
-	return false, nil
+		kubeClient, statusPoller, err := impersonation.GetClientForCluster(ctx, cluster)
+		if err == nil {
+			manager := ssa.NewResourceManager(kubeClient, statusPoller, r.resourceOwner(*cueInstance))
+			_, err = r.prune(ctx, manager, cueInstance, revision, cluster, objects)
+		}
+		if err != nil {
+			msg := fmt.Sprintf("unable to prune objects from cluster '%s', orphaning objects: \n%s",
+				cluster, ssa.FmtUnstructuredList(objects))
+			log.Error(err, msg)
+			r.event(ctx, *cueInstance, revision, events.EventSeverityError, msg, nil)
+		}
+	}
 }
 
 func (r *CueInstanceReconciler) getSource(ctx context.Context, cueInstance cuev1alpha1.CueInstance) (sourcev1.Source, error) {
@@ -933,6 +1691,18 @@ func (r *CueInstanceReconciler) getSource(ctx context.Context, cueInstance cuev1
 			return source, fmt.Errorf("unable to get source '%s': %w", namespacedName, err)
 		}
 		source = &repository
+	case sourcev1.BucketKind:
+		var bucket sourcev1.Bucket
+		err := r.Client.Get(ctx, namespacedName, &bucket)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return source, err
+			}
+			return source, fmt.Errorf("unable to get source '%s': %w", namespacedName, err)
+		}
+		source = &bucket
+	case cuev1alpha1.DirectorySourceKind:
+		return r.getLocalSource(cueInstance.Spec.SourceRef.Name)
 	default:
 		return source, fmt.Errorf("source `%s` kind '%s' not supported",
 			cueInstance.Spec.SourceRef.Name, cueInstance.Spec.SourceRef.Kind)
@@ -944,51 +1714,30 @@ func (r *CueInstanceReconciler) finalize(ctx context.Context, cueInstance cuev1a
 	log := ctrl.LoggerFrom(ctx)
 	if cueInstance.Spec.Prune &&
 		!cueInstance.Spec.Suspend &&
+		!r.ReadOnly &&
 		cueInstance.Status.Inventory != nil &&
 		cueInstance.Status.Inventory.Entries != nil {
-		objects, _ := ListObjectsInInventory(cueInstance.Status.Inventory)
+		for _, cluster := range ListClustersInInventory(cueInstance.Status.Inventory) {
+			objects, _ := ListObjectsInInventory(FilterInventory(cueInstance.Status.Inventory, cluster))
 
-		impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount)
-		if impersonation.CanFinalize(ctx) {
-			kubeClient, _, err := impersonation.GetClient(ctx)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-
-			resourceManager := ssa.NewResourceManager(kubeClient, nil, ssa.Owner{
-				Field: r.ControllerName,
-				Group: cuev1alpha1.GroupVersion.Group,
-			})
-
-			opts := ssa.DeleteOptions{
-				PropagationPolicy: metav1.DeletePropagationBackground,
-				Inclusions:        resourceManager.GetOwnerLabels(cueInstance.Name, cueInstance.Namespace),
-				Exclusions: map[string]string{
-					fmt.Sprintf("%s/prune", cuev1alpha1.GroupVersion.Group):     cuev1alpha1.DisabledValue,
-					fmt.Sprintf("%s/reconcile", cuev1alpha1.GroupVersion.Group): cuev1alpha1.DisabledValue,
-				},
-			}
-
-			changeSet, err := resourceManager.DeleteAll(ctx, objects, opts)
-			if err != nil {
-				r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityError, "pruning for deleted resource failed", nil)
-				// Return the error so we retry the failed garbage collection
-				return ctrl.Result{}, err
-			}
+			if remaining, err := r.pruneForDeletion(ctx, cueInstance, cluster, objects); err != nil {
+				if !cueInstance.FinalizationTimedOut(time.Now()) {
+					// Return the error so we retry the failed garbage collection
+					return ctrl.Result{}, err
+				}
 
-			if changeSet != nil && len(changeSet.Entries) > 0 {
-				r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityInfo, changeSet.String(), nil)
+				// give up on the garbage collection and orphan the remaining objects
+				msg := fmt.Sprintf("finalization timeout of %s exceeded, orphaning objects: \n%s",
+					cueInstance.Spec.FinalizationTimeout.Duration.String(), ssa.FmtUnstructuredList(remaining))
+				log.Error(err, msg)
+				r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityError, msg, nil)
 			}
-		} else {
-			// when the account to impersonate is gone, log the stale objects and continue with the finalization
-			msg := fmt.Sprintf("unable to prune objects: \n%s", ssa.FmtUnstructuredList(objects))
-			log.Error(fmt.Errorf("skiping pruning, failed to find account to impersonate"), msg)
-			r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityError, msg, nil)
 		}
 	}
 
 	// Record deleted status
 	r.recordReadiness(ctx, cueInstance)
+	r.recordInventory(ctx, cueInstance)
 
 	// Remove our finalizer from the list and update it
 	controllerutil.RemoveFinalizer(&cueInstance, cuev1alpha1.CueInstanceFinalizer)
@@ -1000,9 +1749,90 @@ func (r *CueInstanceReconciler) finalize(ctx context.Context, cueInstance cuev1a
 	return ctrl.Result{}, nil
 }
 
+// pruneForDeletion deletes the inventory objects of a deleted CueInstance
+// which were applied to the given cluster. When the deletion fails, it
+// returns the objects which are left in the cluster.
+func (r *CueInstanceReconciler) pruneForDeletion(ctx context.Context, cueInstance cuev1alpha1.CueInstance, cluster string, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount, r.ClientOptions)
+	if !impersonation.CanFinalize(ctx) {
+		// when the account to impersonate is gone, log the stale objects and continue with the finalization
+		msg := fmt.Sprintf("unable to prune objects: \n%s", ssa.FmtUnstructuredList(objects))
+		log.Error(fmt.Errorf("skiping pruning, failed to find account to impersonate"), msg)
+		r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityError, msg, nil)
+		return nil, nil
+	}
+
+	kubeClient, _, err := impersonation.GetClientForCluster(ctx, cluster)
+	if err != nil {
+		return objects, err
+	}
+
+	objects = r.excludeFromPrune(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, objects)
+
+	resourceManager := ssa.NewResourceManager(kubeClient, nil, r.resourceOwner(cueInstance))
+
+	opts := ssa.DeleteOptions{
+		PropagationPolicy: metav1.DeletePropagationBackground,
+		Inclusions:        resourceManager.GetOwnerLabels(cueInstance.Name, cueInstance.Namespace),
+		Exclusions:        PruneExclusions(),
+	}
+
+	reader := r.uncachedReader(kubeClient)
+	changeSet, err := deleteInReverseOrder(ctx, kubeClient, reader, objects, opts, 2*time.Second, cueInstance.GetTimeout())
+	if err != nil {
+		r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityError, "pruning for deleted resource failed", nil)
+		return remainingObjects(ctx, reader, objects), err
+	}
+
+	if retained := filterRetained(cueInstance.Status.RetainedObjects, cluster, objects); len(retained) > 0 {
+		msg := fmt.Sprintf("retaining objects with garbage collection disabled: \n%s", ssa.FmtUnstructuredList(retained))
+		log.Info(msg)
+		r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityInfo, msg, nil)
+	}
+
+	if newGarbageCollectionReport(changeSet, cueInstance.Status.LastAppliedRevision) != nil {
+		msg := garbageCollectionMessage(changeSet, cueInstance.Status.LastAppliedRevision)
+		r.event(ctx, cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityInfo, msg, nil)
+	}
+
+	return nil, nil
+}
+
+// remainingObjects returns the objects which still exist in the cluster,
+// the objects which can't be looked up are assumed to exist.
+func remainingObjects(ctx context.Context, reader client.Reader, objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	var remaining []*unstructured.Unstructured
+	for _, obj := range objects {
+		live := &metav1.PartialObjectMetadata{}
+		live.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := reader.Get(ctx, client.ObjectKeyFromObject(obj), live); apierrors.IsNotFound(err) {
+			continue
+		}
+		remaining = append(remaining, obj)
+	}
+	return remaining
+}
+
 func (r *CueInstanceReconciler) event(ctx context.Context, cueInstance cuev1alpha1.CueInstance, revision, severity, msg string, metadata map[string]string) {
+	r.emitEvent(ctx, cueInstance, revision, severity, msg, metadata, false)
+}
+
+// resultEvent emits the event reporting the result of a reconciliation.
+func (r *CueInstanceReconciler) resultEvent(ctx context.Context, cueInstance cuev1alpha1.CueInstance, revision, severity, msg string, metadata map[string]string) {
+	r.emitEvent(ctx, cueInstance, revision, severity, msg, metadata, true)
+}
+
+func (r *CueInstanceReconciler) emitEvent(ctx context.Context, cueInstance cuev1alpha1.CueInstance, revision, severity, msg string, metadata map[string]string, result bool) {
 	log := ctrl.LoggerFrom(ctx)
 
+	msg, ok := r.eventFilter.allow(client.ObjectKeyFromObject(&cueInstance), severity, revision, msg, result)
+	if !ok {
+		log.V(1).Info("event suppressed", "severity", severity, "message", msg)
+		return
+	}
+
 	if r.EventRecorder != nil {
 		annotations := map[string]string{
 			cuev1alpha1.GroupVersion.Group + "/revision": revision,
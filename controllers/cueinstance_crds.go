@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// crdKinds returns the CRDs among the objects keyed by the kind they define.
+func crdKinds(objects []*unstructured.Unstructured) map[schema.GroupKind]*unstructured.Unstructured {
+	crds := map[schema.GroupKind]*unstructured.Unstructured{}
+	for _, obj := range objects {
+		if obj.GroupVersionKind().GroupKind() != apiextensionsv1.Kind("CustomResourceDefinition") {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		crds[schema.GroupKind{Group: group, Kind: kind}] = obj
+	}
+	return crds
+}
+
+// pendingCRD returns the CRD of the given ones defining the kind the error
+// is about, when the error is caused by the kind not being served yet.
+func pendingCRD(err error, crds map[schema.GroupKind]*unstructured.Unstructured) (*unstructured.Unstructured, bool) {
+	var noKindMatch *apimeta.NoKindMatchError
+	if !errors.As(err, &noKindMatch) {
+		return nil, false
+	}
+	crd, ok := crds[noKindMatch.GroupKind]
+	return crd, ok
+}
+
+// retryOnPendingCRDs runs apply and, as long as it fails solely because a kind
+// defined by one of the CRDs is not served yet, waits for the CRD to be
+// established and runs apply again, instead of failing the reconciliation.
+func retryOnPendingCRDs(ctx context.Context,
+	kubeClient client.Client,
+	crds map[schema.GroupKind]*unstructured.Unstructured,
+	interval, timeout time.Duration,
+	apply func() (*ssa.ChangeSet, error),
+) (*ssa.ChangeSet, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		changeSet, err := apply()
+		crd, pending := pendingCRD(err, crds)
+		if !pending {
+			return changeSet, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return changeSet, err
+		}
+		if werr := waitForEstablished(ctx, kubeClient, crd, interval, remaining); werr != nil {
+			return changeSet, fmt.Errorf("%w, %s", err, werr)
+		}
+
+		// give the REST mapper of the client time to discover the kind
+		select {
+		case <-ctx.Done():
+			return changeSet, err
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitForEstablished polls the CRD until it has the Established condition.
+func waitForEstablished(ctx context.Context, kubeClient client.Client, crd *unstructured.Unstructured, interval, timeout time.Duration) error {
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(crd.GroupVersionKind())
+		if err := kubeClient.Get(ctx, client.ObjectKeyFromObject(crd), existing); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+
+		conditions, _, _ := unstructured.NestedSlice(existing.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, _ := c.(map[string]interface{})
+			if condition["type"] == string(apiextensionsv1.Established) && condition["status"] == string(apiextensionsv1.ConditionTrue) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return fmt.Errorf("timeout waiting for %s to be established", ssa.FmtUnstructured(crd))
+	}
+	return err
+}
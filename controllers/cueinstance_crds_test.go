@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRetryOnPendingCRDs(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(apiextensionsv1.AddToScheme(scheme)).To(Succeed())
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "Widget", Plural: "widgets"},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue},
+			},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build()
+
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	g.Expect(err).NotTo(HaveOccurred())
+	crdObject := &unstructured.Unstructured{Object: data}
+	crdObject.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	crds := crdKinds([]*unstructured.Unstructured{crdObject, newTestObject("example.com/v1", "Widget", "w")})
+	g.Expect(crds).To(HaveKey(schema.GroupKind{Group: "example.com", Kind: "Widget"}))
+
+	noMatch := func(group, kind string) error {
+		return &apimeta.NoKindMatchError{GroupKind: schema.GroupKind{Group: group, Kind: kind}}
+	}
+
+	// the apply is retried once the kind is served
+	attempts := 0
+	_, err = retryOnPendingCRDs(context.TODO(), kubeClient, crds, 10*time.Millisecond, time.Second, func() (*ssa.ChangeSet, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, noMatch("example.com", "Widget")
+		}
+		return ssa.NewChangeSet(), nil
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(attempts).To(Equal(3))
+
+	// the kinds which are not defined by the CRDs of the instance fail immediately
+	attempts = 0
+	_, err = retryOnPendingCRDs(context.TODO(), kubeClient, crds, 10*time.Millisecond, time.Second, func() (*ssa.ChangeSet, error) {
+		attempts++
+		return nil, noMatch("example.com", "Gadget")
+	})
+	g.Expect(apimeta.IsNoMatchError(err)).To(BeTrue())
+	g.Expect(attempts).To(Equal(1))
+
+	// the CRDs which are never established fail after the timeout
+	crd.Status.Conditions = nil
+	g.Expect(kubeClient.Status().Update(context.TODO(), crd)).To(Succeed())
+	_, err = retryOnPendingCRDs(context.TODO(), kubeClient, crds, 10*time.Millisecond, 50*time.Millisecond, func() (*ssa.ChangeSet, error) {
+		return nil, noMatch("example.com", "Widget")
+	})
+	g.Expect(err).To(MatchError(ContainSubstring("timeout waiting for CustomResourceDefinition/widgets.example.com to be established")))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/Masterminds/semver/v3"
+)
+
+// cueModulePath is the path of the Go module of the CUE language.
+const cueModulePath = "cuelang.org/go"
+
+// embeddedCueVersion returns the version of the CUE language the controller
+// is built with, empty when it can't be determined.
+func embeddedCueVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != cueModulePath {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return ""
+}
+
+// moduleLanguageVersion returns the language.version of the module file
+// of the module root, empty when the module doesn't declare one.
+func moduleLanguageVersion(root string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, "cue.mod", "module.cue"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	v := cuecontext.New().CompileBytes(data, cue.Filename("cue.mod/module.cue"))
+	if err := v.Err(); err != nil {
+		return "", fmt.Errorf("invalid cue.mod/module.cue: %w", err)
+	}
+
+	version := v.LookupPath(cue.ParsePath("language.version"))
+	if !version.Exists() {
+		return "", nil
+	}
+	return version.String()
+}
+
+// checkCueVersion returns an error when the embedded CUE version is older than
+// the language version of the module or doesn't satisfy the constraint.
+func checkCueVersion(embedded, language, constraint string) error {
+	if language == "" && constraint == "" {
+		return nil
+	}
+
+	current, err := semver.NewVersion(embedded)
+	if err != nil {
+		return fmt.Errorf("unable to determine the CUE version of the controller from '%s'", embedded)
+	}
+
+	if language != "" {
+		required, err := semver.NewVersion(language)
+		if err != nil {
+			return fmt.Errorf("invalid language.version '%s' in cue.mod/module.cue: %w", language, err)
+		}
+		if current.LessThan(required) {
+			return fmt.Errorf("the module requires the CUE language version %s, the controller embeds CUE %s", language, embedded)
+		}
+	}
+
+	if constraint != "" {
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return fmt.Errorf("invalid CUE version constraint '%s': %w", constraint, err)
+		}
+		if !c.Check(current) {
+			return fmt.Errorf("the CUE version %s of the controller doesn't satisfy the constraint '%s'", embedded, constraint)
+		}
+	}
+	return nil
+}
+
+// checkModuleCueVersion checks the embedded CUE version against the language
+// version of the module found at root and the constraint of the CueInstance.
+func checkModuleCueVersion(root, constraint string) error {
+	language, err := moduleLanguageVersion(root)
+	if err != nil {
+		return err
+	}
+	return checkCueVersion(embeddedCueVersion(), language, constraint)
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCheckCueVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		language   string
+		constraint string
+		wantErr    string
+	}{
+		{name: "no requirements"},
+		{name: "older language version", language: "v0.4.0"},
+		{name: "newer language version", language: "v0.9.0", wantErr: "requires the CUE language version v0.9.0"},
+		{name: "invalid language version", language: "latest", wantErr: "invalid language.version"},
+		{name: "satisfied constraint", constraint: ">=0.4.0 <0.5.0"},
+		{name: "unsatisfied constraint", constraint: "~0.5", wantErr: "doesn't satisfy the constraint '~0.5'"},
+		{name: "invalid constraint", constraint: "not a range", wantErr: "invalid CUE version constraint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := checkCueVersion("v0.4.2", tt.language, tt.constraint)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			}
+		})
+	}
+
+	t.Run("the embedded version is known", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(checkCueVersion(embeddedCueVersion(), "", ">=0.4.0")).To(Succeed())
+	})
+}
+
+func TestModuleLanguageVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	root := t.TempDir()
+	version, err := moduleLanguageVersion(root)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(BeEmpty())
+
+	g.Expect(os.MkdirAll(filepath.Join(root, "cue.mod"), 0o755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(root, "cue.mod", "module.cue"), []byte(`module: "example.com/app"`), 0o644)).To(Succeed())
+	version, err = moduleLanguageVersion(root)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(BeEmpty())
+
+	g.Expect(os.WriteFile(filepath.Join(root, "cue.mod", "module.cue"), []byte(`
+module: "example.com/app"
+language: version: "v0.9.0"
+`), 0o644)).To(Succeed())
+	version, err = moduleLanguageVersion(root)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(Equal("v0.9.0"))
+
+	g.Expect(checkModuleCueVersion(root, "")).To(MatchError(ContainSubstring("requires the CUE language version v0.9.0")))
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	gojson "encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/pelletier/go-toml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// applyDataFiles fills the value of the CUE instance with the contents of the
+// data files of the spec, each file being placed at the path of its glob under
+// a field named after the file without its extension.
+func applyDataFiles(cctx *cue.Context, req BuildRequest, value cue.Value) (cue.Value, error) {
+	for _, df := range req.Spec.DataFiles {
+		files, err := globDataFiles(req.Root, df)
+		if err != nil {
+			return value, err
+		}
+
+		path := cue.ParsePath(df.Path)
+		if err := path.Err(); err != nil {
+			return value, fmt.Errorf("invalid data files path '%s': %w", df.Path, err)
+		}
+
+		names := make(map[string]string, len(files))
+		for _, file := range files {
+			rel, _ := filepath.Rel(req.Root, file)
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			if other, ok := names[name]; ok {
+				return value, fmt.Errorf("data files '%s' and '%s' have the same name", other, rel)
+			}
+			names[name] = rel
+
+			v, err := loadDataFile(cctx, file)
+			if err != nil {
+				return value, fmt.Errorf("data file '%s': %w", rel, err)
+			}
+			value = value.FillPath(cue.MakePath(append(path.Selectors(), cue.Str(name))...), v)
+		}
+	}
+	return value, nil
+}
+
+// globDataFiles returns the absolute paths of the files matching the glob,
+// which is relative to the module root and may not escape it.
+func globDataFiles(root string, df cuev1alpha1.DataFile) ([]string, error) {
+	if filepath.IsAbs(df.Glob) || strings.Contains(df.Glob, "..") {
+		return nil, fmt.Errorf("invalid data files glob '%s': must be relative to the module root", df.Glob)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(root, df.Glob))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data files glob '%s': %w", df.Glob, err)
+	}
+
+	var files []string
+	for _, match := range matches {
+		rel, err := filepath.Rel(root, match)
+		if err != nil {
+			return nil, err
+		}
+		// resolve the symlinks within the module root
+		file, err := securejoin.SecureJoin(root, rel)
+		if err != nil {
+			return nil, err
+		}
+		if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no data files match '%s'", df.Glob)
+	}
+	return files, nil
+}
+
+// loadDataFile builds the value of a YAML, JSON or TOML file.
+func loadDataFile(cctx *cue.Context, path string) (cue.Value, error) {
+	expr, err := extractDataFile(path, strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")))
+	if err != nil {
+		return cue.Value{}, err
+	}
+	return cctx.BuildExpr(expr), nil
+}
+
+// extractDataFile parses a file of the given format, that is yaml, yml,
+// json or toml, into a CUE expression.
+func extractDataFile(path, format string) (ast.Expr, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "yaml", "yml":
+		f, err := yaml.Extract(path, data)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.StructLit{Elts: f.Decls}, nil
+	case "json":
+		return json.Extract(path, data)
+	case "toml":
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data, err := gojson.Marshal(tree.ToMap())
+		if err != nil {
+			return nil, err
+		}
+		return json.Extract(path, data)
+	default:
+		return nil, fmt.Errorf("unsupported file format '%s'", format)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"github.com/hashicorp/go-retryablehttp"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// maxDownloadAttempts is the maximum number of times the download of an
+// artifact is resumed after its transfer was interrupted.
+const maxDownloadAttempts = 3
+
+// ArtifactDownloadOptions configure the HTTP client fetching the artifacts.
+type ArtifactDownloadOptions struct {
+	// CAFile is the path of a PEM bundle of certificate authorities
+	// trusted in addition to the system ones.
+	CAFile string
+
+	// Proxy is the URL of the proxy the artifacts are fetched through,
+	// it defaults to the HTTPS_PROXY and HTTP_PROXY environment variables.
+	Proxy string
+}
+
+// newArtifactHTTPClient returns the retryable HTTP client used for fetching
+// artifacts. By default it retries 10 times within a 3.5 minutes window.
+func newArtifactHTTPClient(retries int, opts ArtifactDownloadOptions) (*retryablehttp.Client, error) {
+	httpClient := retryablehttp.NewClient()
+	httpClient.RetryWaitMin = 5 * time.Second
+	httpClient.RetryWaitMax = 30 * time.Second
+	httpClient.RetryMax = retries
+	httpClient.Logger = nil
+
+	transport, ok := httpClient.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return httpClient, nil
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the artifact CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the artifact CA file '%s'", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return httpClient, nil
+}
+
+func (r *CueInstanceReconciler) download(ctx context.Context, artifact *sourcev1.Artifact, tmpDir string, extract ExtractOptions) error {
+	u, err := url.Parse(artifact.URL)
+	if err != nil {
+		return err
+	}
+
+	var buf *bytes.Buffer
+	if dir, ok := r.localArtifactPath(u); ok {
+		// archive the local source again in case it has changed since its revision was computed
+		data, err := archiveDirectory(dir)
+		if err != nil {
+			return fmt.Errorf("failed to archive directory, error: %w", err)
+		}
+		buf = bytes.NewBuffer(data)
+	} else {
+		artifactURL := artifact.URL
+		if hostname := os.Getenv("SOURCE_CONTROLLER_LOCALHOST"); hostname != "" {
+			u.Host = hostname
+			artifactURL = u.String()
+		}
+		if cached, ok := r.artifactCache.get(artifact); ok {
+			buf = cached
+		} else {
+			if buf, err = fetchArtifact(ctx, r.httpClient, artifactURL); err != nil {
+				return err
+			}
+
+			// verify checksum matches origin
+			if err := verifyArtifact(artifact, buf.Bytes()); err != nil {
+				return err
+			}
+
+			if err := r.artifactCache.put(artifact, buf.Bytes()); err != nil {
+				ctrl.LoggerFrom(ctx).Error(err, "failed to cache artifact", "revision", artifact.Revision)
+			}
+		}
+	}
+
+	// extract
+	if err := extractArtifact(buf, tmpDir, extract); err != nil {
+		return fmt.Errorf("failed to untar artifact, error: %w", err)
+	}
+
+	return nil
+}
+
+// fetchArtifact downloads the artifact, the requests failing with a network
+// or server error are retried by the client while the transfers interrupted
+// after the response was received are resumed with range requests.
+func fetchArtifact(ctx context.Context, httpClient *retryablehttp.Client, artifactURL string) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	var copyErr error
+	for attempt := 0; attempt < maxDownloadAttempts; attempt++ {
+		req, err := retryablehttp.NewRequest(http.MethodGet, artifactURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a new request: %w", err)
+		}
+		req = req.WithContext(ctx)
+		offset := buf.Len()
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download artifact, error: %w", err)
+		}
+
+		switch {
+		case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+			// resume from the received bytes
+		case resp.StatusCode == http.StatusOK:
+			// the server doesn't support range requests, start over
+			buf.Reset()
+		default:
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download artifact from %s, status: %s", artifactURL, resp.Status)
+		}
+
+		_, copyErr = io.Copy(&buf, resp.Body)
+		resp.Body.Close()
+		if copyErr == nil {
+			return &buf, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("failed to download artifact from %s after %d attempts, error: %w",
+		artifactURL, maxDownloadAttempts, copyErr)
+}
+
+func verifyArtifact(artifact *sourcev1.Artifact, data []byte) error {
+	var hasher hash.Hash = sha256.New()
+
+	// for backwards compatibility with source-controller v0.17.2 and older
+	if len(artifact.Checksum) == 40 {
+		hasher = sha1.New()
+	}
+
+	// compute checksum
+	hasher.Write(data)
+
+	if checksum := fmt.Sprintf("%x", hasher.Sum(nil)); checksum != artifact.Checksum {
+		return fmt.Errorf("failed to verify artifact: computed checksum '%s' doesn't match advertised '%s'",
+			checksum, artifact.Checksum)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	. "github.com/onsi/gomega"
+)
+
+func TestFetchArtifact_Resume(t *testing.T) {
+	g := NewWithT(t)
+
+	content := strings.Repeat("artifact", 1024)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") == "" {
+			// interrupt the transfer halfway through the body
+			conn, bufrw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(bufrw, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(content), content[:len(content)/2])
+			bufrw.Flush()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, r, "artifact.tar.gz", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	httpClient, err := newArtifactHTTPClient(0, ArtifactDownloadOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	buf, err := fetchArtifact(context.TODO(), httpClient, server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal(content))
+	g.Expect(ranges).To(Equal([]string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}))
+
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	g.Expect(verifyArtifact(&sourcev1.Artifact{Checksum: checksum}, buf.Bytes())).To(Succeed())
+	g.Expect(verifyArtifact(&sourcev1.Artifact{Checksum: strings.Repeat("0", 64)}, buf.Bytes())).
+		To(MatchError(ContainSubstring("doesn't match advertised")))
+}
+
+func TestNewArtifactHTTPClient_CAFile(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("artifact"))
+	}))
+	defer server.Close()
+
+	untrusted, err := newArtifactHTTPClient(0, ArtifactDownloadOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = fetchArtifact(context.TODO(), untrusted, server.URL)
+	g.Expect(err).To(HaveOccurred())
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	g.Expect(os.WriteFile(caFile, caPEM, 0o600)).To(Succeed())
+
+	trusted, err := newArtifactHTTPClient(0, ArtifactDownloadOptions{CAFile: caFile})
+	g.Expect(err).NotTo(HaveOccurred())
+	buf, err := fetchArtifact(context.TODO(), trusted, server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("artifact"))
+
+	g.Expect(os.WriteFile(caFile, []byte("not a certificate"), 0o600)).To(Succeed())
+	_, err = newArtifactHTTPClient(0, ArtifactDownloadOptions{CAFile: caFile})
+	g.Expect(err).To(MatchError(ContainSubstring("no certificates found")))
+}
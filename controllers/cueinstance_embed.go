@@ -0,0 +1,208 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+	securejoin "github.com/cyphar/filepath-securejoin"
+)
+
+// embedFiles unifies the fields of the instance carrying an @embed attribute
+// with the contents of the files it refers to, e.g.
+//
+//	script: string @embed(file="scripts/init.sh", type=text)
+//	config: _ @embed(file="config.yaml")
+//	dashboards: _ @embed(glob="dashboards/*.json")
+//
+// The paths are relative to the directory of the CUE file and may not escape
+// the module root. The format of the files defaults to their extension, the
+// files matched by a glob are keyed by their path.
+func embedFiles(inst *build.Instance, root string) error {
+	var errs cueerrors.Error
+	for _, f := range inst.Files {
+		ast.Walk(f, func(n ast.Node) bool {
+			field, ok := n.(*ast.Field)
+			if !ok {
+				return true
+			}
+			for _, attr := range field.Attrs {
+				if key, _ := attr.Split(); key != "embed" {
+					continue
+				}
+				expr, err := embedAttr(attr, filepath.Dir(f.Filename), root)
+				if err != nil {
+					errs = cueerrors.Append(errs, cueerrors.Newf(attr.Pos(), "@embed: %v", err))
+					continue
+				}
+				field.Value = &ast.BinaryExpr{X: field.Value, Op: token.AND, Y: expr}
+			}
+			return true
+		}, nil)
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// embedAttr returns the expression of the files an @embed attribute refers to.
+func embedAttr(attr *ast.Attribute, dir, root string) (ast.Expr, error) {
+	_, body := attr.Split()
+	args, err := parseAttrArgs(body)
+	if err != nil {
+		return nil, err
+	}
+
+	file, glob := args["file"], args["glob"]
+	switch {
+	case file != "" && glob != "":
+		return nil, fmt.Errorf("only one of file or glob may be specified")
+	case file != "":
+		path, err := embedPath(root, dir, file)
+		if err != nil {
+			return nil, err
+		}
+		if path, err = resolvePath(root, path); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("file '%s' not found", file)
+		}
+		return embedFile(path, args["type"])
+	case glob != "":
+		pattern, err := embedPath(root, dir, glob)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		st := &ast.StructLit{}
+		for _, match := range matches {
+			path, err := resolvePath(root, match)
+			if err != nil {
+				return nil, err
+			}
+			if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+				continue
+			}
+			expr, err := embedFile(path, args["type"])
+			if err != nil {
+				return nil, err
+			}
+			label, _ := filepath.Rel(dir, match)
+			st.Elts = append(st.Elts, &ast.Field{Label: ast.NewString(filepath.ToSlash(label)), Value: expr})
+		}
+		return st, nil
+	default:
+		return nil, fmt.Errorf("one of file or glob must be specified")
+	}
+}
+
+// embedPath returns the absolute path of a file relative to dir,
+// which must be within the module root.
+func embedPath(root, dir, file string) (string, error) {
+	if filepath.IsAbs(file) {
+		return "", fmt.Errorf("path '%s' must be relative", file)
+	}
+	rel, err := filepath.Rel(root, filepath.Join(dir, file))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path '%s' is outside of the module root", file)
+	}
+	return filepath.Join(root, rel), nil
+}
+
+// resolvePath resolves the symlinks of a path within the module root.
+func resolvePath(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	return securejoin.SecureJoin(root, rel)
+}
+
+// embedFile returns the expression of a file, a string for the text type.
+func embedFile(path, format string) (ast.Expr, error) {
+	if format == "" {
+		format = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	}
+	if format != "text" {
+		return extractDataFile(path, format)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewString(string(data)), nil
+}
+
+// parseAttrArgs parses the comma separated key=value arguments of an
+// attribute body, the values may be quoted.
+func parseAttrArgs(body string) (map[string]string, error) {
+	args := map[string]string{}
+	for len(strings.TrimSpace(body)) > 0 {
+		var arg string
+		arg, body = splitAttrArg(body)
+		kv := strings.SplitN(strings.TrimSpace(arg), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid argument '%s'", strings.TrimSpace(arg))
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of '%s': %w", key, err)
+			}
+			value = unquoted
+		}
+		args[key] = value
+	}
+	return args, nil
+}
+
+// splitAttrArg returns the first argument of an attribute body and the rest
+// of the body, the commas within quoted values are not separators.
+func splitAttrArg(body string) (arg, rest string) {
+	quoted := false
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return body[:i], body[i+1:]
+			}
+		}
+	}
+	return body, ""
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestBuildInstance_Embed(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+	data: {
+		"init.sh":     string @embed(file="scripts/init.sh", type=text)
+		"replicas":    "\(config.replicas)"
+		"dashboards":  "\(len(dashboards))"
+	}
+}]
+
+config: {replicas: int} @embed(file="files/config.yaml")
+dashboards: _ @embed(glob="dashboards/*.json")
+`)
+	files := map[string]string{
+		"scripts/init.sh":      "#!/bin/sh\necho \"init\"\n",
+		"files/config.yaml":    "replicas: 3\n",
+		"dashboards/app.json":  `{"title": "app"}`,
+		"dashboards/node.json": `{"title": "node"}`,
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		NewWithT(t).Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		NewWithT(t).Expect(os.WriteFile(path, []byte(data), 0o644)).To(Succeed())
+	}
+
+	t.Run("embeds the files", func(t *testing.T) {
+		g := NewWithT(t)
+
+		result, err := buildInstance(BuildRequest{Root: root, Dir: root})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].Object["data"]).To(Equal(map[string]interface{}{
+			"init.sh":    "#!/bin/sh\necho \"init\"\n",
+			"replicas":   "3",
+			"dashboards": "2",
+		}))
+	})
+
+	t.Run("rejects files outside of the module", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(os.WriteFile(filepath.Join(root, "escape.cue"), []byte(`package app
+
+secret: string @embed(file="../secret.txt", type=text)
+`), 0o644)).To(Succeed())
+		defer os.Remove(filepath.Join(root, "escape.cue"))
+
+		_, err := buildInstance(BuildRequest{Root: root, Dir: root})
+		g.Expect(err).To(MatchError(ContainSubstring("@embed: path '../secret.txt' is outside of the module root")))
+	})
+}
+
+func TestParseAttrArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	args, err := parseAttrArgs(`file="a,b.txt", type=text`)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args).To(Equal(map[string]string{"file": "a,b.txt", "type": "text"}))
+
+	_, err = parseAttrArgs(`file`)
+	g.Expect(err).To(MatchError("invalid argument 'file'"))
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cueerrors "cuelang.org/go/cue/errors"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxBuildErrors is the maximum number of build errors recorded in the status.
+const maxBuildErrors = 50
+
+// buildErrors converts err into a list of structured build errors.
+// CUE errors are expanded into one entry per error, with positions
+// made relative to the module root; other errors result in a single entry.
+func buildErrors(err error, root string) []cuev1alpha1.BuildError {
+	var cueErr cueerrors.Error
+	if !errors.As(err, &cueErr) {
+		return []cuev1alpha1.BuildError{{Message: err.Error()}}
+	}
+
+	var result []cuev1alpha1.BuildError
+	for _, e := range cueerrors.Errors(cueErr) {
+		if len(result) == maxBuildErrors {
+			break
+		}
+		format, args := e.Msg()
+		be := cuev1alpha1.BuildError{
+			Message: fmt.Sprintf(format, args...),
+			Path:    strings.Join(e.Path(), "."),
+		}
+		if positions := cueerrors.Positions(e); len(positions) > 0 {
+			pos := positions[0]
+			filename := pos.Filename()
+			if rel, err := filepath.Rel(root, filename); err == nil && !strings.HasPrefix(rel, "..") {
+				filename = rel
+			}
+			be.Position = fmt.Sprintf("%s:%d:%d", filename, pos.Line(), pos.Column())
+		}
+		result = append(result, be)
+	}
+	return result
+}
+
+// positionedError is a build error whose message lists the
+// positions of the underlying CUE errors.
+type positionedError struct {
+	msg string
+	err error
+}
+
+func (e *positionedError) Error() string {
+	return e.msg
+}
+
+func (e *positionedError) Unwrap() error {
+	return e.err
+}
+
+// withErrorPositions rewrites the message of err so that each of the
+// CUE errors it contains is prefixed by its position relative to the
+// module root. Errors which do not contain CUE errors are returned as is.
+func withErrorPositions(err error, errs []cuev1alpha1.BuildError) error {
+	var cueErr cueerrors.Error
+	if !errors.As(err, &cueErr) || len(errs) == 0 {
+		return err
+	}
+
+	lines := make([]string, 0, len(errs))
+	for _, e := range errs {
+		var b strings.Builder
+		if e.Position != "" {
+			b.WriteString(e.Position + ": ")
+		}
+		if e.Path != "" {
+			b.WriteString(e.Path + ": ")
+		}
+		b.WriteString(e.Message)
+		lines = append(lines, b.String())
+	}
+
+	// keep the context added when wrapping the CUE error, e.g. "cue validation failed: "
+	prefix := strings.TrimSuffix(err.Error(), cueErr.Error())
+	return &positionedError{
+		msg: prefix + strings.Join(lines, "\n"),
+		err: err,
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestBuildErrors(t *testing.T) {
+	g := NewWithT(t)
+
+	root := writeCueModule(t, `package app
+
+out: {
+	replicas: 1 & 2
+	name:     "app" & 3
+}
+`)
+
+	result, err := buildInstance(BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{Exprs: []string{"out"}},
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(result.Errors).To(HaveLen(2))
+	for _, e := range result.Errors {
+		g.Expect(e.Message).NotTo(BeEmpty())
+		g.Expect(e.Path).To(HavePrefix("out."))
+		g.Expect(e.Position).To(HavePrefix("app.cue:"))
+	}
+
+	t.Run("prefixes the error message with the positions", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(err.Error()).To(HavePrefix("app.cue:4:12: out.replicas: conflicting values"))
+		g.Expect(err.Error()).To(ContainSubstring("\napp.cue:5:"))
+		g.Expect(err.Error()).NotTo(ContainSubstring(root))
+	})
+
+	t.Run("keeps the context of wrapped errors", func(t *testing.T) {
+		g := NewWithT(t)
+		err := fmt.Errorf("cue validation failed: %w", cueerrors.Newf(token.NoPos, "invalid value"))
+		errs := []cuev1alpha1.BuildError{{Message: "invalid value", Path: "out", Position: "app.cue:1:1"}}
+		g.Expect(withErrorPositions(err, errs).Error()).To(Equal("cue validation failed: app.cue:1:1: out: invalid value"))
+		g.Expect(errors.Unwrap(withErrorPositions(err, errs))).To(Equal(err))
+	})
+
+	t.Run("wraps other errors", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(buildErrors(errors.New("boom"), root)).To(Equal([]cuev1alpha1.BuildError{{Message: "boom"}}))
+	})
+}
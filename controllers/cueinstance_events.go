@@ -0,0 +1,148 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxSummaryLength is the maximum length of the summary of a commit status,
+// the limit of the descriptions of the GitHub commit statuses.
+const maxSummaryLength = 140
+
+// EventFilterOptions configure the deduplication and rate limiting of events.
+type EventFilterOptions struct {
+	// DedupWindow is the period during which identical error events
+	// of a CueInstance are emitted only once, zero disables deduplication.
+	DedupWindow time.Duration
+
+	// RateLimit is the maximum number of events emitted per minute
+	// for each CueInstance, zero disables rate limiting.
+	RateLimit int
+}
+
+// eventFilter deduplicates identical error events and
+// rate limits the events of each CueInstance.
+type eventFilter struct {
+	opts EventFilterOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	history map[types.NamespacedName]*eventHistory
+}
+
+type eventHistory struct {
+	limiter *rate.Limiter
+
+	// the last error event and the number of times it was suppressed
+	lastError  string
+	lastSent   time.Time
+	suppressed int
+}
+
+func newEventFilter(opts EventFilterOptions) *eventFilter {
+	return &eventFilter{
+		opts:    opts,
+		now:     time.Now,
+		history: map[types.NamespacedName]*eventHistory{},
+	}
+}
+
+// allow reports whether the event should be emitted and returns its message,
+// which mentions how many times the event was suppressed since it was last emitted.
+// The events reporting the result of a reconciliation are not rate limited, and
+// only the successful results reset the deduplication of the error events.
+func (f *eventFilter) allow(key types.NamespacedName, severity, revision, msg string, result bool) (string, bool) {
+	if f == nil {
+		return msg, true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, ok := f.history[key]
+	if !ok {
+		h = &eventHistory{}
+		if f.opts.RateLimit > 0 {
+			h.limiter = rate.NewLimiter(rate.Limit(float64(f.opts.RateLimit)/60), f.opts.RateLimit)
+		}
+		f.history[key] = h
+	}
+
+	now := f.now()
+	if severity == events.EventSeverityError && f.opts.DedupWindow > 0 {
+		id := revision + "/" + msg
+		if id == h.lastError && now.Sub(h.lastSent) < f.opts.DedupWindow {
+			h.suppressed++
+			return msg, false
+		}
+		if id == h.lastError && h.suppressed > 0 {
+			msg = fmt.Sprintf("%s (repeated %d times)", msg, h.suppressed+1)
+		}
+		h.lastError = id
+		h.lastSent = now
+		h.suppressed = 0
+	} else if severity != events.EventSeverityError && result {
+		// a successful reconciliation resets the deduplication
+		h.lastError = ""
+		h.suppressed = 0
+	}
+
+	if h.limiter != nil && !result && !h.limiter.AllowN(now, 1) {
+		return msg, false
+	}
+
+	return msg, true
+}
+
+// forget drops the history of a deleted CueInstance.
+func (f *eventFilter) forget(key types.NamespacedName) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.history, key)
+}
+
+// commitStatusMetadata returns the metadata of the events reporting the result
+// of the reconciliation of a source revision, which the Git providers of the
+// notification-controller use to set the status of the commit.
+func commitStatusMetadata(cueInstance cuev1alpha1.CueInstance, msg string) map[string]string {
+	summary := strings.TrimSpace(msg)
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = strings.TrimSpace(summary[:i])
+	}
+	if runes := []rune(summary); len(runes) > maxSummaryLength {
+		summary = string(runes[:maxSummaryLength-3]) + "..."
+	}
+
+	return map[string]string{
+		"commit_status": "update",
+		"kind":          cueInstance.Spec.SourceRef.Kind,
+		"summary":       summary,
+	}
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestEventFilter(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "app"}
+	now := time.Now()
+
+	newFilter := func(opts EventFilterOptions) *eventFilter {
+		f := newEventFilter(opts)
+		f.now = func() time.Time { return now }
+		return f
+	}
+
+	t.Run("deduplicates identical errors", func(t *testing.T) {
+		g := NewWithT(t)
+		f := newFilter(EventFilterOptions{DedupWindow: 10 * time.Minute})
+
+		_, ok := f.allow(key, events.EventSeverityError, "main/1", "build failed", false)
+		g.Expect(ok).To(BeTrue())
+
+		for i := 0; i < 3; i++ {
+			_, ok = f.allow(key, events.EventSeverityError, "main/1", "build failed", false)
+			g.Expect(ok).To(BeFalse())
+		}
+
+		_, ok = f.allow(key, events.EventSeverityError, "main/2", "build failed", false)
+		g.Expect(ok).To(BeTrue())
+		_, ok = f.allow(key, events.EventSeverityError, "main/2", "build failed", false)
+		g.Expect(ok).To(BeFalse())
+
+		now = now.Add(11 * time.Minute)
+		msg, ok := f.allow(key, events.EventSeverityError, "main/2", "build failed", false)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(msg).To(Equal("build failed (repeated 2 times)"))
+
+		// the info events of a failing reconciliation keep the deduplication
+		_, ok = f.allow(key, events.EventSeverityInfo, "main/2", "pruned objects", false)
+		g.Expect(ok).To(BeTrue())
+		_, ok = f.allow(key, events.EventSeverityError, "main/2", "build failed", true)
+		g.Expect(ok).To(BeFalse())
+
+		_, ok = f.allow(key, events.EventSeverityInfo, "main/2", "reconciliation finished", true)
+		g.Expect(ok).To(BeTrue())
+		msg, ok = f.allow(key, events.EventSeverityError, "main/2", "build failed", true)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(msg).To(Equal("build failed"))
+	})
+
+	t.Run("rate limits each instance", func(t *testing.T) {
+		g := NewWithT(t)
+		f := newFilter(EventFilterOptions{RateLimit: 2})
+
+		for i := 0; i < 2; i++ {
+			_, ok := f.allow(key, events.EventSeverityInfo, "main/1", "applied", false)
+			g.Expect(ok).To(BeTrue())
+		}
+		_, ok := f.allow(key, events.EventSeverityInfo, "main/1", "applied", false)
+		g.Expect(ok).To(BeFalse())
+
+		other := types.NamespacedName{Namespace: "default", Name: "other"}
+		_, ok = f.allow(other, events.EventSeverityInfo, "main/1", "applied", false)
+		g.Expect(ok).To(BeTrue())
+
+		// the results of the reconciliations are not rate limited
+		_, ok = f.allow(key, events.EventSeverityInfo, "main/1", "reconciliation finished", true)
+		g.Expect(ok).To(BeTrue())
+
+		now = now.Add(time.Minute)
+		_, ok = f.allow(key, events.EventSeverityInfo, "main/1", "applied", false)
+		g.Expect(ok).To(BeTrue())
+
+		f.forget(key)
+		g.Expect(f.history).NotTo(HaveKey(key))
+	})
+
+	t.Run("nil filter allows everything", func(t *testing.T) {
+		g := NewWithT(t)
+		var f *eventFilter
+		_, ok := f.allow(key, events.EventSeverityError, "main/1", "build failed", false)
+		g.Expect(ok).To(BeTrue())
+	})
+}
+
+func TestCommitStatusMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	instance := cuev1alpha1.CueInstance{
+		Spec: cuev1alpha1.CueInstanceSpec{
+			SourceRef: cuev1alpha1.CrossNamespaceSourceReference{Kind: "GitRepository", Name: "app"},
+		},
+	}
+
+	metadata := commitStatusMetadata(instance, "Applied revision: main/8d1b5a3")
+	g.Expect(metadata).To(Equal(map[string]string{
+		"commit_status": "update",
+		"kind":          "GitRepository",
+		"summary":       "Applied revision: main/8d1b5a3",
+	}))
+
+	metadata = commitStatusMetadata(instance, "build failed:\nfield not allowed")
+	g.Expect(metadata).To(HaveKeyWithValue("summary", "build failed:"))
+
+	metadata = commitStatusMetadata(instance, strings.Repeat("a", 200))
+	g.Expect(metadata["summary"]).To(HaveLen(maxSummaryLength))
+	g.Expect(metadata["summary"]).To(HaveSuffix("..."))
+
+	metadata = commitStatusMetadata(instance, strings.Repeat("é", 200))
+	g.Expect(utf8.ValidString(metadata["summary"])).To(BeTrue())
+	g.Expect([]rune(metadata["summary"])).To(HaveLen(maxSummaryLength))
+}
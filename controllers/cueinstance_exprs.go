@@ -0,0 +1,50 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// resolveExprs returns the expressions of the spec followed by
+// the expressions loaded from the referenced ConfigMap.
+func (r *CueInstanceReconciler) resolveExprs(ctx context.Context, namespace string, spec cuev1alpha1.CueInstanceSpec) ([]string, error) {
+	if spec.ExprsFrom == nil {
+		return spec.Exprs, nil
+	}
+
+	ref := spec.ExprsFrom
+	name := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, name, &cm); err != nil {
+		return nil, fmt.Errorf("unable to load expressions from ConfigMap '%s': %w", name, err)
+	}
+
+	data, ok := cm.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found in ConfigMap '%s'", ref.Key, name)
+	}
+
+	return append(append([]string{}, spec.Exprs...), ParseExpressions(data)...), nil
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveExprs(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "selectors", Namespace: "default"},
+		Data:       map[string]string{"standard": "out.deployments\n\n  out.services  \n"},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap).Build(),
+	}
+
+	spec := cuev1alpha1.CueInstanceSpec{Exprs: []string{"out.namespace"}}
+	g.Expect(r.resolveExprs(context.TODO(), "default", spec)).To(Equal([]string{"out.namespace"}))
+
+	spec.ExprsFrom = &cuev1alpha1.ExpressionsSource{Name: "selectors", Key: "standard"}
+	g.Expect(r.resolveExprs(context.TODO(), "default", spec)).To(Equal([]string{"out.namespace", "out.deployments", "out.services"}))
+	g.Expect(spec.Exprs).To(Equal([]string{"out.namespace"}))
+
+	spec.ExprsFrom.Key = "missing"
+	_, err := r.resolveExprs(context.TODO(), "default", spec)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = r.resolveExprs(context.TODO(), "other", spec)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// ExtractOptions configure the limits enforced when extracting
+// the source artifacts, they can be overridden by each CueInstance.
+type ExtractOptions struct {
+	// MaxSize is the maximum total size in bytes of the
+	// extracted files, zero means unlimited.
+	MaxSize int64
+
+	// MaxFiles is the maximum number of extracted files, zero means unlimited.
+	MaxFiles int
+
+	// Symlinks determines how the symbolic links are extracted,
+	// they are rejected by default.
+	Symlinks cuev1alpha1.SymlinkPolicy
+}
+
+// withOverrides returns the options overridden by the ones of the CueInstance.
+func (o ExtractOptions) withOverrides(overrides *cuev1alpha1.ExtractOptions) ExtractOptions {
+	if overrides == nil {
+		return o
+	}
+	if overrides.MaxSize != nil {
+		o.MaxSize = overrides.MaxSize.Value()
+	}
+	if overrides.MaxFiles != nil {
+		o.MaxFiles = *overrides.MaxFiles
+	}
+	if overrides.Symlinks != "" {
+		o.Symlinks = overrides.Symlinks
+	}
+	return o
+}
+
+// extractArtifact reads the gzip-compressed tarball from r and writes it
+// into dir, failing as soon as one of the limits is exceeded.
+func extractArtifact(r io.Reader, dir string, opts ExtractOptions) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("requires gzip-compressed body: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	var size int64
+	files := 0
+	var symlinks []string
+	for {
+		f, err := tr.Next()
+		if err == io.EOF {
+			return checkSymlinks(dir, symlinks)
+		}
+		if err != nil {
+			return fmt.Errorf("tar error: %w", err)
+		}
+		if !validRelPath(f.Name) {
+			return fmt.Errorf("tar contained invalid name error %q", f.Name)
+		}
+		// resolve the symlinks extracted so far within dir
+		abs, err := securejoin.SecureJoin(dir, filepath.FromSlash(f.Name))
+		if err != nil {
+			return err
+		}
+
+		switch f.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(abs, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			files++
+			if opts.MaxFiles > 0 && files > opts.MaxFiles {
+				return fmt.Errorf("artifact exceeds the limit of %d files", opts.MaxFiles)
+			}
+			size += f.Size
+			if opts.MaxSize > 0 && size > opts.MaxSize {
+				return fmt.Errorf("artifact exceeds the size limit of %d bytes", opts.MaxSize)
+			}
+			if err := writeFile(abs, tr, f); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			switch opts.Symlinks {
+			case cuev1alpha1.SkipSymlinks:
+				continue
+			case cuev1alpha1.AllowSymlinks:
+				target := filepath.Join(filepath.Dir(abs), filepath.FromSlash(f.Linkname))
+				if filepath.IsAbs(f.Linkname) || !withinDir(dir, target) {
+					return fmt.Errorf("tar symlink %s points outside the artifact: %s", f.Name, f.Linkname)
+				}
+				if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+					return err
+				}
+				if err := os.Symlink(f.Linkname, abs); err != nil {
+					return err
+				}
+				symlinks = append(symlinks, abs)
+			default:
+				return fmt.Errorf("tar file entry %s is a symlink, symlinks are rejected", f.Name)
+			}
+		default:
+			return fmt.Errorf("tar file entry %s contained unsupported file type %v", f.Name, f.FileInfo().Mode())
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, f *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	wf, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, f.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(wf, r)
+	if closeErr := wf.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to %s: %w", path, err)
+	}
+	if n != f.Size {
+		return fmt.Errorf("only wrote %d bytes to %s; expected %d", n, path, f.Size)
+	}
+	return nil
+}
+
+// checkSymlinks verifies that the extracted symlinks resolve inside dir once
+// all of them exist, since a link may point through links extracted after it.
+func checkSymlinks(dir string, symlinks []string) error {
+	if len(symlinks) == 0 {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	for _, link := range symlinks {
+		target, err := filepath.EvalSymlinks(link)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !withinDir(root, target) {
+			rel, _ := filepath.Rel(dir, link)
+			return fmt.Errorf("tar symlink %s points outside the artifact", filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+func validRelPath(p string) bool {
+	return p != "" && !strings.Contains(p, `\`) && !strings.HasPrefix(p, "/") && !strings.Contains(p, "../")
+}
+
+// withinDir reports whether the path is dir or one of its descendants.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestExtractArtifact(t *testing.T) {
+	type entry struct {
+		name, content, link string
+	}
+	archive := func(g *WithT, entries ...entry) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			if e.link != "" {
+				g.Expect(tw.WriteHeader(&tar.Header{Name: e.name, Linkname: e.link, Typeflag: tar.TypeSymlink})).To(Succeed())
+				continue
+			}
+			g.Expect(tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg})).To(Succeed())
+			_, err := tw.Write([]byte(e.content))
+			g.Expect(err).NotTo(HaveOccurred())
+		}
+		g.Expect(tw.Close()).To(Succeed())
+		g.Expect(gz.Close()).To(Succeed())
+		return &buf
+	}
+
+	files := []entry{
+		{name: "app/main.cue", content: "package app"},
+		{name: "app/values.cue", content: "package app\nreplicas: 3"},
+	}
+	withLink := func(link entry) []entry {
+		return append([]entry{{name: "shared/schema.cue", content: "package shared"}}, link)
+	}
+
+	tests := []struct {
+		name    string
+		entries []entry
+		opts    ExtractOptions
+		err     string
+	}{
+		{name: "unlimited", entries: files},
+		{name: "within limits", entries: files, opts: ExtractOptions{MaxFiles: 2, MaxSize: 64}},
+		{name: "too many files", entries: files, opts: ExtractOptions{MaxFiles: 1}, err: "artifact exceeds the limit of 1 files"},
+		{name: "too large", entries: files, opts: ExtractOptions{MaxSize: 16}, err: "artifact exceeds the size limit of 16 bytes"},
+		{
+			name:    "symlinks rejected by default",
+			entries: withLink(entry{name: "app/schema.cue", link: "../shared/schema.cue"}),
+			err:     "tar file entry app/schema.cue is a symlink, symlinks are rejected",
+		},
+		{
+			name:    "symlinks skipped",
+			entries: withLink(entry{name: "app/schema.cue", link: "../shared/schema.cue"}),
+			opts:    ExtractOptions{Symlinks: cuev1alpha1.SkipSymlinks},
+		},
+		{
+			name:    "symlinks allowed",
+			entries: withLink(entry{name: "app/schema.cue", link: "../shared/schema.cue"}),
+			opts:    ExtractOptions{Symlinks: cuev1alpha1.AllowSymlinks},
+		},
+		{
+			name:    "symlinks outside the artifact",
+			entries: withLink(entry{name: "app/token", link: "../../../var/run/secrets/token"}),
+			opts:    ExtractOptions{Symlinks: cuev1alpha1.AllowSymlinks},
+			err:     "tar symlink app/token points outside the artifact",
+		},
+		{
+			name: "symlinks escaping through later symlinks",
+			entries: append(withLink(entry{name: "escape", link: "shared/up/.."}),
+				entry{name: "shared/up", link: ".."}),
+			opts: ExtractOptions{Symlinks: cuev1alpha1.AllowSymlinks},
+			err:  "tar symlink escape points outside the artifact",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			dir := t.TempDir()
+			err := extractArtifact(archive(g, tt.entries...), dir, tt.opts)
+			if tt.err != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.err)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			if tt.opts.Symlinks == cuev1alpha1.AllowSymlinks {
+				data, err := os.ReadFile(filepath.Join(dir, "app", "schema.cue"))
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(string(data)).To(Equal("package shared"))
+			}
+		})
+	}
+}
+
+func TestExtractOptions_WithOverrides(t *testing.T) {
+	g := NewWithT(t)
+
+	defaults := ExtractOptions{MaxSize: 1 << 20, MaxFiles: 100, Symlinks: cuev1alpha1.RejectSymlinks}
+	g.Expect(defaults.withOverrides(nil)).To(Equal(defaults))
+
+	maxSize := resource.MustParse("1Gi")
+	maxFiles := 10000
+	g.Expect(defaults.withOverrides(&cuev1alpha1.ExtractOptions{MaxSize: &maxSize, MaxFiles: &maxFiles})).To(Equal(
+		ExtractOptions{MaxSize: 1 << 30, MaxFiles: 10000, Symlinks: cuev1alpha1.RejectSymlinks}))
+	g.Expect(defaults.withOverrides(&cuev1alpha1.ExtractOptions{Symlinks: cuev1alpha1.AllowSymlinks})).To(Equal(
+		ExtractOptions{MaxSize: 1 << 20, MaxFiles: 100, Symlinks: cuev1alpha1.AllowSymlinks}))
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestResourceOwner(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &CueInstanceReconciler{ControllerName: "cue-controller"}
+	cueInstance := cuev1alpha1.CueInstance{}
+	g.Expect(r.resourceOwner(cueInstance).Field).To(Equal("cue-controller"))
+
+	r.FieldManager = "platform"
+	g.Expect(r.resourceOwner(cueInstance).Field).To(Equal("platform"))
+
+	// the field manager of a CueInstance can't claim the fields of other managers
+	cueInstance.Spec.FieldManager = "kustomize-controller"
+	g.Expect(r.resourceOwner(cueInstance).Field).To(Equal("platform/kustomize-controller"))
+	g.Expect(r.resourceOwner(cueInstance).Group).To(Equal(cuev1alpha1.GroupVersion.Group))
+}
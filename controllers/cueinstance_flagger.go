@@ -0,0 +1,134 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// PromotionGatePath is the path of the promotion gate handler, it can be
+// used as a Flagger confirm-promotion webhook.
+const PromotionGatePath = "/gates/promotion"
+
+// setCanaryMetadata annotates the rendered Deployments and their pod templates
+// with the source revision, so that every CueInstance rollout starts a new
+// canary analysis that can be traced back to the revision.
+func setCanaryMetadata(objects []*unstructured.Unstructured, revision string) error {
+	key := cuev1alpha1.GroupVersion.Group + "/revision"
+	for _, obj := range objects {
+		if obj.GetAPIVersion() != "apps/v1" || obj.GetKind() != "Deployment" {
+			continue
+		}
+
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[key] = revision
+		obj.SetAnnotations(annotations)
+
+		if err := unstructured.SetNestedField(obj.Object, revision,
+			"spec", "template", "metadata", "annotations", key); err != nil {
+			return fmt.Errorf("unable to annotate the pod template of Deployment/%s: %w", obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// flaggerWebhookPayload is the payload Flagger sends to its webhooks.
+type flaggerWebhookPayload struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Phase     string            `json:"phase"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// NewPromotionGateHandler returns a handler which approves the promotion of a
+// canary only when the CueInstance which rendered it has been successfully
+// applied and is healthy. The CueInstance is looked up from the 'cueInstance'
+// and 'cueInstanceNamespace' webhook metadata, defaulting to the canary.
+func NewPromotionGateHandler(c client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload flaggerWebhookPayload
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("invalid payload: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		name := types.NamespacedName{Namespace: payload.Namespace, Name: payload.Name}
+		if v := payload.Metadata["cueInstance"]; v != "" {
+			name.Name = v
+		}
+		if v := payload.Metadata["cueInstanceNamespace"]; v != "" {
+			name.Namespace = v
+		}
+
+		var cueInstance cuev1alpha1.CueInstance
+		if err := c.Get(req.Context(), name, &cueInstance); err != nil {
+			status := http.StatusInternalServerError
+			if apierrors.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if err := promotionAllowed(cueInstance); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprintf(w, "promotion of revision %s approved", cueInstance.Status.LastAppliedRevision)
+	})
+}
+
+// promotionAllowed returns an error describing why the canaries
+// rendered by the CueInstance must not be promoted yet.
+func promotionAllowed(cueInstance cuev1alpha1.CueInstance) error {
+	if cueInstance.Spec.ProgressiveDelivery == nil {
+		return fmt.Errorf("progressive delivery is not enabled for '%s'", cueInstance.GetName())
+	}
+	if cueInstance.Generation != cueInstance.Status.ObservedGeneration {
+		return fmt.Errorf("generation %d has not been reconciled yet", cueInstance.Generation)
+	}
+	if !apimeta.IsStatusConditionTrue(cueInstance.Status.Conditions, meta.ReadyCondition) {
+		return fmt.Errorf("'%s' is not ready", cueInstance.GetName())
+	}
+	if apimeta.IsStatusConditionFalse(cueInstance.Status.Conditions, cuev1alpha1.HealthyCondition) {
+		return fmt.Errorf("'%s' is not healthy", cueInstance.GetName())
+	}
+	if cueInstance.Status.LastAppliedRevision != cueInstance.Status.LastAttemptedRevision {
+		return fmt.Errorf("revision %s has not been applied yet", cueInstance.Status.LastAttemptedRevision)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSetCanaryMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetName("podinfo")
+
+	service := &unstructured.Unstructured{}
+	service.SetAPIVersion("v1")
+	service.SetKind("Service")
+	service.SetName("podinfo")
+
+	g.Expect(setCanaryMetadata([]*unstructured.Unstructured{deployment, service}, "main/8d1b5a3")).To(Succeed())
+
+	key := cuev1alpha1.GroupVersion.Group + "/revision"
+	g.Expect(deployment.GetAnnotations()).To(HaveKeyWithValue(key, "main/8d1b5a3"))
+	template, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "annotations")
+	g.Expect(template).To(HaveKeyWithValue(key, "main/8d1b5a3"))
+	g.Expect(service.GetAnnotations()).To(BeEmpty())
+}
+
+func TestPromotionGateHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	instance := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "apps", Generation: 2},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			ProgressiveDelivery: &cuev1alpha1.ProgressiveDelivery{Provider: "flagger"},
+		},
+		Status: cuev1alpha1.CueInstanceStatus{
+			ObservedGeneration:    2,
+			LastAppliedRevision:   "main/8d1b5a3",
+			LastAttemptedRevision: "main/8d1b5a3",
+		},
+	}
+	apimeta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:   meta.ReadyCondition,
+		Status: metav1.ConditionTrue,
+		Reason: meta.ReconciliationSucceededReason,
+	})
+
+	pending := instance.DeepCopy()
+	pending.Name = "frontend"
+	pending.Status.LastAttemptedRevision = "main/0000000"
+
+	handler := NewPromotionGateHandler(fake.NewClientBuilder().WithScheme(scheme).WithObjects(instance, pending).Build())
+
+	tests := []struct {
+		name    string
+		payload string
+		status  int
+	}{
+		{name: "ready instance", payload: `{"name":"podinfo","namespace":"apps"}`, status: http.StatusOK},
+		{name: "instance from metadata", payload: `{"name":"canary","namespace":"apps","metadata":{"cueInstance":"podinfo"}}`, status: http.StatusOK},
+		{name: "revision not applied", payload: `{"name":"frontend","namespace":"apps"}`, status: http.StatusForbidden},
+		{name: "unknown instance", payload: `{"name":"backend","namespace":"apps"}`, status: http.StatusNotFound},
+		{name: "invalid payload", payload: `{`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, PromotionGatePath, strings.NewReader(tt.payload)))
+			g.Expect(rec.Code).To(Equal(tt.status), rec.Body.String())
+		})
+	}
+}
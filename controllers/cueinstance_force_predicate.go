@@ -0,0 +1,43 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// ForceRequestedPredicate triggers an update event when the
+// force request annotation of an object changes.
+type ForceRequestedPredicate struct {
+	predicate.Funcs
+}
+
+func (ForceRequestedPredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+
+	val, ok := e.ObjectNew.GetAnnotations()[cuev1alpha1.ForceRequestAnnotation]
+	if !ok {
+		return false
+	}
+
+	return val != e.ObjectOld.GetAnnotations()[cuev1alpha1.ForceRequestAnnotation]
+}
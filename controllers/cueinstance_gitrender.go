@@ -0,0 +1,298 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	// gitAuthorName and gitAuthorEmail identify the controller as
+	// the author of the commits of the rendered manifests.
+	gitAuthorName  = "cue-controller"
+	gitAuthorEmail = "cue-controller@cue.contrib.flux.io"
+)
+
+// renderToGit commits the manifests of the objects to the Git repository of
+// the CueInstance and returns the commit. The commit is skipped when the
+// objects of the revision have already been rendered.
+func (r *CueInstanceReconciler) renderToGit(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision, checksum string,
+	objects []*unstructured.Unstructured,
+) (*cuev1alpha1.RenderedCommit, error) {
+	opts := cueInstance.Spec.RenderTo
+	if opts == nil {
+		return nil, nil
+	}
+	if last := cueInstance.Status.LastRendered; last != nil && last.Revision == revision && last.Checksum == checksum {
+		return last, nil
+	}
+	// the branch is passed to git as an argument, not as an option
+	if strings.HasPrefix(opts.Branch, "-") {
+		return nil, fmt.Errorf("invalid branch '%s'", opts.Branch)
+	}
+
+	tmpDir, err := os.MkdirTemp("", cueInstance.GetName()+"-render-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repo, err := r.gitRepository(ctx, cueInstance, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	masked := make([]*unstructured.Unstructured, len(objects))
+	for i, obj := range objects {
+		masked[i] = maskSecretData(obj)
+	}
+	manifests, err := ssa.ObjectsToYAML(masked)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.Path
+	if dir == "" {
+		dir = path.Join(cueInstance.GetNamespace(), cueInstance.GetName())
+	}
+	msg := fmt.Sprintf("Render %s/%s revision %s", cueInstance.GetNamespace(), cueInstance.GetName(), revision)
+	commit, err := repo.commit(ctx, opts.Branch, dir, manifests, msg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render the manifests to branch '%s' of '%s': %w", opts.Branch, opts.URL, err)
+	}
+
+	ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("manifests rendered to branch '%s' of %s", opts.Branch, opts.URL), "commit", commit)
+	return &cuev1alpha1.RenderedCommit{
+		Commit:   commit,
+		Revision: revision,
+		Checksum: checksum,
+	}, nil
+}
+
+// gitRepository returns the repository of the CueInstance to be cloned
+// in dir, with the credentials of the referenced Secret.
+func (r *CueInstanceReconciler) gitRepository(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	dir string,
+) (*gitRepository, error) {
+	opts := cueInstance.Spec.RenderTo
+	repo := &gitRepository{
+		dir: filepath.Join(dir, "repository"),
+		url: opts.URL,
+		env: []string{
+			"HOME=" + dir,
+			"GIT_TERMINAL_PROMPT=0",
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=" + gitAuthorName,
+			"GIT_AUTHOR_EMAIL=" + gitAuthorEmail,
+			"GIT_COMMITTER_NAME=" + gitAuthorName,
+			"GIT_COMMITTER_EMAIL=" + gitAuthorEmail,
+		},
+	}
+	if opts.SecretRef == nil {
+		return repo, nil
+	}
+
+	secretName := types.NamespacedName{Namespace: cueInstance.GetNamespace(), Name: opts.SecretRef.Name}
+	var secret corev1.Secret
+	if err := r.Get(ctx, secretName, &secret); err != nil {
+		return nil, fmt.Errorf("unable to read the Git secret '%s': %w", secretName, err)
+	}
+
+	if identity, ok := secret.Data["identity"]; ok {
+		// the host keys can't be confirmed interactively
+		knownHosts, ok := secret.Data["known_hosts"]
+		if !ok {
+			return nil, fmt.Errorf("the Git secret '%s' has an identity but no known_hosts", secretName)
+		}
+		identityFile := filepath.Join(dir, "identity")
+		if err := os.WriteFile(identityFile, identity, 0o600); err != nil {
+			return nil, err
+		}
+		knownHostsFile := filepath.Join(dir, "known_hosts")
+		if err := os.WriteFile(knownHostsFile, knownHosts, 0o600); err != nil {
+			return nil, err
+		}
+		repo.env = append(repo.env, "GIT_SSH_COMMAND="+fmt.Sprintf(
+			"ssh -F /dev/null -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s",
+			identityFile, knownHostsFile))
+		return repo, nil
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.User = url.UserPassword(string(secret.Data["username"]), string(secret.Data["password"]))
+	repo.url = u.String()
+	repo.secret = string(secret.Data["password"])
+	return repo, nil
+}
+
+// gitRepository runs the git commands committing the manifests.
+type gitRepository struct {
+	dir string
+	url string
+	env []string
+	// secret is redacted from the output of the commands
+	secret string
+}
+
+// maxPushAttempts is the number of times the manifests are committed on top
+// of the branch when the push is rejected, e.g. when several CueInstances
+// render to the same branch.
+const maxPushAttempts = 5
+
+// errPushRejected is returned when the branch has been updated since it was fetched.
+var errPushRejected = errors.New("the push was rejected as the branch has been updated")
+
+// commit writes the manifests to dir on the branch, creating the branch when
+// missing, pushes the commit and returns its SHA. No commit is made when the
+// manifests are unchanged. The commit is made again on top of the branch
+// when the push is rejected.
+func (g *gitRepository) commit(ctx context.Context, branch, dir, manifests, msg string) (string, error) {
+	if err := os.MkdirAll(g.dir, 0o755); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, "init", "--quiet"); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, "remote", "add", "origin", g.url); err != nil {
+		return "", err
+	}
+
+	// the path comes from the spec, keep it within the working tree
+	target, err := securejoin.SecureJoin(g.dir, filepath.FromSlash(dir))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(g.dir, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path '%s', it must be a directory of the working tree", dir)
+	}
+
+	for attempt := 1; ; attempt++ {
+		sha, err := g.commitOnce(ctx, branch, target, rel, manifests, msg)
+		if errors.Is(err, errPushRejected) && attempt < maxPushAttempts {
+			continue
+		}
+		return sha, err
+	}
+}
+
+// commitOnce checks out the branch, or an orphan branch when it doesn't exist
+// yet, commits the manifests to target and pushes the commit.
+func (g *gitRepository) commitOnce(ctx context.Context, branch, target, rel, manifests, msg string) (string, error) {
+	// start a new branch when the remote one doesn't exist yet
+	refs, err := g.run(ctx, "ls-remote", "--heads", "origin", branch)
+	if err != nil {
+		return "", err
+	}
+	exists := strings.TrimSpace(refs) != ""
+	if exists {
+		if _, err := g.run(ctx, "fetch", "--quiet", "--depth", "1", "origin", branch); err != nil {
+			return "", err
+		}
+		if _, err := g.run(ctx, "checkout", "--quiet", "--force", "-B", branch, "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	} else if _, err := g.run(ctx, "checkout", "--quiet", "--orphan", branch); err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(target, manifestsKey), []byte(manifests), 0o644); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, "add", "--all", "--", filepath.ToSlash(rel)); err != nil {
+		return "", err
+	}
+
+	status, err := g.run(ctx, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	// a new branch always gets a commit for HEAD to exist
+	if strings.TrimSpace(status) != "" || !exists {
+		if _, err := g.run(ctx, "commit", "--quiet", "--allow-empty", "-m", msg); err != nil {
+			return "", err
+		}
+		if _, err := g.run(ctx, "push", "--quiet", "origin", "HEAD:refs/heads/"+branch); err != nil {
+			// the branch was created or updated since it was fetched
+			if now, lsErr := g.run(ctx, "ls-remote", "--heads", "origin", branch); lsErr == nil && now != refs {
+				return "", errPushRejected
+			}
+			return "", err
+		}
+	}
+
+	sha, err := g.run(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sha), nil
+}
+
+// run runs the git command in the repository and returns its output.
+func (g *gitRepository) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = g.env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(stderr.String())
+		if g.secret != "" {
+			// the password is escaped as in the userinfo of the remote URL
+			escaped := strings.TrimPrefix(url.UserPassword("", g.secret).String(), ":")
+			out = strings.ReplaceAll(out, escaped, "***")
+			out = strings.ReplaceAll(out, g.secret, "***")
+		}
+		return "", fmt.Errorf("git %s failed: %w\n%s", args[0], err, tail(out, maxSandboxStderr))
+	}
+	return stdout.String(), nil
+}
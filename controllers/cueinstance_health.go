@@ -0,0 +1,286 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/ssa"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxFailingObjects is the maximum number of failing objects listed in the inventory health.
+const maxFailingObjects = 50
+
+// maxListedObjects is the maximum number of objects listed with their status in the inventory health.
+const maxListedObjects = 1000
+
+// healthCheckInterval is the interval at which the health of the
+// checked objects is polled.
+const healthCheckInterval = 5 * time.Second
+
+// checkHealth waits for the objects referenced by spec.healthChecks, or all
+// the applied objects when spec.wait is set, to become ready.
+// It reports whether any objects were checked.
+func (r *CueInstanceReconciler) checkHealth(ctx context.Context,
+	kubeClient client.Client,
+	cueInstance cuev1alpha1.CueInstance,
+	changeSet *ssa.ChangeSet,
+) (bool, error) {
+	if len(cueInstance.Spec.HealthChecks) == 0 && !cueInstance.Spec.Wait {
+		return false, nil
+	}
+
+	var objects object.ObjMetadataSet
+	if cueInstance.Spec.Wait {
+		objects = changeSet.ToObjMetadataSet()
+	} else {
+		refs := make([]meta.NamespacedObjectKindReference, 0, len(cueInstance.Spec.HealthChecks))
+		for _, ref := range cueInstance.Spec.HealthChecks {
+			if ref.Namespace == "" {
+				ref.Namespace = cueInstance.GetNamespace()
+			}
+			refs = append(refs, ref)
+		}
+		var err error
+		objects, err = referenceToObjMetadataSet(refs)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if len(objects) == 0 {
+		return false, nil
+	}
+
+	checkStart := time.Now()
+	if err := waitForHealthy(ctx, kubeClient, objects, healthCheckInterval, cueInstance.GetTimeout()); err != nil {
+		return true, fmt.Errorf("health check failed after %s: %w", time.Since(checkStart).Round(time.Second), err)
+	}
+
+	return true, nil
+}
+
+// setHealthyCondition records the result of the health checks in the Healthy condition.
+func setHealthyCondition(cueInstance *cuev1alpha1.CueInstance, healthErr error) {
+	condition := metav1.Condition{
+		Type:               cuev1alpha1.HealthyCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             meta.ReconciliationSucceededReason,
+		Message:            "Health check passed",
+		ObservedGeneration: cueInstance.Generation,
+	}
+	if healthErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = cuev1alpha1.HealthCheckFailedReason
+		condition.Message = healthErr.Error()
+	}
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, condition)
+}
+
+// errJobFailed is returned when a health checked Job has failed.
+var errJobFailed = errors.New("job failed")
+
+// waitForHealthy polls the given objects until all of them are ready
+// according to kstatus. Jobs are only ready once they have completed and
+// a failed Job ends the wait immediately.
+func waitForHealthy(ctx context.Context, kubeClient client.Client, objects object.ObjMetadataSet, interval, timeout time.Duration) error {
+	pending := map[object.ObjMetadata]string{}
+
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		for _, id := range objects {
+			msg, err := objectHealth(ctx, kubeClient, id)
+			if err != nil {
+				return false, err
+			}
+			if msg != "" {
+				pending[id] = msg
+			} else {
+				delete(pending, id)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		unhealthy := make([]string, 0, len(pending))
+		for _, id := range objects {
+			if msg, ok := pending[id]; ok {
+				unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", ssa.FmtObjMetadata(id), msg))
+			}
+		}
+		return fmt.Errorf("timeout waiting for: [%s]", strings.Join(unhealthy, ", "))
+	}
+
+	return err
+}
+
+// objectHealth returns the reason why the object is not ready yet,
+// or an empty string if the object is ready.
+func objectHealth(ctx context.Context, kubeClient client.Client, id object.ObjMetadata) (string, error) {
+	mapping, err := kubeClient.RESTMapper().RESTMapping(id.GroupKind)
+	if err != nil {
+		return "unknown kind", nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(mapping.GroupVersionKind)
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: id.Namespace, Name: id.Name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "not found", nil
+		}
+		return err.Error(), nil
+	}
+
+	if id.GroupKind == batchv1.SchemeGroupVersion.WithKind("Job").GroupKind() {
+		return jobHealth(id, obj)
+	}
+
+	res, err := status.Compute(obj)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if res.Status != status.CurrentStatus {
+		return fmt.Sprintf("status '%s'", res.Status), nil
+	}
+
+	return "", nil
+}
+
+// jobHealth reports a Job as ready only once it has completed,
+// a Job which exceeded its backoff limit fails the health check.
+func jobHealth(id object.ObjMetadata, obj *unstructured.Unstructured) (string, error) {
+	var job batchv1.Job
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &job); err != nil {
+		return "", err
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return "", nil
+		case batchv1.JobFailed:
+			return "", fmt.Errorf("%w: %s: %s", errJobFailed, ssa.FmtObjMetadata(id), c.Message)
+		}
+	}
+
+	return fmt.Sprintf("job in progress, %d succeeded, %d failed", job.Status.Succeeded, job.Status.Failed), nil
+}
+
+// inventoryHealth computes the kstatus of each object in the inventory.
+func inventoryHealth(ctx context.Context, kubeClient client.Client, inv *cuev1alpha1.ResourceInventory) *cuev1alpha1.InventoryHealth {
+	health := &cuev1alpha1.InventoryHealth{}
+	for _, entry := range inv.Entries {
+		health.Total++
+
+		res, msg := entryStatus(ctx, kubeClient, entry)
+		if len(health.Objects) < maxListedObjects {
+			if obj, err := entry.Object(); err == nil {
+				health.Objects = append(health.Objects, cuev1alpha1.ManagedObject{
+					InventoryObject: obj,
+					Status:          res.String(),
+					Message:         msg,
+				})
+			}
+		}
+		if res == status.CurrentStatus {
+			health.Current++
+			continue
+		}
+		if len(health.Failing) < maxFailingObjects {
+			health.Failing = append(health.Failing, cuev1alpha1.ObjectHealth{
+				ResourceRef: entry,
+				Status:      res.String(),
+				Message:     msg,
+			})
+		}
+	}
+	health.Percentage = healthPercentage(health)
+	return health
+}
+
+// mergeInventoryHealth adds the object counts and failures of b to a.
+func mergeInventoryHealth(a, b *cuev1alpha1.InventoryHealth) *cuev1alpha1.InventoryHealth {
+	if a == nil {
+		return b
+	}
+	a.Total += b.Total
+	a.Current += b.Current
+	for _, f := range b.Failing {
+		if len(a.Failing) < maxFailingObjects {
+			a.Failing = append(a.Failing, f)
+		}
+	}
+	for _, o := range b.Objects {
+		if len(a.Objects) < maxListedObjects {
+			a.Objects = append(a.Objects, o)
+		}
+	}
+	a.Percentage = healthPercentage(a)
+	return a
+}
+
+func healthPercentage(health *cuev1alpha1.InventoryHealth) int {
+	if health.Total == 0 {
+		return 100
+	}
+	return health.Current * 100 / health.Total
+}
+
+// entryStatus returns the kstatus of the object referenced by the inventory entry.
+func entryStatus(ctx context.Context, kubeClient client.Client, entry cuev1alpha1.ResourceRef) (status.Status, string) {
+	id, err := object.ParseObjMetadata(entry.ID)
+	if err != nil {
+		return status.UnknownStatus, err.Error()
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(id.GroupKind.WithVersion(entry.Version))
+	if err := kubeClient.Get(ctx, types.NamespacedName{Namespace: id.Namespace, Name: id.Name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return status.NotFoundStatus, "object not found"
+		}
+		return status.UnknownStatus, err.Error()
+	}
+
+	res, err := status.Compute(obj)
+	if err != nil {
+		return status.UnknownStatus, err.Error()
+	}
+	return res.Status, res.Message
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWaitForHealthy_Jobs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{batchv1.SchemeGroupVersion})
+	mapper.Add(batchv1.SchemeGroupVersion.WithKind("Job"), apimeta.RESTScopeNamespace)
+
+	job := func(name string, conditions ...batchv1.JobCondition) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     batchv1.JobStatus{Conditions: conditions},
+		}
+	}
+
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithObjects(
+			job("complete", batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}),
+			job("failed", batchv1.JobCondition{
+				Type:    batchv1.JobFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  "BackoffLimitExceeded",
+				Message: "Job has reached the specified backoff limit",
+			}),
+			job("running"),
+		).
+		Build()
+
+	id := func(name string) object.ObjMetadata {
+		return object.ObjMetadata{
+			GroupKind: batchv1.SchemeGroupVersion.WithKind("Job").GroupKind(),
+			Namespace: "default",
+			Name:      name,
+		}
+	}
+
+	t.Run("completed job is healthy", func(t *testing.T) {
+		g := NewWithT(t)
+		err := waitForHealthy(context.TODO(), kubeClient, object.ObjMetadataSet{id("complete")}, time.Millisecond, time.Second)
+		g.Expect(err).NotTo(HaveOccurred())
+	})
+
+	t.Run("failed job fails immediately", func(t *testing.T) {
+		g := NewWithT(t)
+		err := waitForHealthy(context.TODO(), kubeClient, object.ObjMetadataSet{id("complete"), id("failed")}, time.Millisecond, time.Minute)
+		g.Expect(errors.Is(err, errJobFailed)).To(BeTrue())
+		g.Expect(err.Error()).To(ContainSubstring("backoff limit"))
+	})
+
+	t.Run("running job times out", func(t *testing.T) {
+		g := NewWithT(t)
+		err := waitForHealthy(context.TODO(), kubeClient, object.ObjMetadataSet{id("running")}, time.Millisecond, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("job in progress"))
+	})
+}
+
+func TestInventoryHealth(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}}
+	running := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "default"}}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap, running).Build()
+
+	entry := func(gvk schema.GroupVersionKind, name string) cuev1alpha1.ResourceRef {
+		return cuev1alpha1.ResourceRef{
+			ID: object.ObjMetadata{
+				GroupKind: gvk.GroupKind(),
+				Namespace: "default",
+				Name:      name,
+			}.String(),
+			Version: gvk.Version,
+		}
+	}
+
+	inv := &cuev1alpha1.ResourceInventory{Entries: []cuev1alpha1.ResourceRef{
+		entry(corev1.SchemeGroupVersion.WithKind("ConfigMap"), "settings"),
+		entry(batchv1.SchemeGroupVersion.WithKind("Job"), "migrate"),
+		entry(corev1.SchemeGroupVersion.WithKind("Secret"), "missing"),
+	}}
+
+	health := inventoryHealth(context.TODO(), kubeClient, inv)
+	g.Expect(health.Total).To(Equal(3))
+	g.Expect(health.Current).To(Equal(1))
+	g.Expect(health.Percentage).To(Equal(33))
+	g.Expect(health.Failing).To(HaveLen(2))
+	g.Expect(health.Failing[0].Status).To(Equal("InProgress"))
+	g.Expect(health.Failing[1].Status).To(Equal("NotFound"))
+	g.Expect(health.Objects).To(HaveLen(3))
+	g.Expect(health.Objects[0].InventoryObject).To(Equal(cuev1alpha1.InventoryObject{
+		APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "settings",
+	}))
+	g.Expect(health.Objects[0].Status).To(Equal("Current"))
+	g.Expect(health.Objects[1].APIVersion).To(Equal("batch/v1"))
+
+	merged := mergeInventoryHealth(nil, health)
+	merged = mergeInventoryHealth(merged, &cuev1alpha1.InventoryHealth{Total: 1, Current: 1})
+	g.Expect(merged.Total).To(Equal(4))
+	g.Expect(merged.Objects).To(HaveLen(3))
+	g.Expect(merged.Percentage).To(Equal(50))
+	g.Expect(healthPercentage(&cuev1alpha1.InventoryHealth{})).To(Equal(100))
+}
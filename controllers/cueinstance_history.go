@@ -0,0 +1,170 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// historyLimit returns the number of applied revisions kept in the history,
+// the rollbacks on failure need the snapshot of the last applied revision.
+func historyLimit(cueInstance cuev1alpha1.CueInstance) int {
+	if cueInstance.Spec.HistoryLimit < 1 && cueInstance.Spec.RollbackOnFailure {
+		return 1
+	}
+	return cueInstance.Spec.HistoryLimit
+}
+
+// recordHistory records the applied revision at the top of the history with
+// a snapshot of its objects, and deletes the snapshots beyond the limit.
+func (r *CueInstanceReconciler) recordHistory(ctx context.Context, cueInstance *cuev1alpha1.CueInstance, snap snapshot) {
+	history := cueInstance.Status.History
+	limit := historyLimit(*cueInstance)
+	if limit == 0 {
+		setSnapshotFailedCondition(cueInstance, snap.revision, nil)
+		r.deleteSnapshots(ctx, *cueInstance, history)
+		cueInstance.Status.History = nil
+		return
+	}
+
+	// the revision is already at the top of the history
+	if len(history) > 0 && history[0].Revision == snap.revision && history[0].Checksum == snap.checksum {
+		if len(history) > limit {
+			r.deleteSnapshots(ctx, *cueInstance, unreferencedSnapshots(history[limit:], history[:limit]))
+			cueInstance.Status.History = history[:limit]
+		}
+		return
+	}
+
+	name := snapshotName(*cueInstance, snap.checksum)
+	err := r.writeSnapshot(ctx, *cueInstance, name, snap)
+	setSnapshotFailedCondition(cueInstance, snap.revision, err)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to write the snapshot", "revision", snap.revision)
+		return
+	}
+	entries := []cuev1alpha1.HistoryEntry{{
+		Revision:  snap.revision,
+		Checksum:  snap.checksum,
+		AppliedAt: metav1.Now(),
+		Snapshot:  name,
+	}}
+
+	// the entries are keyed by revision and checksum, a revision
+	// applied again moves to the top of the history
+	for _, entry := range history {
+		if entry.Revision != snap.revision || entry.Checksum != snap.checksum {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > limit {
+		r.deleteSnapshots(ctx, *cueInstance, unreferencedSnapshots(entries[limit:], entries[:limit]))
+		entries = entries[:limit]
+	}
+	cueInstance.Status.History = entries
+}
+
+// unreferencedSnapshots returns the removed entries whose snapshot is not
+// referenced by the kept entries, the snapshots being shared by the
+// revisions which rendered the same objects.
+func unreferencedSnapshots(removed, kept []cuev1alpha1.HistoryEntry) []cuev1alpha1.HistoryEntry {
+	referenced := make(map[string]bool, len(kept))
+	for _, entry := range kept {
+		referenced[entry.Snapshot] = true
+	}
+
+	var entries []cuev1alpha1.HistoryEntry
+	for _, entry := range removed {
+		if !referenced[entry.Snapshot] {
+			referenced[entry.Snapshot] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// deleteSnapshots deletes the snapshots of the history entries.
+func (r *CueInstanceReconciler) deleteSnapshots(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	entries []cuev1alpha1.HistoryEntry,
+) {
+	if len(entries) == 0 {
+		return
+	}
+	kubeClient, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to delete the snapshots")
+		return
+	}
+
+	for _, entry := range entries {
+		secret := &corev1.Secret{}
+		secret.SetName(entry.Snapshot)
+		secret.SetNamespace(cueInstance.GetNamespace())
+		if err := deleteControlled(ctx, kubeClient, &cueInstance, secret); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "unable to delete the snapshot", "revision", entry.Revision)
+		}
+	}
+}
+
+// historySnapshot returns the snapshot of the most recent
+// application of the revision recorded in the history.
+func (r *CueInstanceReconciler) historySnapshot(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+) (*snapshot, error) {
+	for _, entry := range cueInstance.Status.History {
+		if entry.Revision != revision {
+			continue
+		}
+		snap, err := r.readSnapshot(ctx, cueInstance, entry.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if snap == nil {
+			return nil, fmt.Errorf("the snapshot of revision %s was not found", revision)
+		}
+		// the snapshot may have been recorded first for another revision
+		snap.revision = revision
+		return snap, nil
+	}
+	return nil, fmt.Errorf("revision %s not found in the history", revision)
+}
+
+// RollbackRequestedPredicate triggers an update event when the
+// rollback annotation of an object is set, changed or removed.
+type RollbackRequestedPredicate struct {
+	predicate.Funcs
+}
+
+func (RollbackRequestedPredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+
+	return e.ObjectNew.GetAnnotations()[cuev1alpha1.RollbackAnnotation] !=
+		e.ObjectOld.GetAnnotations()[cuev1alpha1.RollbackAnnotation]
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestRecordHistory(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	cueInstance.Spec.HistoryLimit = 2
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+
+	apply := func(revision, checksum string) {
+		r.recordHistory(context.TODO(), cueInstance, snapshot{
+			revision: revision,
+			checksum: checksum,
+			objects:  []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", revision)},
+		})
+	}
+	revisions := func() []string {
+		var revisions []string
+		for _, entry := range cueInstance.Status.History {
+			revisions = append(revisions, entry.Revision)
+		}
+		return revisions
+	}
+	snapshots := func() []string {
+		var secrets corev1.SecretList
+		g.Expect(r.List(context.TODO(), &secrets, client.InNamespace("default"))).To(Succeed())
+		var names []string
+		for _, s := range secrets.Items {
+			names = append(names, s.GetName())
+		}
+		return names
+	}
+
+	apply("v1/aaa", "111111111111111")
+	apply("v1/aaa", "111111111111111")
+	g.Expect(revisions()).To(Equal([]string{"v1/aaa"}))
+
+	apply("v2/bbb", "222222222222222")
+	apply("v3/ccc", "333333333333333")
+	g.Expect(revisions()).To(Equal([]string{"v3/ccc", "v2/bbb"}))
+	g.Expect(snapshots()).To(ConsistOf("app-snapshot-222222222222", "app-snapshot-333333333333"))
+
+	// revisions rendering the same objects share their snapshot
+	cueInstance.Spec.HistoryLimit = 3
+	apply("v4/ddd", "222222222222222")
+	g.Expect(revisions()).To(Equal([]string{"v4/ddd", "v3/ccc", "v2/bbb"}))
+	g.Expect(snapshots()).To(ConsistOf("app-snapshot-222222222222", "app-snapshot-333333333333"))
+
+	// the snapshot is kept while a revision of the history references it
+	cueInstance.Spec.HistoryLimit = 2
+	apply("v4/ddd", "222222222222222")
+	g.Expect(revisions()).To(Equal([]string{"v4/ddd", "v3/ccc"}))
+	g.Expect(snapshots()).To(ConsistOf("app-snapshot-222222222222", "app-snapshot-333333333333"))
+
+	// a revision applied again moves to the top of the history
+	apply("v3/ccc", "333333333333333")
+	g.Expect(revisions()).To(Equal([]string{"v3/ccc", "v4/ddd"}))
+	g.Expect(snapshots()).To(ConsistOf("app-snapshot-222222222222", "app-snapshot-333333333333"))
+	apply("v4/ddd", "222222222222222")
+	g.Expect(revisions()).To(Equal([]string{"v4/ddd", "v3/ccc"}))
+
+	snap, err := r.historySnapshot(context.TODO(), *cueInstance, "v3/ccc")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(snap.checksum).To(Equal("333333333333333"))
+	g.Expect(snap.objects[0].GetName()).To(Equal("v3/ccc"))
+	_, err = r.historySnapshot(context.TODO(), *cueInstance, "v1/aaa")
+	g.Expect(err).To(MatchError("revision v1/aaa not found in the history"))
+
+	cueInstance.Spec.HistoryLimit = 1
+	apply("v4/ddd", "222222222222222")
+	g.Expect(revisions()).To(Equal([]string{"v4/ddd"}))
+	g.Expect(snapshots()).To(ConsistOf("app-snapshot-222222222222"))
+
+	// the snapshots too large to be stored are reported in a condition
+	large := make([]*unstructured.Unstructured, 0, 64)
+	for i := 0; i < cap(large); i++ {
+		obj := newTestObject("v1", "Secret", fmt.Sprintf("large-%d", i))
+		obj.Object["data"] = map[string]interface{}{"key": randomString(16 * 1024)}
+		large = append(large, obj)
+	}
+	r.recordHistory(context.TODO(), cueInstance, snapshot{revision: "v5/eee", checksum: "555555555555555", objects: large})
+	g.Expect(revisions()).To(Equal([]string{"v4/ddd"}))
+	g.Expect(apimeta.IsStatusConditionTrue(cueInstance.Status.Conditions, cuev1alpha1.SnapshotFailedCondition)).To(BeTrue())
+	apply("v6/fff", "666666666666666")
+	g.Expect(revisions()).To(Equal([]string{"v6/fff"}))
+	g.Expect(apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.SnapshotFailedCondition)).To(BeNil())
+
+	cueInstance.Spec.HistoryLimit = 0
+	cueInstance.Spec.RollbackOnFailure = true
+	g.Expect(historyLimit(*cueInstance)).To(Equal(1))
+	cueInstance.Spec.RollbackOnFailure = false
+	apply("v7/ggg", "777777777777777")
+	g.Expect(cueInstance.Status.History).To(BeEmpty())
+	g.Expect(snapshots()).To(BeEmpty())
+}
+
+func TestRollbackRequestedPredicate(t *testing.T) {
+	g := NewWithT(t)
+
+	object := func(revision string) *cuev1alpha1.CueInstance {
+		obj := &cuev1alpha1.CueInstance{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+		if revision != "" {
+			obj.SetAnnotations(map[string]string{cuev1alpha1.RollbackAnnotation: revision})
+		}
+		return obj
+	}
+
+	p := RollbackRequestedPredicate{}
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object(""), ObjectNew: object("v1/aaa")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object("v1/aaa"), ObjectNew: object("")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: object("v1/aaa"), ObjectNew: object("v1/aaa")})).To(BeFalse())
+
+	revision, ok := object("v1/aaa").RollbackRequested()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(revision).To(Equal("v1/aaa"))
+	_, ok = object("").RollbackRequested()
+	g.Expect(ok).To(BeFalse())
+}
+
+// randomString returns an incompressible string of n bytes.
+func randomString(n int) string {
+	b := make([]byte, n*3/4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
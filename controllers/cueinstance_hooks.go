@@ -0,0 +1,142 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// hookJobs holds the rendered Jobs selected by a hook.
+type hookJobs struct {
+	name    string
+	objects []*unstructured.Unstructured
+}
+
+// selectHookJobs removes the Jobs selected by the given hooks from the
+// rendered objects and returns them grouped by hook, together with the
+// remaining objects.
+func selectHookJobs(hooks []cuev1alpha1.Hook, objects []*unstructured.Unstructured) ([]hookJobs, []*unstructured.Unstructured, error) {
+	if len(hooks) == 0 {
+		return nil, objects, nil
+	}
+
+	selected := make([]hookJobs, len(hooks))
+	selectors := make([]labels.Selector, len(hooks))
+	for i, hook := range hooks {
+		sel, err := metav1.LabelSelectorAsSelector(&hook.Selector)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid selector of hook '%s': %w", hook.Name, err)
+		}
+		selectors[i] = sel
+		selected[i].name = hook.Name
+	}
+
+	remaining := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		matched := false
+		if obj.GroupVersionKind() == batchv1.SchemeGroupVersion.WithKind("Job") {
+			for i, sel := range selectors {
+				if sel.Matches(labels.Set(obj.GetLabels())) {
+					selected[i].objects = append(selected[i].objects, obj)
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			remaining = append(remaining, obj)
+		}
+	}
+
+	return selected, remaining, nil
+}
+
+// addHookJobsToInventory adds the hook Jobs to the inventory,
+// so that they are garbage collected like any other object.
+func addHookJobsToInventory(inv *cuev1alpha1.ResourceInventory, hooks []hookJobs, cluster string) {
+	for _, hook := range hooks {
+		for _, obj := range hook.objects {
+			inv.Entries = append(inv.Entries, cuev1alpha1.ResourceRef{
+				ID:      object.UnstructuredToObjMetadata(obj).String(),
+				Version: obj.GroupVersionKind().Version,
+				Cluster: cluster,
+			})
+		}
+	}
+}
+
+// runHooks recreates the Jobs of each hook in order
+// and waits for them to complete.
+func (r *CueInstanceReconciler) runHooks(ctx context.Context,
+	manager *ssa.ResourceManager,
+	kubeClient client.Client,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+	hooks []hookJobs,
+) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	for _, hook := range hooks {
+		if len(hook.objects) == 0 {
+			continue
+		}
+
+		if err := ssa.SetNativeKindsDefaults(hook.objects); err != nil {
+			return err
+		}
+
+		// the Job spec is immutable, remove the Jobs of the previous run
+		if _, err := manager.DeleteAll(ctx, hook.objects, ssa.DefaultDeleteOptions()); err != nil {
+			return fmt.Errorf("hook '%s' failed: %w", hook.name, err)
+		}
+		if err := manager.WaitForTermination(hook.objects, ssa.WaitOptions{
+			Interval: 2 * time.Second,
+			Timeout:  cueInstance.GetTimeout(),
+		}); err != nil {
+			return fmt.Errorf("hook '%s' failed: %w", hook.name, err)
+		}
+
+		changeSet, err := manager.ApplyAll(ctx, hook.objects, ssa.DefaultApplyOptions())
+		if err != nil {
+			return fmt.Errorf("hook '%s' failed: %w", hook.name, err)
+		}
+
+		if err := waitForHealthy(ctx, kubeClient, changeSet.ToObjMetadataSet(), healthCheckInterval, cueInstance.GetTimeout()); err != nil {
+			return fmt.Errorf("hook '%s' failed: %w", hook.name, err)
+		}
+
+		msg := fmt.Sprintf("Hook '%s' completed", hook.name)
+		log.Info(msg, "output", changeSet.ToMap())
+		r.event(ctx, cueInstance, revision, events.EventSeverityInfo, msg, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSelectHookJobs(t *testing.T) {
+	g := NewWithT(t)
+
+	newObject := func(apiVersion, kind, name string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName(name)
+		obj.SetNamespace("default")
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	migrate := newObject("batch/v1", "Job", "migrate", map[string]string{"hook": "migrate"})
+	smoke := newObject("batch/v1", "Job", "smoke", map[string]string{"hook": "smoke"})
+	cron := newObject("batch/v1", "Job", "cleanup", nil)
+	config := newObject("v1", "ConfigMap", "config", map[string]string{"hook": "migrate"})
+
+	hooks := []cuev1alpha1.Hook{
+		{Name: "migrate", Selector: metav1.LabelSelector{MatchLabels: map[string]string{"hook": "migrate"}}},
+		{Name: "smoke", Selector: metav1.LabelSelector{MatchLabels: map[string]string{"hook": "smoke"}}},
+	}
+
+	selected, remaining, err := selectHookJobs(hooks, []*unstructured.Unstructured{migrate, smoke, cron, config})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(selected).To(HaveLen(2))
+	g.Expect(selected[0].name).To(Equal("migrate"))
+	g.Expect(selected[0].objects).To(ConsistOf(migrate))
+	g.Expect(selected[1].objects).To(ConsistOf(smoke))
+	g.Expect(remaining).To(ConsistOf(cron, config))
+
+	inv := NewInventory()
+	addHookJobsToInventory(inv, selected, "")
+	g.Expect(inv.Entries).To(HaveLen(2))
+	g.Expect(inv.Entries[0].ID).To(Equal("default_migrate_batch_Job"))
+
+	_, remaining, err = selectHookJobs(nil, []*unstructured.Unstructured{migrate})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(remaining).To(ConsistOf(migrate))
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// removeIgnoredPaths removes the fields matched by the ignore rules from the objects.
+func removeIgnoredPaths(objects []*unstructured.Unstructured, rules []cuev1alpha1.IgnoreRule) error {
+	return forEachIgnoredPath(objects, rules, func(obj *unstructured.Unstructured, tokens []string) error {
+		removePath(obj.Object, tokens)
+		return nil
+	})
+}
+
+// preserveIgnoredPaths sets the fields matched by the ignore rules to their
+// live values, as removing the fields previously applied by the controller
+// from the patch would make server-side apply delete them. The fields which
+// are not set on the live objects are removed from the objects.
+func preserveIgnoredPaths(ctx context.Context, reader client.Reader, objects []*unstructured.Unstructured, rules []cuev1alpha1.IgnoreRule) error {
+	liveObjects := map[*unstructured.Unstructured]*unstructured.Unstructured{}
+	return forEachIgnoredPath(objects, rules, func(obj *unstructured.Unstructured, tokens []string) error {
+		live, ok := liveObjects[obj]
+		if !ok {
+			live = &unstructured.Unstructured{}
+			live.SetGroupVersionKind(obj.GroupVersionKind())
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+				if !apierrors.IsNotFound(err) && !apimeta.IsNoMatchError(err) {
+					return fmt.Errorf("unable to read the ignored fields of %s: %w", ssa.FmtUnstructured(obj), err)
+				}
+				live = nil
+			}
+			liveObjects[obj] = live
+		}
+
+		if live != nil {
+			if value, ok := lookupPath(live.Object, tokens); ok && setPath(obj.Object, tokens, runtime.DeepCopyJSONValue(value)) {
+				return nil
+			}
+		}
+		removePath(obj.Object, tokens)
+		return nil
+	})
+}
+
+// forEachIgnoredPath calls fn with the objects matched by
+// each of the ignore rules and the tokens of their paths.
+func forEachIgnoredPath(objects []*unstructured.Unstructured, rules []cuev1alpha1.IgnoreRule,
+	fn func(obj *unstructured.Unstructured, tokens []string) error) error {
+	for _, rule := range rules {
+		paths := make([][]string, 0, len(rule.Paths))
+		for _, path := range rule.Paths {
+			tokens, err := parseJSONPointer(path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, tokens)
+		}
+
+		for _, obj := range objects {
+			if rule.Target != nil {
+				ok, err := selectorMatches(*rule.Target, obj)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+			for _, tokens := range paths {
+				if err := fn(obj, tokens); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseJSONPointer splits an RFC 6901 JSON pointer into its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || pointer == "/" {
+		return nil, fmt.Errorf("invalid JSON pointer '%s'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// removePath returns the value with the field at the path removed,
+// paths which do not exist are ignored.
+func removePath(value interface{}, tokens []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(tokens) == 1 {
+			delete(v, tokens[0])
+			return v
+		}
+		if child, ok := v[tokens[0]]; ok {
+			v[tokens[0]] = removePath(child, tokens[1:])
+		}
+		return v
+	case []interface{}:
+		i, err := strconv.Atoi(tokens[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return v
+		}
+		if len(tokens) == 1 {
+			return append(v[:i], v[i+1:]...)
+		}
+		v[i] = removePath(v[i], tokens[1:])
+		return v
+	default:
+		return v
+	}
+}
+
+// lookupPath returns the value of the field at the path, if it exists.
+func lookupPath(value interface{}, tokens []string) (interface{}, bool) {
+	for _, t := range tokens {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[t]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setPath sets the field at the path to the given value and reports
+// whether it was set, which requires the parent of the field to exist.
+func setPath(value interface{}, tokens []string, field interface{}) bool {
+	parent, ok := lookupPath(value, tokens[:len(tokens)-1])
+	if !ok {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[last] = field
+		return true
+	case []interface{}:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(v) {
+			return false
+		}
+		v[i] = field
+		return true
+	default:
+		return false
+	}
+}
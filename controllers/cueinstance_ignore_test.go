@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRemoveIgnoredPaths(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := newTestObject("apps/v1", "Deployment", "frontend")
+	deployment.SetAnnotations(map[string]string{"example.com/owner": "team-a", "keep": "true"})
+	g.Expect(unstructured.SetNestedField(deployment.Object, int64(2), "spec", "replicas")).To(Succeed())
+	g.Expect(unstructured.SetNestedSlice(deployment.Object, []interface{}{
+		map[string]interface{}{"name": "app", "image": "app:v1"},
+		map[string]interface{}{"name": "sidecar"},
+	}, "spec", "template", "spec", "containers")).To(Succeed())
+
+	service := newTestObject("v1", "Service", "frontend")
+	g.Expect(unstructured.SetNestedField(service.Object, int64(2), "spec", "replicas")).To(Succeed())
+
+	err := removeIgnoredPaths([]*unstructured.Unstructured{deployment, service}, []cuev1alpha1.IgnoreRule{
+		{
+			Paths: []string{
+				"/spec/replicas",
+				"/metadata/annotations/example.com~1owner",
+				"/spec/template/spec/containers/1",
+				"/spec/template/spec/containers/0/image",
+				"/spec/missing/field",
+			},
+			Target: &cuev1alpha1.Selector{Kind: "Deployment"},
+		},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	g.Expect(found).To(BeFalse())
+	g.Expect(deployment.GetAnnotations()).To(Equal(map[string]string{"keep": "true"}))
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	g.Expect(containers).To(Equal([]interface{}{map[string]interface{}{"name": "app"}}))
+
+	_, found, _ = unstructured.NestedInt64(service.Object, "spec", "replicas")
+	g.Expect(found).To(BeTrue())
+
+	t.Run("rejects invalid pointers", func(t *testing.T) {
+		g := NewWithT(t)
+		err := removeIgnoredPaths(nil, []cuev1alpha1.IgnoreRule{{Paths: []string{"spec.replicas"}}})
+		g.Expect(err).To(MatchError(ContainSubstring("invalid JSON pointer")))
+	})
+}
+
+func TestPreserveIgnoredPaths(t *testing.T) {
+	g := NewWithT(t)
+
+	live := newTestObject("apps/v1", "Deployment", "frontend")
+	g.Expect(unstructured.SetNestedField(live.Object, int64(5), "spec", "replicas")).To(Succeed())
+	g.Expect(unstructured.SetNestedSlice(live.Object, []interface{}{
+		map[string]interface{}{"name": "app", "image": "app:v2"},
+	}, "spec", "template", "spec", "containers")).To(Succeed())
+	reader := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(live).Build()
+
+	deployment := newTestObject("apps/v1", "Deployment", "frontend")
+	g.Expect(unstructured.SetNestedField(deployment.Object, int64(2), "spec", "replicas")).To(Succeed())
+	g.Expect(unstructured.SetNestedField(deployment.Object, "team-a", "spec", "owner")).To(Succeed())
+	g.Expect(unstructured.SetNestedSlice(deployment.Object, []interface{}{
+		map[string]interface{}{"name": "app", "image": "app:v1"},
+	}, "spec", "template", "spec", "containers")).To(Succeed())
+
+	created := newTestObject("apps/v1", "Deployment", "backend")
+	g.Expect(unstructured.SetNestedField(created.Object, int64(2), "spec", "replicas")).To(Succeed())
+
+	err := preserveIgnoredPaths(context.TODO(), reader, []*unstructured.Unstructured{deployment, created}, []cuev1alpha1.IgnoreRule{
+		{Paths: []string{"/spec/replicas", "/spec/owner", "/spec/template/spec/containers/0/image"}},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the live values are applied again instead of being removed
+	replicas, _, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	g.Expect(replicas).To(Equal(int64(5)))
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	g.Expect(containers).To(Equal([]interface{}{map[string]interface{}{"name": "app", "image": "app:v2"}}))
+
+	// the fields which are not live are removed
+	_, found, _ := unstructured.NestedFieldNoCopy(deployment.Object, "spec", "owner")
+	g.Expect(found).To(BeFalse())
+	_, found, _ = unstructured.NestedFieldNoCopy(created.Object, "spec", "replicas")
+	g.Expect(found).To(BeFalse())
+}
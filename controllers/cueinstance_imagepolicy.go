@@ -0,0 +1,129 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const imagePolicyIndexKey string = ".metadata.imagePolicies"
+
+// imagePolicyGVK is the kind of the Flux ImagePolicies, they are read as
+// unstructured objects to avoid depending on the image automation APIs.
+var imagePolicyGVK = schema.GroupVersionKind{
+	Group:   "image.toolkit.fluxcd.io",
+	Version: "v1beta1",
+	Kind:    "ImagePolicy",
+}
+
+// newImagePolicy returns an empty ImagePolicy object.
+func newImagePolicy() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(imagePolicyGVK)
+	return obj
+}
+
+// getImagePolicyValue returns the latest image selected by the ImagePolicy,
+// or nil when the reference is optional and no image has been selected yet.
+func (r *CueInstanceReconciler) getImagePolicyValue(ctx context.Context, namespace string, ref cuev1alpha1.TagVarSource) (*string, error) {
+	name := types.NamespacedName{Namespace: namespace, Name: ref.ImagePolicyRef.Name}
+
+	policy := newImagePolicy()
+	if err := r.Get(ctx, name, policy); err != nil {
+		if apierrors.IsNotFound(err) && ref.Optional {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	image, _, _ := unstructured.NestedString(policy.Object, "status", "latestImage")
+	if image == "" {
+		if ref.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ImagePolicy '%s' has not selected an image yet", name)
+	}
+
+	if ref.ImagePolicyRef.Part == "Tag" {
+		image = imageTag(image)
+	}
+	return &image, nil
+}
+
+// imageTag returns the tag of the image reference, or the empty string when it has none.
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// indexImagePolicyRefs returns the names of the ImagePolicies referenced by the CueInstance.
+func (r *CueInstanceReconciler) indexImagePolicyRefs(o client.Object) []string {
+	k, ok := o.(*cuev1alpha1.CueInstance)
+	if !ok {
+		panic(fmt.Sprintf("Expected a CueInstance, got %T", o))
+	}
+
+	var names []string
+	for _, tags := range [][]cuev1alpha1.TagVar{k.Spec.Tags, k.Spec.TagVars} {
+		for _, t := range tags {
+			if t.ValueFrom != nil && t.ValueFrom.ImagePolicyRef != nil {
+				names = append(names, t.ValueFrom.ImagePolicyRef.Name)
+			}
+		}
+	}
+	return uniqueNames(names)
+}
+
+// ImagePolicyChangePredicate triggers an update event
+// when an ImagePolicy selects a new image.
+type ImagePolicyChangePredicate struct {
+	predicate.Funcs
+}
+
+func (ImagePolicyChangePredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+
+	oldPolicy, ok := e.ObjectOld.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+
+	newPolicy, ok := e.ObjectNew.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+
+	oldImage, _, _ := unstructured.NestedString(oldPolicy.Object, "status", "latestImage")
+	newImage, _, _ := unstructured.NestedString(newPolicy.Object, "status", "latestImage")
+	return oldImage != newImage
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func testImagePolicy(name, latestImage string) *unstructured.Unstructured {
+	policy := newImagePolicy()
+	policy.SetName(name)
+	policy.SetNamespace("default")
+	if latestImage != "" {
+		_ = unstructured.SetNestedField(policy.Object, latestImage, "status", "latestImage")
+	}
+	return policy
+}
+
+func TestGetImagePolicyValue(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(
+			testImagePolicy("app", "ghcr.io/org/app:1.4.2"),
+			testImagePolicy("pending", ""),
+		).Build(),
+	}
+
+	ref := func(name, part string, optional bool) cuev1alpha1.TagVarSource {
+		return cuev1alpha1.TagVarSource{
+			ImagePolicyRef: &cuev1alpha1.ImagePolicyReference{Name: name, Part: part},
+			Optional:       optional,
+		}
+	}
+
+	value, err := r.getTagValue(context.TODO(), "default", ref("app", "", false))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*value).To(Equal("ghcr.io/org/app:1.4.2"))
+
+	value, err = r.getTagValue(context.TODO(), "default", ref("app", "Tag", false))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*value).To(Equal("1.4.2"))
+
+	_, err = r.getTagValue(context.TODO(), "default", ref("pending", "", false))
+	g.Expect(err).To(MatchError(ContainSubstring("has not selected an image yet")))
+	_, err = r.getTagValue(context.TODO(), "default", ref("missing", "", false))
+	g.Expect(err).To(HaveOccurred())
+
+	value, err = r.getTagValue(context.TODO(), "default", ref("pending", "", true))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(BeNil())
+	value, err = r.getTagValue(context.TODO(), "default", ref("missing", "", true))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(BeNil())
+}
+
+func TestImageTag(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(imageTag("ghcr.io/org/app:1.4.2")).To(Equal("1.4.2"))
+	g.Expect(imageTag("localhost:5000/app:dev")).To(Equal("dev"))
+	g.Expect(imageTag("localhost:5000/app")).To(Equal(""))
+}
+
+func TestImagePolicyChangePredicate(t *testing.T) {
+	g := NewWithT(t)
+
+	p := ImagePolicyChangePredicate{}
+	g.Expect(p.Update(event.UpdateEvent{
+		ObjectOld: testImagePolicy("app", "ghcr.io/org/app:1.4.2"),
+		ObjectNew: testImagePolicy("app", "ghcr.io/org/app:1.4.3"),
+	})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{
+		ObjectOld: testImagePolicy("app", ""),
+		ObjectNew: testImagePolicy("app", "ghcr.io/org/app:1.4.2"),
+	})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{
+		ObjectOld: testImagePolicy("app", "ghcr.io/org/app:1.4.2"),
+		ObjectNew: testImagePolicy("app", "ghcr.io/org/app:1.4.2"),
+	})).To(BeFalse())
+}
@@ -25,6 +25,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
@@ -33,22 +34,38 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
+// ClientOptions holds the rate limits of the Kubernetes clients
+// created for the CueInstances.
+type ClientOptions struct {
+	// QPS and Burst limit the requests of the clients impersonating
+	// service accounts on the cluster of the controller.
+	QPS   float32
+	Burst int
+	// RemoteQPS and RemoteBurst limit the requests sent to the remote
+	// clusters, unless overridden by the KubeConfig of the cluster.
+	RemoteQPS   float32
+	RemoteBurst int
+}
+
 type CueInstanceImpersonation struct {
 	client.Client
 	cueInstance           cuev1alpha1.CueInstance
 	statusPoller          *polling.StatusPoller
 	defaultServiceAccount string
+	clientOpts            ClientOptions
 }
 
 func NewCueInstanceImpersonation(
 	cueInstance cuev1alpha1.CueInstance,
 	kubeClient client.Client,
 	statusPoller *polling.StatusPoller,
-	defaultServiceAccount string) *CueInstanceImpersonation {
+	defaultServiceAccount string,
+	clientOpts ClientOptions) *CueInstanceImpersonation {
 	return &CueInstanceImpersonation{
 		defaultServiceAccount: defaultServiceAccount,
 		cueInstance:           cueInstance,
 		statusPoller:          statusPoller,
+		clientOpts:            clientOpts,
 		Client:                kubeClient,
 	}
 }
@@ -99,9 +116,15 @@ func (ci *CueInstanceImpersonation) GetServiceAccountToken(ctx context.Context)
 // If --kubeconfig is set, will use the kubeconfig file at that location.
 // Otherwise will assume running in cluster and use the cluster provided kubeconfig.
 func (ci *CueInstanceImpersonation) GetClient(ctx context.Context) (client.Client, *polling.StatusPoller, error) {
+	return ci.GetClientForCluster(ctx, clusterName(ci.cueInstance))
+}
+
+// GetClientForCluster creates a controller-runtime client for the cluster recorded in
+// the inventory, that is the KubeConfig secret name or empty for the local cluster.
+func (ci *CueInstanceImpersonation) GetClientForCluster(ctx context.Context, cluster string) (client.Client, *polling.StatusPoller, error) {
 	switch {
-	case ci.cueInstance.Spec.KubeConfig != nil:
-		return ci.clientForKubeConfig(ctx)
+	case cluster != "":
+		return ci.clientForKubeConfig(ctx, cluster)
 	case ci.defaultServiceAccount != "" || ci.cueInstance.Spec.ServiceAccountName != "":
 		return ci.clientForServiceAccountOrDefault()
 	default:
@@ -109,6 +132,30 @@ func (ci *CueInstanceImpersonation) GetClient(ctx context.Context) (client.Clien
 	}
 }
 
+// GetDiscoveryForCluster creates a discovery client for the cluster recorded in the inventory.
+func (ci *CueInstanceImpersonation) GetDiscoveryForCluster(ctx context.Context, cluster string) (discovery.DiscoveryInterface, error) {
+	var (
+		restConfig *rest.Config
+		err        error
+	)
+	if cluster != "" {
+		var kubeConfigBytes []byte
+		if kubeConfigBytes, err = ci.getKubeConfig(ctx, cluster); err != nil {
+			return nil, err
+		}
+		restConfig, err = clientcmd.RESTConfigFromKubeConfig(kubeConfigBytes)
+	} else {
+		restConfig, err = config.GetConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ci.setImpersonationConfig(restConfig)
+	ci.setRateLimits(restConfig, cluster)
+
+	return discovery.NewDiscoveryClientForConfig(restConfig)
+}
+
 // CanFinalize asserts if the given CueInstance can be finalized using impersonation.
 func (ci *CueInstanceImpersonation) CanFinalize(ctx context.Context) bool {
 	name := ci.defaultServiceAccount
@@ -147,12 +194,34 @@ func (ci *CueInstanceImpersonation) setImpersonationConfig(restConfig *rest.Conf
 	}
 }
 
+// setRateLimits sets the rate limits of the requests sent to the cluster,
+// the limits of the KubeConfig of a remote cluster take precedence.
+func (ci *CueInstanceImpersonation) setRateLimits(restConfig *rest.Config, cluster string) {
+	if cluster == "" {
+		restConfig.QPS = ci.clientOpts.QPS
+		restConfig.Burst = ci.clientOpts.Burst
+		return
+	}
+
+	restConfig.QPS = ci.clientOpts.RemoteQPS
+	restConfig.Burst = ci.clientOpts.RemoteBurst
+	if kc := findKubeConfig(ci.cueInstance, cluster); kc != nil {
+		if kc.QPS > 0 {
+			restConfig.QPS = float32(kc.QPS)
+		}
+		if kc.Burst > 0 {
+			restConfig.Burst = int(kc.Burst)
+		}
+	}
+}
+
 func (ci *CueInstanceImpersonation) clientForServiceAccountOrDefault() (client.Client, *polling.StatusPoller, error) {
 	restConfig, err := config.GetConfig()
 	if err != nil {
 		return nil, nil, err
 	}
 	ci.setImpersonationConfig(restConfig)
+	ci.setRateLimits(restConfig, "")
 
 	restMapper, err := apiutil.NewDynamicRESTMapper(restConfig)
 	if err != nil {
@@ -169,8 +238,8 @@ func (ci *CueInstanceImpersonation) clientForServiceAccountOrDefault() (client.C
 
 }
 
-func (ci *CueInstanceImpersonation) clientForKubeConfig(ctx context.Context) (client.Client, *polling.StatusPoller, error) {
-	kubeConfigBytes, err := ci.getKubeConfig(ctx)
+func (ci *CueInstanceImpersonation) clientForKubeConfig(ctx context.Context, secretName string) (client.Client, *polling.StatusPoller, error) {
+	kubeConfigBytes, err := ci.getKubeConfig(ctx, secretName)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -180,6 +249,7 @@ func (ci *CueInstanceImpersonation) clientForKubeConfig(ctx context.Context) (cl
 		return nil, nil, err
 	}
 	ci.setImpersonationConfig(restConfig)
+	ci.setRateLimits(restConfig, secretName)
 
 	restMapper, err := apiutil.NewDynamicRESTMapper(restConfig)
 	if err != nil {
@@ -196,10 +266,10 @@ func (ci *CueInstanceImpersonation) clientForKubeConfig(ctx context.Context) (cl
 	return client, statusPoller, err
 }
 
-func (ci *CueInstanceImpersonation) getKubeConfig(ctx context.Context) ([]byte, error) {
+func (ci *CueInstanceImpersonation) getKubeConfig(ctx context.Context, name string) ([]byte, error) {
 	secretName := types.NamespacedName{
 		Namespace: ci.cueInstance.GetNamespace(),
-		Name:      ci.cueInstance.Spec.KubeConfig.SecretRef.Name,
+		Name:      name,
 	}
 
 	var secret corev1.Secret
@@ -221,3 +291,32 @@ func (ci *CueInstanceImpersonation) getKubeConfig(ctx context.Context) ([]byte,
 
 	return kubeConfig, nil
 }
+
+// clusterName returns the name of the cluster targeted by the CueInstance
+// as recorded in the inventory.
+func clusterName(cueInstance cuev1alpha1.CueInstance) string {
+	if cueInstance.Spec.KubeConfig != nil {
+		return cueInstance.Spec.KubeConfig.SecretRef.Name
+	}
+	return ""
+}
+
+// findKubeConfig returns the KubeConfig of the cluster among those of the
+// spec and of the dependencies of the CueInstance, nil if there is none,
+// e.g. for the clusters matching the cluster selector.
+func findKubeConfig(cueInstance cuev1alpha1.CueInstance, cluster string) *cuev1alpha1.KubeConfig {
+	if kc := cueInstance.Spec.KubeConfig; kc != nil && kc.SecretRef.Name == cluster {
+		return kc
+	}
+	for i, kc := range cueInstance.Spec.KubeConfigs {
+		if kc.SecretRef.Name == cluster {
+			return &cueInstance.Spec.KubeConfigs[i]
+		}
+	}
+	for _, d := range cueInstance.Spec.DependsOn {
+		if d.IsRemote() && d.KubeConfig.SecretRef.Name == cluster {
+			return d.KubeConfig
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestSetRateLimits(t *testing.T) {
+	g := NewWithT(t)
+
+	instance := cuev1alpha1.CueInstance{
+		Spec: cuev1alpha1.CueInstanceSpec{
+			KubeConfigs: []cuev1alpha1.KubeConfig{
+				{SecretRef: meta.LocalObjectReference{Name: "staging"}},
+				{SecretRef: meta.LocalObjectReference{Name: "prod"}, QPS: 5, Burst: 10},
+			},
+			DependsOn: []cuev1alpha1.DependencyReference{
+				{KubeConfig: &cuev1alpha1.KubeConfig{SecretRef: meta.LocalObjectReference{Name: "hub"}, Burst: 100}},
+			},
+		},
+	}
+	ci := NewCueInstanceImpersonation(instance, nil, nil, "", ClientOptions{
+		QPS:         50,
+		Burst:       100,
+		RemoteQPS:   20,
+		RemoteBurst: 40,
+	})
+
+	restConfig := &rest.Config{}
+	ci.setRateLimits(restConfig, "")
+	g.Expect(restConfig.QPS).To(Equal(float32(50)))
+	g.Expect(restConfig.Burst).To(Equal(100))
+
+	restConfig = &rest.Config{}
+	ci.setRateLimits(restConfig, "staging")
+	g.Expect(restConfig.QPS).To(Equal(float32(20)))
+	g.Expect(restConfig.Burst).To(Equal(40))
+
+	restConfig = &rest.Config{}
+	ci.setRateLimits(restConfig, "prod")
+	g.Expect(restConfig.QPS).To(Equal(float32(5)))
+	g.Expect(restConfig.Burst).To(Equal(10))
+
+	restConfig = &rest.Config{}
+	ci.setRateLimits(restConfig, "hub")
+	g.Expect(restConfig.QPS).To(Equal(float32(20)))
+	g.Expect(restConfig.Burst).To(Equal(100))
+}
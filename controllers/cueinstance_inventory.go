@@ -17,10 +17,13 @@ limitations under the License.
 package controllers
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/ssa"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/cli-utils/pkg/object"
@@ -35,7 +38,7 @@ func NewInventory() *cuev1alpha1.ResourceInventory {
 }
 
 // AddObjectsToInventory extracts the metadata from the given objects and adds it to the inventory.
-func AddObjectsToInventory(inv *cuev1alpha1.ResourceInventory, set *ssa.ChangeSet) error {
+func AddObjectsToInventory(inv *cuev1alpha1.ResourceInventory, set *ssa.ChangeSet, cluster string) error {
 	if set == nil {
 		return nil
 	}
@@ -44,12 +47,38 @@ func AddObjectsToInventory(inv *cuev1alpha1.ResourceInventory, set *ssa.ChangeSe
 		inv.Entries = append(inv.Entries, cuev1alpha1.ResourceRef{
 			ID:      entry.ObjMetadata.String(),
 			Version: entry.GroupVersion,
+			Cluster: cluster,
 		})
 	}
 
 	return nil
 }
 
+// ListClustersInInventory returns the sorted list of clusters the inventory entries were applied to.
+func ListClustersInInventory(inv *cuev1alpha1.ResourceInventory) []string {
+	seen := map[string]bool{}
+	clusters := []string{}
+	for _, entry := range inv.Entries {
+		if !seen[entry.Cluster] {
+			seen[entry.Cluster] = true
+			clusters = append(clusters, entry.Cluster)
+		}
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// FilterInventory returns the inventory entries which were applied to the given cluster.
+func FilterInventory(inv *cuev1alpha1.ResourceInventory, cluster string) *cuev1alpha1.ResourceInventory {
+	filtered := NewInventory()
+	for _, entry := range inv.Entries {
+		if entry.Cluster == cluster {
+			filtered.Entries = append(filtered.Entries, entry)
+		}
+	}
+	return filtered
+}
+
 // ListObjectsInInventory returns the inventory entries as unstructured.Unstructured objects.
 func ListObjectsInInventory(inv *cuev1alpha1.ResourceInventory) ([]*unstructured.Unstructured, error) {
 	objects := make([]*unstructured.Unstructured, 0)
@@ -95,13 +124,11 @@ func ListMetaInInventory(inv *cuev1alpha1.ResourceInventory) (object.ObjMetadata
 
 // DiffInventory returns the slice of objects that do not exist in the target inventory.
 func DiffInventory(inv *cuev1alpha1.ResourceInventory, target *cuev1alpha1.ResourceInventory) ([]*unstructured.Unstructured, error) {
-	versionOf := func(i *cuev1alpha1.ResourceInventory, objMetadata object.ObjMetadata) string {
-		for _, entry := range i.Entries {
-			if entry.ID == objMetadata.String() {
-				return entry.Version
-			}
+	versions := make(map[string]string, len(inv.Entries))
+	for _, entry := range inv.Entries {
+		if _, ok := versions[entry.ID]; !ok {
+			versions[entry.ID] = entry.Version
 		}
-		return ""
 	}
 
 	objects := make([]*unstructured.Unstructured, 0)
@@ -125,7 +152,7 @@ func DiffInventory(inv *cuev1alpha1.ResourceInventory, target *cuev1alpha1.Resou
 		u.SetGroupVersionKind(schema.GroupVersionKind{
 			Group:   metadata.GroupKind.Group,
 			Kind:    metadata.GroupKind.Kind,
-			Version: versionOf(inv, metadata),
+			Version: versions[metadata.String()],
 		})
 		u.SetName(metadata.Name)
 		u.SetNamespace(metadata.Namespace)
@@ -167,3 +194,85 @@ func referenceToObjMetadataSet(cr []meta.NamespacedObjectKindReference) (object.
 
 	return objects, nil
 }
+
+// newGarbageCollectionReport returns a report of the objects deleted by the given
+// change set, or nil if no objects were deleted.
+func newGarbageCollectionReport(set *ssa.ChangeSet, revision string) *cuev1alpha1.GarbageCollectionReport {
+	if set == nil {
+		return nil
+	}
+
+	var entries []cuev1alpha1.ResourceRef
+	for _, entry := range set.Entries {
+		if entry.Action != string(ssa.DeletedAction) {
+			continue
+		}
+		entries = append(entries, cuev1alpha1.ResourceRef{
+			ID:      entry.ObjMetadata.String(),
+			Version: entry.GroupVersion,
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return &cuev1alpha1.GarbageCollectionReport{
+		Revision: revision,
+		Time:     metav1.Now(),
+		Entries:  entries,
+	}
+}
+
+// garbageCollectionMessage returns a single message listing
+// the objects deleted by the given change set.
+func garbageCollectionMessage(set *ssa.ChangeSet, revision string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Garbage collection completed for revision %s:", revision)
+	for _, entry := range set.Entries {
+		if entry.Action != string(ssa.DeletedAction) {
+			continue
+		}
+		b.WriteString("\n" + entry.Subject + " pruned")
+	}
+	return b.String()
+}
+
+// newApplySummary counts the actions of the change set of an apply, whose
+// first entries are those of the skipped objects.
+func newApplySummary(revision string, set *ssa.ChangeSet, skipped int) *cuev1alpha1.ApplySummary {
+	summary := &cuev1alpha1.ApplySummary{Revision: revision, Skipped: skipped}
+	for _, entry := range set.Entries[skipped:] {
+		switch ssa.Action(entry.Action) {
+		case ssa.CreatedAction:
+			summary.Created++
+		case ssa.ConfiguredAction:
+			summary.Configured++
+		case ssa.UnchangedAction:
+			summary.Unchanged++
+		}
+	}
+	return summary
+}
+
+// addApplySummary sums up the summaries of the applies to multiple clusters.
+func addApplySummary(total, summary *cuev1alpha1.ApplySummary) *cuev1alpha1.ApplySummary {
+	if summary == nil {
+		return total
+	}
+	if total == nil {
+		return summary.DeepCopy()
+	}
+	total.Created += summary.Created
+	total.Configured += summary.Configured
+	total.Unchanged += summary.Unchanged
+	total.Skipped += summary.Skipped
+	total.Pruned += summary.Pruned
+	return total
+}
+
+// applySummaryMessage formats the counts of the summary.
+func applySummaryMessage(summary cuev1alpha1.ApplySummary) string {
+	return fmt.Sprintf("%d created, %d configured, %d unchanged, %d skipped, %d pruned",
+		summary.Created, summary.Configured, summary.Unchanged, summary.Skipped, summary.Pruned)
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/object"
+)
+
+func TestGarbageCollectionReport(t *testing.T) {
+	g := NewWithT(t)
+
+	entry := func(kind, namespace, name string, action ssa.Action) ssa.ChangeSetEntry {
+		id := object.ObjMetadata{
+			GroupKind: schema.GroupKind{Kind: kind},
+			Namespace: namespace,
+			Name:      name,
+		}
+		return ssa.ChangeSetEntry{
+			ObjMetadata:  id,
+			GroupVersion: "v1",
+			Subject:      ssa.FmtObjMetadata(id),
+			Action:       string(action),
+		}
+	}
+
+	g.Expect(newGarbageCollectionReport(nil, "main/8d1b5a3")).To(BeNil())
+
+	set := ssa.NewChangeSet()
+	set.Add(entry("ConfigMap", "apps", "config", ssa.DeletedAction))
+	set.Add(entry("Secret", "apps", "keep", ssa.UnchangedAction))
+	set.Add(entry("Namespace", "", "apps", ssa.DeletedAction))
+
+	report := newGarbageCollectionReport(set, "main/8d1b5a3")
+	g.Expect(report).NotTo(BeNil())
+	g.Expect(report.Revision).To(Equal("main/8d1b5a3"))
+	g.Expect(report.Entries).To(HaveLen(2))
+	g.Expect(report.Entries[0].ID).To(Equal("apps_config__ConfigMap"))
+
+	msg := garbageCollectionMessage(set, "main/8d1b5a3")
+	g.Expect(msg).To(ContainSubstring("ConfigMap/apps/config pruned"))
+	g.Expect(msg).To(ContainSubstring("Namespace/apps pruned"))
+	g.Expect(msg).NotTo(ContainSubstring("keep"))
+
+	unchanged := ssa.NewChangeSet()
+	unchanged.Add(entry("Secret", "apps", "keep", ssa.UnchangedAction))
+	g.Expect(newGarbageCollectionReport(unchanged, "main/8d1b5a3")).To(BeNil())
+}
+
+func TestInventoryClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := &cuev1alpha1.ResourceInventory{
+		Entries: []cuev1alpha1.ResourceRef{
+			{ID: "apps_config__ConfigMap", Version: "v1", Cluster: "staging"},
+			{ID: "_apps__Namespace", Version: "v1"},
+			{ID: "apps_config__ConfigMap", Version: "v1"},
+			{ID: "_apps__Namespace", Version: "v1", Cluster: "staging"},
+		},
+	}
+
+	g.Expect(ListClustersInInventory(inv)).To(Equal([]string{"", "staging"}))
+	g.Expect(FilterInventory(inv, "staging").Entries).To(HaveLen(2))
+	g.Expect(FilterInventory(inv, "production").Entries).To(BeEmpty())
+
+	// switching cluster makes every object of the previous cluster stale
+	stale, err := DiffInventory(FilterInventory(inv, "staging"), FilterInventory(inv, "production"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stale).To(HaveLen(2))
+
+	stale, err = DiffInventory(FilterInventory(inv, ""), FilterInventory(inv, "staging"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stale).To(BeEmpty())
+}
+
+func TestIsNoOpReconcile(t *testing.T) {
+	g := NewWithT(t)
+
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Status: cuev1alpha1.CueInstanceStatus{
+			ObservedGeneration:  2,
+			LastAppliedRevision: "main/8d1b5a3",
+		},
+	}
+	in := clusterReconcile{revision: "main/8d1b5a3", checksum: "abc", lastAppliedChecksum: "abc"}
+	g.Expect(isNoOpReconcile(instance, in)).To(BeTrue())
+
+	changed := in
+	changed.revision = "main/0000000"
+	g.Expect(isNoOpReconcile(instance, changed)).To(BeFalse())
+
+	changed = in
+	changed.lastAppliedChecksum = ""
+	g.Expect(isNoOpReconcile(instance, changed)).To(BeFalse())
+
+	instance.Generation = 3
+	g.Expect(isNoOpReconcile(instance, in)).To(BeFalse())
+}
+
+func TestApplySummary(t *testing.T) {
+	g := NewWithT(t)
+
+	set := ssa.NewChangeSet()
+	set.Add(ssa.ChangeSetEntry{Subject: "v1/ConfigMap/default/once", Action: string(ssa.UnchangedAction)})
+	set.Add(ssa.ChangeSetEntry{Subject: "v1/Namespace/app", Action: string(ssa.UnchangedAction)})
+	set.Add(ssa.ChangeSetEntry{Subject: "apps/Deployment/app/app", Action: string(ssa.ConfiguredAction)})
+	set.Add(ssa.ChangeSetEntry{Subject: "v1/Service/app/app", Action: string(ssa.CreatedAction)})
+
+	summary := newApplySummary("main/abc", set, 1)
+	g.Expect(*summary).To(Equal(cuev1alpha1.ApplySummary{
+		Revision:   "main/abc",
+		Created:    1,
+		Configured: 1,
+		Unchanged:  1,
+		Skipped:    1,
+	}))
+
+	summary.Pruned = 2
+	total := addApplySummary(nil, summary)
+	total = addApplySummary(total, nil)
+	total = addApplySummary(total, summary)
+	g.Expect(applySummaryMessage(*total)).To(Equal("2 created, 2 configured, 2 unchanged, 2 skipped, 4 pruned"))
+	g.Expect(summary.Created).To(Equal(1))
+}
+
+func TestInventoryObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	inv := &cuev1alpha1.ResourceInventory{Entries: []cuev1alpha1.ResourceRef{
+		{
+			ID: object.ObjMetadata{
+				GroupKind: schema.GroupKind{Group: "apps", Kind: "Deployment"},
+				Namespace: "default",
+				Name:      "frontend",
+			}.String(),
+			Version: "v1",
+			Cluster: "staging",
+		},
+		{
+			ID: object.ObjMetadata{
+				GroupKind: schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+				Name:      "system:frontend",
+			}.String(),
+			Version: "v1",
+		},
+	}}
+
+	objects, err := inv.Objects()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(objects).To(Equal([]cuev1alpha1.InventoryObject{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "frontend", Cluster: "staging"},
+		{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "system:frontend"},
+	}))
+
+	_, err = cuev1alpha1.ResourceRef{ID: "default_frontend"}.Object()
+	g.Expect(err).To(MatchError(ContainSubstring("invalid inventory entry ID")))
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"time"
+)
+
+// withJitter returns the interval randomly shifted by up to the given
+// percentage in either direction, so that CueInstances created at the
+// same time are not reconciled in lockstep.
+func withJitter(interval time.Duration, percentage int) time.Duration {
+	if percentage <= 0 || interval <= 0 {
+		return interval
+	}
+	max := int64(interval) * int64(percentage) / 100
+	if max == 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*max+1)-max)
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWithJitter(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(withJitter(time.Minute, 0)).To(Equal(time.Minute))
+	g.Expect(withJitter(0, 10)).To(BeZero())
+
+	for i := 0; i < 100; i++ {
+		d := withJitter(10*time.Minute, 10)
+		g.Expect(d).To(BeNumerically(">=", 9*time.Minute))
+		g.Expect(d).To(BeNumerically("<=", 11*time.Minute))
+	}
+}
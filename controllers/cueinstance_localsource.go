@@ -0,0 +1,176 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// localSource is a source read from a directory of the controller filesystem,
+// its artifact is a reproducible archive of the directory.
+type localSource struct {
+	artifact *sourcev1.Artifact
+}
+
+func (s *localSource) GetArtifact() *sourcev1.Artifact {
+	return s.artifact
+}
+
+func (s *localSource) GetInterval() metav1.Duration {
+	return metav1.Duration{}
+}
+
+// getLocalSource returns the Directory source at the given path relative to
+// the local source root, archiving the directory to compute its revision.
+func (r *CueInstanceReconciler) getLocalSource(path string) (sourcev1.Source, error) {
+	if r.LocalSourceRoot == "" {
+		return nil, fmt.Errorf("source kind '%s' not supported, local sources are disabled", cuev1alpha1.DirectorySourceKind)
+	}
+
+	root, err := filepath.Abs(r.LocalSourceRoot)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := securejoin.SecureJoin(root, path)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "directories"}, path)
+	}
+
+	data, err := archiveDirectory(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to archive directory '%s': %w", path, err)
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	return &localSource{artifact: &sourcev1.Artifact{
+		Path:           dir,
+		URL:            "file://" + filepath.ToSlash(dir),
+		Revision:       "local/" + checksum,
+		Checksum:       checksum,
+		LastUpdateTime: metav1.Now(),
+	}}, nil
+}
+
+// localArtifactPath returns the directory of the artifact when it is a
+// file URL of the local source root, local sources being enabled.
+func (r *CueInstanceReconciler) localArtifactPath(artifactURL *url.URL) (string, bool) {
+	if r.LocalSourceRoot == "" || artifactURL.Scheme != "file" {
+		return "", false
+	}
+	root, err := filepath.Abs(r.LocalSourceRoot)
+	if err != nil {
+		return "", false
+	}
+	dir := filepath.FromSlash(artifactURL.Path)
+	return dir, withinDir(root, dir)
+}
+
+// archiveDirectory returns the gzip-compressed tarball of the directory
+// without the .git directory. The tarball of identical directories is
+// identical, as the entries are ordered lexically and have no timestamps.
+func archiveDirectory(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		header := &tar.Header{Name: filepath.ToSlash(rel), Mode: int64(fi.Mode().Perm())}
+		switch {
+		case fi.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case fi.Mode().IsRegular():
+			header.Typeflag = tar.TypeReg
+			header.Size = fi.Size()
+		case fi.Mode()&fs.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+			if header.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			// skip sockets, devices and pipes
+			return nil
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.CopyN(tw, f, header.Size); err != nil {
+			return fmt.Errorf("error reading %s: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestGetLocalSource(t *testing.T) {
+	g := NewWithT(t)
+
+	root := t.TempDir()
+	app := filepath.Join(root, "apps", "podinfo")
+	g.Expect(os.MkdirAll(filepath.Join(app, ".git"), 0o755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(app, "main.cue"), []byte("package podinfo\nreplicas: 1\n"), 0o644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(app, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644)).To(Succeed())
+
+	_, err := (&CueInstanceReconciler{}).getLocalSource("apps/podinfo")
+	g.Expect(err).To(MatchError(ContainSubstring("local sources are disabled")))
+
+	r := &CueInstanceReconciler{LocalSourceRoot: root}
+	_, err = r.getLocalSource("apps/missing")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	// paths are resolved within the root
+	_, err = r.getLocalSource("../../apps/podinfo")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	source, err := r.getLocalSource("apps/podinfo")
+	g.Expect(err).NotTo(HaveOccurred())
+	revision := source.GetArtifact().Revision
+	g.Expect(revision).To(HavePrefix("local/"))
+
+	// the revision only changes with the content of the directory
+	g.Expect(os.WriteFile(filepath.Join(app, ".git", "HEAD"), []byte("ref: refs/heads/dev\n"), 0o644)).To(Succeed())
+	source, err = r.getLocalSource("apps/podinfo")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(source.GetArtifact().Revision).To(Equal(revision))
+
+	g.Expect(os.WriteFile(filepath.Join(app, "main.cue"), []byte("package podinfo\nreplicas: 2\n"), 0o644)).To(Succeed())
+	source, err = r.getLocalSource("apps/podinfo")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(source.GetArtifact().Revision).NotTo(Equal(revision))
+
+	tmpDir := t.TempDir()
+	g.Expect(r.download(context.TODO(), source.GetArtifact(), tmpDir, ExtractOptions{})).To(Succeed())
+	data, err := os.ReadFile(filepath.Join(tmpDir, "main.cue"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("package podinfo\nreplicas: 2\n"))
+	g.Expect(filepath.Join(tmpDir, ".git")).NotTo(BeADirectory())
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxMatrixVariants is the maximum number of variants of a matrix build.
+const maxMatrixVariants = 256
+
+// buildFunc builds a single CUE instance.
+type buildFunc func(req BuildRequest) (*BuildResult, error)
+
+// buildMatrix renders the instance once per combination of the tag values
+// of spec.matrix and concatenates the manifests of all the variants.
+// All the variants are built even when one of them fails, so that
+// their status can be reported.
+func buildMatrix(req BuildRequest, build buildFunc) (*BuildResult, error) {
+	if len(req.Spec.Matrix) == 0 {
+		return build(req)
+	}
+
+	variants, err := matrixVariants(req.Spec.Matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BuildResult{}
+	var (
+		manifests bytes.Buffer
+		failures  []string
+	)
+	renderedBy := map[object.ObjMetadata]string{}
+	for _, tags := range variants {
+		name := variantName(tags)
+		status := cuev1alpha1.VariantStatus{Name: name}
+
+		variantReq := req
+		variantReq.Spec = *req.Spec.DeepCopy()
+		variantReq.Spec.Matrix = nil
+		variantReq.Spec.Tags = mergeTags(variantReq.Spec.Tags, tags)
+
+		variant, err := build(variantReq)
+		if variant != nil {
+			result.Validation = append(result.Validation, variant.Validation...)
+			result.ValidationDuration += variant.ValidationDuration
+			result.Errors = append(result.Errors, variant.Errors...)
+		}
+		if err == nil {
+			err = checkVariantObjects(name, variant.Manifests, renderedBy, &status)
+		}
+		if err != nil {
+			status.Message = err.Error()
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err.Error()))
+		} else {
+			status.Ready = true
+			manifests.Write(variant.Manifests)
+			if !bytes.HasSuffix(variant.Manifests, []byte("---\n")) {
+				manifests.WriteString("\n---\n")
+			}
+		}
+		result.Variants = append(result.Variants, status)
+	}
+
+	if len(failures) > 0 {
+		return result, fmt.Errorf("matrix build failed for %d of %d variants: %s",
+			len(failures), len(variants), strings.Join(failures, "; "))
+	}
+
+	result.Manifests = manifests.Bytes()
+	return result, nil
+}
+
+// checkVariantObjects counts the objects rendered by the variant and
+// fails when one of them was already rendered by another variant.
+func checkVariantObjects(name string, manifests []byte, renderedBy map[object.ObjMetadata]string, status *cuev1alpha1.VariantStatus) error {
+	objects, err := decodeObjects(bytes.NewReader(manifests))
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		id := object.UnstructuredToObjMetadata(obj)
+		if other, ok := renderedBy[id]; ok {
+			return fmt.Errorf("object %s is also rendered by variant '%s'", ssa.FmtObjMetadata(id), other)
+		}
+		renderedBy[id] = name
+	}
+	status.Objects = len(objects)
+	return nil
+}
+
+// matrixVariants returns the tags of every combination of the
+// values of the matrix dimensions, in the order they are listed.
+func matrixVariants(matrix []cuev1alpha1.MatrixDimension) ([][]cuev1alpha1.TagVar, error) {
+	count := 1
+	for _, dim := range matrix {
+		if len(dim.Values) == 0 {
+			return nil, fmt.Errorf("matrix tag '%s' has no values", dim.Name)
+		}
+		count *= len(dim.Values)
+		if count > maxMatrixVariants {
+			return nil, fmt.Errorf("matrix exceeds the maximum of %d variants", maxMatrixVariants)
+		}
+	}
+
+	variants := [][]cuev1alpha1.TagVar{{}}
+	for _, dim := range matrix {
+		next := make([][]cuev1alpha1.TagVar, 0, len(variants)*len(dim.Values))
+		for _, tags := range variants {
+			for _, value := range dim.Values {
+				variant := make([]cuev1alpha1.TagVar, len(tags), len(tags)+1)
+				copy(variant, tags)
+				next = append(next, append(variant, cuev1alpha1.TagVar{Name: dim.Name, Value: value}))
+			}
+		}
+		variants = next
+	}
+	return variants, nil
+}
+
+// variantName identifies a variant by its tag values, e.g. 'region=eu,tier=web'.
+func variantName(tags []cuev1alpha1.TagVar) string {
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Name + "=" + t.Value
+	}
+	return strings.Join(parts, ",")
+}
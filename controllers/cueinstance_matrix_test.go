@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestMatrixVariants(t *testing.T) {
+	g := NewWithT(t)
+
+	variants, err := matrixVariants([]cuev1alpha1.MatrixDimension{
+		{Name: "region", Values: []string{"eu", "us"}},
+		{Name: "tier", Values: []string{"web", "api"}},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var names []string
+	for _, tags := range variants {
+		names = append(names, variantName(tags))
+	}
+	g.Expect(names).To(Equal([]string{
+		"region=eu,tier=web",
+		"region=eu,tier=api",
+		"region=us,tier=web",
+		"region=us,tier=api",
+	}))
+
+	_, err = matrixVariants([]cuev1alpha1.MatrixDimension{{Name: "region"}})
+	g.Expect(err).To(MatchError(ContainSubstring("has no values")))
+}
+
+func TestBuildMatrix(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+region: string @tag(region)
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app-\(region)"
+}]
+`)
+
+	tests := []struct {
+		name     string
+		tags     []cuev1alpha1.TagVar
+		values   []string
+		want     []string
+		variants []cuev1alpha1.VariantStatus
+		wantErr  string
+	}{
+		{
+			name:   "one variant per value",
+			tags:   []cuev1alpha1.TagVar{{Name: "region", Value: "ignored"}},
+			values: []string{"eu", "us"},
+			want:   []string{"app-eu", "app-us"},
+			variants: []cuev1alpha1.VariantStatus{
+				{Name: "region=eu", Ready: true, Objects: 1},
+				{Name: "region=us", Ready: true, Objects: 1},
+			},
+		},
+		{
+			name:    "duplicate objects",
+			values:  []string{"eu", "eu"},
+			wantErr: "matrix build failed for 1 of 2 variants",
+			variants: []cuev1alpha1.VariantStatus{
+				{Name: "region=eu", Ready: true, Objects: 1},
+				{Name: "region=eu", Message: "object ConfigMap/app-eu is also rendered by variant 'region=eu'"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			result, err := buildMatrix(BuildRequest{
+				Root: root,
+				Dir:  root,
+				Spec: cuev1alpha1.CueInstanceSpec{
+					Tags:   tt.tags,
+					Matrix: []cuev1alpha1.MatrixDimension{{Name: "region", Values: tt.values}},
+				},
+			}, buildInstance)
+			g.Expect(result.Variants).To(Equal(tt.variants))
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			objects, err := readObjects(cuev1alpha1.CueInstance{}, result.Manifests)
+			g.Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, obj := range objects {
+				names = append(names, obj.GetName())
+			}
+			g.Expect(names).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/reference"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// Metrics records the metrics specific to the CueInstances, next to the
+// GitOps Toolkit metrics of the runtime recorder.
+type Metrics struct {
+	validationFailures *prometheus.CounterVec
+	droppedObjects     *prometheus.CounterVec
+	policyViolations   *prometheus.CounterVec
+	inventorySize      *prometheus.GaugeVec
+	prunedObjects      *prometheus.GaugeVec
+	driftedObjects     *prometheus.GaugeVec
+}
+
+// NewMetrics returns the recorder of the CueInstance metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		validationFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cue_validation_failures_total",
+				Help: "The number of objects failing the schema validation of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace", "result"},
+		),
+		droppedObjects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cue_dropped_objects_total",
+				Help: "The number of objects dropped by the validations of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace"},
+		),
+		policyViolations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cue_policy_violations_total",
+				Help: "The number of policy violations of the objects of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace", "policy", "result"},
+		),
+		inventorySize: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cue_inventory_objects",
+				Help: "The number of objects in the inventory of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace"},
+		),
+		prunedObjects: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cue_pruned_objects",
+				Help: "The number of objects pruned by the last reconciliation of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace"},
+		),
+		driftedObjects: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "cue_drifted_objects",
+				Help: "The number of drifted objects detected or corrected by the last reconciliation of a CueInstance.",
+			},
+			[]string{"kind", "name", "namespace", "state"},
+		),
+	}
+}
+
+// Collectors returns the collectors to register.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.validationFailures, m.droppedObjects, m.policyViolations,
+		m.inventorySize, m.prunedObjects, m.driftedObjects,
+	}
+}
+
+// RecordValidation counts the failed validations of a reconciliation,
+// an object dropped by several validations is counted once.
+func (m *Metrics) RecordValidation(ref corev1.ObjectReference, results []cuev1alpha1.ValidationResult) {
+	dropped := make(map[string]bool)
+	for _, result := range results {
+		if result.Result == cuev1alpha1.PassResult {
+			continue
+		}
+		if result.Result == cuev1alpha1.DropResult {
+			dropped[result.Subject] = true
+		}
+
+		switch {
+		case result.Source == "schema":
+			m.validationFailures.WithLabelValues(ref.Kind, ref.Name, ref.Namespace, string(result.Result)).Inc()
+		case result.Source == "rego":
+			m.policyViolations.WithLabelValues(ref.Kind, ref.Name, ref.Namespace, "rego", string(result.Result)).Inc()
+		case strings.HasPrefix(result.Source, "policy/"):
+			policy := strings.TrimPrefix(result.Source, "policy/")
+			m.policyViolations.WithLabelValues(ref.Kind, ref.Name, ref.Namespace, policy, string(result.Result)).Inc()
+		}
+	}
+
+	if len(dropped) > 0 {
+		m.droppedObjects.WithLabelValues(ref.Kind, ref.Name, ref.Namespace).Add(float64(len(dropped)))
+	}
+}
+
+// RecordInventory sets the number of objects in the inventory.
+func (m *Metrics) RecordInventory(ref corev1.ObjectReference, size int) {
+	m.inventorySize.WithLabelValues(ref.Kind, ref.Name, ref.Namespace).Set(float64(size))
+}
+
+// RecordObjectChanges sets the number of objects pruned by the last reconciliation,
+// and the number of drifted objects it detected and corrected. Drifted objects are
+// those changed by a reconciliation of the last applied revision and spec.
+func (m *Metrics) RecordObjectChanges(ref corev1.ObjectReference, pruned, detected, corrected int) {
+	m.prunedObjects.WithLabelValues(ref.Kind, ref.Name, ref.Namespace).Set(float64(pruned))
+	m.driftedObjects.WithLabelValues(ref.Kind, ref.Name, ref.Namespace, "detected").Set(float64(detected))
+	m.driftedObjects.WithLabelValues(ref.Kind, ref.Name, ref.Namespace, "corrected").Set(float64(corrected))
+}
+
+// DeleteGauges removes the gauges of a deleted CueInstance.
+func (m *Metrics) DeleteGauges(ref corev1.ObjectReference) {
+	m.inventorySize.DeleteLabelValues(ref.Kind, ref.Name, ref.Namespace)
+	m.prunedObjects.DeleteLabelValues(ref.Kind, ref.Name, ref.Namespace)
+	m.driftedObjects.DeleteLabelValues(ref.Kind, ref.Name, ref.Namespace, "detected")
+	m.driftedObjects.DeleteLabelValues(ref.Kind, ref.Name, ref.Namespace, "corrected")
+}
+
+// recordValidation records the validation metrics of the report.
+func (r *CueInstanceReconciler) recordValidation(ctx context.Context, cueInstance cuev1alpha1.CueInstance, report *validationReport) {
+	if r.Metrics == nil || report == nil || len(report.results) == 0 {
+		return
+	}
+
+	objRef, err := reference.GetReference(r.Scheme, &cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to record validation metrics")
+		return
+	}
+	r.Metrics.RecordValidation(*objRef, report.results)
+}
+
+// recordInventory records the size of the inventory, or removes
+// the gauges of the CueInstance when it is deleted.
+func (r *CueInstanceReconciler) recordInventory(ctx context.Context, cueInstance cuev1alpha1.CueInstance) {
+	if r.Metrics == nil {
+		return
+	}
+
+	objRef, err := reference.GetReference(r.Scheme, &cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to record inventory metrics")
+		return
+	}
+	if !cueInstance.DeletionTimestamp.IsZero() {
+		r.Metrics.DeleteGauges(*objRef)
+		return
+	}
+
+	size := 0
+	if cueInstance.Status.Inventory != nil {
+		size = len(cueInstance.Status.Inventory.Entries)
+	}
+	r.Metrics.RecordInventory(*objRef, size)
+}
+
+// recordObjectChanges records the pruned and drifted objects of a reconciliation.
+func (r *CueInstanceReconciler) recordObjectChanges(ctx context.Context, cueInstance cuev1alpha1.CueInstance, pruned, detected, corrected int) {
+	if r.Metrics == nil {
+		return
+	}
+
+	objRef, err := reference.GetReference(r.Scheme, &cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to record drift metrics")
+		return
+	}
+	r.Metrics.RecordObjectChanges(*objRef, pruned, detected, corrected)
+}
+
+// driftedObjects returns the number of objects created or configured by
+// the server-side apply.
+func driftedObjects(changeSet *ssa.ChangeSet) int {
+	if changeSet == nil {
+		return 0
+	}
+
+	n := 0
+	for _, entry := range changeSet.Entries {
+		switch ssa.Action(entry.Action) {
+		case ssa.CreatedAction, ssa.ConfiguredAction:
+			n++
+		}
+	}
+	return n
+}
+
+// driftedChanges returns the number of objects the pending changes would create or configure.
+func driftedChanges(changes []cuev1alpha1.PendingChange) int {
+	n := 0
+	for _, c := range changes {
+		if c.Action == string(ssa.CreatedAction) || c.Action == string(ssa.ConfiguredAction) {
+			n++
+		}
+	}
+	return n
+}
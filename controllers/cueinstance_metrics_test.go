@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestMetricsRecordValidation(t *testing.T) {
+	g := NewWithT(t)
+
+	m := NewMetrics()
+	ref := corev1.ObjectReference{Kind: cuev1alpha1.CueInstanceKind, Name: "app", Namespace: "default"}
+
+	m.RecordValidation(ref, []cuev1alpha1.ValidationResult{
+		{Subject: "apps/Deployment/default/app", Source: "schema", Result: cuev1alpha1.WarnResult},
+		{Subject: "apps/Deployment/default/app", Source: "policy/replicas", Result: cuev1alpha1.DropResult},
+		{Subject: "apps/Deployment/default/app", Source: "rego", Result: cuev1alpha1.DropResult},
+		{Subject: "v1/Service/default/app", Source: "policy/replicas", Result: cuev1alpha1.AuditResult},
+		{Subject: "v1/ConfigMap/default/app", Result: cuev1alpha1.PassResult},
+	})
+
+	g.Expect(testutil.ToFloat64(m.validationFailures.WithLabelValues(ref.Kind, "app", "default", "Warn"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(m.policyViolations.WithLabelValues(ref.Kind, "app", "default", "replicas", "Drop"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(m.policyViolations.WithLabelValues(ref.Kind, "app", "default", "replicas", "Audit"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(m.policyViolations.WithLabelValues(ref.Kind, "app", "default", "rego", "Drop"))).To(Equal(1.0))
+	g.Expect(testutil.ToFloat64(m.droppedObjects.WithLabelValues(ref.Kind, "app", "default"))).To(Equal(1.0))
+}
+
+func TestMetricsRecordObjectChanges(t *testing.T) {
+	g := NewWithT(t)
+
+	m := NewMetrics()
+	ref := corev1.ObjectReference{Kind: cuev1alpha1.CueInstanceKind, Name: "app", Namespace: "default"}
+
+	m.RecordInventory(ref, 12)
+	m.RecordObjectChanges(ref, 2, 3, 1)
+	g.Expect(testutil.ToFloat64(m.inventorySize.WithLabelValues(ref.Kind, "app", "default"))).To(Equal(12.0))
+	g.Expect(testutil.ToFloat64(m.prunedObjects.WithLabelValues(ref.Kind, "app", "default"))).To(Equal(2.0))
+	g.Expect(testutil.ToFloat64(m.driftedObjects.WithLabelValues(ref.Kind, "app", "default", "detected"))).To(Equal(3.0))
+	g.Expect(testutil.ToFloat64(m.driftedObjects.WithLabelValues(ref.Kind, "app", "default", "corrected"))).To(Equal(1.0))
+
+	m.DeleteGauges(ref)
+	g.Expect(testutil.CollectAndCount(m.inventorySize)).To(BeZero())
+	g.Expect(testutil.CollectAndCount(m.prunedObjects)).To(BeZero())
+	g.Expect(testutil.CollectAndCount(m.driftedObjects)).To(BeZero())
+}
+
+func TestDriftedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	changeSet := ssa.NewChangeSet()
+	changeSet.Add(ssa.ChangeSetEntry{Subject: "Deployment/default/app", Action: string(ssa.ConfiguredAction)})
+	changeSet.Add(ssa.ChangeSetEntry{Subject: "Service/default/app", Action: string(ssa.UnchangedAction)})
+	changeSet.Add(ssa.ChangeSetEntry{Subject: "ConfigMap/default/app", Action: string(ssa.CreatedAction)})
+	g.Expect(driftedObjects(changeSet)).To(Equal(2))
+	g.Expect(driftedObjects(nil)).To(BeZero())
+
+	g.Expect(driftedChanges([]cuev1alpha1.PendingChange{
+		{Subject: "Deployment/default/app", Action: string(ssa.ConfiguredAction)},
+		{Subject: "Service/default/old", Action: string(ssa.DeletedAction)},
+	})).To(Equal(1))
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// nameKey identifies a rendered object for the reference fixups.
+type nameKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// nameReference is a field referencing an object of the given kind by name,
+// in the form of a dot separated path where '[]' iterates over a list.
+type nameReference struct {
+	kind string
+	path string
+}
+
+// podSpecReferences are the references found in a pod spec.
+var podSpecReferences = []nameReference{
+	{kind: "ServiceAccount", path: "serviceAccountName"},
+	{kind: "Secret", path: "imagePullSecrets[].name"},
+	{kind: "ConfigMap", path: "volumes[].configMap.name"},
+	{kind: "Secret", path: "volumes[].secret.secretName"},
+	{kind: "PersistentVolumeClaim", path: "volumes[].persistentVolumeClaim.claimName"},
+	{kind: "ConfigMap", path: "volumes[].projected.sources[].configMap.name"},
+	{kind: "Secret", path: "volumes[].projected.sources[].secret.name"},
+	{kind: "ConfigMap", path: "containers[].env[].valueFrom.configMapKeyRef.name"},
+	{kind: "Secret", path: "containers[].env[].valueFrom.secretKeyRef.name"},
+	{kind: "ConfigMap", path: "containers[].envFrom[].configMapRef.name"},
+	{kind: "Secret", path: "containers[].envFrom[].secretRef.name"},
+	{kind: "ConfigMap", path: "initContainers[].env[].valueFrom.configMapKeyRef.name"},
+	{kind: "Secret", path: "initContainers[].env[].valueFrom.secretKeyRef.name"},
+	{kind: "ConfigMap", path: "initContainers[].envFrom[].configMapRef.name"},
+	{kind: "Secret", path: "initContainers[].envFrom[].secretRef.name"},
+}
+
+// podSpecPaths are the paths of the pod spec of the workload kinds.
+var podSpecPaths = map[string]string{
+	"Pod":         "spec",
+	"Deployment":  "spec.template.spec",
+	"StatefulSet": "spec.template.spec",
+	"DaemonSet":   "spec.template.spec",
+	"ReplicaSet":  "spec.template.spec",
+	"Job":         "spec.template.spec",
+	"CronJob":     "spec.jobTemplate.spec.template.spec",
+}
+
+// kindReferences are the references specific to a kind.
+var kindReferences = map[string][]nameReference{
+	"StatefulSet": {{kind: "Service", path: "spec.serviceName"}},
+	"Ingress": {
+		{kind: "Service", path: "spec.defaultBackend.service.name"},
+		{kind: "Service", path: "spec.rules[].http.paths[].backend.service.name"},
+	},
+}
+
+// transformNames adds the prefix and suffix to the names of the objects
+// and updates the references between the renamed objects.
+func transformNames(objects []*unstructured.Unstructured, prefix, suffix string) {
+	if prefix == "" && suffix == "" {
+		return
+	}
+
+	renamed := map[nameKey]string{}
+	for _, obj := range objects {
+		switch obj.GetKind() {
+		case "Namespace", "CustomResourceDefinition":
+			continue
+		}
+		name := prefix + obj.GetName() + suffix
+		renamed[nameKey{kind: obj.GetKind(), namespace: obj.GetNamespace(), name: obj.GetName()}] = name
+		obj.SetName(name)
+	}
+
+	for _, obj := range objects {
+		namespace := obj.GetNamespace()
+		rename := func(kind string) func(string) string {
+			return func(name string) string {
+				if newName, ok := renamed[nameKey{kind: kind, namespace: namespace, name: name}]; ok {
+					return newName
+				}
+				return name
+			}
+		}
+
+		if podSpec, ok := podSpecPaths[obj.GetKind()]; ok {
+			for _, ref := range podSpecReferences {
+				visitNameField(obj.Object, splitFieldPath(podSpec+"."+ref.path), rename(ref.kind))
+			}
+		}
+		for _, ref := range kindReferences[obj.GetKind()] {
+			visitNameField(obj.Object, splitFieldPath(ref.path), rename(ref.kind))
+		}
+
+		switch obj.GetKind() {
+		case "RoleBinding", "ClusterRoleBinding":
+			renameRoleBindingRefs(obj, renamed)
+		case "HorizontalPodAutoscaler":
+			if kind, ok, _ := unstructured.NestedString(obj.Object, "spec", "scaleTargetRef", "kind"); ok {
+				visitNameField(obj.Object, []string{"spec", "scaleTargetRef", "name"}, rename(kind))
+			}
+		}
+	}
+}
+
+// renameRoleBindingRefs updates the role and service account subjects of a binding.
+func renameRoleBindingRefs(obj *unstructured.Unstructured, renamed map[nameKey]string) {
+	if kind, ok, _ := unstructured.NestedString(obj.Object, "roleRef", "kind"); ok {
+		namespace := obj.GetNamespace()
+		if kind == "ClusterRole" {
+			namespace = ""
+		}
+		visitNameField(obj.Object, []string{"roleRef", "name"}, func(name string) string {
+			if newName, ok := renamed[nameKey{kind: kind, namespace: namespace, name: name}]; ok {
+				return newName
+			}
+			return name
+		})
+	}
+
+	subjects, ok, _ := unstructured.NestedSlice(obj.Object, "subjects")
+	if !ok {
+		return
+	}
+	for _, s := range subjects {
+		subject, ok := s.(map[string]interface{})
+		if !ok || subject["kind"] != "ServiceAccount" {
+			continue
+		}
+		name, _ := subject["name"].(string)
+		namespace, _ := subject["namespace"].(string)
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		if newName, ok := renamed[nameKey{kind: "ServiceAccount", namespace: namespace, name: name}]; ok {
+			subject["name"] = newName
+		}
+	}
+	_ = unstructured.SetNestedSlice(obj.Object, subjects, "subjects")
+}
+
+// splitFieldPath splits a dot separated path, keeping the '[]' list markers
+// as separate segments.
+func splitFieldPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, ".") {
+		if strings.HasSuffix(s, "[]") {
+			segments = append(segments, strings.TrimSuffix(s, "[]"), "[]")
+			continue
+		}
+		segments = append(segments, s)
+	}
+	return segments
+}
+
+// visitNameField replaces the string values found at the path with the
+// result of fn, paths which do not exist are ignored.
+func visitNameField(value interface{}, path []string, fn func(string) string) {
+	if len(path) == 0 {
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			if name, ok := child.(string); ok {
+				v[path[0]] = fn(name)
+			}
+			return
+		}
+		visitNameField(child, path[1:], fn)
+	case []interface{}:
+		if path[0] != "[]" {
+			return
+		}
+		for _, item := range v {
+			visitNameField(item, path[1:], fn)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTransformNames(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := newTestObject("apps/v1", "Deployment", "app")
+	g.Expect(unstructured.SetNestedField(deployment.Object, map[string]interface{}{
+		"serviceAccountName": "app",
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name": "app",
+				"envFrom": []interface{}{
+					map[string]interface{}{"configMapRef": map[string]interface{}{"name": "settings"}},
+					map[string]interface{}{"secretRef": map[string]interface{}{"name": "external"}},
+				},
+			},
+		},
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "config", "configMap": map[string]interface{}{"name": "settings"}},
+		},
+	}, "spec", "template", "spec")).To(Succeed())
+
+	binding := newTestObject("rbac.authorization.k8s.io/v1", "RoleBinding", "app")
+	binding.Object["roleRef"] = map[string]interface{}{"kind": "Role", "name": "app"}
+	binding.Object["subjects"] = []interface{}{
+		map[string]interface{}{"kind": "ServiceAccount", "name": "app"},
+	}
+
+	hpa := newTestObject("autoscaling/v2", "HorizontalPodAutoscaler", "app")
+	g.Expect(unstructured.SetNestedField(hpa.Object, "Deployment", "spec", "scaleTargetRef", "kind")).To(Succeed())
+	g.Expect(unstructured.SetNestedField(hpa.Object, "app", "spec", "scaleTargetRef", "name")).To(Succeed())
+
+	namespace := newTestObject("v1", "Namespace", "apps")
+	namespace.SetNamespace("")
+
+	objects := []*unstructured.Unstructured{
+		deployment,
+		binding,
+		hpa,
+		namespace,
+		newTestObject("v1", "ServiceAccount", "app"),
+		newTestObject("v1", "ConfigMap", "settings"),
+		newTestObject("rbac.authorization.k8s.io/v1", "Role", "app"),
+	}
+	transformNames(objects, "team-", "-v2")
+
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{
+		"team-app-v2", "team-app-v2", "team-app-v2", "apps",
+		"team-app-v2", "team-settings-v2", "team-app-v2",
+	}))
+
+	podSpec := deployment.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	g.Expect(podSpec["serviceAccountName"]).To(Equal("team-app-v2"))
+	envFrom := podSpec["containers"].([]interface{})[0].(map[string]interface{})["envFrom"].([]interface{})
+	g.Expect(envFrom[0]).To(HaveKeyWithValue("configMapRef", HaveKeyWithValue("name", "team-settings-v2")))
+	g.Expect(envFrom[1]).To(HaveKeyWithValue("secretRef", HaveKeyWithValue("name", "external")))
+	g.Expect(podSpec["volumes"].([]interface{})[0]).To(HaveKeyWithValue("configMap", HaveKeyWithValue("name", "team-settings-v2")))
+
+	g.Expect(binding.Object["roleRef"]).To(HaveKeyWithValue("name", "team-app-v2"))
+	g.Expect(binding.Object["subjects"].([]interface{})[0]).To(HaveKeyWithValue("name", "team-app-v2"))
+
+	target, _, _ := unstructured.NestedString(hpa.Object, "spec", "scaleTargetRef", "name")
+	g.Expect(target).To(Equal("team-app-v2"))
+}
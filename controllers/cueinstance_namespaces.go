@@ -0,0 +1,57 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// missingNamespaces returns a Namespace object for each namespace
+// referenced by the given objects which is not itself part of the objects.
+func missingNamespaces(objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	declared := map[string]bool{}
+	referenced := map[string]bool{}
+	for _, obj := range objects {
+		if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Namespace" {
+			declared[obj.GetName()] = true
+			continue
+		}
+		if ns := obj.GetNamespace(); ns != "" {
+			referenced[ns] = true
+		}
+	}
+
+	names := make([]string, 0, len(referenced))
+	for ns := range referenced {
+		if !declared[ns] {
+			names = append(names, ns)
+		}
+	}
+	sort.Strings(names)
+
+	namespaces := make([]*unstructured.Unstructured, 0, len(names))
+	for _, name := range names {
+		ns := &unstructured.Unstructured{}
+		ns.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+		ns.SetName(name)
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMissingNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	object := func(apiVersion, kind, name, namespace string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetName(name)
+		u.SetNamespace(namespace)
+		return u
+	}
+
+	objects := []*unstructured.Unstructured{
+		object("v1", "Namespace", "declared", ""),
+		object("v1", "ConfigMap", "config", "declared"),
+		object("apps/v1", "Deployment", "app", "web"),
+		object("v1", "Service", "app", "web"),
+		object("v1", "ConfigMap", "config", "backend"),
+		object("rbac.authorization.k8s.io/v1", "ClusterRole", "reader", ""),
+	}
+
+	namespaces := missingNamespaces(objects)
+	g.Expect(namespaces).To(HaveLen(2))
+	for i, name := range []string{"backend", "web"} {
+		g.Expect(namespaces[i].GetKind()).To(Equal("Namespace"))
+		g.Expect(namespaces[i].GetAPIVersion()).To(Equal("v1"))
+		g.Expect(namespaces[i].GetName()).To(Equal(name))
+	}
+
+	g.Expect(missingNamespaces(objects[:2])).To(BeEmpty())
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	celtypes "github.com/google/cel-go/common/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// objectPolicy is an object policy with its compiled rule.
+type objectPolicy struct {
+	cuev1alpha1.ObjectPolicy
+	program cel.Program
+}
+
+// policyViolation is an object which does not comply with a policy.
+type policyViolation struct {
+	policy  cuev1alpha1.ObjectPolicy
+	subject string
+}
+
+func (v policyViolation) String() string {
+	return fmt.Sprintf("%s violates policy '%s': %s", v.subject, v.policy.Name, v.policy.Message)
+}
+
+// enforceObjectPolicies evaluates the policies of the CueInstance against the
+// objects, emits an event for each audited, warned or dropped violation and
+// returns the objects which are not dropped together with the warnings.
+// The violations are recorded in the report.
+func (r *CueInstanceReconciler) enforceObjectPolicies(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+	objects []*unstructured.Unstructured,
+	report *validationReport,
+) ([]*unstructured.Unstructured, []string, error) {
+	if len(cueInstance.Spec.Policies) == 0 {
+		return objects, nil, nil
+	}
+
+	policies := make([]objectPolicy, 0, len(cueInstance.Spec.Policies))
+	for _, p := range cueInstance.Spec.Policies {
+		if p.RuleFrom != nil {
+			rule, err := r.getPolicyRule(ctx, cueInstance.GetNamespace(), *p.RuleFrom)
+			if err != nil {
+				return nil, nil, fmt.Errorf("policy '%s': %w", p.Name, err)
+			}
+			p.Rule = rule
+		}
+		policy, err := compileObjectPolicy(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	kept, violations, err := evalObjectPolicies(policies, objects)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var failures, warnings []string
+	for _, v := range violations {
+		report.add(v.subject, "policy/"+v.policy.Name, v.policy.Action, v.policy.Message)
+		switch v.policy.Action {
+		case cuev1alpha1.IgnorePolicy:
+		case cuev1alpha1.AuditPolicy, cuev1alpha1.DropPolicy:
+			r.event(ctx, cueInstance, revision, events.EventSeverityInfo, v.String(), nil)
+		case cuev1alpha1.WarnPolicy:
+			r.event(ctx, cueInstance, revision, events.EventSeverityInfo, v.String(), nil)
+			warnings = append(warnings, v.String())
+		default:
+			failures = append(failures, v.String())
+		}
+	}
+
+	if len(failures) > 0 {
+		return nil, nil, fmt.Errorf("%w: %d objects violate the policies: %s",
+			errPolicyViolation, len(failures), summarize(failures, maxPolicyViolations))
+	}
+
+	return kept, warnings, nil
+}
+
+// getPolicyRule loads a policy rule from a ConfigMap key.
+func (r *CueInstanceReconciler) getPolicyRule(ctx context.Context, namespace string, ref cuev1alpha1.ExpressionsSource) (string, error) {
+	name := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, name, &cm); err != nil {
+		return "", fmt.Errorf("unable to load rule from ConfigMap '%s': %w", name, err)
+	}
+
+	rule, ok := cm.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key '%s' not found in ConfigMap '%s'", ref.Key, name)
+	}
+	return strings.TrimSpace(rule), nil
+}
+
+// compileObjectPolicy compiles the CEL rule of the policy.
+func compileObjectPolicy(p cuev1alpha1.ObjectPolicy) (objectPolicy, error) {
+	if p.Rule == "" {
+		return objectPolicy{}, fmt.Errorf("policy '%s' has no rule", p.Name)
+	}
+	if p.Message == "" {
+		p.Message = p.Rule
+	}
+
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("object", decls.Dyn)))
+	if err != nil {
+		return objectPolicy{}, err
+	}
+
+	ast, issues := env.Compile(p.Rule)
+	if issues != nil && issues.Err() != nil {
+		return objectPolicy{}, fmt.Errorf("invalid rule of policy '%s': %w", p.Name, issues.Err())
+	}
+	if ast.ResultType() != decls.Bool && ast.ResultType() != decls.Dyn {
+		return objectPolicy{}, fmt.Errorf("invalid rule of policy '%s': must return a bool", p.Name)
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return objectPolicy{}, fmt.Errorf("invalid rule of policy '%s': %w", p.Name, err)
+	}
+
+	return objectPolicy{ObjectPolicy: p, program: prg}, nil
+}
+
+// evalObjectPolicies evaluates the policies against the objects selected
+// by their targets and returns the objects which are not dropped
+// together with the violations. The action of the violations is the one
+// set by the validation mode annotation of the object, if any.
+func evalObjectPolicies(policies []objectPolicy, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, []policyViolation, error) {
+	kept := make([]*unstructured.Unstructured, 0, len(objects))
+	var violations []policyViolation
+	for _, obj := range objects {
+		subject := ssa.FmtObjMetadata(object.UnstructuredToObjMetadata(obj))
+		annotation := obj.GetAnnotations()[cuev1alpha1.ValidationModeAnnotation]
+		drop := false
+		for _, p := range policies {
+			if p.Target != nil {
+				ok, err := selectorMatches(*p.Target, obj)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			out, _, err := p.program.Eval(map[string]interface{}{"object": obj.Object})
+			if err != nil {
+				return nil, nil, fmt.Errorf("policy '%s' evaluation failed for %s: %w", p.Name, subject, err)
+			}
+			compliant, ok := out.(celtypes.Bool)
+			if !ok {
+				return nil, nil, fmt.Errorf("policy '%s' returned %s instead of a bool", p.Name, out.Type().TypeName())
+			}
+			if compliant {
+				continue
+			}
+
+			violation := policyViolation{policy: p.ObjectPolicy, subject: subject}
+			violation.policy.Action, err = validationModeOverride(annotation, p.Action)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", subject, err)
+			}
+			violations = append(violations, violation)
+			if violation.policy.Action == cuev1alpha1.DropPolicy {
+				drop = true
+			}
+		}
+		if !drop {
+			kept = append(kept, obj)
+		}
+	}
+	return kept, violations, nil
+}
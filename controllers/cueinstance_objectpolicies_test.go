@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestEvalObjectPolicies(t *testing.T) {
+	g := NewWithT(t)
+
+	loadBalancer := newTestObject("v1", "Service", "public")
+	loadBalancer.Object["spec"] = map[string]interface{}{"type": "LoadBalancer"}
+	clusterIP := newTestObject("v1", "Service", "internal")
+	clusterIP.Object["spec"] = map[string]interface{}{"type": "ClusterIP"}
+	configMap := newTestObject("v1", "ConfigMap", "settings")
+
+	compile := func(p cuev1alpha1.ObjectPolicy) objectPolicy {
+		policy, err := compileObjectPolicy(p)
+		g.Expect(err).NotTo(HaveOccurred())
+		return policy
+	}
+	policies := []objectPolicy{
+		compile(cuev1alpha1.ObjectPolicy{
+			Name:   "no-load-balancers",
+			Rule:   `object.spec.type != "LoadBalancer"`,
+			Target: &cuev1alpha1.Selector{Kind: "Service"},
+			Action: cuev1alpha1.DropPolicy,
+		}),
+		compile(cuev1alpha1.ObjectPolicy{
+			Name:    "labelled",
+			Rule:    `has(object.metadata.labels) && "team" in object.metadata.labels`,
+			Message: "objects must have a team label",
+			Action:  cuev1alpha1.AuditPolicy,
+		}),
+	}
+
+	kept, violations, err := evalObjectPolicies(policies, []*unstructured.Unstructured{loadBalancer, clusterIP, configMap})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(kept).To(Equal([]*unstructured.Unstructured{clusterIP, configMap}))
+
+	var messages []string
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	g.Expect(messages).To(Equal([]string{
+		`Service/default/public violates policy 'no-load-balancers': object.spec.type != "LoadBalancer"`,
+		"Service/default/public violates policy 'labelled': objects must have a team label",
+		"Service/default/internal violates policy 'labelled': objects must have a team label",
+		"ConfigMap/default/settings violates policy 'labelled': objects must have a team label",
+	}))
+
+	// the validation mode annotation overrides the action of the policies
+	loadBalancer.SetAnnotations(map[string]string{cuev1alpha1.ValidationModeAnnotation: "Audit"})
+	kept, violations, err = evalObjectPolicies(policies[:1], []*unstructured.Unstructured{loadBalancer})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(kept).To(Equal([]*unstructured.Unstructured{loadBalancer}))
+	g.Expect(violations).To(HaveLen(1))
+	g.Expect(violations[0].policy.Action).To(Equal(cuev1alpha1.AuditPolicy))
+
+	_, _, err = evalObjectPolicies([]objectPolicy{
+		compile(cuev1alpha1.ObjectPolicy{Name: "replicas", Rule: "object.spec.replicas < 3"}),
+	}, []*unstructured.Unstructured{configMap})
+	g.Expect(err).To(MatchError(ContainSubstring("policy 'replicas' evaluation failed for ConfigMap/default/settings")))
+}
+
+func TestEnforceObjectPolicies_Warn(t *testing.T) {
+	g := NewWithT(t)
+
+	configMap := newTestObject("v1", "ConfigMap", "settings")
+	cueInstance := cuev1alpha1.CueInstance{
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Policies: []cuev1alpha1.ObjectPolicy{{
+				Name:    "labelled",
+				Rule:    `has(object.metadata.labels)`,
+				Message: "objects must have labels",
+				Action:  cuev1alpha1.WarnPolicy,
+			}},
+		},
+	}
+
+	r := &CueInstanceReconciler{}
+	kept, warnings, err := r.enforceObjectPolicies(context.TODO(), cueInstance, "main/abc", []*unstructured.Unstructured{configMap}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(kept).To(Equal([]*unstructured.Unstructured{configMap}))
+	g.Expect(warnings).To(Equal([]string{"ConfigMap/default/settings violates policy 'labelled': objects must have labels"}))
+
+	setValidationWarningCondition(&cueInstance, warnings)
+	condition := apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.ValidationWarningCondition)
+	g.Expect(condition).NotTo(BeNil())
+	g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(condition.Message).To(Equal("1 validation warnings: ConfigMap/default/settings violates policy 'labelled': objects must have labels"))
+
+	setValidationWarningCondition(&cueInstance, nil)
+	g.Expect(apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.ValidationWarningCondition)).To(BeNil())
+}
+
+func TestCompileObjectPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := compileObjectPolicy(cuev1alpha1.ObjectPolicy{Name: "empty"})
+	g.Expect(err).To(MatchError("policy 'empty' has no rule"))
+
+	_, err = compileObjectPolicy(cuev1alpha1.ObjectPolicy{Name: "string", Rule: `"value"`})
+	g.Expect(err).To(MatchError("invalid rule of policy 'string': must return a bool"))
+
+	_, err = compileObjectPolicy(cuev1alpha1.ObjectPolicy{Name: "syntax", Rule: "object.kind ==="})
+	g.Expect(err).To(MatchError(ContainSubstring("invalid rule of policy 'syntax'")))
+}
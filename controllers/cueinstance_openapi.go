@@ -0,0 +1,126 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/kubectl/pkg/util/openapi"
+	"k8s.io/kubectl/pkg/util/openapi/validation"
+)
+
+// openAPICacheTTL is the duration for which the OpenAPI schemas of a cluster
+// are reused before being fetched again, so that new CRDs are picked up.
+const openAPICacheTTL = 10 * time.Minute
+
+// openAPICache holds the OpenAPI schemas of the clusters
+// keyed by the cluster name recorded in the inventory.
+type openAPICache struct {
+	mu      sync.Mutex
+	entries map[string]openAPICacheEntry
+}
+
+type openAPICacheEntry struct {
+	resources openapi.Resources
+	fetchedAt time.Time
+}
+
+func newOpenAPICache() *openAPICache {
+	return &openAPICache{entries: map[string]openAPICacheEntry{}}
+}
+
+// get returns the cached schemas of the cluster, or fetches them when
+// they are missing or expired.
+func (c *openAPICache) get(cluster string, fetch func() (openapi.Resources, error)) (openapi.Resources, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[cluster]; ok && time.Since(entry.fetchedAt) < openAPICacheTTL {
+		return entry.resources, nil
+	}
+
+	resources, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.entries[cluster] = openAPICacheEntry{resources: resources, fetchedAt: time.Now()}
+	return resources, nil
+}
+
+// validateClientSide validates the objects against the OpenAPI schemas of
+// the cluster before they are dry-run, when client-side validation is enabled.
+func (r *CueInstanceReconciler) validateClientSide(ctx context.Context,
+	impersonation *CueInstanceImpersonation,
+	cluster string,
+	objects []*unstructured.Unstructured,
+) error {
+	if !r.ClientSideValidation {
+		return nil
+	}
+
+	fetch := func() (openapi.Resources, error) {
+		dc, err := impersonation.GetDiscoveryForCluster(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := dc.OpenAPISchema()
+		if err != nil {
+			return nil, err
+		}
+		return openapi.NewOpenAPIData(doc)
+	}
+
+	cache := r.openAPICache
+	if cache == nil {
+		cache = newOpenAPICache()
+	}
+	resources, err := cache.get(cluster, fetch)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the OpenAPI schemas: %w", err)
+	}
+
+	return validateOpenAPI(resources, objects)
+}
+
+// validateOpenAPI validates all the objects against the OpenAPI schemas and
+// returns a single error listing the invalid ones. The objects whose kind has
+// no schema, such as the custom resources of CRDs yet to be applied, are skipped.
+func validateOpenAPI(resources openapi.Resources, objects []*unstructured.Unstructured) error {
+	validator := validation.NewSchemaValidation(resources)
+
+	var failures []string
+	for _, obj := range objects {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if err := validator.ValidateBytes(data); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", ssa.FmtUnstructured(obj), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d objects failed the OpenAPI validation: %s",
+			len(failures), summarize(failures, maxPolicyViolations))
+	}
+	return nil
+}
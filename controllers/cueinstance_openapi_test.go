@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	openapi_v2 "github.com/googleapis/gnostic/openapiv2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/kubectl/pkg/util/openapi"
+)
+
+const testOpenAPISchema = `swagger: "2.0"
+info:
+  title: Kubernetes
+  version: v1.23.0
+paths: {}
+definitions:
+  io.k8s.api.core.v1.ConfigMap:
+    type: object
+    properties:
+      apiVersion:
+        type: string
+      kind:
+        type: string
+      metadata:
+        type: object
+      data:
+        type: object
+        additionalProperties:
+          type: string
+    x-kubernetes-group-version-kind:
+    - group: ""
+      kind: ConfigMap
+      version: v1
+`
+
+func TestValidateOpenAPI(t *testing.T) {
+	g := NewWithT(t)
+
+	doc, err := openapi_v2.ParseDocument([]byte(testOpenAPISchema))
+	g.Expect(err).NotTo(HaveOccurred())
+	resources, err := openapi.NewOpenAPIData(doc)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	valid := newTestObject("v1", "ConfigMap", "valid")
+	valid.Object["data"] = map[string]interface{}{"key": "value"}
+	typo := newTestObject("v1", "ConfigMap", "typo")
+	typo.Object["dta"] = map[string]interface{}{"key": "value"}
+	wrongType := newTestObject("v1", "ConfigMap", "wrong-type")
+	wrongType.Object["data"] = []interface{}{"key=value"}
+	// kinds without a schema are left to the server-side dry-run
+	custom := newTestObject("example.com/v1", "Widget", "custom")
+	custom.Object["spec"] = map[string]interface{}{"size": 3}
+
+	err = validateOpenAPI(resources, []*unstructured.Unstructured{valid, custom})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	err = validateOpenAPI(resources, []*unstructured.Unstructured{valid, typo, wrongType, custom})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(HavePrefix("2 objects failed the OpenAPI validation"))
+	g.Expect(err.Error()).To(ContainSubstring(`ConfigMap/default/typo: ValidationError(ConfigMap): unknown field "dta"`))
+	g.Expect(err.Error()).To(ContainSubstring("ConfigMap/default/wrong-type"))
+}
+
+func TestOpenAPICache(t *testing.T) {
+	g := NewWithT(t)
+
+	fetches := 0
+	fetch := func() (openapi.Resources, error) {
+		fetches++
+		return nil, nil
+	}
+
+	cache := newOpenAPICache()
+	_, err := cache.get("", fetch)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = cache.get("", fetch)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = cache.get("staging-kubeconfig", fetch)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(fetches).To(Equal(2))
+
+	// failures are not cached
+	_, err = cache.get("prod-kubeconfig", func() (openapi.Resources, error) {
+		return nil, errors.New("unreachable")
+	})
+	g.Expect(err).To(MatchError("unreachable"))
+	_, err = cache.get("prod-kubeconfig", fetch)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(fetches).To(Equal(3))
+}
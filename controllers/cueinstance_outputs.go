@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"cuelang.org/go/cue"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// evalOutputs evaluates the expressions of the outputs against the value,
+// the strings are returned as they are and the other values encoded to JSON.
+func evalOutputs(value cue.Value, outputs []cuev1alpha1.Output) (map[string]string, error) {
+	values := make(map[string]string, len(outputs))
+	for _, o := range outputs {
+		v := lookupExpr(value, o.Expr)
+		if !v.Exists() {
+			return nil, fmt.Errorf("output '%s': expression '%s' not found", o.Key, o.Expr)
+		}
+		if err := v.Validate(cue.Concrete(true)); err != nil {
+			return nil, fmt.Errorf("output '%s': expression '%s' is not concrete: %w", o.Key, o.Expr, err)
+		}
+
+		if s, err := v.String(); err == nil {
+			values[o.Key] = s
+			continue
+		}
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("output '%s': %w", o.Key, err)
+		}
+		values[o.Key] = string(data)
+	}
+	return values, nil
+}
+
+// writeOutputs writes the outputs of the build to the destination of the
+// CueInstance with its impersonation, the destination is created if needed and
+// controlled by the CueInstance, an existing destination it doesn't control
+// is an error. Returns the checksum of the outputs, or an empty string
+// when no outputs are written.
+func (r *CueInstanceReconciler) writeOutputs(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+	outputs map[string]string,
+) (string, error) {
+	dest := cueInstance.Spec.WriteOutputsTo
+	if dest == nil || len(cueInstance.Spec.Matrix) > 0 {
+		return "", nil
+	}
+
+	var (
+		obj    client.Object
+		mutate func()
+	)
+	switch dest.Kind {
+	case "ConfigMap":
+		cm := &corev1.ConfigMap{}
+		obj, mutate = cm, func() {
+			cm.Data = outputs
+		}
+	case "Secret":
+		secret := &corev1.Secret{}
+		obj, mutate = secret, func() {
+			secret.Data = make(map[string][]byte, len(outputs))
+			for k, v := range outputs {
+				secret.Data[k] = []byte(v)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unsupported outputs kind '%s'", dest.Kind)
+	}
+	obj.SetName(dest.Name)
+	obj.SetNamespace(cueInstance.GetNamespace())
+
+	kubeClient, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		return "", err
+	}
+
+	op, err := createOrUpdateControlled(ctx, kubeClient, r.Scheme, &cueInstance, obj, func() error {
+		mutate()
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[cuev1alpha1.GroupVersion.Group+"/revision"] = revision
+		obj.SetAnnotations(annotations)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to write the outputs to %s '%s': %w", dest.Kind, dest.Name, err)
+	}
+	if op != controllerutil.OperationResultNone {
+		ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("outputs written to %s '%s'", dest.Kind, dest.Name), "revision", revision)
+	}
+	return checksumOutputs(outputs)
+}
+
+// checksumOutputs returns the SHA256 digest of the outputs.
+func checksumOutputs(outputs map[string]string) (string, error) {
+	// the keys of the maps are encoded in sorted order
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBuildInstance_Outputs(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+db: {
+	host: "db.default.svc"
+	port: 5432
+}
+replicas: int
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+}]
+`)
+
+	build := func(outputs ...cuev1alpha1.Output) (*BuildResult, error) {
+		return buildInstance(BuildRequest{
+			Root: root,
+			Dir:  root,
+			Spec: cuev1alpha1.CueInstanceSpec{
+				WriteOutputsTo: &cuev1alpha1.OutputsDestination{Kind: "ConfigMap", Name: "outputs", Outputs: outputs},
+			},
+		})
+	}
+
+	g := NewWithT(t)
+	result, err := build(
+		cuev1alpha1.Output{Key: "host", Expr: "db.host"},
+		cuev1alpha1.Output{Key: "db.json", Expr: "db"},
+	)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Outputs).To(Equal(map[string]string{
+		"host":    "db.default.svc",
+		"db.json": `{"host":"db.default.svc","port":5432}`,
+	}))
+
+	_, err = build(cuev1alpha1.Output{Key: "user", Expr: "db.user"})
+	g.Expect(err).To(MatchError(ContainSubstring("output 'user': expression 'db.user' not found")))
+	_, err = build(cuev1alpha1.Output{Key: "replicas", Expr: "replicas"})
+	g.Expect(err).To(MatchError(ContainSubstring("output 'replicas': expression 'replicas' is not concrete")))
+}
+
+func TestWriteOutputs(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "infra", Namespace: "default", UID: "uid"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			WriteOutputsTo: &cuev1alpha1.OutputsDestination{Kind: "Secret", Name: "infra-outputs"},
+		},
+	}
+	key := types.NamespacedName{Name: "infra-outputs", Namespace: "default"}
+
+	checksum, err := r.writeOutputs(context.TODO(), instance, "main/abc", map[string]string{"password": "s3cr3t"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(checksum).NotTo(BeEmpty())
+	var secret corev1.Secret
+	g.Expect(r.Get(context.TODO(), key, &secret)).To(Succeed())
+	g.Expect(secret.Data).To(Equal(map[string][]byte{"password": []byte("s3cr3t")}))
+	g.Expect(secret.GetAnnotations()).To(HaveKeyWithValue("cue.contrib.flux.io/revision", "main/abc"))
+	g.Expect(secret.GetOwnerReferences()).To(HaveLen(1))
+
+	// the keys which are no longer output are removed
+	next, err := r.writeOutputs(context.TODO(), instance, "main/def", map[string]string{"endpoint": "db:5432"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(next).NotTo(Equal(checksum))
+	g.Expect(r.Get(context.TODO(), key, &secret)).To(Succeed())
+	g.Expect(secret.Data).To(Equal(map[string][]byte{"endpoint": []byte("db:5432")}))
+
+	instance.Spec.WriteOutputsTo = &cuev1alpha1.OutputsDestination{Kind: "ConfigMap", Name: "infra-outputs"}
+	_, err = r.writeOutputs(context.TODO(), instance, "main/def", map[string]string{"endpoint": "db:5432"})
+	g.Expect(err).NotTo(HaveOccurred())
+	var cm corev1.ConfigMap
+	g.Expect(r.Get(context.TODO(), key, &cm)).To(Succeed())
+	g.Expect(cm.Data).To(Equal(map[string]string{"endpoint": "db:5432"}))
+
+	// the objects not controlled by the CueInstance are not overwritten
+	g.Expect(r.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("tenant")},
+	})).To(Succeed())
+	instance.Spec.WriteOutputsTo = &cuev1alpha1.OutputsDestination{Kind: "Secret", Name: "credentials"}
+	_, err = r.writeOutputs(context.TODO(), instance, "main/def", map[string]string{"endpoint": "db:5432"})
+	g.Expect(err).To(MatchError(ContainSubstring("'default/credentials' already exists and is not controlled by the CueInstance")))
+	g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: "credentials", Namespace: "default"}, &secret)).To(Succeed())
+	g.Expect(secret.Data).To(Equal(map[string][]byte{"token": []byte("tenant")}))
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/load"
+	securejoin "github.com/cyphar/filepath-securejoin"
+)
+
+// applyOverlays unifies the values of the overlays of the spec, in order,
+// over the value of the CUE instance.
+func applyOverlays(cctx *cue.Context, req BuildRequest, value cue.Value) (cue.Value, error) {
+	for _, overlay := range req.Spec.Overlays {
+		path, err := securejoin.SecureJoin(req.Root, overlay)
+		if err != nil {
+			return value, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return value, fmt.Errorf("overlay '%s' not found", overlay)
+		}
+
+		v, err := loadOverlay(cctx, req.Root, path)
+		if err != nil {
+			return value, fmt.Errorf("overlay '%s': %w", overlay, err)
+		}
+		value = value.Unify(v)
+	}
+	return value, nil
+}
+
+// loadOverlay builds the value of an overlay, that is a directory holding a
+// CUE package or a CUE, YAML or JSON file within the module root.
+func loadOverlay(cctx *cue.Context, root, path string) (cue.Value, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return cue.Value{}, err
+	}
+
+	if !fi.IsDir() {
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".yaml", ".yml", ".json":
+			return loadDataFile(cctx, path)
+		case ".cue":
+		default:
+			return cue.Value{}, fmt.Errorf("unsupported file extension '%s'", ext)
+		}
+	}
+
+	// the tags of the instance are not injected into the overlays
+	// as the loader rejects the tags a package doesn't declare
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return cue.Value{}, err
+	}
+	ix := load.Instances([]string{"./" + filepath.ToSlash(rel)}, &load.Config{ModuleRoot: root, Dir: root})
+	if len(ix) == 0 {
+		return cue.Value{}, fmt.Errorf("no instances found")
+	}
+	if ix[0].Err != nil {
+		return cue.Value{}, ix[0].Err
+	}
+	if err := embedFiles(ix[0], root); err != nil {
+		return cue.Value{}, err
+	}
+	return cctx.BuildInstance(ix[0]), nil
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestAddPhaseDuration(t *testing.T) {
+	g := NewWithT(t)
+
+	durations := &cuev1alpha1.PhaseDurations{}
+	addPhaseDuration(&durations.Apply, 1200*time.Microsecond)
+	addPhaseDuration(&durations.Apply, 2*time.Second)
+
+	g.Expect(durations.Apply.Duration).To(Equal(2001 * time.Millisecond))
+	g.Expect(durations.Build).To(BeNil())
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/pmezard/go-difflib/difflib"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	// maxPlanSize is the maximum size of the data of a plan ConfigMap,
+	// which is kept below the 1MiB limit of the objects of the API server.
+	maxPlanSize = 900 * 1024
+
+	planKey      = "plan.yaml"
+	manifestsKey = "manifests.yaml"
+	diffKey      = "diff.patch"
+
+	// secretMask replaces the values of the Secrets rendered in a plan.
+	secretMask = "***"
+)
+
+// writePlan stores the plan, the rendered objects and the diffs of the drifted
+// objects in a ConfigMap owned by the CueInstance, and references it from the plan.
+// The ConfigMap is written with the impersonation of the CueInstance and an
+// existing ConfigMap of the same name not controlled by it is left untouched.
+func (r *CueInstanceReconciler) writePlan(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	plan *cuev1alpha1.Plan,
+	objects []*unstructured.Unstructured,
+	diff string,
+) {
+	data, err := planData(*plan, objects, diff, cueInstance.Spec.SensitivePaths)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to render the plan")
+		return
+	}
+
+	kubeClient, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to write the plan")
+		return
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.SetName(planConfigMapName(cueInstance))
+	cm.SetNamespace(cueInstance.GetNamespace())
+
+	_, err = createOrUpdateControlled(ctx, kubeClient, r.Scheme, &cueInstance, cm, func() error {
+		cm.Data = data
+		return nil
+	})
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to write the plan")
+		return
+	}
+	plan.ConfigMapRef = &meta.LocalObjectReference{Name: cm.GetName()}
+}
+
+// deletePlan deletes the ConfigMap holding the plan, once it has been applied.
+func (r *CueInstanceReconciler) deletePlan(ctx context.Context, cueInstance cuev1alpha1.CueInstance, plan *cuev1alpha1.Plan) {
+	if plan == nil || plan.ConfigMapRef == nil {
+		return
+	}
+
+	kubeClient, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to delete the plan")
+		return
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.SetName(plan.ConfigMapRef.Name)
+	cm.SetNamespace(cueInstance.GetNamespace())
+	if err := deleteControlled(ctx, kubeClient, &cueInstance, cm); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to delete the plan")
+	}
+}
+
+func planConfigMapName(cueInstance cuev1alpha1.CueInstance) string {
+	return fmt.Sprintf("%s-plan", cueInstance.GetName())
+}
+
+// planData renders the ConfigMap data of the plan. The values of the Secrets and
+// of the sensitive fields are masked, and the manifests then the diffs are
+// truncated to fit maxPlanSize.
+func planData(plan cuev1alpha1.Plan, objects []*unstructured.Unstructured, diff string, sensitivePaths []string) (map[string]string, error) {
+	summary, err := yaml.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	masked := make([]*unstructured.Unstructured, len(objects))
+	for i, obj := range objects {
+		masked[i] = MaskSensitiveData(obj, sensitivePaths)
+	}
+	manifests, err := ssa.ObjectsToYAML(masked)
+	if err != nil {
+		return nil, err
+	}
+
+	available := maxPlanSize - len(summary)
+	diff = truncatePlan(diff, available)
+	manifests = truncatePlan(manifests, available-len(diff))
+
+	return map[string]string{
+		planKey:      string(summary),
+		manifestsKey: manifests,
+		diffKey:      diff,
+	}, nil
+}
+
+// truncatePlan truncates s to n bytes, ending with a comment when truncated.
+func truncatePlan(s string, n int) string {
+	const marker = "\n# truncated, the plan exceeds the size of a ConfigMap\n"
+	if len(s) <= n {
+		return s
+	}
+	if n <= len(marker) {
+		return ""
+	}
+	return s[:n-len(marker)] + marker
+}
+
+// maskSecretData returns a copy of the object with the values of
+// its data and stringData replaced by secretMask, when it is a Secret.
+func maskSecretData(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj.GetKind() != "Secret" || obj.GroupVersionKind().Group != "" {
+		return obj
+	}
+
+	masked := obj.DeepCopy()
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := masked.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k := range values {
+			values[k] = secretMask
+		}
+	}
+	return masked
+}
+
+// writePlanDiff writes the unified diff between the YAML representations of
+// the live and the dry-run object, whose sensitive values are masked.
+func writePlanDiff(w io.Writer, subject string, live, dryRun *unstructured.Unstructured, sensitivePaths []string) error {
+	from, err := yaml.Marshal(MaskSensitiveData(live, sensitivePaths).Object)
+	if err != nil {
+		return err
+	}
+	to, err := yaml.Marshal(MaskSensitiveData(dryRun, sensitivePaths).Object)
+	if err != nil {
+		return err
+	}
+
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from)),
+		B:        difflib.SplitLines(string(to)),
+		FromFile: subject + " (live)",
+		ToFile:   subject + " (planned)",
+		Context:  3,
+	})
+}
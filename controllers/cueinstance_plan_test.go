@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWritePlan(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+
+	secret := newTestObject("v1", "Secret", "credentials")
+	secret.Object["stringData"] = map[string]interface{}{"password": "hunter2"}
+	objects := []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "settings"), secret}
+
+	live := newTestObject("v1", "ConfigMap", "settings")
+	live.Object["data"] = map[string]interface{}{"level": "info"}
+	dryRun := newTestObject("v1", "ConfigMap", "settings")
+	dryRun.Object["data"] = map[string]interface{}{"level": "debug"}
+	var diff strings.Builder
+	g.Expect(writePlanDiff(&diff, "ConfigMap/default/settings", live, dryRun, nil)).To(Succeed())
+
+	plan := &cuev1alpha1.Plan{
+		ID:       "0123abcd",
+		Revision: "main/abc",
+		Changes: []cuev1alpha1.PendingChange{
+			{Subject: "ConfigMap/default/settings", Action: "configured"},
+			{Subject: "Secret/default/credentials", Action: "created"},
+		},
+	}
+	r.writePlan(context.TODO(), cueInstance, plan, objects, diff.String())
+	g.Expect(plan.ConfigMapRef).NotTo(BeNil())
+	g.Expect(plan.ConfigMapRef.Name).To(Equal("app-plan"))
+
+	var cm corev1.ConfigMap
+	key := types.NamespacedName{Name: "app-plan", Namespace: "default"}
+	g.Expect(r.Get(context.TODO(), key, &cm)).To(Succeed())
+	g.Expect(cm.GetOwnerReferences()).To(HaveLen(1))
+	g.Expect(cm.Data[planKey]).To(ContainSubstring("id: 0123abcd"))
+	g.Expect(cm.Data[manifestsKey]).To(ContainSubstring("name: credentials"))
+	g.Expect(cm.Data[manifestsKey]).To(ContainSubstring("password: '***'"))
+	g.Expect(cm.Data[manifestsKey]).NotTo(ContainSubstring("hunter2"))
+	g.Expect(cm.Data[diffKey]).To(ContainSubstring("--- ConfigMap/default/settings (live)\n+++ ConfigMap/default/settings (planned)\n"))
+	g.Expect(cm.Data[diffKey]).To(ContainSubstring("-  level: info\n+  level: debug\n"))
+	g.Expect(secret.Object["stringData"]).To(Equal(map[string]interface{}{"password": "hunter2"}))
+
+	r.deletePlan(context.TODO(), cueInstance, plan)
+	g.Expect(apierrors.IsNotFound(r.Get(context.TODO(), key, &cm))).To(BeTrue())
+	// deleting a missing plan is a no-op
+	r.deletePlan(context.TODO(), cueInstance, plan)
+	r.deletePlan(context.TODO(), cueInstance, nil)
+}
+
+func TestWritePlan_NotControlled(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-plan", Namespace: "default"},
+		Data:       map[string]string{"config": "tenant"},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build(),
+		Scheme: scheme,
+	}
+
+	plan := &cuev1alpha1.Plan{ID: "0123abcd", Revision: "main/abc"}
+	r.writePlan(context.TODO(), cueInstance, plan, nil, "")
+	g.Expect(plan.ConfigMapRef).To(BeNil())
+
+	var cm corev1.ConfigMap
+	key := types.NamespacedName{Name: "app-plan", Namespace: "default"}
+	g.Expect(r.Get(context.TODO(), key, &cm)).To(Succeed())
+	g.Expect(cm.GetOwnerReferences()).To(BeEmpty())
+	g.Expect(cm.Data).To(Equal(map[string]string{"config": "tenant"}))
+
+	// a plan referencing a ConfigMap not controlled by the CueInstance does not delete it
+	r.deletePlan(context.TODO(), cueInstance, &cuev1alpha1.Plan{ConfigMapRef: &meta.LocalObjectReference{Name: "app-plan"}})
+	g.Expect(r.Get(context.TODO(), key, &cm)).To(Succeed())
+}
+
+func TestPlanData_Truncated(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newTestObject("v1", "ConfigMap", "large")
+	obj.Object["data"] = map[string]interface{}{"blob": strings.Repeat("x", maxPlanSize)}
+	diff := strings.Repeat("+x\n", maxPlanSize/6)
+
+	data, err := planData(cuev1alpha1.Plan{ID: "0123abcd"}, []*unstructured.Unstructured{obj}, diff, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data[diffKey]).To(Equal(diff))
+	g.Expect(data[manifestsKey]).To(HaveSuffix("# truncated, the plan exceeds the size of a ConfigMap\n"))
+	g.Expect(len(data[planKey]) + len(data[manifestsKey]) + len(data[diffKey])).To(BeNumerically("<=", maxPlanSize))
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxPolicyViolations is the maximum number of objects listed
+// in the error reporting a policy violation.
+const maxPolicyViolations = 10
+
+// errPolicyViolation is wrapped by the errors of the objects violating the
+// policies, such failures are not retried until the next reconciliation interval.
+var errPolicyViolation = errors.New("policy violation")
+
+// KindPolicy restricts the kinds of the objects which may be applied, in the
+// form 'Kind.group' or 'Kind' for the core group. Shell patterns are supported.
+type KindPolicy struct {
+	// Allowed are the only kinds which may be applied, when not empty.
+	Allowed []string
+	// Denied are the kinds which may not be applied.
+	Denied []string
+}
+
+// allows reports whether the policy allows applying objects of the given kind.
+func (p KindPolicy) allows(kind string) bool {
+	if len(p.Allowed) > 0 && !matchesAny(p.Allowed, kind) {
+		return false
+	}
+	return !matchesAny(p.Denied, kind)
+}
+
+// checkKinds fails when the kind of one of the objects is not allowed by each of the policies.
+func checkKinds(objects []*unstructured.Unstructured, policies ...KindPolicy) error {
+	var violations []string
+	for _, obj := range objects {
+		kind := obj.GroupVersionKind().GroupKind().String()
+		for _, p := range policies {
+			if !p.allows(kind) {
+				violations = append(violations, ssa.FmtObjMetadata(object.UnstructuredToObjMetadata(obj)))
+				break
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d objects have kinds which are not allowed: %s",
+		errPolicyViolation, len(violations), summarize(violations, maxPolicyViolations))
+}
+
+// namespaceKindPolicy returns the kind policy set through the
+// annotations of the given namespace.
+func (r *CueInstanceReconciler) namespaceKindPolicy(ctx context.Context, namespace string) (KindPolicy, error) {
+	var ns corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return KindPolicy{}, fmt.Errorf("unable to read the kind policy of namespace '%s': %w", namespace, err)
+	}
+
+	annotations := ns.GetAnnotations()
+	return KindPolicy{
+		Allowed: splitList(annotations[cuev1alpha1.AllowedKindsAnnotation]),
+		Denied:  splitList(annotations[cuev1alpha1.DeniedKindsAnnotation]),
+	}, nil
+}
+
+// checkObjectPlacement enforces the namespaces the objects are allowed to target,
+// the kinds they are allowed to have and whether they may be cluster-scoped.
+// It returns the reason of the readiness condition when a check fails.
+func (r *CueInstanceReconciler) checkObjectPlacement(ctx context.Context, cueInstance cuev1alpha1.CueInstance, objects []*unstructured.Unstructured) (string, error) {
+	if err := checkTargetNamespaces(objects, r.AllowedNamespaces, cueInstance.Spec.AllowedNamespaces); err != nil {
+		return cuev1alpha1.NamespaceNotAllowedReason, err
+	}
+
+	nsKindPolicy, err := r.namespaceKindPolicy(ctx, cueInstance.GetNamespace())
+	if err != nil {
+		return meta.ReconciliationFailedReason, err
+	}
+	if err := checkKinds(objects, r.KindPolicy, nsKindPolicy); err != nil {
+		return cuev1alpha1.KindNotAllowedReason, err
+	}
+
+	if err := checkClusterScoped(r.RESTMapper(), objects, cueInstance.GetNamespace(), r.ClusterScopedNamespaces); err != nil {
+		return cuev1alpha1.ClusterScopeNotAllowedReason, err
+	}
+	return "", nil
+}
+
+// splitList returns the non-empty items of a comma separated list.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkTargetNamespaces fails when one of the objects targets a namespace
+// which is not matched by each of the non-empty allowlists. A Namespace
+// object targets the namespace it defines.
+func checkTargetNamespaces(objects []*unstructured.Unstructured, allowlists ...[]string) error {
+	var violations []string
+	for _, obj := range objects {
+		namespace := obj.GetNamespace()
+		if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Namespace" {
+			namespace = obj.GetName()
+		}
+		if namespace == "" {
+			continue
+		}
+
+		for _, allowed := range allowlists {
+			if len(allowed) > 0 && !matchesAny(allowed, namespace) {
+				violations = append(violations, ssa.FmtObjMetadata(object.UnstructuredToObjMetadata(obj)))
+				break
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d objects target namespaces which are not allowed: %s",
+		errPolicyViolation, len(violations), summarize(violations, maxPolicyViolations))
+}
+
+// matchesAny reports whether the name matches one of the shell patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// summarize joins at most max of the items, noting how many were left out.
+func summarize(items []string, max int) string {
+	if len(items) <= max {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:max], ", "), len(items)-max)
+}
+
+// checkClusterScoped fails when the CueInstance namespace is not matched by
+// the allowlist and one of the objects is cluster-scoped. The scope of the
+// kinds defined by the CRDs of the same object set is read from the CRDs,
+// the objects of unknown kinds are cluster-scoped if they have no namespace.
+func checkClusterScoped(mapper apimeta.RESTMapper, objects []*unstructured.Unstructured, namespace string, allowed []string) error {
+	if len(allowed) == 0 || matchesAny(allowed, namespace) {
+		return nil
+	}
+
+	crdScopes := map[schema.GroupKind]apiextensionsv1.ResourceScope{}
+	for _, obj := range objects {
+		if !ssa.IsClusterDefinition(obj) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		crdScopes[schema.GroupKind{Group: group, Kind: kind}] = apiextensionsv1.ResourceScope(scope)
+	}
+
+	var violations []string
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		var clusterScoped bool
+		if scope, ok := crdScopes[gvk.GroupKind()]; ok {
+			clusterScoped = scope == apiextensionsv1.ClusterScoped
+		} else if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			clusterScoped = mapping.Scope.Name() == apimeta.RESTScopeNameRoot
+		} else if apimeta.IsNoMatchError(err) {
+			clusterScoped = obj.GetNamespace() == ""
+		} else {
+			return err
+		}
+		if clusterScoped {
+			violations = append(violations, ssa.FmtObjMetadata(object.UnstructuredToObjMetadata(obj)))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: cluster-scoped objects are not allowed in namespace '%s': %s",
+		errPolicyViolation, namespace, summarize(violations, maxPolicyViolations))
+}
+
+// setValidationWarningCondition reports the validation failures and policy
+// violations of the objects in Warn mode, and removes the ValidationWarning
+// condition once there are none.
+func setValidationWarningCondition(cueInstance *cuev1alpha1.CueInstance, warnings []string) {
+	if len(warnings) == 0 {
+		apimeta.RemoveStatusCondition(&cueInstance.Status.Conditions, cuev1alpha1.ValidationWarningCondition)
+		return
+	}
+
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, metav1.Condition{
+		Type:               cuev1alpha1.ValidationWarningCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             cuev1alpha1.PolicyViolationReason,
+		Message:            fmt.Sprintf("%d validation warnings: %s", len(warnings), summarize(warnings, maxPolicyViolations)),
+		ObservedGeneration: cueInstance.Generation,
+	})
+}
+
+// validationModeOverride returns the validation mode set by the value of the
+// ValidationModeAnnotation of an object, or mode when the object has none.
+func validationModeOverride(annotation string, mode cuev1alpha1.ValidationMode) (cuev1alpha1.ValidationMode, error) {
+	switch override := cuev1alpha1.ValidationMode(annotation); override {
+	case "":
+		return mode, nil
+	case cuev1alpha1.IgnorePolicy, cuev1alpha1.AuditPolicy, cuev1alpha1.WarnPolicy, cuev1alpha1.DropPolicy, cuev1alpha1.FailPolicy:
+		return override, nil
+	default:
+		return "", fmt.Errorf("invalid %s annotation '%s'", cuev1alpha1.ValidationModeAnnotation, annotation)
+	}
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckTargetNamespaces(t *testing.T) {
+	inNamespace := func(obj *unstructured.Unstructured, namespace string) *unstructured.Unstructured {
+		obj.SetNamespace(namespace)
+		return obj
+	}
+
+	objects := []*unstructured.Unstructured{
+		inNamespace(newTestObject("v1", "ConfigMap", "app"), "team-a"),
+		inNamespace(newTestObject("v1", "Namespace", "team-b"), ""),
+		inNamespace(newTestObject("rbac.authorization.k8s.io/v1", "ClusterRole", "app"), ""),
+	}
+
+	tests := []struct {
+		name       string
+		allowlists [][]string
+		wantErr    string
+	}{
+		{name: "no allowlists"},
+		{name: "empty allowlists", allowlists: [][]string{nil, {}}},
+		{name: "patterns", allowlists: [][]string{{"team-*"}}},
+		{name: "all allowlists must match", allowlists: [][]string{{"team-*"}, {"team-a"}},
+			wantErr: "policy violation: 1 objects target namespaces which are not allowed: Namespace/team-b"},
+		{name: "namespaced objects", allowlists: [][]string{{"team-b"}},
+			wantErr: "policy violation: 1 objects target namespaces which are not allowed: ConfigMap/team-a/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := checkTargetNamespaces(objects, tt.allowlists...)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(tt.wantErr))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestCheckKinds(t *testing.T) {
+	objects := []*unstructured.Unstructured{
+		newTestObject("v1", "ConfigMap", "app"),
+		newTestObject("apps/v1", "Deployment", "app"),
+		newTestObject("rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "app"),
+	}
+
+	tests := []struct {
+		name     string
+		policies []KindPolicy
+		wantErr  string
+	}{
+		{name: "no policies"},
+		{name: "allowed patterns", policies: []KindPolicy{{Allowed: []string{"ConfigMap", "*.apps", "*.rbac.authorization.k8s.io"}}}},
+		{name: "allowed kinds", policies: []KindPolicy{{Allowed: []string{"ConfigMap", "Deployment.apps"}}},
+			wantErr: "policy violation: 1 objects have kinds which are not allowed: ClusterRoleBinding/default/app"},
+		{name: "denied kinds", policies: []KindPolicy{{}, {Denied: []string{"ClusterRoleBinding.*", "ConfigMap"}}},
+			wantErr: "policy violation: 2 objects have kinds which are not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := checkKinds(objects, tt.policies...)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(err).To(MatchError(errPolicyViolation))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestNamespaceKindPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tenant",
+			Annotations: map[string]string{
+				cuev1alpha1.AllowedKindsAnnotation: "ConfigMap, *.apps",
+				cuev1alpha1.DeniedKindsAnnotation:  "DaemonSet.apps",
+			},
+		},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace).Build(),
+	}
+
+	policy, err := r.namespaceKindPolicy(context.TODO(), "tenant")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(policy).To(Equal(KindPolicy{
+		Allowed: []string{"ConfigMap", "*.apps"},
+		Denied:  []string{"DaemonSet.apps"},
+	}))
+	g.Expect(policy.allows("Deployment.apps")).To(BeTrue())
+	g.Expect(policy.allows("DaemonSet.apps")).To(BeFalse())
+	g.Expect(policy.allows("Secret")).To(BeFalse())
+}
+
+func TestCheckClusterScoped(t *testing.T) {
+	crd := newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com")
+	crd.SetNamespace("")
+	crd.Object["spec"] = map[string]interface{}{
+		"group": "example.com",
+		"scope": "Namespaced",
+		"names": map[string]interface{}{"kind": "Widget"},
+	}
+	clusterRole := newTestObject("rbac.authorization.k8s.io/v1", "ClusterRole", "app")
+	clusterRole.SetNamespace("")
+	widget := newTestObject("example.com/v1", "Widget", "app")
+	widget.SetNamespace("")
+	gadget := newTestObject("example.com/v1", "Gadget", "app")
+	gadget.SetNamespace("")
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	objects := []*unstructured.Unstructured{crd, clusterRole, widget, gadget, newTestObject("v1", "ConfigMap", "app")}
+
+	tests := []struct {
+		name      string
+		namespace string
+		allowed   []string
+		wantErr   string
+	}{
+		{name: "no allowlist", namespace: "tenant"},
+		{name: "allowed namespace", namespace: "flux-system", allowed: []string{"flux-*"}},
+		{name: "tenant namespace", namespace: "tenant", allowed: []string{"flux-system"},
+			wantErr: "cluster-scoped objects are not allowed in namespace 'tenant': " +
+				"CustomResourceDefinition/widgets.example.com, ClusterRole/app, Gadget/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := checkClusterScoped(mapper, objects, tt.namespace, tt.allowed)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestCheckObjectPlacement(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "tenant",
+			Annotations: map[string]string{cuev1alpha1.DeniedKindsAnnotation: "Secret"},
+		},
+	}
+	r := &CueInstanceReconciler{
+		Client:                  fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(namespace).Build(),
+		ClusterScopedNamespaces: []string{"flux-system"},
+	}
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "tenant"},
+		Spec:       cuev1alpha1.CueInstanceSpec{AllowedNamespaces: []string{"tenant"}},
+	}
+
+	inTenant := func(obj *unstructured.Unstructured) *unstructured.Unstructured {
+		obj.SetNamespace("tenant")
+		return obj
+	}
+	clusterRole := newTestObject("rbac.authorization.k8s.io/v1", "ClusterRole", "app")
+	clusterRole.SetNamespace("")
+
+	tests := []struct {
+		name       string
+		objects    []*unstructured.Unstructured
+		wantReason string
+	}{
+		{name: "allowed", objects: []*unstructured.Unstructured{inTenant(newTestObject("v1", "ConfigMap", "app"))}},
+		{name: "namespace not allowed", objects: []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "app")},
+			wantReason: cuev1alpha1.NamespaceNotAllowedReason},
+		{name: "kind not allowed", objects: []*unstructured.Unstructured{inTenant(newTestObject("v1", "Secret", "app"))},
+			wantReason: cuev1alpha1.KindNotAllowedReason},
+		{name: "cluster scope not allowed", objects: []*unstructured.Unstructured{clusterRole},
+			wantReason: cuev1alpha1.ClusterScopeNotAllowedReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			reason, err := r.checkObjectPlacement(context.TODO(), cueInstance, tt.objects)
+			g.Expect(reason).To(Equal(tt.wantReason))
+			if tt.wantReason != "" {
+				g.Expect(err).To(MatchError(errPolicyViolation))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
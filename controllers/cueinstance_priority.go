@@ -0,0 +1,128 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// priorityGate limits the number of concurrent reconciliations. Once all its
+// slots are taken, the waiting reconciliations are admitted by decreasing
+// priority, and in arrival order for equal priorities.
+type priorityGate struct {
+	mu      sync.Mutex
+	slots   int
+	seq     uint64
+	waiters waiterQueue
+}
+
+func newPriorityGate(slots int) *priorityGate {
+	if slots < 1 {
+		slots = 1
+	}
+	return &priorityGate{slots: slots}
+}
+
+// acquire blocks until a slot is available for a reconciliation of the given
+// priority, the returned function releases the slot.
+func (g *priorityGate) acquire(ctx context.Context, priority int32) (func(), error) {
+	g.mu.Lock()
+	if g.slots > 0 && g.waiters.Len() == 0 {
+		g.slots--
+		g.mu.Unlock()
+		return g.release, nil
+	}
+
+	w := &waiter{priority: priority, seq: g.seq, ready: make(chan struct{})}
+	g.seq++
+	heap.Push(&g.waiters, w)
+	g.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return g.release, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		select {
+		case <-w.ready:
+			// the slot was handed over concurrently, pass it on
+			g.releaseLocked()
+		default:
+			heap.Remove(&g.waiters, w.index)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (g *priorityGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.releaseLocked()
+}
+
+// releaseLocked hands the slot over to the waiter of highest priority.
+func (g *priorityGate) releaseLocked() {
+	if g.waiters.Len() == 0 {
+		g.slots++
+		return
+	}
+	w := heap.Pop(&g.waiters).(*waiter)
+	close(w.ready)
+}
+
+type waiter struct {
+	priority int32
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+// waiterQueue is a heap of waiters ordered by decreasing priority and arrival.
+type waiterQueue []*waiter
+
+func (q waiterQueue) Len() int { return len(q) }
+
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waiterQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waiterQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return w
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPriorityGate(t *testing.T) {
+	g := NewWithT(t)
+
+	gate := newPriorityGate(1)
+	release, err := gate.acquire(context.TODO(), 0)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	waiting := func() int {
+		gate.mu.Lock()
+		defer gate.mu.Unlock()
+		return gate.waiters.Len()
+	}
+
+	// queue the waiters one at a time so that their arrival order is known
+	admitted := make(chan string, 3)
+	wait := func(name string, priority int32) {
+		queued := waiting()
+		go func() {
+			release, err := gate.acquire(context.TODO(), priority)
+			if err != nil {
+				return
+			}
+			admitted <- name
+			release()
+		}()
+		g.Eventually(waiting).Should(Equal(queued + 1))
+	}
+	wait("tenant-a", 0)
+	wait("platform", 10)
+	wait("tenant-b", 0)
+
+	release()
+	var order []string
+	for i := 0; i < 3; i++ {
+		select {
+		case name := <-admitted:
+			order = append(order, name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the gate")
+		}
+	}
+	g.Expect(order).To(Equal([]string{"platform", "tenant-a", "tenant-b"}))
+
+	t.Run("cancelled waiters are removed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		gate := newPriorityGate(1)
+		release, err := gate.acquire(context.TODO(), 0)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		_, err = gate.acquire(ctx, 0)
+		g.Expect(err).To(MatchError(context.Canceled))
+		g.Expect(gate.waiters.Len()).To(BeZero())
+
+		release()
+		release, err = gate.acquire(context.TODO(), 0)
+		g.Expect(err).NotTo(HaveOccurred())
+		release()
+		g.Expect(gate.slots).To(Equal(1))
+	})
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// applyProfile returns a copy of the CueInstance in which the tags and tag
+// variables of the profile selected by spec.profile have been merged into the spec.
+func (r *CueInstanceReconciler) applyProfile(ctx context.Context, cueInstance cuev1alpha1.CueInstance) (cuev1alpha1.CueInstance, error) {
+	instance := *cueInstance.DeepCopy()
+	if instance.Spec.Profile == "" {
+		return instance, nil
+	}
+
+	profile, err := r.getProfile(ctx, instance.GetNamespace(), instance.Spec.Profile)
+	if err != nil {
+		return instance, err
+	}
+
+	MergeProfile(&instance.Spec, *profile)
+	return instance, nil
+}
+
+// MergeProfile merges the tags and tag variables of the profile into the spec,
+// the ones already listed in the spec take precedence.
+func MergeProfile(spec *cuev1alpha1.CueInstanceSpec, profile cuev1alpha1.Profile) {
+	spec.Tags = mergeTags(profile.Tags, spec.Tags)
+	spec.TagVars = mergeTags(profile.TagVars, spec.TagVars)
+}
+
+// getProfile looks up the named profile in the ProfileConfigs of the given
+// namespace and then in the ones of the controller namespace.
+// The ProfileConfigs are searched in alphabetical order.
+func (r *CueInstanceReconciler) getProfile(ctx context.Context, namespace, name string) (*cuev1alpha1.Profile, error) {
+	namespaces := []string{namespace}
+	if r.ProfileNamespace != "" && r.ProfileNamespace != namespace {
+		namespaces = append(namespaces, r.ProfileNamespace)
+	}
+
+	for _, ns := range namespaces {
+		var list cuev1alpha1.ProfileConfigList
+		if err := r.List(ctx, &list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("unable to list ProfileConfigs in namespace '%s': %w", ns, err)
+		}
+
+		sort.Slice(list.Items, func(i, j int) bool {
+			return list.Items[i].GetName() < list.Items[j].GetName()
+		})
+		for _, config := range list.Items {
+			if profile := config.GetProfile(name); profile != nil {
+				return profile, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("profile '%s' not found in namespaces %v", name, namespaces)
+}
+
+// mergeTags returns the profile tags overridden by the CueInstance tags
+// with the same name, followed by the remaining CueInstance tags.
+func mergeTags(profile, instance []cuev1alpha1.TagVar) []cuev1alpha1.TagVar {
+	if len(profile) == 0 {
+		return instance
+	}
+
+	overrides := make(map[string]cuev1alpha1.TagVar, len(instance))
+	for _, t := range instance {
+		overrides[t.Name] = t
+	}
+
+	merged := make([]cuev1alpha1.TagVar, 0, len(profile)+len(instance))
+	seen := make(map[string]bool, len(profile))
+	for _, t := range profile {
+		if o, ok := overrides[t.Name]; ok {
+			t = o
+		}
+		seen[t.Name] = true
+		merged = append(merged, t)
+	}
+	for _, t := range instance {
+		if !seen[t.Name] {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+// requestsForProfileConfig enqueues the CueInstances using one of the
+// profiles of the ProfileConfig. The ProfileConfigs of the controller
+// namespace apply to the CueInstances of all namespaces.
+func (r *CueInstanceReconciler) requestsForProfileConfig(obj client.Object) []reconcile.Request {
+	config, ok := obj.(*cuev1alpha1.ProfileConfig)
+	if !ok {
+		return nil
+	}
+
+	var opts []client.ListOption
+	if config.GetNamespace() != r.ProfileNamespace {
+		opts = append(opts, client.InNamespace(config.GetNamespace()))
+	}
+
+	var list cuev1alpha1.CueInstanceList
+	if err := r.List(context.Background(), &list, opts...); err != nil {
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		if list.Items[i].Spec.Profile == "" {
+			continue
+		}
+		if config.GetProfile(list.Items[i].Spec.Profile) == nil {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return reqs
+}
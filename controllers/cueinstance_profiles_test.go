@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyProfile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	profileConfig := func(namespace, env string) *cuev1alpha1.ProfileConfig {
+		return &cuev1alpha1.ProfileConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "environments", Namespace: namespace},
+			Spec: cuev1alpha1.ProfileConfigSpec{
+				Profiles: []cuev1alpha1.Profile{
+					{
+						Name: "staging",
+						Tags: []cuev1alpha1.TagVar{
+							{Name: "env", Value: env},
+							{Name: "replicas", Value: "1"},
+						},
+						TagVars: []cuev1alpha1.TagVar{{Name: "region", Value: "eu-west-1"}},
+					},
+				},
+			},
+		}
+	}
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			profileConfig("flux-system", "staging"),
+			profileConfig("apps", "apps-staging"),
+		).Build(),
+		ProfileNamespace: "flux-system",
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		profile   string
+		tags      []cuev1alpha1.TagVar
+		wantTags  []cuev1alpha1.TagVar
+		wantErr   bool
+	}{
+		{
+			name:      "no profile",
+			namespace: "default",
+			tags:      []cuev1alpha1.TagVar{{Name: "env", Value: "dev"}},
+			wantTags:  []cuev1alpha1.TagVar{{Name: "env", Value: "dev"}},
+		},
+		{
+			name:      "controller namespace profile",
+			namespace: "default",
+			profile:   "staging",
+			tags:      []cuev1alpha1.TagVar{{Name: "hpa"}},
+			wantTags: []cuev1alpha1.TagVar{
+				{Name: "env", Value: "staging"},
+				{Name: "replicas", Value: "1"},
+				{Name: "hpa"},
+			},
+		},
+		{
+			name:      "namespaced profile takes precedence",
+			namespace: "apps",
+			profile:   "staging",
+			wantTags: []cuev1alpha1.TagVar{
+				{Name: "env", Value: "apps-staging"},
+				{Name: "replicas", Value: "1"},
+			},
+		},
+		{
+			name:      "instance tags override the profile",
+			namespace: "default",
+			profile:   "staging",
+			tags:      []cuev1alpha1.TagVar{{Name: "replicas", Value: "2"}},
+			wantTags: []cuev1alpha1.TagVar{
+				{Name: "env", Value: "staging"},
+				{Name: "replicas", Value: "2"},
+			},
+		},
+		{
+			name:      "missing profile",
+			namespace: "default",
+			profile:   "production",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			instance := cuev1alpha1.CueInstance{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: tt.namespace},
+				Spec: cuev1alpha1.CueInstanceSpec{
+					Profile: tt.profile,
+					Tags:    tt.tags,
+				},
+			}
+
+			got, err := r.applyProfile(context.TODO(), instance)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got.Spec.Tags).To(Equal(tt.wantTags))
+			if tt.profile != "" {
+				g.Expect(got.Spec.TagVars).To(Equal([]cuev1alpha1.TagVar{{Name: "region", Value: "eu-west-1"}}))
+			}
+			g.Expect(instance.Spec.Tags).To(Equal(tt.tags))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// applyInChunks applies the objects in contiguous chunks of at most size
+// objects and reports the number of applied objects after each chunk.
+// When a chunk fails, the returned change set holds the objects applied so far.
+func applyInChunks(objects []*unstructured.Unstructured,
+	size int,
+	apply func([]*unstructured.Unstructured) (*ssa.ChangeSet, error),
+	progress func(applied, total int),
+) (*ssa.ChangeSet, error) {
+	if size <= 0 || size >= len(objects) {
+		return apply(objects)
+	}
+
+	changeSet := ssa.NewChangeSet()
+	for start := 0; start < len(objects); start += size {
+		end := start + size
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		cs, err := apply(objects[start:end])
+		if err != nil {
+			return changeSet, fmt.Errorf("applied %d/%d objects: %w", start, len(objects), err)
+		}
+		changeSet.Append(cs.Entries)
+		progress(end, len(objects))
+	}
+	return changeSet, nil
+}
+
+// reportApplyProgress records the number of applied objects in the
+// progressing Ready condition of the CueInstance.
+func (r *CueInstanceReconciler) reportApplyProgress(ctx context.Context, cueInstance cuev1alpha1.CueInstance, applied, total int) {
+	msg := fmt.Sprintf("applied %d/%d objects", applied, total)
+	cueInstance = cuev1alpha1.CueInstanceProgressing(*cueInstance.DeepCopy(), msg)
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&cueInstance)}
+	if err := r.patchStatus(ctx, req, cueInstance.Status); err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to report the apply progress", "progress", msg)
+	}
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyInChunks(t *testing.T) {
+	objects := make([]*unstructured.Unstructured, 5)
+	for i := range objects {
+		objects[i] = newTestObject("v1", "ConfigMap", string(rune('a'+i)))
+	}
+
+	apply := func(failAt string) func([]*unstructured.Unstructured) (*ssa.ChangeSet, error) {
+		return func(chunk []*unstructured.Unstructured) (*ssa.ChangeSet, error) {
+			cs := ssa.NewChangeSet()
+			for _, obj := range chunk {
+				if obj.GetName() == failAt {
+					return nil, errors.New("apply failed")
+				}
+				cs.Add(ssa.ChangeSetEntry{Subject: obj.GetName(), Action: string(ssa.CreatedAction)})
+			}
+			return cs, nil
+		}
+	}
+
+	tests := []struct {
+		size     int
+		failAt   string
+		progress []string
+		applied  int
+		err      string
+	}{
+		{size: 0, applied: 5},
+		{size: 5, applied: 5},
+		{size: 2, progress: []string{"2/5", "4/5", "5/5"}, applied: 5},
+		{size: 2, failAt: "d", progress: []string{"2/5"}, applied: 2, err: "applied 2/5 objects: apply failed"},
+	}
+
+	for _, tt := range tests {
+		g := NewWithT(t)
+
+		var progress []string
+		changeSet, err := applyInChunks(objects, tt.size, apply(tt.failAt), func(applied, total int) {
+			progress = append(progress, fmt.Sprintf("%d/%d", applied, total))
+		})
+		if tt.err != "" {
+			g.Expect(err).To(MatchError(tt.err))
+		} else {
+			g.Expect(err).NotTo(HaveOccurred())
+		}
+		g.Expect(progress).To(Equal(tt.progress), "size: %d", tt.size)
+		g.Expect(changeSet.Entries).To(HaveLen(tt.applied))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// PruneProtection lists the objects the garbage collection never deletes,
+// as a safety net for all the CueInstances. Shell patterns are supported.
+type PruneProtection struct {
+	// Kinds are the protected kinds, in the form 'Kind.group'
+	// or 'Kind' for the core group.
+	Kinds []string
+	// Namespaces are the namespaces whose objects are protected,
+	// including the Namespace objects themselves.
+	Namespaces []string
+}
+
+// protects reports whether the object must not be deleted.
+func (p PruneProtection) protects(obj *unstructured.Unstructured) bool {
+	if matchesAny(p.Kinds, obj.GroupVersionKind().GroupKind().String()) {
+		return true
+	}
+	namespace := obj.GetNamespace()
+	if obj.GetAPIVersion() == "v1" && obj.GetKind() == "Namespace" {
+		namespace = obj.GetName()
+	}
+	return namespace != "" && matchesAny(p.Namespaces, namespace)
+}
+
+// filterProtected splits the objects into the ones which may
+// be deleted and the protected ones.
+func (p PruneProtection) filterProtected(objects []*unstructured.Unstructured) (deletable, protected []*unstructured.Unstructured) {
+	for _, obj := range objects {
+		if p.protects(obj) {
+			protected = append(protected, obj)
+		} else {
+			deletable = append(deletable, obj)
+		}
+	}
+	return deletable, protected
+}
+
+// excludedFromPrune reports whether the garbage collection of the
+// CueInstance must leave the object untouched.
+func (r *CueInstanceReconciler) excludedFromPrune(cueInstance cuev1alpha1.CueInstance, obj *unstructured.Unstructured) bool {
+	return r.PruneProtection.protects(obj) || (cueInstance.PruneExcludesClusterScoped() && obj.GetNamespace() == "")
+}
+
+// excludeFromPrune returns the objects the garbage collection may delete,
+// reporting the protected and the excluded cluster-scoped ones.
+func (r *CueInstanceReconciler) excludeFromPrune(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+	objects []*unstructured.Unstructured,
+) []*unstructured.Unstructured {
+	objects, protected := r.PruneProtection.filterProtected(objects)
+	if len(protected) > 0 {
+		r.reportExcludedFromPrune(ctx, cueInstance, revision, "protected objects", protected)
+	}
+
+	if !cueInstance.PruneExcludesClusterScoped() {
+		return objects
+	}
+	var namespaced, clusterScoped []*unstructured.Unstructured
+	for _, obj := range objects {
+		if obj.GetNamespace() == "" {
+			clusterScoped = append(clusterScoped, obj)
+		} else {
+			namespaced = append(namespaced, obj)
+		}
+	}
+	if len(clusterScoped) > 0 {
+		r.reportExcludedFromPrune(ctx, cueInstance, revision, "cluster-scoped objects", clusterScoped)
+	}
+	return namespaced
+}
+
+func (r *CueInstanceReconciler) reportExcludedFromPrune(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision, what string,
+	objects []*unstructured.Unstructured,
+) {
+	msg := fmt.Sprintf("skipping the garbage collection of %s: \n%s", what, ssa.FmtUnstructuredList(objects))
+	ctrl.LoggerFrom(ctx).Info(msg)
+	r.event(ctx, cueInstance, revision, events.EventSeverityInfo, msg, nil)
+}
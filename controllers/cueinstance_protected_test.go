@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPruneProtection(t *testing.T) {
+	g := NewWithT(t)
+
+	protection := PruneProtection{
+		Kinds:      []string{"PersistentVolumeClaim", "CustomResourceDefinition.apiextensions.k8s.io"},
+		Namespaces: []string{"kube-*"},
+	}
+
+	namespace := func(name string) *unstructured.Unstructured {
+		obj := newTestObject("v1", "Namespace", name)
+		obj.SetNamespace("")
+		return obj
+	}
+	proxy := newTestObject("apps/v1", "DaemonSet", "proxy")
+	proxy.SetNamespace("kube-system")
+
+	objects := []*unstructured.Unstructured{
+		newTestObject("v1", "PersistentVolumeClaim", "data"),
+		newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com"),
+		proxy,
+		namespace("kube-public"),
+		namespace("apps"),
+		newTestObject("apps/v1", "Deployment", "app"),
+	}
+
+	deletable, protected := protection.filterProtected(objects)
+	var names []string
+	for _, obj := range protected {
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{
+		"PersistentVolumeClaim/data",
+		"CustomResourceDefinition/widgets.example.com",
+		"DaemonSet/proxy",
+		"Namespace/kube-public",
+	}))
+	g.Expect(deletable).To(Equal([]*unstructured.Unstructured{objects[4], objects[5]}))
+
+	deletable, protected = PruneProtection{}.filterProtected(objects)
+	g.Expect(deletable).To(Equal(objects))
+	g.Expect(protected).To(BeEmpty())
+}
+
+func TestExcludeFromPrune_ClusterScoped(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &CueInstanceReconciler{
+		PruneProtection: PruneProtection{Kinds: []string{"PersistentVolumeClaim"}},
+	}
+
+	role := newTestObject("rbac.authorization.k8s.io/v1", "ClusterRole", "reader")
+	role.SetNamespace("")
+	crd := newTestObject("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com")
+	crd.SetNamespace("")
+	objects := []*unstructured.Unstructured{
+		role,
+		crd,
+		newTestObject("v1", "PersistentVolumeClaim", "data"),
+		newTestObject("apps/v1", "Deployment", "app"),
+	}
+
+	cueInstance := cuev1alpha1.CueInstance{}
+	g.Expect(r.excludeFromPrune(context.TODO(), cueInstance, "", objects)).
+		To(Equal([]*unstructured.Unstructured{role, crd, objects[3]}))
+	g.Expect(r.excludedFromPrune(cueInstance, role)).To(BeFalse())
+
+	cueInstance.Spec.PruneOptions = &cuev1alpha1.PruneOptions{ExcludeClusterScoped: true}
+	g.Expect(r.excludeFromPrune(context.TODO(), cueInstance, "", objects)).
+		To(Equal([]*unstructured.Unstructured{objects[3]}))
+	g.Expect(r.excludedFromPrune(cueInstance, role)).To(BeTrue())
+	g.Expect(r.excludedFromPrune(cueInstance, objects[3])).To(BeFalse())
+}
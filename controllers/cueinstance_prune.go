@@ -0,0 +1,256 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// uncachedReader returns the reader of the metadata of the objects to prune.
+// The delegating client of the manager reads the metadata from informers
+// started on demand for every kind, instead the API reader is used for the
+// local cluster. The impersonated and remote clients are not cached.
+func (r *CueInstanceReconciler) uncachedReader(kubeClient client.Client) client.Reader {
+	if kubeClient == r.Client && r.APIReader != nil {
+		return r.APIReader
+	}
+	return kubeClient
+}
+
+// deleteStaleObjects deletes the objects in the reverse reconcile order like
+// ssa.ResourceManager.DeleteAll, but instead of getting each object in full it
+// lists the metadata of the objects matching the inclusion labels once per kind
+// and namespace. The objects which are not listed, because they no longer exist
+// or are not owned by the CueInstance, are left unchanged. The metadata is read
+// with the reader, which must not be backed by an informer cache.
+func deleteStaleObjects(ctx context.Context,
+	kubeClient client.Client,
+	reader client.Reader,
+	objects []*unstructured.Unstructured,
+	opts ssa.DeleteOptions,
+) (*ssa.ChangeSet, error) {
+	sorted := make([]*unstructured.Unstructured, len(objects))
+	copy(sorted, objects)
+	sort.Sort(sort.Reverse(ssa.SortableUnstructureds(sorted)))
+
+	type listKey struct {
+		gvk       schema.GroupVersionKind
+		namespace string
+	}
+	listed := map[listKey]map[string]*metav1.PartialObjectMetadata{}
+	listErrs := map[listKey]error{}
+
+	changeSet := ssa.NewChangeSet()
+	var errs []string
+	for _, obj := range sorted {
+		key := listKey{gvk: obj.GroupVersionKind(), namespace: obj.GetNamespace()}
+		if _, ok := listed[key]; !ok {
+			listed[key], listErrs[key] = listObjectsMetadata(ctx, reader, key.gvk, key.namespace, opts.Inclusions)
+		}
+		if err := listErrs[key]; err != nil {
+			changeSet.Add(pruneEntry(obj, ssa.UnknownAction))
+			errs = append(errs, fmt.Sprintf("%s query failed, error: %s", ssa.FmtUnstructured(obj), err))
+			continue
+		}
+
+		existing, ok := listed[key][obj.GetName()]
+		if !ok || anyInObjectMeta(existing, opts.Exclusions) {
+			changeSet.Add(pruneEntry(obj, ssa.UnchangedAction))
+			continue
+		}
+
+		err := kubeClient.Delete(ctx, existing, client.PropagationPolicy(opts.PropagationPolicy))
+		if err != nil && !apierrors.IsNotFound(err) {
+			changeSet.Add(pruneEntry(obj, ssa.UnknownAction))
+			errs = append(errs, fmt.Sprintf("%s delete failed, error: %s", ssa.FmtUnstructured(obj), err))
+			continue
+		}
+		changeSet.Add(pruneEntry(obj, ssa.DeletedAction))
+	}
+
+	if len(errs) > 0 {
+		return changeSet, fmt.Errorf("delete failed, errors: %s", strings.Join(errs, "; "))
+	}
+	return changeSet, nil
+}
+
+// deleteInReverseOrder deletes the objects in the reverse apply order. The CRDs
+// and Namespaces are deleted last, once the deleted objects they contain or
+// define have disappeared, so that the finalizers of the custom resources can
+// still be handled by their controllers.
+func deleteInReverseOrder(ctx context.Context,
+	kubeClient client.Client,
+	reader client.Reader,
+	objects []*unstructured.Unstructured,
+	opts ssa.DeleteOptions,
+	interval, timeout time.Duration,
+) (*ssa.ChangeSet, error) {
+	var definitions, others []*unstructured.Unstructured
+	for _, obj := range objects {
+		if ssa.IsClusterDefinition(obj) {
+			definitions = append(definitions, obj)
+		} else {
+			others = append(others, obj)
+		}
+	}
+
+	changeSet, err := deleteStaleObjects(ctx, kubeClient, reader, others, opts)
+	if err != nil || len(definitions) == 0 {
+		return changeSet, err
+	}
+
+	crds := crdKinds(definitions)
+	namespaces := map[string]bool{}
+	for _, obj := range definitions {
+		if obj.GetKind() == "Namespace" {
+			namespaces[obj.GetName()] = true
+		}
+	}
+	var dependents []*unstructured.Unstructured
+	for _, obj := range deletedObjects(others, changeSet) {
+		if _, definedByCRD := crds[obj.GroupVersionKind().GroupKind()]; definedByCRD || namespaces[obj.GetNamespace()] {
+			dependents = append(dependents, obj)
+		}
+	}
+	if err := waitForDeletion(ctx, reader, dependents, interval, timeout); err != nil {
+		return changeSet, fmt.Errorf("failed to delete the CRDs and Namespaces: %w", err)
+	}
+
+	definitionSet, err := deleteStaleObjects(ctx, kubeClient, reader, definitions, opts)
+	changeSet.Append(definitionSet.Entries)
+	return changeSet, err
+}
+
+// deletedObjects returns the objects which were deleted according to the change set.
+func deletedObjects(objects []*unstructured.Unstructured, changeSet *ssa.ChangeSet) []*unstructured.Unstructured {
+	deleted := map[string]bool{}
+	for _, entry := range changeSet.Entries {
+		if entry.Action == string(ssa.DeletedAction) {
+			deleted[entry.Subject] = true
+		}
+	}
+
+	var result []*unstructured.Unstructured
+	for _, obj := range objects {
+		if deleted[ssa.FmtUnstructured(obj)] {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// waitForDeletion polls the objects with the reader until none of them exists.
+func waitForDeletion(ctx context.Context,
+	reader client.Reader,
+	objects []*unstructured.Unstructured,
+	interval, timeout time.Duration,
+) error {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	pending := map[string]bool{}
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		for _, obj := range objects {
+			existing := &metav1.PartialObjectMetadata{}
+			existing.SetGroupVersionKind(obj.GroupVersionKind())
+			err := reader.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+			switch {
+			case apierrors.IsNotFound(err):
+				delete(pending, ssa.FmtUnstructured(obj))
+			case err != nil:
+				return false, err
+			default:
+				pending[ssa.FmtUnstructured(obj)] = true
+			}
+		}
+		return len(pending) == 0, nil
+	})
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		terminating := make([]string, 0, len(pending))
+		for _, obj := range objects {
+			if pending[ssa.FmtUnstructured(obj)] {
+				terminating = append(terminating, ssa.FmtUnstructured(obj))
+			}
+		}
+		return fmt.Errorf("timeout waiting for the deletion of %s", summarize(terminating, maxPolicyViolations))
+	}
+	return err
+}
+
+// listObjectsMetadata returns the metadata of the objects of the given kind
+// in the namespace which match the labels, keyed by the object name.
+func listObjectsMetadata(ctx context.Context,
+	reader client.Reader,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	labels map[string]string,
+) (map[string]*metav1.PartialObjectMetadata, error) {
+	list := &metav1.PartialObjectMetadataList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+	opts := []client.ListOption{client.MatchingLabels(labels)}
+	if namespace != "" {
+		opts = append(opts, client.InNamespace(namespace))
+	}
+	if err := reader.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]*metav1.PartialObjectMetadata, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		item.SetGroupVersionKind(gvk)
+		items[item.GetName()] = item
+	}
+	return items, nil
+}
+
+// anyInObjectMeta reports whether any of the key-value pairs
+// is set in the labels or the annotations of the object.
+func anyInObjectMeta(obj *metav1.PartialObjectMetadata, metadata map[string]string) bool {
+	for key, val := range metadata {
+		if obj.GetLabels()[key] == val || obj.GetAnnotations()[key] == val {
+			return true
+		}
+	}
+	return false
+}
+
+func pruneEntry(obj *unstructured.Unstructured, action ssa.Action) ssa.ChangeSetEntry {
+	return ssa.ChangeSetEntry{
+		ObjMetadata:  object.UnstructuredToObjMetadata(obj),
+		GroupVersion: obj.GroupVersionKind().Version,
+		Subject:      ssa.FmtUnstructured(obj),
+		Action:       string(action),
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestDeleteStaleObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	owned := map[string]string{"cue.contrib.flux.io/name": "app"}
+	configMap := func(name string, labels, annotations map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "default", Labels: labels, Annotations: annotations,
+		}}
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		configMap("stale", owned, nil),
+		configMap("foreign", map[string]string{"cue.contrib.flux.io/name": "other"}, nil),
+		configMap("retained", owned, map[string]string{"cue.contrib.flux.io/prune": "disabled"}),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "default", Labels: owned}},
+	).Build()
+
+	objects := []*unstructured.Unstructured{
+		newTestObject("v1", "ConfigMap", "stale"),
+		newTestObject("v1", "ConfigMap", "foreign"),
+		newTestObject("v1", "ConfigMap", "retained"),
+		newTestObject("v1", "ConfigMap", "gone"),
+		newTestObject("v1", "Secret", "stale"),
+	}
+	changeSet, err := deleteStaleObjects(context.TODO(), kubeClient, kubeClient, objects, ssa.DeleteOptions{
+		PropagationPolicy: metav1.DeletePropagationBackground,
+		Inclusions:        owned,
+		Exclusions:        PruneExclusions(),
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	actions := map[string]string{}
+	for _, entry := range changeSet.Entries {
+		actions[entry.Subject] = entry.Action
+	}
+	g.Expect(actions).To(Equal(map[string]string{
+		"ConfigMap/default/stale":    string(ssa.DeletedAction),
+		"ConfigMap/default/foreign":  string(ssa.UnchangedAction),
+		"ConfigMap/default/retained": string(ssa.UnchangedAction),
+		"ConfigMap/default/gone":     string(ssa.UnchangedAction),
+		"Secret/default/stale":       string(ssa.DeletedAction),
+	}))
+
+	err = kubeClient.Get(context.TODO(), types.NamespacedName{Name: "stale", Namespace: "default"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(kubeClient.Get(context.TODO(), types.NamespacedName{Name: "foreign", Namespace: "default"}, &corev1.ConfigMap{})).To(Succeed())
+	g.Expect(kubeClient.Get(context.TODO(), types.NamespacedName{Name: "retained", Namespace: "default"}, &corev1.ConfigMap{})).To(Succeed())
+
+	t.Run("the metadata is read with the reader", func(t *testing.T) {
+		g := NewWithT(t)
+
+		reader := fake.NewClientBuilder().WithScheme(scheme).Build()
+		changeSet, err := deleteStaleObjects(context.TODO(), kubeClient, reader, objects[2:3], ssa.DeleteOptions{Inclusions: owned})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(changeSet.Entries[0].Action).To(Equal(string(ssa.UnchangedAction)))
+		g.Expect(kubeClient.Get(context.TODO(), types.NamespacedName{Name: "retained", Namespace: "default"}, &corev1.ConfigMap{})).To(Succeed())
+	})
+}
+
+func TestUncachedReader(t *testing.T) {
+	g := NewWithT(t)
+
+	cached := fake.NewClientBuilder().Build()
+	apiReader := fake.NewClientBuilder().Build()
+	impersonated := fake.NewClientBuilder().Build()
+
+	r := &CueInstanceReconciler{Client: cached}
+	g.Expect(r.uncachedReader(cached)).To(BeIdenticalTo(cached))
+
+	r.APIReader = apiReader
+	g.Expect(r.uncachedReader(cached)).To(BeIdenticalTo(apiReader))
+	g.Expect(r.uncachedReader(impersonated)).To(BeIdenticalTo(impersonated))
+}
+
+func TestDeleteInReverseOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	owned := map[string]string{"cue.contrib.flux.io/name": "app"}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name: "settings", Namespace: "team", Labels: owned, Finalizers: []string{"example.com/cleanup"},
+	}}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: owned}},
+		configMap,
+	).Build()
+
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName("team")
+	settings := newTestObject("v1", "ConfigMap", "settings")
+	settings.SetNamespace("team")
+	opts := ssa.DeleteOptions{PropagationPolicy: metav1.DeletePropagationBackground, Inclusions: owned}
+
+	// the namespace is kept while the objects it contains are terminating
+	_, err := deleteInReverseOrder(context.TODO(), kubeClient, kubeClient, []*unstructured.Unstructured{namespace, settings}, opts,
+		10*time.Millisecond, 50*time.Millisecond)
+	g.Expect(err).To(MatchError(ContainSubstring("timeout waiting for the deletion of ConfigMap/team/settings")))
+	g.Expect(kubeClient.Get(context.TODO(), types.NamespacedName{Name: "team"}, &corev1.Namespace{})).To(Succeed())
+
+	g.Expect(kubeClient.Get(context.TODO(), types.NamespacedName{Name: "settings", Namespace: "team"}, configMap)).To(Succeed())
+	configMap.Finalizers = nil
+	g.Expect(kubeClient.Update(context.TODO(), configMap)).To(Succeed())
+
+	changeSet, err := deleteInReverseOrder(context.TODO(), kubeClient, kubeClient, []*unstructured.Unstructured{namespace, settings}, opts,
+		10*time.Millisecond, 50*time.Millisecond)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(changeSet.Entries).To(HaveLen(2))
+	g.Expect(changeSet.Entries[1].Subject).To(Equal("Namespace/team"))
+	g.Expect(changeSet.Entries[1].Action).To(Equal(string(ssa.DeletedAction)))
+	err = kubeClient.Get(context.TODO(), types.NamespacedName{Name: "team"}, &corev1.Namespace{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestPrune_Wait(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Prune: true,
+			PruneOptions: &cuev1alpha1.PruneOptions{
+				Wait:    true,
+				Timeout: &metav1.Duration{Duration: 50 * time.Millisecond},
+			},
+		},
+	}
+	r := &CueInstanceReconciler{ControllerName: "cue-controller"}
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	manager := ssa.NewResourceManager(kubeClient, nil, r.resourceOwner(*cueInstance))
+
+	g.Expect(kubeClient.Create(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:       "settings",
+		Namespace:  "default",
+		Labels:     manager.GetOwnerLabels("app", "default"),
+		Finalizers: []string{"example.com/cleanup"},
+	}})).To(Succeed())
+
+	objects := []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "settings")}
+	pruned, err := r.prune(context.TODO(), manager, cueInstance, "main/abc", "", objects)
+	g.Expect(err).To(MatchError(ContainSubstring("timeout waiting for the deletion of ConfigMap/default/settings")))
+	g.Expect(pruned).To(BeTrue())
+	g.Expect(cueInstance.Status.LastGarbageCollection).NotTo(BeNil())
+	g.Expect(cueInstance.Status.LastGarbageCollection.Entries).To(HaveLen(1))
+}
+
+func TestWaitForDeletion(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+	}).Build()
+	objects := []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "settings")}
+
+	err := waitForDeletion(context.TODO(), reader, objects, 10*time.Millisecond, 50*time.Millisecond)
+	g.Expect(err).To(MatchError(ContainSubstring("timeout waiting for the deletion of ConfigMap/default/settings")))
+
+	g.Expect(reader.Delete(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+	})).To(Succeed())
+	g.Expect(waitForDeletion(context.TODO(), reader, objects, 10*time.Millisecond, 50*time.Millisecond)).To(Succeed())
+}
+
+func TestRemainingObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "left", Namespace: "default"}},
+	).Build()
+
+	objects := []*unstructured.Unstructured{
+		newTestObject("v1", "ConfigMap", "left"),
+		newTestObject("v1", "ConfigMap", "deleted"),
+	}
+	g.Expect(remainingObjects(context.TODO(), reader, objects)).To(Equal(objects[:1]))
+}
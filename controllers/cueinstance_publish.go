@@ -0,0 +1,206 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	// publishConfigMediaType and publishContentMediaType are the media
+	// types of the Flux artifacts, so that OCIRepositories can consume them.
+	publishConfigMediaType  types.MediaType = "application/vnd.cncf.flux.config.v1+json"
+	publishContentMediaType types.MediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+
+	// maxTagLength is the maximum length of an OCI tag.
+	maxTagLength = 128
+)
+
+// invalidTagChars matches the characters not allowed in an OCI tag.
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// publish pushes the manifests of the objects to the OCI repository of the
+// CueInstance and returns the pushed artifact. The push is skipped when the
+// objects of the revision have already been published.
+func (r *CueInstanceReconciler) publish(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision, checksum string,
+	objects []*unstructured.Unstructured,
+) (*cuev1alpha1.PublishedArtifact, error) {
+	opts := cueInstance.Spec.Publish
+	if opts == nil {
+		return nil, nil
+	}
+	if last := cueInstance.Status.LastPublished; last != nil && last.Revision == revision && last.Checksum == checksum {
+		return last, nil
+	}
+
+	url := fmt.Sprintf("%s:%s", strings.TrimPrefix(opts.URL, "oci://"), publishTag(revision, checksum))
+
+	craneOpts := []crane.Option{crane.WithContext(ctx)}
+	if opts.Insecure {
+		craneOpts = append(craneOpts, crane.Insecure)
+	}
+	if opts.SecretRef != nil {
+		auth, err := r.registryAuth(ctx, cueInstance, url)
+		if err != nil {
+			return nil, err
+		}
+		craneOpts = append(craneOpts, crane.WithAuth(auth))
+	}
+
+	masked := make([]*unstructured.Unstructured, len(objects))
+	for i, obj := range objects {
+		masked[i] = maskSecretData(obj)
+	}
+	manifests, err := ssa.ObjectsToYAML(masked)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := publishArtifact(manifests, map[string]string{
+		"org.opencontainers.image.revision":          revision,
+		"org.opencontainers.image.source":            fmt.Sprintf("%s/%s/%s", cuev1alpha1.CueInstanceKind, cueInstance.GetNamespace(), cueInstance.GetName()),
+		cuev1alpha1.GroupVersion.Group + "/checksum": checksum,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the artifact: %w", err)
+	}
+
+	if err := crane.Push(img, url, craneOpts...); err != nil {
+		return nil, fmt.Errorf("unable to push the manifests to '%s': %w", url, err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("manifests published to %s", url), "digest", digest.String())
+	return &cuev1alpha1.PublishedArtifact{
+		URL:      "oci://" + url,
+		Digest:   digest.String(),
+		Revision: revision,
+		Checksum: checksum,
+	}, nil
+}
+
+// publishArtifact builds a Flux artifact holding the manifests in a single
+// gzipped tarball layer, with the given manifest annotations.
+func publishArtifact(manifests string, annotations map[string]string) (v1.Image, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     manifestsKey,
+		Mode:     0o644,
+		Size:     int64(len(manifests)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write([]byte(manifests)); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, publishConfigMediaType)
+	img, err := mutate.AppendLayers(img, static.NewLayer(buf.Bytes(), publishContentMediaType))
+	if err != nil {
+		return nil, err
+	}
+	return mutate.Annotations(img, annotations).(v1.Image), nil
+}
+
+// publishTag returns the tag of the artifact of the revision,
+// or the short checksum of the objects when the revision is empty.
+func publishTag(revision, checksum string) string {
+	tag := strings.TrimLeft(invalidTagChars.ReplaceAllString(revision, "-"), ".-")
+	if tag == "" {
+		tag = checksum
+		if len(tag) > 12 {
+			tag = tag[:12]
+		}
+	}
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return tag
+}
+
+// registryAuth returns the credentials of the registry of the artifact URL
+// from the docker config of the Secret referenced by the publish options.
+func (r *CueInstanceReconciler) registryAuth(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	url string,
+) (authn.Authenticator, error) {
+	secretName := ktypes.NamespacedName{
+		Namespace: cueInstance.GetNamespace(),
+		Name:      cueInstance.Spec.Publish.SecretRef.Name,
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, secretName, &secret); err != nil {
+		return nil, fmt.Errorf("unable to read the registry secret '%s': %w", secretName, err)
+	}
+
+	ref, err := name.ParseReference(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Auths map[string]authn.AuthConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil, fmt.Errorf("invalid docker config in secret '%s': %w", secretName, err)
+	}
+	for host, auth := range config.Auths {
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		if strings.SplitN(host, "/", 2)[0] == ref.Context().RegistryStr() {
+			return authn.FromConfig(auth), nil
+		}
+	}
+	return nil, fmt.Errorf("secret '%s' has no credentials for registry '%s'", secretName, ref.Context().RegistryStr())
+}
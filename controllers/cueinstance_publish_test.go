@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPublish(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + host + `":{"username":"flux","password":"s3cr3t"}}}`),
+			},
+		}).Build(),
+	}
+
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Publish: &cuev1alpha1.PublishOptions{
+				URL:       "oci://" + host + "/manifests/app",
+				SecretRef: &meta.LocalObjectReference{Name: "registry"},
+				Insecure:  true,
+			},
+		},
+	}
+
+	secret := newTestObject("v1", "Secret", "credentials")
+	secret.Object["data"] = map[string]interface{}{"token": "czNjcjN0"}
+	objects := []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "settings"), secret}
+
+	published, err := r.publish(context.TODO(), instance, "main/8d1b5a3", "abc", objects)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(published.URL).To(Equal("oci://" + host + "/manifests/app:main-8d1b5a3"))
+	g.Expect(published.Digest).To(HavePrefix("sha256:"))
+
+	img, err := crane.Pull(host+"/manifests/app:main-8d1b5a3", crane.Insecure)
+	g.Expect(err).NotTo(HaveOccurred())
+	manifest, err := img.Manifest()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifest.Annotations).To(HaveKeyWithValue("org.opencontainers.image.revision", "main/8d1b5a3"))
+	g.Expect(manifest.Config.MediaType).To(Equal(publishConfigMediaType))
+	g.Expect(manifest.Layers).To(HaveLen(1))
+
+	layers, err := img.Layers()
+	g.Expect(err).NotTo(HaveOccurred())
+	rc, err := layers[0].Compressed()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer rc.Close()
+	dir := t.TempDir()
+	g.Expect(extractArtifact(rc, dir, ExtractOptions{})).To(Succeed())
+	manifests, err := os.ReadFile(filepath.Join(dir, manifestsKey))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(manifests)).To(ContainSubstring("name: settings"))
+	g.Expect(string(manifests)).NotTo(ContainSubstring("czNjcjN0"))
+
+	// the objects of a revision are only published once
+	instance.Status.LastPublished = published
+	instance.Spec.Publish.SecretRef = &meta.LocalObjectReference{Name: "missing"}
+	again, err := r.publish(context.TODO(), instance, "main/8d1b5a3", "abc", objects)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(again).To(Equal(published))
+	_, err = r.publish(context.TODO(), instance, "main/8d1b5a3", "def", objects)
+	g.Expect(err).To(MatchError(ContainSubstring("unable to read the registry secret")))
+}
+
+func TestPublishTag(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(publishTag("main/8d1b5a3", "abc")).To(Equal("main-8d1b5a3"))
+	g.Expect(publishTag("main@sha1:8d1b5a3", "abc")).To(Equal("main-sha1-8d1b5a3"))
+	g.Expect(publishTag("", "0123456789abcdef")).To(Equal("0123456789ab"))
+	g.Expect(publishTag(strings.Repeat("a", 200), "abc")).To(HaveLen(maxTagLength))
+}
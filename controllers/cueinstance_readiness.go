@@ -0,0 +1,181 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/runtime/acl"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	celtypes "github.com/google/cel-go/common/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// dependencyReader returns the client used to look up the dependency, that
+// is the client of the remote cluster when the dependency references a
+// KubeConfig secret, with the same impersonation as the applies. The local
+// dependencies which are not CueInstances, or whose status is read by a ready
+// expression, are looked up with the impersonation of the CueInstance too.
+func (r *CueInstanceReconciler) dependencyReader(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	d cuev1alpha1.DependencyReference,
+) (client.Reader, error) {
+	if !d.IsRemote() && !exposesDependency(d) {
+		return r.Client, nil
+	}
+
+	cluster := ""
+	if d.IsRemote() {
+		cluster = d.KubeConfig.SecretRef.Name
+	}
+	impersonation := NewCueInstanceImpersonation(cueInstance, r.Client, r.StatusPoller, r.DefaultServiceAccount, r.ClientOptions)
+	kubeClient, _, err := impersonation.GetClientForCluster(ctx, cluster)
+	if err != nil {
+		if cluster == "" {
+			return nil, fmt.Errorf("unable to get the client of dependency '%s': %w", d.Name, err)
+		}
+		return nil, fmt.Errorf("unable to connect to cluster '%s' of dependency '%s': %w", cluster, d.Name, err)
+	}
+	return kubeClient, nil
+}
+
+// exposesDependency reports whether the existence or the status of the
+// dependency is exposed to the CueInstance, that is when the dependency is
+// an arbitrary object or its status is read by a ready expression.
+func exposesDependency(d cuev1alpha1.DependencyReference) bool {
+	return !d.IsCueInstance() || d.ReadyExpr != ""
+}
+
+// checkDependencyAccess rejects the dependencies exposed to the CueInstance
+// in other namespaces when the cross-namespace references are blocked.
+func (r *CueInstanceReconciler) checkDependencyAccess(cueInstance cuev1alpha1.CueInstance, d cuev1alpha1.DependencyReference) error {
+	if !r.NoCrossNamespaceRefs || !exposesDependency(d) || d.Namespace == cueInstance.GetNamespace() {
+		return nil
+	}
+	return acl.AccessDeniedError(
+		fmt.Sprintf("can't access dependency '%s', cross-namespace references have been blocked",
+			dependencyName(d, types.NamespacedName(d.CrossNamespaceDependencyReference).String())))
+}
+
+// dependencyName formats the reference of the dependency for
+// the messages, along with its cluster when it is remote.
+func dependencyName(d cuev1alpha1.DependencyReference, ref string) string {
+	if d.IsRemote() {
+		return fmt.Sprintf("%s@%s", ref, d.KubeConfig.SecretRef.Name)
+	}
+	return ref
+}
+
+// checkObjectDependency checks the readiness of a dependency
+// which refers to an arbitrary cluster object.
+func (r *CueInstanceReconciler) checkObjectDependency(ctx context.Context, reader client.Reader, d cuev1alpha1.DependencyReference) error {
+	gv, err := schema.ParseGroupVersion(d.APIVersion)
+	if err != nil {
+		return fmt.Errorf("invalid apiVersion of dependency '%s': %w", d.Name, err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gv.WithKind(d.Kind))
+	ref := dependencyName(d, fmt.Sprintf("%s/%s", d.Kind, d.CrossNamespaceDependencyReference))
+
+	if err := reader.Get(ctx, types.NamespacedName(d.CrossNamespaceDependencyReference), obj); err != nil {
+		return fmt.Errorf("unable to get '%s' dependency: %w", ref, err)
+	}
+
+	if d.ReadyExpr != "" {
+		ready, err := evalReadyExpr(d.ReadyExpr, obj)
+		if err != nil {
+			return fmt.Errorf("dependency '%s': %w", ref, err)
+		}
+		if !ready {
+			return fmt.Errorf("dependency '%s' does not meet the ready expression", ref)
+		}
+		return nil
+	}
+
+	if d.Check == cuev1alpha1.DependencyExistsCheck {
+		return nil
+	}
+
+	res, err := status.Compute(obj)
+	if err != nil {
+		return fmt.Errorf("unable to compute the status of dependency '%s': %w", ref, err)
+	}
+	if res.Status != status.CurrentStatus {
+		return fmt.Errorf("dependency '%s' is not ready: %s", ref, res.Message)
+	}
+
+	return nil
+}
+
+// evalReadyExpr evaluates the CEL expression expr against the status
+// of obj and reports whether the expression returned true.
+func evalReadyExpr(expr string, obj runtime.Object) (bool, error) {
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("status", decls.Dyn)))
+	if err != nil {
+		return false, err
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return false, fmt.Errorf("invalid ready expression: %w", issues.Err())
+	}
+	if ast.ResultType() != decls.Bool && ast.ResultType() != decls.Dyn {
+		return false, fmt.Errorf("invalid ready expression: must return a bool")
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return false, fmt.Errorf("invalid ready expression: %w", err)
+	}
+
+	var content map[string]interface{}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content = u.UnstructuredContent()
+	} else {
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	status, ok := content["status"]
+	if !ok {
+		status = map[string]interface{}{}
+	}
+
+	out, _, err := prg.Eval(map[string]interface{}{"status": status})
+	if err != nil {
+		return false, fmt.Errorf("ready expression evaluation failed: %w", err)
+	}
+
+	ready, ok := out.(celtypes.Bool)
+	if !ok {
+		return false, fmt.Errorf("ready expression returned %s instead of a bool", out.Type().TypeName())
+	}
+
+	return bool(ready), nil
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/dependency"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEvalReadyExpr(t *testing.T) {
+	dep := &cuev1alpha1.CueInstance{
+		Status: cuev1alpha1.CueInstanceStatus{
+			LastAppliedRevision: "main/8d1b5a3",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		ready   bool
+		wantErr bool
+	}{
+		{name: "matching revision", expr: `status.lastAppliedRevision == "main/8d1b5a3"`, ready: true},
+		{name: "different revision", expr: `status.lastAppliedRevision == "main/0000000"`, ready: false},
+		{name: "field presence", expr: `has(status.inventory)`, ready: false},
+		{name: "non bool result", expr: `status.lastAppliedRevision`, wantErr: true},
+		{name: "invalid syntax", expr: `status.`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ready, err := evalReadyExpr(tt.expr, dep)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ready).To(Equal(tt.ready))
+		})
+	}
+}
+
+func TestCheckObjectDependency(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(1)},
+	}
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret, deployment).Build(),
+	}
+
+	ref := func(apiVersion, kind, name string, check cuev1alpha1.DependencyCheck) cuev1alpha1.DependencyReference {
+		return cuev1alpha1.DependencyReference{
+			CrossNamespaceDependencyReference: dependency.CrossNamespaceDependencyReference{
+				Name:      name,
+				Namespace: "default",
+			},
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Check:      check,
+		}
+	}
+
+	g.Expect(r.checkObjectDependency(context.TODO(), r.Client, ref("v1", "Secret", "credentials", cuev1alpha1.DependencyExistsCheck))).To(Succeed())
+	g.Expect(r.checkObjectDependency(context.TODO(), r.Client, ref("v1", "Secret", "missing", cuev1alpha1.DependencyExistsCheck))).NotTo(Succeed())
+	g.Expect(r.checkObjectDependency(context.TODO(), r.Client, ref("apps/v1", "Deployment", "app", cuev1alpha1.DependencyExistsCheck))).To(Succeed())
+
+	err := r.checkObjectDependency(context.TODO(), r.Client, ref("apps/v1", "Deployment", "app", ""))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("is not ready"))
+
+	readyExpr := ref("apps/v1", "Deployment", "app", "")
+	readyExpr.ReadyExpr = `!has(status.readyReplicas)`
+	g.Expect(r.checkObjectDependency(context.TODO(), r.Client, readyExpr)).To(Succeed())
+}
+
+func TestRemoteDependency(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+	}
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	}
+
+	local := cuev1alpha1.DependencyReference{
+		CrossNamespaceDependencyReference: dependency.CrossNamespaceDependencyReference{Name: "crds"},
+	}
+	remote := local
+	remote.KubeConfig = &cuev1alpha1.KubeConfig{SecretRef: meta.LocalObjectReference{Name: "spoke"}}
+	instance.Spec.DependsOn = []cuev1alpha1.DependencyReference{local, remote}
+
+	g.Expect(remote.IsRemote()).To(BeTrue())
+	g.Expect(dependencyName(remote, "default/crds")).To(Equal("default/crds@spoke"))
+	g.Expect(dependencyName(local, "default/crds")).To(Equal("default/crds"))
+
+	// the remote dependencies are not sorted with the local ones
+	_, deps := instance.GetDependsOn()
+	g.Expect(deps).To(HaveLen(1))
+
+	reader, err := r.dependencyReader(context.TODO(), instance, local)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reader).To(Equal(r.Client))
+
+	_, err = r.dependencyReader(context.TODO(), instance, remote)
+	g.Expect(err).To(MatchError(ContainSubstring("unable to connect to cluster 'spoke' of dependency 'crds'")))
+}
+
+func TestDependencyAccess(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "other"},
+		}).Build(),
+		NoCrossNamespaceRefs: true,
+	}
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+	}
+	dep := cuev1alpha1.DependencyReference{
+		CrossNamespaceDependencyReference: dependency.CrossNamespaceDependencyReference{Name: "credentials", Namespace: "other"},
+		APIVersion:                        "v1",
+		Kind:                              "Secret",
+		ReadyExpr:                         `has(status.phase)`,
+	}
+
+	instance.Spec.DependsOn = []cuev1alpha1.DependencyReference{dep}
+	err := r.checkDependencies(context.TODO(), nil, instance)
+	g.Expect(err).To(MatchError(ContainSubstring("can't access dependency 'other/credentials', cross-namespace references have been blocked")))
+
+	r.NoCrossNamespaceRefs = false
+	err = r.checkDependencies(context.TODO(), nil, instance)
+	g.Expect(err).To(MatchError(ContainSubstring("does not meet the ready expression")))
+
+	// without a service account the dependencies are read with the controller permissions
+	reader, err := r.dependencyReader(context.TODO(), instance, dep)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reader).To(Equal(r.Client))
+
+	t.Run("the existence of arbitrary objects is not exposed across namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r.NoCrossNamespaceRefs = true
+		exists := dep
+		exists.ReadyExpr = ""
+		exists.Check = cuev1alpha1.DependencyExistsCheck
+		instance.Spec.DependsOn = []cuev1alpha1.DependencyReference{exists}
+		g.Expect(r.checkDependencies(context.TODO(), nil, instance)).To(MatchError(ContainSubstring("cross-namespace references have been blocked")))
+
+		// the CueInstances in other namespaces can still be waited for
+		g.Expect(r.checkDependencyAccess(instance, cuev1alpha1.DependencyReference{
+			CrossNamespaceDependencyReference: dependency.CrossNamespaceDependencyReference{Name: "infra", Namespace: "other"},
+		})).To(Succeed())
+	})
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io"
+
+	"github.com/fluxcd/pkg/ssa"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxPendingChanges is the maximum number of pending changes recorded in the status.
+const maxPendingChanges = 100
+
+// dryRunCluster computes the changes the reconciliation would make to the
+// cluster without mutating it: the objects are diffed with a server-side
+// apply dry-run and the stale objects of the inventory are listed.
+// The unified diffs of the drifted objects are written to diffs, if not nil.
+func (r *CueInstanceReconciler) dryRunCluster(ctx context.Context,
+	resourceManager *ssa.ResourceManager,
+	cueInstance cuev1alpha1.CueInstance,
+	in clusterReconcile,
+	objects []*unstructured.Unstructured,
+	diffs io.Writer,
+) ([]cuev1alpha1.PendingChange, error) {
+	if err := ssa.SetNativeKindsDefaults(objects); err != nil {
+		return nil, err
+	}
+
+	objects, skipped, err := selectObjectsToApply(ctx, resourceManager.Client(), objects, func(obj *unstructured.Unstructured) applyMode {
+		return objectApplyMode(cueInstance, obj)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diffOpts := ssa.DefaultDiffOptions()
+	diffOpts.Exclusions = ApplyExclusions()
+
+	var changes []cuev1alpha1.PendingChange
+	changeSet := ssa.NewChangeSet()
+	changeSet.Append(skipped)
+	for _, obj := range objects {
+		entry, live, dryRun, err := resourceManager.Diff(ctx, obj, diffOpts)
+		if err != nil {
+			// the kinds defined by the CRDs of the same object set are not known yet
+			if !apimeta.IsNoMatchError(err) {
+				return nil, err
+			}
+			entry = &ssa.ChangeSetEntry{
+				ObjMetadata:  object.UnstructuredToObjMetadata(obj),
+				GroupVersion: obj.GroupVersionKind().Version,
+				Subject:      ssa.FmtUnstructured(obj),
+				Action:       string(ssa.CreatedAction),
+			}
+		}
+		changeSet.Add(*entry)
+
+		switch ssa.Action(entry.Action) {
+		case ssa.CreatedAction, ssa.ConfiguredAction:
+			changes = append(changes, cuev1alpha1.PendingChange{
+				Subject: entry.Subject,
+				Action:  entry.Action,
+				Cluster: in.cluster,
+			})
+		}
+
+		if diffs != nil && live != nil && dryRun != nil {
+			if err := writePlanDiff(diffs, clusterMessage(in.cluster != "", in.cluster, entry.Subject), live, dryRun, cueInstance.Spec.SensitivePaths); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cueInstance.Spec.Prune && in.oldInventory != nil {
+		newInventory := NewInventory()
+		if err := AddObjectsToInventory(newInventory, changeSet, in.cluster); err != nil {
+			return nil, err
+		}
+		staleObjects, err := DiffInventory(FilterInventory(in.oldInventory, in.cluster), newInventory)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range staleObjects {
+			if ssa.AnyInMetadata(obj, PruneExclusions()) || r.excludedFromPrune(cueInstance, obj) {
+				continue
+			}
+			changes = append(changes, cuev1alpha1.PendingChange{
+				Subject: ssa.FmtUnstructured(obj),
+				Action:  string(ssa.DeletedAction),
+				Cluster: in.cluster,
+			})
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDryRunCluster(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	kubeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	resourceManager := ssa.NewResourceManager(kubeClient, nil, ssa.Owner{Field: "cue-controller", Group: cuev1alpha1.GroupVersion.Group})
+
+	stale := newTestObject("v1", "ConfigMap", "stale")
+	oldInventory := NewInventory()
+	g.Expect(AddObjectsToInventory(oldInventory, changeSetOf(stale), "")).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{Spec: cuev1alpha1.CueInstanceSpec{Prune: true}}
+	changes, err := (&CueInstanceReconciler{}).dryRunCluster(context.TODO(), resourceManager, cueInstance,
+		clusterReconcile{oldInventory: oldInventory},
+		[]*unstructured.Unstructured{newTestObject("example.com/v1", "Widget", "app")},
+		nil,
+	)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(changes).To(Equal([]cuev1alpha1.PendingChange{
+		{Subject: "Widget/default/app", Action: "created"},
+		{Subject: "ConfigMap/default/stale", Action: "deleted"},
+	}))
+}
+
+func changeSetOf(objects ...*unstructured.Unstructured) *ssa.ChangeSet {
+	changeSet := ssa.NewChangeSet()
+	for _, obj := range objects {
+		changeSet.Add(ssa.ChangeSetEntry{
+			ObjMetadata:  object.UnstructuredToObjMetadata(obj),
+			GroupVersion: obj.GroupVersionKind().Version,
+			Subject:      ssa.FmtUnstructured(obj),
+			Action:       string(ssa.CreatedAction),
+		})
+	}
+	return changeSet
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// minRedactedLength is the minimum length of the sensitive values redacted
+// from the messages, shorter values would mask unrelated parts of them.
+const minRedactedLength = 4
+
+// MaskSensitiveData returns a copy of the object with the values of the Secret
+// data and of the fields matching the sensitive paths replaced by a mask.
+// The paths are dot separated field names, where '*' matches any field or
+// list item, e.g. 'spec.values.*.password'.
+func MaskSensitiveData(obj *unstructured.Unstructured, paths []string) *unstructured.Unstructured {
+	masked := maskSecretData(obj)
+	if len(paths) == 0 {
+		return masked
+	}
+
+	if masked == obj {
+		masked = obj.DeepCopy()
+	}
+	for _, path := range paths {
+		maskPath(masked.Object, strings.Split(path, "."))
+	}
+	return masked
+}
+
+// maskPath replaces the scalar values found at the path within v by secretMask.
+func maskPath(v interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+
+	segment, last := segments[0], len(segments) == 1
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			if segment != "*" && segment != k {
+				continue
+			}
+			if last {
+				t[k] = maskValue(item)
+			} else {
+				maskPath(item, segments[1:])
+			}
+		}
+	case []interface{}:
+		if segment != "*" {
+			return
+		}
+		for i, item := range t {
+			if last {
+				t[i] = maskValue(item)
+			} else {
+				maskPath(item, segments[1:])
+			}
+		}
+	}
+}
+
+// maskValue returns v with all its scalar values replaced by secretMask.
+func maskValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = maskValue(item)
+		}
+		return t
+	case []interface{}:
+		for i, item := range t {
+			t[i] = maskValue(item)
+		}
+		return t
+	case nil:
+		return nil
+	default:
+		return secretMask
+	}
+}
+
+// sensitiveValues returns the values of the Secret data and of the fields
+// matching the sensitive paths of the Kubernetes objects found in v.
+func sensitiveValues(v cue.Value, paths []string) []string {
+	values := map[string]bool{}
+	collectSensitiveValues(v, paths, values)
+
+	result := make([]string, 0, len(values))
+	for value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+// sensitiveTagValues returns the values of the sensitive tags of the spec.
+func sensitiveTagValues(spec cuev1alpha1.CueInstanceSpec) []string {
+	values := map[string]bool{}
+	for _, tags := range [][]cuev1alpha1.TagVar{spec.Tags, spec.TagVars} {
+		for _, t := range tags {
+			if t.IsSensitive() {
+				addSensitiveValue(values, t.Value)
+			}
+		}
+	}
+
+	result := make([]string, 0, len(values))
+	for value := range values {
+		result = append(result, value)
+	}
+	return result
+}
+
+func collectSensitiveValues(v cue.Value, paths []string, values map[string]bool) {
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		kind, _ := v.LookupPath(cue.ParsePath("kind")).String()
+		apiVersion, _ := v.LookupPath(cue.ParsePath("apiVersion")).String()
+		if kind != "" && apiVersion != "" {
+			if kind == "Secret" && apiVersion == "v1" {
+				collectScalars(v.LookupPath(cue.ParsePath("data")), values, true)
+				collectScalars(v.LookupPath(cue.ParsePath("stringData")), values, false)
+			}
+			for _, path := range paths {
+				collectPath(v, strings.Split(path, "."), values)
+			}
+			return
+		}
+
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectSensitiveValues(iter.Value(), paths, values)
+		}
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectSensitiveValues(iter.Value(), paths, values)
+		}
+	}
+}
+
+// collectPath collects the scalar values found at the path within v.
+func collectPath(v cue.Value, segments []string, values map[string]bool) {
+	if len(segments) == 0 {
+		collectScalars(v, values, false)
+		return
+	}
+
+	segment := segments[0]
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		if segment != "*" {
+			collectPath(v.LookupPath(cue.MakePath(cue.Str(segment))), segments[1:], values)
+			return
+		}
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectPath(iter.Value(), segments[1:], values)
+		}
+	case cue.ListKind:
+		if segment != "*" {
+			return
+		}
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectPath(iter.Value(), segments[1:], values)
+		}
+	}
+}
+
+// collectScalars collects the concrete strings of v, decoding them
+// as well when they are base64 encoded.
+func collectScalars(v cue.Value, values map[string]bool, encoded bool) {
+	if !v.Exists() {
+		return
+	}
+
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectScalars(iter.Value(), values, encoded)
+		}
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			collectScalars(iter.Value(), values, encoded)
+		}
+	case cue.StringKind:
+		s, err := v.String()
+		if err != nil {
+			return
+		}
+		addSensitiveValue(values, s)
+		if encoded {
+			if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+				addSensitiveValue(values, string(decoded))
+			}
+		}
+	}
+}
+
+func addSensitiveValue(values map[string]bool, s string) {
+	if len(s) >= minRedactedLength {
+		values[s] = true
+	}
+}
+
+// redactValues replaces the sensitive values within msg by secretMask.
+func redactValues(msg string, values []string) string {
+	// replace the longest values first, in case they contain shorter ones
+	sorted := append([]string(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	for _, value := range sorted {
+		msg = strings.ReplaceAll(msg, value, secretMask)
+	}
+	return msg
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func TestMaskSensitiveData(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newTestObject("example.com/v1", "Database", "app")
+	obj.Object["spec"] = map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "admin", "password": "hunter2"},
+		},
+		"connection": map[string]interface{}{"host": "db", "port": int64(5432)},
+	}
+
+	masked := MaskSensitiveData(obj, []string{"spec.users.*.password", "spec.connection"})
+	g.Expect(masked.Object["spec"]).To(Equal(map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "admin", "password": secretMask},
+		},
+		"connection": map[string]interface{}{"host": secretMask, "port": secretMask},
+	}))
+	// the object is left untouched
+	g.Expect(obj.Object["spec"].(map[string]interface{})["connection"]).To(HaveKeyWithValue("host", "db"))
+
+	secret := newTestObject("v1", "Secret", "credentials")
+	secret.Object["data"] = map[string]interface{}{"token": "c2VjcmV0"}
+	g.Expect(MaskSensitiveData(secret, nil).Object["data"]).To(Equal(map[string]interface{}{"token": secretMask}))
+}
+
+func TestBuildInstance_RedactsSensitiveValues(t *testing.T) {
+	g := NewWithT(t)
+
+	root := writeCueModule(t, `package app
+
+#Secret: {
+	stringData: [string]: =~"^[a-z]+$"
+	...
+}
+#Database: {
+	spec: password: =~"^[a-z]+$"
+	...
+}
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "Secret"
+	metadata: name: "credentials"
+	stringData: token: "S3cr3t-T0ken"
+}, {
+	apiVersion: "example.com/v1"
+	kind:       "Database"
+	metadata: name: "app"
+	spec: password: "Hunter-2"
+}]
+`)
+
+	for expr, schema := range map[string]string{"objects[0]": "#Secret", "objects[1]": "#Database"} {
+		result, err := buildInstance(BuildRequest{
+			Root: root,
+			Dir:  root,
+			Spec: cuev1alpha1.CueInstanceSpec{
+				Exprs:          []string{expr},
+				SensitivePaths: []string{"spec.password"},
+				Validate: &cuev1alpha1.Validation{
+					Mode:   cuev1alpha1.AuditPolicy,
+					Schema: schema,
+					Type:   "cue",
+				},
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.Validation).NotTo(BeEmpty())
+		for _, v := range result.Validation {
+			g.Expect(v.Message).NotTo(Or(ContainSubstring("S3cr3t-T0ken"), ContainSubstring("Hunter-2")))
+			g.Expect(strings.Contains(v.Message, secretMask)).To(BeTrue(), v.Message)
+		}
+	}
+}
+
+func TestBuildInstance_RedactsSensitiveTags(t *testing.T) {
+	g := NewWithT(t)
+
+	root := writeCueModule(t, `package app
+
+apiToken: string @tag(token)
+password: string @tag(password)
+
+objects: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+	data: token: apiToken & =~"^[a-z]+$"
+}]
+`)
+
+	_, err := buildInstance(BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Tags: []cuev1alpha1.TagVar{
+				{Name: "token", Value: "T0ken-Value", Sensitive: true},
+				{Name: "password", Value: "Passw0rd", ValueFrom: &cuev1alpha1.TagVarSource{Kind: "Secret", Name: "db", Key: "password"}},
+			},
+		},
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).NotTo(ContainSubstring("T0ken-Value"))
+	g.Expect(err.Error()).To(ContainSubstring(secretMask))
+
+	g.Expect(sensitiveTagValues(cuev1alpha1.CueInstanceSpec{
+		Tags: []cuev1alpha1.TagVar{
+			{Name: "token", Value: "T0ken-Value", Sensitive: true},
+			{Name: "password", Value: "Passw0rd", ValueFrom: &cuev1alpha1.TagVarSource{Kind: "Secret", Name: "db", Key: "password"}},
+			{Name: "env", Value: "production"},
+		},
+	})).To(ConsistOf("T0ken-Value", "Passw0rd"))
+}
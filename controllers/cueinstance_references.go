@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	secretIndexKey    string = ".metadata.secrets"
+	configMapIndexKey string = ".metadata.configMaps"
+)
+
+// indexSecretRefs returns the names of the Secrets referenced by the CueInstance.
+func (r *CueInstanceReconciler) indexSecretRefs(o client.Object) []string {
+	k, ok := o.(*cuev1alpha1.CueInstance)
+	if !ok {
+		panic(fmt.Sprintf("Expected a CueInstance, got %T", o))
+	}
+
+	var names []string
+	if k.Spec.KubeConfig != nil {
+		names = append(names, k.Spec.KubeConfig.SecretRef.Name)
+	}
+	for _, kc := range k.Spec.KubeConfigs {
+		names = append(names, kc.SecretRef.Name)
+	}
+	names = append(names, tagSourceNames(k.Spec, "Secret")...)
+	return uniqueNames(names)
+}
+
+// indexConfigMapRefs returns the names of the ConfigMaps referenced by the CueInstance.
+func (r *CueInstanceReconciler) indexConfigMapRefs(o client.Object) []string {
+	k, ok := o.(*cuev1alpha1.CueInstance)
+	if !ok {
+		panic(fmt.Sprintf("Expected a CueInstance, got %T", o))
+	}
+
+	names := tagSourceNames(k.Spec, "ConfigMap")
+	if k.Spec.ExprsFrom != nil {
+		names = append(names, k.Spec.ExprsFrom.Name)
+	}
+	for _, p := range k.Spec.Policies {
+		if p.RuleFrom != nil {
+			names = append(names, p.RuleFrom.Name)
+		}
+	}
+	return uniqueNames(names)
+}
+
+// requestsForReferenceOf enqueues the CueInstances in the namespace of
+// the object which reference it according to the given index.
+func (r *CueInstanceReconciler) requestsForReferenceOf(indexKey string) func(obj client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		var list cuev1alpha1.CueInstanceList
+		if err := r.List(context.Background(), &list,
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{indexKey: obj.GetName()},
+		); err != nil {
+			return nil
+		}
+
+		reqs := make([]reconcile.Request, len(list.Items))
+		for i := range list.Items {
+			reqs[i].NamespacedName = client.ObjectKeyFromObject(&list.Items[i])
+		}
+		return reqs
+	}
+}
+
+// tagSourceNames returns the names of the objects of the given kind
+// from which the values of the tags and tag variables are sourced.
+func tagSourceNames(spec cuev1alpha1.CueInstanceSpec, kind string) []string {
+	var names []string
+	for _, tags := range [][]cuev1alpha1.TagVar{spec.Tags, spec.TagVars} {
+		for _, t := range tags {
+			if t.ValueFrom != nil && t.ValueFrom.Kind == kind {
+				names = append(names, t.ValueFrom.Name)
+			}
+		}
+	}
+	return names
+}
+
+func uniqueNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReferenceIndexes(t *testing.T) {
+	g := NewWithT(t)
+
+	tag := func(name, kind, ref string) cuev1alpha1.TagVar {
+		return cuev1alpha1.TagVar{
+			Name:      name,
+			ValueFrom: &cuev1alpha1.TagVarSource{Kind: kind, Name: ref, Key: name},
+		}
+	}
+
+	instance := &cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			KubeConfig: &cuev1alpha1.KubeConfig{SecretRef: meta.LocalObjectReference{Name: "staging"}},
+			KubeConfigs: []cuev1alpha1.KubeConfig{
+				{SecretRef: meta.LocalObjectReference{Name: "staging"}},
+				{SecretRef: meta.LocalObjectReference{Name: "production"}},
+			},
+			Tags:      []cuev1alpha1.TagVar{tag("token", "Secret", "credentials"), {Name: "debug"}},
+			TagVars:   []cuev1alpha1.TagVar{tag("env", "ConfigMap", "settings")},
+			ExprsFrom: &cuev1alpha1.ExpressionsSource{Name: "selectors", Key: "standard"},
+		},
+	}
+
+	r := &CueInstanceReconciler{}
+	g.Expect(r.indexSecretRefs(instance)).To(Equal([]string{"staging", "production", "credentials"}))
+	g.Expect(r.indexConfigMapRefs(instance)).To(Equal([]string{"settings", "selectors"}))
+	g.Expect(r.indexConfigMapRefs(&cuev1alpha1.CueInstance{})).To(BeEmpty())
+
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/fluxcd/pkg/runtime/events"
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/open-policy-agent/opa/rego"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// defaultRegoNamespace is the Rego package of the rules evaluated by default.
+const defaultRegoNamespace = "main"
+
+// regoResult holds the messages returned by the rules for a single object.
+type regoResult struct {
+	subject  string
+	failures []string
+	warnings []string
+}
+
+// enforceRegoPolicies evaluates the Rego policies of the source artifact
+// against the objects, emits an event for each warning and for each audited,
+// warned or dropped failure, and returns the objects which are not dropped
+// together with the failures reported as warnings. The failures are recorded
+// in the report.
+func (r *CueInstanceReconciler) enforceRegoPolicies(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision, artifactDir string,
+	objects []*unstructured.Unstructured,
+	report *validationReport,
+) ([]*unstructured.Unstructured, []string, error) {
+	policies := cueInstance.Spec.RegoPolicies
+	if policies == nil {
+		return objects, nil, nil
+	}
+
+	dir, err := securejoin.SecureJoin(artifactDir, policies.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, nil, fmt.Errorf("rego policies path not found: %w", err)
+	}
+
+	queries, err := prepareRegoQueries(ctx, dir, policies.Namespaces)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := make([]*unstructured.Unstructured, 0, len(objects))
+	var failures, warnings []string
+	for _, obj := range objects {
+		result, err := evalRegoQueries(ctx, queries, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, msg := range result.warnings {
+			r.event(ctx, cueInstance, revision, events.EventSeverityInfo,
+				fmt.Sprintf("%s: rego policy warning: %s", result.subject, msg), nil)
+		}
+
+		if len(result.failures) == 0 {
+			kept = append(kept, obj)
+			continue
+		}
+
+		action, err := validationModeOverride(obj.GetAnnotations()[cuev1alpha1.ValidationModeAnnotation], policies.Action)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", result.subject, err)
+		}
+		for _, msg := range result.failures {
+			report.add(result.subject, "rego", action, msg)
+		}
+
+		switch action {
+		case cuev1alpha1.IgnorePolicy:
+			kept = append(kept, obj)
+		case cuev1alpha1.AuditPolicy, cuev1alpha1.DropPolicy:
+			for _, msg := range result.failures {
+				r.event(ctx, cueInstance, revision, events.EventSeverityInfo,
+					fmt.Sprintf("%s: rego policy violation: %s", result.subject, msg), nil)
+			}
+			if action == cuev1alpha1.AuditPolicy {
+				kept = append(kept, obj)
+			}
+		case cuev1alpha1.WarnPolicy:
+			for _, msg := range result.failures {
+				msg = fmt.Sprintf("%s: rego policy violation: %s", result.subject, msg)
+				r.event(ctx, cueInstance, revision, events.EventSeverityInfo, msg, nil)
+				warnings = append(warnings, msg)
+			}
+			kept = append(kept, obj)
+		default:
+			for _, msg := range result.failures {
+				failures = append(failures, fmt.Sprintf("%s: %s", result.subject, msg))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return nil, nil, fmt.Errorf("%w: %d rego policy violations: %s",
+			errPolicyViolation, len(failures), summarize(failures, maxPolicyViolations))
+	}
+
+	return kept, warnings, nil
+}
+
+// prepareRegoQueries compiles the .rego files of dir and prepares a query
+// for each of the given Rego namespaces.
+func prepareRegoQueries(ctx context.Context, dir string, namespaces []string) ([]rego.PreparedEvalQuery, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{defaultRegoNamespace}
+	}
+
+	// only load the policies, the other files of the artifact are not data documents
+	onlyRego := func(abspath string, info os.FileInfo, depth int) bool {
+		return !info.IsDir() && filepath.Ext(info.Name()) != ".rego"
+	}
+
+	queries := make([]rego.PreparedEvalQuery, 0, len(namespaces))
+	for _, ns := range namespaces {
+		query, err := rego.New(
+			rego.Query("data."+ns),
+			rego.Load([]string{dir}, onlyRego),
+		).PrepareForEval(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compile the rego policies: %w", err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// evalRegoQueries evaluates the rules of the queries with the object as input
+// and collects the messages of the deny, violation and warn rules.
+func evalRegoQueries(ctx context.Context, queries []rego.PreparedEvalQuery, obj *unstructured.Unstructured) (regoResult, error) {
+	result := regoResult{subject: ssa.FmtObjMetadata(object.UnstructuredToObjMetadata(obj))}
+
+	for _, query := range queries {
+		rs, err := query.Eval(ctx, rego.EvalInput(obj.Object))
+		if err != nil {
+			return result, fmt.Errorf("rego policy evaluation failed for %s: %w", result.subject, err)
+		}
+
+		for _, r := range rs {
+			for _, expr := range r.Expressions {
+				rules, ok := expr.Value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				names := make([]string, 0, len(rules))
+				for name := range rules {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					switch {
+					case isRegoRule(name, "deny"), isRegoRule(name, "violation"):
+						result.failures = append(result.failures, regoMessages(rules[name])...)
+					case isRegoRule(name, "warn"):
+						result.warnings = append(result.warnings, regoMessages(rules[name])...)
+					}
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// isRegoRule reports whether name is the rule prefix or starts with 'prefix_'.
+func isRegoRule(name, prefix string) bool {
+	return name == prefix || strings.HasPrefix(name, prefix+"_")
+}
+
+// regoMessages returns the messages of a rule, which are either
+// strings or objects with a 'msg' field.
+func regoMessages(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	messages := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			messages = append(messages, v)
+		case map[string]interface{}:
+			if msg, ok := v["msg"].(string); ok {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	return messages
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEvalRegoQueries(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "policy.rego"), []byte(`package main
+
+deny[msg] {
+	input.kind == "Service"
+	input.spec.type == "LoadBalancer"
+	msg := "load balancers are not allowed"
+}
+
+violation_labels[{"msg": msg}] {
+	not input.metadata.labels.team
+	msg := "objects must have a team label"
+}
+
+warn[msg] {
+	input.kind == "ConfigMap"
+	msg := "prefer immutable config maps"
+}
+`), 0o644)).To(Succeed())
+	// files which are not policies are ignored
+	g.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte("# policies"), 0o644)).To(Succeed())
+
+	queries, err := prepareRegoQueries(context.TODO(), dir, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	service := newTestObject("v1", "Service", "public")
+	service.Object["spec"] = map[string]interface{}{"type": "LoadBalancer"}
+	result, err := evalRegoQueries(context.TODO(), queries, service)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.subject).To(Equal("Service/default/public"))
+	g.Expect(result.failures).To(Equal([]string{"load balancers are not allowed", "objects must have a team label"}))
+	g.Expect(result.warnings).To(BeEmpty())
+
+	configMap := newTestObject("v1", "ConfigMap", "settings")
+	configMap.SetLabels(map[string]string{"team": "apps"})
+	result, err = evalRegoQueries(context.TODO(), queries, configMap)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.failures).To(BeEmpty())
+	g.Expect(result.warnings).To(Equal([]string{"prefer immutable config maps"}))
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// readObjects converts the manifests rendered for the CueInstance into
+// Kubernetes objects, renamed according to the name prefix and suffix
+// and including the namespaces the controller creates.
+func readObjects(cueInstance cuev1alpha1.CueInstance, manifests []byte) ([]*unstructured.Unstructured, error) {
+	objects, err := decodeObjects(bytes.NewReader(manifests))
+	if err != nil {
+		return nil, err
+	}
+
+	transformNames(objects, cueInstance.Spec.NamePrefix, cueInstance.Spec.NameSuffix)
+
+	if cueInstance.Spec.CreateNamespace {
+		objects = append(objects, missingNamespaces(objects)...)
+	}
+
+	return objects, nil
+}
+
+// decodeObjects reads the Kubernetes objects of a multi-doc YAML or JSON stream.
+// Documents which are arrays or List kinds are flattened into their items,
+// at any depth, and documents which are not Kubernetes objects are skipped.
+func decodeObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	reader := yamlutil.NewYAMLOrJSONDecoder(r, 2048)
+	objects := make([]*unstructured.Unstructured, 0)
+
+	for {
+		var doc json.RawMessage
+		if err := reader.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return objects, err
+		}
+
+		var err error
+		objects, err = appendObjects(objects, doc)
+		if err != nil {
+			return objects, err
+		}
+	}
+
+	return objects, nil
+}
+
+func appendObjects(objects []*unstructured.Unstructured, doc json.RawMessage) ([]*unstructured.Unstructured, error) {
+	doc = bytes.TrimSpace(doc)
+	if len(doc) == 0 || bytes.Equal(doc, []byte("null")) {
+		return objects, nil
+	}
+
+	if doc[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(doc, &items); err != nil {
+			return objects, err
+		}
+		for _, item := range items {
+			var err error
+			objects, err = appendObjects(objects, item)
+			if err != nil {
+				return objects, err
+			}
+		}
+		return objects, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(doc); err != nil {
+		return objects, err
+	}
+
+	if obj.IsList() {
+		items, _, err := unstructured.NestedSlice(obj.Object, "items")
+		if err != nil {
+			return objects, err
+		}
+		data, err := json.Marshal(items)
+		if err != nil {
+			return objects, err
+		}
+		return appendObjects(objects, data)
+	}
+
+	if ssa.IsKubernetesObject(obj) && !ssa.IsKustomization(obj) {
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// RenderInstance builds the CUE instance described by req and returns the
+// objects the controller applies on behalf of the CueInstance for the given
+// revision, in the order in which they are applied.
+func RenderInstance(req BuildRequest, cueInstance cuev1alpha1.CueInstance, revision string) ([]*unstructured.Unstructured, error) {
+	result, err := buildMatrix(req, buildInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range result.Validation {
+		if v.Mode == cuev1alpha1.FailPolicy {
+			return nil, fmt.Errorf(v.Message)
+		}
+	}
+
+	objects, err := readObjects(cueInstance, result.Manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeIgnoredPaths(objects, cueInstance.Spec.IgnorePaths); err != nil {
+		return nil, err
+	}
+
+	resourceManager := ssa.NewResourceManager(nil, nil, ssa.Owner{
+		Group: cuev1alpha1.GroupVersion.Group,
+	})
+	resourceManager.SetOwnerLabels(objects, cueInstance.GetName(), cueInstance.GetNamespace())
+
+	if cueInstance.Spec.ProgressiveDelivery != nil {
+		if err := setCanaryMetadata(objects, revision); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ssa.SetNativeKindsDefaults(objects); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(ssa.SortableUnstructureds(objects))
+	return objects, nil
+}
+
+// ParseExpressions returns the CUE expressions listed in data, one per line.
+func ParseExpressions(data string) []string {
+	var exprs []string
+	for _, line := range strings.Split(data, "\n") {
+		if expr := strings.TrimSpace(line); expr != "" {
+			exprs = append(exprs, expr)
+		}
+	}
+	return exprs
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReadObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests := []byte(`apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+  data:
+    replicas: "1"
+- apiVersion: v1
+  kind: List
+  items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: b
+---
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: c
+- - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: d
+---
+---
+[{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "e"}, "spec": {"replicas": 2}}]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: f
+`)
+
+	objects, err := readObjects(cuev1alpha1.CueInstance{}, manifests)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{"a", "b", "c", "d", "e", "f"}))
+
+	replicas, found, err := unstructured.NestedInt64(objects[4].Object, "spec", "replicas")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(found).To(BeTrue())
+	g.Expect(replicas).To(Equal(int64(2)))
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// maxReportResults is the maximum number of results listed in a ValidationReport,
+// the summary counts all of them.
+const maxReportResults = 1000
+
+// validationReport collects the results of the validations of a reconciliation.
+// A nil report discards them.
+type validationReport struct {
+	results []cuev1alpha1.ValidationResult
+}
+
+// add records a failed validation of subject according to the mode in effect.
+func (vr *validationReport) add(subject, source string, mode cuev1alpha1.ValidationMode, message string) {
+	if vr == nil || mode == cuev1alpha1.IgnorePolicy {
+		return
+	}
+
+	result := cuev1alpha1.FailResult
+	switch mode {
+	case cuev1alpha1.AuditPolicy:
+		result = cuev1alpha1.AuditResult
+	case cuev1alpha1.WarnPolicy:
+		result = cuev1alpha1.WarnResult
+	case cuev1alpha1.DropPolicy:
+		result = cuev1alpha1.DropResult
+	}
+
+	vr.results = append(vr.results, cuev1alpha1.ValidationResult{
+		Subject: subject,
+		Source:  source,
+		Result:  result,
+		Message: message,
+	})
+}
+
+// spec returns the report of the validations, the objects without
+// any failed validation are listed as passing.
+func (vr *validationReport) spec(revision string, objects []*unstructured.Unstructured) cuev1alpha1.ValidationReportSpec {
+	results := append([]cuev1alpha1.ValidationResult{}, vr.results...)
+
+	failed := make(map[string]bool, len(results))
+	for _, result := range results {
+		failed[result.Subject] = true
+	}
+	for _, obj := range objects {
+		subject := ssa.FmtUnstructured(obj)
+		if !failed[subject] {
+			results = append(results, cuev1alpha1.ValidationResult{
+				Subject: subject,
+				Result:  cuev1alpha1.PassResult,
+			})
+		}
+	}
+
+	spec := cuev1alpha1.ValidationReportSpec{Revision: revision}
+	for _, result := range results {
+		switch result.Result {
+		case cuev1alpha1.PassResult:
+			spec.Summary.Pass++
+		case cuev1alpha1.FailResult:
+			spec.Summary.Fail++
+		case cuev1alpha1.DropResult:
+			spec.Summary.Drop++
+		case cuev1alpha1.WarnResult:
+			spec.Summary.Warn++
+		case cuev1alpha1.AuditResult:
+			spec.Summary.Audit++
+		}
+	}
+
+	if len(results) > maxReportResults {
+		results = results[:maxReportResults]
+	}
+	spec.Results = results
+	return spec
+}
+
+// writeValidationReport creates or updates the ValidationReport of the
+// CueInstance, owned by it, when validation reports are enabled.
+// Failing to write the report doesn't fail the reconciliation.
+func (r *CueInstanceReconciler) writeValidationReport(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	revision string,
+	report *validationReport,
+	objects []*unstructured.Unstructured,
+) {
+	if !r.ValidationReports || report == nil {
+		return
+	}
+
+	vr := &cuev1alpha1.ValidationReport{}
+	vr.SetName(cueInstance.GetName())
+	vr.SetNamespace(cueInstance.GetNamespace())
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, vr, func() error {
+		vr.Spec = report.spec(revision, objects)
+		return controllerutil.SetControllerReference(&cueInstance, vr, r.Scheme)
+	})
+	if err != nil {
+		ctrl.LoggerFrom(ctx).Error(err, "unable to write the validation report")
+	}
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestWriteValidationReport(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	r := &CueInstanceReconciler{
+		Client:            fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme:            scheme,
+		ValidationReports: true,
+	}
+
+	report := &validationReport{}
+	report.add("expression 'out'", "schema", cuev1alpha1.AuditPolicy, "replicas: invalid value 5")
+	report.add("Service/default/public", "policy/no-load-balancers", cuev1alpha1.DropPolicy, "load balancers are not allowed")
+	report.add("ConfigMap/default/settings", "rego", cuev1alpha1.WarnPolicy, "prefer immutable config maps")
+	report.add("ConfigMap/default/settings", "rego", cuev1alpha1.IgnorePolicy, "ignored")
+
+	objects := []*unstructured.Unstructured{
+		newTestObject("v1", "ConfigMap", "settings"),
+		newTestObject("v1", "Service", "internal"),
+	}
+	r.writeValidationReport(context.TODO(), cueInstance, "main/abc", report, objects)
+
+	var vr cuev1alpha1.ValidationReport
+	g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: "default"}, &vr)).To(Succeed())
+	g.Expect(vr.Spec.Revision).To(Equal("main/abc"))
+	g.Expect(vr.Spec.Summary).To(Equal(cuev1alpha1.ValidationSummary{Pass: 1, Drop: 1, Warn: 1, Audit: 1}))
+	g.Expect(vr.Spec.Results).To(HaveLen(4))
+	g.Expect(vr.Spec.Results[3]).To(Equal(cuev1alpha1.ValidationResult{
+		Subject: "Service/default/internal",
+		Result:  cuev1alpha1.PassResult,
+	}))
+	g.Expect(vr.GetOwnerReferences()).To(HaveLen(1))
+	g.Expect(vr.GetOwnerReferences()[0].Name).To(Equal("app"))
+
+	// the report is replaced on the next reconciliation
+	r.writeValidationReport(context.TODO(), cueInstance, "main/def", &validationReport{}, objects)
+	g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: "default"}, &vr)).To(Succeed())
+	g.Expect(vr.Spec.Revision).To(Equal("main/def"))
+	g.Expect(vr.Spec.Summary).To(Equal(cuev1alpha1.ValidationSummary{Pass: 2}))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/object"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// ApplyExclusions returns the labels and annotations which exclude
+// a live object from being applied.
+func ApplyExclusions() map[string]string {
+	return map[string]string{
+		fmt.Sprintf("%s/reconcile", cuev1alpha1.GroupVersion.Group): cuev1alpha1.DisabledValue,
+		cuev1alpha1.ManagedAnnotation:                               "false",
+	}
+}
+
+// PruneExclusions returns the labels and annotations which exclude
+// an object from garbage collection.
+func PruneExclusions() map[string]string {
+	return map[string]string{
+		fmt.Sprintf("%s/prune", cuev1alpha1.GroupVersion.Group):     cuev1alpha1.DisabledValue,
+		fmt.Sprintf("%s/reconcile", cuev1alpha1.GroupVersion.Group): cuev1alpha1.DisabledValue,
+		cuev1alpha1.ManagedAnnotation:                               "false",
+	}
+}
+
+// retainedObjects returns the inventory entries of the objects which have
+// garbage collection disabled in their rendered metadata.
+func retainedObjects(inv *cuev1alpha1.ResourceInventory, objects []*unstructured.Unstructured) []cuev1alpha1.ResourceRef {
+	exclusions := PruneExclusions()
+	retained := map[string]bool{}
+	for _, obj := range objects {
+		if ssa.AnyInMetadata(obj, exclusions) {
+			retained[object.UnstructuredToObjMetadata(obj).String()] = true
+		}
+	}
+	if len(retained) == 0 {
+		return nil
+	}
+
+	var refs []cuev1alpha1.ResourceRef
+	for _, entry := range inv.Entries {
+		if retained[entry.ID] {
+			refs = append(refs, entry)
+		}
+	}
+	return refs
+}
+
+// filterRetained returns the objects of the given cluster which are listed as retained.
+func filterRetained(retained []cuev1alpha1.ResourceRef, cluster string, objects []*unstructured.Unstructured) []*unstructured.Unstructured {
+	ids := map[string]bool{}
+	for _, ref := range retained {
+		if ref.Cluster == cluster {
+			ids[ref.ID] = true
+		}
+	}
+
+	var result []*unstructured.Unstructured
+	for _, obj := range objects {
+		if ids[object.UnstructuredToObjMetadata(obj).String()] {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
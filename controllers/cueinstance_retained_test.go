@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRetainedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	configMap := func(name string, annotations map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("default")
+		obj.SetName(name)
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+
+	objects := []*unstructured.Unstructured{
+		configMap("kept", map[string]string{cuev1alpha1.GroupVersion.Group + "/prune": cuev1alpha1.DisabledValue}),
+		configMap("pruned", nil),
+	}
+
+	inv := &cuev1alpha1.ResourceInventory{Entries: []cuev1alpha1.ResourceRef{
+		{ID: "default_kept__ConfigMap", Version: "v1"},
+		{ID: "default_pruned__ConfigMap", Version: "v1"},
+		{ID: "default_kept__ConfigMap", Version: "v1", Cluster: "staging"},
+	}}
+
+	retained := retainedObjects(inv, objects)
+	g.Expect(retained).To(Equal([]cuev1alpha1.ResourceRef{
+		{ID: "default_kept__ConfigMap", Version: "v1"},
+		{ID: "default_kept__ConfigMap", Version: "v1", Cluster: "staging"},
+	}))
+	g.Expect(retainedObjects(inv, objects[1:])).To(BeNil())
+
+	filtered := filterRetained(retained[1:], "staging", objects)
+	g.Expect(filtered).To(HaveLen(1))
+	g.Expect(filtered[0].GetName()).To(Equal("kept"))
+	g.Expect(filterRetained(retained[1:], "", objects)).To(BeEmpty())
+}
+
+func TestManagedAnnotationExclusions(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newTestObject("v1", "ConfigMap", "overridden")
+	g.Expect(ssa.AnyInMetadata(obj, ApplyExclusions())).To(BeFalse())
+	g.Expect(ssa.AnyInMetadata(obj, PruneExclusions())).To(BeFalse())
+
+	obj.SetAnnotations(map[string]string{cuev1alpha1.ManagedAnnotation: "false"})
+	g.Expect(ssa.AnyInMetadata(obj, ApplyExclusions())).To(BeTrue())
+	g.Expect(ssa.AnyInMetadata(obj, PruneExclusions())).To(BeTrue())
+
+	obj.SetAnnotations(map[string]string{cuev1alpha1.ManagedAnnotation: "true"})
+	g.Expect(ssa.AnyInMetadata(obj, ApplyExclusions())).To(BeFalse())
+}
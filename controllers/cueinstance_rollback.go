@@ -0,0 +1,112 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fluxcd/pkg/ssa"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// canRollback reports whether the cluster can be rolled back to the
+// snapshot once the health checks of the applied objects have failed.
+func canRollback(cueInstance cuev1alpha1.CueInstance, in clusterReconcile) bool {
+	return cueInstance.Spec.RollbackOnFailure && in.snapshot != nil && in.snapshot.checksum != in.checksum
+}
+
+// rollback re-applies the objects of the snapshot to the cluster and garbage
+// collects the objects of the failed inventory which are not part of it.
+func (r *CueInstanceReconciler) rollback(ctx context.Context,
+	manager *ssa.ResourceManager,
+	cueInstance *cuev1alpha1.CueInstance,
+	in clusterReconcile,
+	failedInventory *cuev1alpha1.ResourceInventory,
+) (*cuev1alpha1.ResourceInventory, error) {
+	objects := make([]*unstructured.Unstructured, len(in.snapshot.objects))
+	for i, obj := range in.snapshot.objects {
+		objects[i] = obj.DeepCopy()
+	}
+
+	if err := preserveIgnoredPaths(ctx, r.uncachedReader(manager.Client()), objects, cueInstance.Spec.IgnorePaths); err != nil {
+		return nil, err
+	}
+	manager.SetOwnerLabels(objects, cueInstance.GetName(), cueInstance.GetNamespace())
+	if cueInstance.Spec.ProgressiveDelivery != nil {
+		if err := setCanaryMetadata(objects, in.snapshot.revision); err != nil {
+			return nil, err
+		}
+	}
+
+	_, changeSet, err := r.apply(ctx, manager, *cueInstance, in.snapshot.revision, objects, in.force)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := NewInventory()
+	if err := AddObjectsToInventory(inventory, changeSet, in.cluster); err != nil {
+		return nil, err
+	}
+
+	staleObjects, err := DiffInventory(failedInventory, inventory)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.prune(ctx, manager, cueInstance, in.snapshot.revision, in.cluster, staleObjects); err != nil {
+		// keep track of the objects which may not have been deleted
+		applied := make(map[string]bool, len(inventory.Entries))
+		for _, entry := range inventory.Entries {
+			applied[entry.ID] = true
+		}
+		for _, entry := range failedInventory.Entries {
+			if !applied[entry.ID] {
+				inventory.Entries = append(inventory.Entries, entry)
+			}
+		}
+		return inventory, err
+	}
+	return inventory, nil
+}
+
+// rolledBack reports whether the objects are those of a revision
+// rolled back for the current generation of the CueInstance.
+func rolledBack(cueInstance cuev1alpha1.CueInstance, checksum string) bool {
+	return cueInstance.Spec.RollbackOnFailure &&
+		cueInstance.Status.RolledBackChecksum != "" &&
+		cueInstance.Status.RolledBackChecksum == checksum &&
+		cueInstance.Generation == cueInstance.Status.ObservedGeneration
+}
+
+// setRolledBackCondition records the rollback of the revision in the RolledBack condition.
+func setRolledBackCondition(cueInstance *cuev1alpha1.CueInstance, snapshotRevision, revision string, clusters []string) {
+	msg := fmt.Sprintf("Rolled back to revision %s after the health checks of revision %s failed", snapshotRevision, revision)
+	if len(clusters) > 0 {
+		msg = fmt.Sprintf("%s on clusters: %s", msg, summarize(clusters, maxPolicyViolations))
+	}
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, metav1.Condition{
+		Type:               cuev1alpha1.RolledBackCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             cuev1alpha1.HealthCheckFailedReason,
+		Message:            msg,
+		ObservedGeneration: cueInstance.Generation,
+	})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSnapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid"},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+
+	name := snapshotName(cueInstance, "0123456789abcdef")
+	g.Expect(name).To(Equal("app-snapshot-0123456789ab"))
+	snap, err := r.readSnapshot(context.TODO(), cueInstance, name)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(snap).To(BeNil())
+
+	secret := newTestObject("v1", "Secret", "credentials")
+	secret.Object["stringData"] = map[string]interface{}{"password": "hunter2"}
+	objects := []*unstructured.Unstructured{newTestObject("v1", "ConfigMap", "settings"), secret}
+	g.Expect(r.writeSnapshot(context.TODO(), cueInstance, name, snapshot{
+		revision: "main/abc",
+		checksum: "digest",
+		objects:  objects,
+	})).To(Succeed())
+
+	var stored corev1.Secret
+	g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "default"}, &stored)).To(Succeed())
+	g.Expect(stored.Type).To(Equal(snapshotSecretType))
+	g.Expect(stored.GetOwnerReferences()).To(HaveLen(1))
+
+	snap, err = r.readSnapshot(context.TODO(), cueInstance, name)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(snap.revision).To(Equal("main/abc"))
+	g.Expect(snap.checksum).To(Equal("digest"))
+	g.Expect(snap.objects).To(HaveLen(2))
+	g.Expect(snap.objects[1].Object["stringData"]).To(Equal(map[string]interface{}{"password": "hunter2"}))
+
+	// other secrets are not mistaken for snapshots
+	g.Expect(r.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+	})).To(Succeed())
+	_, err = r.readSnapshot(context.TODO(), cueInstance, "credentials")
+	g.Expect(err).To(MatchError("secret 'default/credentials' is not a snapshot"))
+}
+
+func TestWriteSnapshot_NotControlled(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	cueInstance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid", Generation: 1},
+	}
+	name := snapshotName(cueInstance, "0123456789abcdef")
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Type:       snapshotSecretType,
+		Data:       map[string][]byte{"token": []byte("tenant")},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build(),
+		Scheme: scheme,
+	}
+
+	err := r.writeSnapshot(context.TODO(), cueInstance, name, snapshot{revision: "main/abc", checksum: "digest"})
+	g.Expect(err).To(MatchError("'default/app-snapshot-0123456789ab' already exists and is not controlled by the CueInstance"))
+
+	var stored corev1.Secret
+	g.Expect(r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "default"}, &stored)).To(Succeed())
+	g.Expect(stored.Data).To(Equal(map[string][]byte{"token": []byte("tenant")}))
+
+	// a Secret of the snapshot type not controlled by the CueInstance isn't read
+	_, err = r.readSnapshot(context.TODO(), cueInstance, name)
+	g.Expect(err).To(MatchError("secret 'default/app-snapshot-0123456789ab' is not a snapshot"))
+
+	setSnapshotFailedCondition(&cueInstance, "main/abc", err)
+	cond := apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.SnapshotFailedCondition)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Reason).To(Equal(cuev1alpha1.SnapshotFailedReason))
+	g.Expect(cond.Message).To(HavePrefix("Unable to store the snapshot of revision main/abc: "))
+	setSnapshotFailedCondition(&cueInstance, "main/def", nil)
+	g.Expect(cueInstance.Status.Conditions).To(BeEmpty())
+}
+
+func TestRollbackConditions(t *testing.T) {
+	g := NewWithT(t)
+
+	cueInstance := cuev1alpha1.CueInstance{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	cueInstance.Spec.RollbackOnFailure = true
+	snap := &snapshot{revision: "main/abc", checksum: "good"}
+
+	g.Expect(canRollback(cueInstance, clusterReconcile{checksum: "bad", snapshot: snap})).To(BeTrue())
+	g.Expect(canRollback(cueInstance, clusterReconcile{checksum: "good", snapshot: snap})).To(BeFalse())
+	g.Expect(canRollback(cueInstance, clusterReconcile{checksum: "bad"})).To(BeFalse())
+
+	setRolledBackCondition(&cueInstance, "main/abc", "main/def", nil)
+	cueInstance.Status.RolledBackChecksum = "bad"
+	cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/def", cuev1alpha1.HealthCheckFailedReason, "timeout")
+	condition := apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.RolledBackCondition)
+	g.Expect(condition.Message).To(Equal("Rolled back to revision main/abc after the health checks of revision main/def failed"))
+
+	// the rolled back objects are not applied again for the same generation
+	g.Expect(rolledBack(cueInstance, "bad")).To(BeTrue())
+	g.Expect(rolledBack(cueInstance, "fixed")).To(BeFalse())
+	cueInstance.Generation = 2
+	g.Expect(rolledBack(cueInstance, "bad")).To(BeFalse())
+
+	cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/def", cuev1alpha1.RolledBackReason, "rolled back")
+	g.Expect(apimeta.IsStatusConditionTrue(cueInstance.Status.Conditions, meta.StalledCondition)).To(BeTrue())
+
+	cueInstance.Spec.RollbackOnFailure = false
+	g.Expect(rolledBack(cueInstance, "bad")).To(BeFalse())
+
+	setRolledBackCondition(&cueInstance, "main/abc", "main/def", []string{"staging", "prod"})
+	condition = apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.RolledBackCondition)
+	g.Expect(condition.Message).To(HaveSuffix("on clusters: staging, prod"))
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// SandboxBuildCommand is the first argument which makes the controller
+// binary act as a sandboxed CUE build process instead of a manager.
+const SandboxBuildCommand = "sandbox-build"
+
+// maxSandboxStderr is the number of stderr bytes of a failed
+// sandboxed build that are included in the returned error.
+const maxSandboxStderr = 4096
+
+// SandboxOptions configures running CUE builds in a separate,
+// resource-limited process so that a huge or non-terminating build
+// cannot destabilize the controller.
+type SandboxOptions struct {
+	// Enabled runs every CUE build in a sandboxed subprocess.
+	Enabled bool
+
+	// MemoryLimit is the maximum memory in bytes of the sandboxed build
+	// process, zero means unlimited. It is set as the soft limit of the Go
+	// runtime of the process and as the hard limit of a cgroup the process is
+	// killed in when it exceeds the limit, which requires the cgroup of the
+	// controller to be writable and to delegate the memory controller.
+	MemoryLimit int64
+
+	// Timeout is the maximum duration of a sandboxed build,
+	// zero means the timeout of the CueInstance is used.
+	Timeout time.Duration
+}
+
+// sandboxResponse is written by the sandboxed build process on stdout.
+type sandboxResponse struct {
+	Result *BuildResult `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// buildInSandbox runs the build described by req in a subprocess
+// of the current executable and returns its result.
+func (r *CueInstanceReconciler) buildInSandbox(ctx context.Context, req BuildRequest, timeout time.Duration) (*BuildResult, error) {
+	if r.Sandbox.Timeout > 0 {
+		timeout = r.Sandbox.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to locate the sandbox executable: %w", err)
+	}
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, executable, SandboxBuildCommand)
+	cmd.Dir = req.Root
+	cmd.Env = []string{"HOME=" + os.TempDir()}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// the address space of a Go process is not a measure of the memory it
+	// uses, the limit is enforced by the runtime and by a cgroup
+	if r.Sandbox.MemoryLimit > 0 {
+		cmd.Env = append(cmd.Env, "GOMEMLIMIT="+strconv.FormatInt(r.Sandbox.MemoryLimit, 10))
+	}
+	cgroup, err := newMemoryCgroup(r.Sandbox.MemoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to enforce the sandbox memory limit: %w", err)
+	}
+	if cgroup != nil {
+		defer cgroup.remove()
+		cgroup.startIn(cmd)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start the sandboxed build: %w", err)
+	}
+	_, _ = stdin.Write(input)
+	stdin.Close()
+
+	runErr := cmd.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("sandboxed build exceeded the timeout of %s", timeout)
+	}
+	if cgroup != nil && cgroup.oomKilled() {
+		return nil, fmt.Errorf("sandboxed build exceeded the memory limit of %d bytes", r.Sandbox.MemoryLimit)
+	}
+
+	var resp sandboxResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("sandboxed build failed: %w\n%s", runErr, tail(stderr.String(), maxSandboxStderr))
+		}
+		return nil, fmt.Errorf("unable to decode the sandboxed build result: %w", err)
+	}
+
+	if resp.Error != "" {
+		return resp.Result, errors.New(resp.Error)
+	}
+
+	return resp.Result, nil
+}
+
+// CheckSandboxMemoryLimit returns an error when the memory limit of
+// the sandboxed builds can't be enforced by a cgroup.
+func CheckSandboxMemoryLimit(limit int64) error {
+	cgroup, err := newMemoryCgroup(limit)
+	if err != nil {
+		return err
+	}
+	if cgroup != nil {
+		return cgroup.remove()
+	}
+	return nil
+}
+
+// RunSandboxBuild is the entrypoint of the sandboxed build process.
+// It reads a BuildRequest from in, builds the instance and writes the
+// result to out. The returned value is the process exit code.
+func RunSandboxBuild(in io.Reader, out io.Writer) int {
+	var req BuildRequest
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to decode build request: %s\n", err)
+		return 1
+	}
+
+	var resp sandboxResponse
+	result, err := buildInstance(req)
+	resp.Result = result
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	if err := json.NewEncoder(out).Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to encode build result: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
@@ -0,0 +1,126 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// cgroupRoot is the mount point of the cgroup v2 hierarchy.
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// cgroup2SuperMagic is the type of the cgroup v2 filesystem.
+	cgroup2SuperMagic = 0x63677270
+)
+
+// memoryCgroup is a cgroup v2 capping the memory of a sandboxed build,
+// the processes of which are killed when they exceed the limit.
+type memoryCgroup struct {
+	dir string
+	// fd is the directory of the cgroup, the processes are started into
+	fd *os.File
+}
+
+// newMemoryCgroup creates a child of the cgroup of the current process with
+// the given memory limit. It fails when the hierarchy is not cgroup v2, is not
+// writable or does not delegate the memory controller to the child cgroups.
+func newMemoryCgroup(limit int64) (*memoryCgroup, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(cgroupRoot, &fs); err != nil || fs.Type != cgroup2SuperMagic {
+		return nil, fmt.Errorf("the cgroup v2 hierarchy is not mounted at %s", cgroupRoot)
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	var current string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			current = strings.TrimPrefix(line, "0::")
+		}
+	}
+	if current == "" {
+		return nil, fmt.Errorf("the cgroup v2 hierarchy is not mounted")
+	}
+
+	dir, err := os.MkdirTemp(filepath.Join(cgroupRoot, current), "cue-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	cg := &memoryCgroup{dir: dir}
+	if err := cg.write("memory.max", strconv.FormatInt(limit, 10)); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	if cg.fd, err = os.Open(dir); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// startIn makes the command start its process in the cgroup, which is
+// then limited from its first allocation.
+func (c *memoryCgroup) startIn(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.fd.Fd())
+}
+
+// oomKilled reports whether a process of the cgroup was killed
+// for exceeding the memory limit.
+func (c *memoryCgroup) oomKilled() bool {
+	data, err := os.ReadFile(filepath.Join(c.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "oom_kill" {
+			return fields[1] != "0"
+		}
+	}
+	return false
+}
+
+// remove deletes the cgroup once its processes have exited.
+func (c *memoryCgroup) remove() error {
+	if c.fd != nil {
+		c.fd.Close()
+	}
+	return os.Remove(c.dir)
+}
+
+func (c *memoryCgroup) write(file, value string) error {
+	return os.WriteFile(filepath.Join(c.dir, file), []byte(value), 0)
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// memoryCgroup is only supported on Linux.
+type memoryCgroup struct{}
+
+// newMemoryCgroup is only supported on Linux.
+func newMemoryCgroup(limit int64) (*memoryCgroup, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("memory cgroups are only supported on linux")
+}
+
+func (c *memoryCgroup) startIn(cmd *exec.Cmd) {}
+
+func (c *memoryCgroup) oomKilled() bool { return false }
+
+func (c *memoryCgroup) remove() error { return nil }
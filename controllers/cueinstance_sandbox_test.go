@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+func init() {
+	// the test binary is the executable of the sandboxed builds
+	if len(os.Args) > 1 && os.Args[1] == SandboxBuildCommand {
+		os.Exit(RunSandboxBuild(os.Stdin, os.Stdout))
+	}
+}
+
+func TestRunSandboxBuild(t *testing.T) {
+	g := NewWithT(t)
+
+	root, err := filepath.Abs("testdata/app")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	req := BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Exprs: []string{"out"},
+			Tags: []cuev1alpha1.TagVar{
+				{Name: "name", Value: "sandboxed"},
+				{Name: "namespace", Value: "default"},
+			},
+		},
+	}
+	input, err := json.Marshal(req)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var out bytes.Buffer
+	g.Expect(RunSandboxBuild(bytes.NewReader(input), &out)).To(Equal(0))
+
+	var resp sandboxResponse
+	g.Expect(json.Unmarshal(out.Bytes(), &resp)).To(Succeed())
+	g.Expect(resp.Error).To(BeEmpty())
+	g.Expect(resp.Result).NotTo(BeNil())
+	g.Expect(string(resp.Result.Manifests)).To(ContainSubstring("name: sandboxed"))
+
+	t.Run("reports build errors", func(t *testing.T) {
+		g := NewWithT(t)
+
+		req.Dir = filepath.Join(root, "missing")
+		input, err := json.Marshal(req)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		out.Reset()
+		g.Expect(RunSandboxBuild(bytes.NewReader(input), &out)).To(Equal(0))
+
+		var resp sandboxResponse
+		g.Expect(json.Unmarshal(out.Bytes(), &resp)).To(Succeed())
+		g.Expect(resp.Error).NotTo(BeEmpty())
+	})
+}
+
+func TestBuildInSandbox_MemoryLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	root, err := filepath.Abs("testdata/app")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	req := BuildRequest{
+		Root: root,
+		Dir:  root,
+		Spec: cuev1alpha1.CueInstanceSpec{
+			Exprs: []string{"out"},
+			Tags: []cuev1alpha1.TagVar{
+				{Name: "name", Value: "sandboxed"},
+				{Name: "namespace", Value: "default"},
+			},
+		},
+	}
+
+	// a limit far below the address space reserved by the Go runtime
+	r := &CueInstanceReconciler{Sandbox: SandboxOptions{Enabled: true, MemoryLimit: 32 << 20}}
+	result, err := r.buildInSandbox(context.TODO(), req, time.Minute)
+
+	// the builds fail when the limit can't be enforced
+	if checkErr := CheckSandboxMemoryLimit(32 << 20); checkErr != nil {
+		g.Expect(err).To(MatchError(ContainSubstring("unable to enforce the sandbox memory limit")))
+		t.Skipf("the memory limit can't be enforced: %s", checkErr)
+	}
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(result.Manifests)).To(ContainSubstring("name: sandboxed"))
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cuelang.org/go/cue"
+	"github.com/google/go-containerregistry/pkg/crane"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	// maxSchemaSize is the maximum size in bytes of a remote schema.
+	maxSchemaSize = 10 << 20
+
+	// schemaCacheTTL is the duration for which a remote schema without
+	// a checksum is reused before being fetched again.
+	schemaCacheTTL = 5 * time.Minute
+
+	// maxCachedSchemas is the maximum number of remote schemas kept in the cache.
+	maxCachedSchemas = 100
+)
+
+// IsRemoteSchema reports whether the schema refers to a remote location
+// rather than to a path within the instance.
+func IsRemoteSchema(schema string) bool {
+	return strings.HasPrefix(schema, "https://") || strings.HasPrefix(schema, "oci://")
+}
+
+// splitSchemaRef splits a remote schema reference into its location
+// and the CUE path of the schema within the fetched file.
+func splitSchemaRef(ref string) (location, path string) {
+	if i := strings.Index(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// validationSchema returns the schema value against which the instance is
+// validated, compiled from the remote source when one was fetched.
+func validationSchema(cctx *cue.Context, value cue.Value, schema, source string) (cue.Value, error) {
+	if !IsRemoteSchema(schema) {
+		return value.LookupPath(cue.ParsePath(schema)), nil
+	}
+
+	location, path := splitSchemaRef(schema)
+	remote := cctx.CompileString(source, cue.Filename(location))
+	if remote.Err() != nil {
+		return remote, fmt.Errorf("failed to compile schema %s: %w", location, remote.Err())
+	}
+	if path == "" {
+		return remote, nil
+	}
+
+	v := remote.LookupPath(cue.ParsePath(path))
+	if !v.Exists() {
+		return v, fmt.Errorf("schema %s has no path '%s'", location, path)
+	}
+	return v, nil
+}
+
+// schemaCache holds the remote schemas fetched by the controller.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]schemaCacheEntry
+}
+
+type schemaCacheEntry struct {
+	source    string
+	checksum  string
+	fetchedAt time.Time
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: map[string]schemaCacheEntry{}}
+}
+
+// get returns the cached schema of location. A schema matching the pinned
+// checksum never expires, other schemas are reused for schemaCacheTTL.
+func (c *schemaCache) get(location, checksum string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[location]
+	if !ok {
+		return "", false
+	}
+	if checksum != "" {
+		return entry.source, entry.checksum == checksum
+	}
+	return entry.source, time.Since(entry.fetchedAt) < schemaCacheTTL
+}
+
+func (c *schemaCache) set(location, source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[location]; !ok && len(c.entries) >= maxCachedSchemas {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.fetchedAt.Before(c.entries[oldest].fetchedAt) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[location] = schemaCacheEntry{
+		source:    source,
+		checksum:  schemaChecksum([]byte(source)),
+		fetchedAt: time.Now(),
+	}
+}
+
+// fetchSchema returns the source of the remote validation schema,
+// from the cache when possible.
+func (r *CueInstanceReconciler) fetchSchema(ctx context.Context, validation *cuev1alpha1.Validation) (string, error) {
+	location, _ := splitSchemaRef(validation.Schema)
+	if r.schemaCache != nil {
+		if source, ok := r.schemaCache.get(location, validation.Checksum); ok {
+			return source, nil
+		}
+	}
+
+	var httpClient *http.Client
+	if r.httpClient != nil {
+		httpClient = r.httpClient.StandardClient()
+	}
+	source, err := FetchSchema(ctx, httpClient, validation)
+	if err != nil {
+		return "", err
+	}
+
+	if r.schemaCache != nil {
+		r.schemaCache.set(location, source)
+	}
+	return source, nil
+}
+
+// FetchSchema downloads the remote validation schema and verifies it
+// against the pinned checksum. A nil httpClient uses http.DefaultClient.
+func FetchSchema(ctx context.Context, httpClient *http.Client, validation *cuev1alpha1.Validation) (string, error) {
+	location, _ := splitSchemaRef(validation.Schema)
+
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasPrefix(location, "oci://") {
+		data, err = fetchOCISchema(ctx, strings.TrimPrefix(location, "oci://"))
+	} else {
+		data, err = fetchHTTPSchema(ctx, httpClient, location)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch schema %s: %w", location, err)
+	}
+
+	if validation.Checksum != "" {
+		if sum := schemaChecksum(data); sum != validation.Checksum {
+			return "", fmt.Errorf("schema %s checksum mismatch, expected %s, got %s", location, validation.Checksum, sum)
+		}
+	}
+
+	return string(data), nil
+}
+
+func schemaChecksum(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func fetchHTTPSchema(ctx context.Context, httpClient *http.Client, url string) ([]byte, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status: %s", resp.Status)
+	}
+
+	return readSchema(resp.Body)
+}
+
+// fetchOCISchema pulls the artifact and returns the content of its first
+// layer, which is either a CUE file or a tarball containing a single one.
+func fetchOCISchema(ctx context.Context, ref string) ([]byte, error) {
+	img, err := crane.Pull(ref, crane.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("artifact has no layers")
+	}
+
+	mediaType, err := layers[0].MediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := readSchema(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(string(mediaType), "tar") {
+		return data, nil
+	}
+	return extractSchema(data)
+}
+
+// extractSchema returns the single CUE file of a, possibly gzipped, tarball.
+func extractSchema(data []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var schema []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || filepath.Ext(hdr.Name) != ".cue" {
+			continue
+		}
+		if schema != nil {
+			return nil, errors.New("artifact contains more than one CUE file")
+		}
+		if schema, err = readSchema(tr); err != nil {
+			return nil, err
+		}
+	}
+
+	if schema == nil {
+		return nil, errors.New("artifact contains no CUE file")
+	}
+	return schema, nil
+}
+
+func readSchema(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxSchemaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSchemaSize {
+		return nil, fmt.Errorf("schema exceeds the maximum size of %d bytes", maxSchemaSize)
+	}
+	return data, nil
+}
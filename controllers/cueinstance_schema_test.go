@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const testSchema = `#Deployment: {
+	kind: "Deployment"
+	spec: replicas: <=3
+	...
+}
+`
+
+func TestFetchSchema(t *testing.T) {
+	g := NewWithT(t)
+
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(testSchema))
+	}))
+	defer server.Close()
+
+	httpClient := retryablehttp.NewClient()
+	httpClient.HTTPClient = server.Client()
+	httpClient.RetryMax = 0
+	httpClient.Logger = nil
+	r := &CueInstanceReconciler{httpClient: httpClient, schemaCache: newSchemaCache()}
+
+	checksum := schemaChecksum([]byte(testSchema))
+	validation := &cuev1alpha1.Validation{
+		Schema:   server.URL + "/k8s.cue##Deployment",
+		Checksum: checksum,
+	}
+
+	source, err := r.fetchSchema(context.TODO(), validation)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(source).To(Equal(testSchema))
+
+	// a pinned schema is served from the cache
+	_, err = r.fetchSchema(context.TODO(), validation)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requests).To(Equal(1))
+
+	// a different pin fetches the schema again and fails
+	validation.Checksum = "sha256:" + strings.Repeat("0", 64)
+	_, err = r.fetchSchema(context.TODO(), validation)
+	g.Expect(err).To(MatchError(ContainSubstring("checksum mismatch")))
+	g.Expect(requests).To(Equal(2))
+}
+
+func TestValidationSchema(t *testing.T) {
+	root := writeCueModule(t, `package app
+
+out: [{
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: "app"
+	spec: replicas: 5
+}]
+`)
+
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{
+			name:    "validates against the remote definition",
+			schema:  "https://example.com/k8s.cue##Deployment",
+			wantErr: "invalid value 5",
+		},
+		{
+			name:    "reports a missing path",
+			schema:  "https://example.com/k8s.cue##Service",
+			wantErr: "has no path '#Service'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := buildInstance(BuildRequest{
+				Root: root,
+				Dir:  root,
+				Spec: cuev1alpha1.CueInstanceSpec{
+					Exprs: []string{"out[0]"},
+					Validate: &cuev1alpha1.Validation{
+						Mode:   cuev1alpha1.FailPolicy,
+						Schema: tt.schema,
+						Type:   "cue",
+					},
+				},
+				Schema: testSchema,
+			})
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+		})
+	}
+}
+
+func TestExtractSchema(t *testing.T) {
+	g := NewWithT(t)
+
+	archive := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range files {
+			g.Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+			_, err := tw.Write([]byte(content))
+			g.Expect(err).NotTo(HaveOccurred())
+		}
+		g.Expect(tw.Close()).To(Succeed())
+		g.Expect(gz.Close()).To(Succeed())
+		return buf.Bytes()
+	}
+
+	schema, err := extractSchema(archive(map[string]string{"k8s.cue": testSchema, "README.md": "# schemas"}))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(schema)).To(Equal(testSchema))
+
+	_, err = extractSchema(archive(map[string]string{"a.cue": testSchema, "b.cue": testSchema}))
+	g.Expect(err).To(MatchError(ContainSubstring("more than one CUE file")))
+
+	_, err = extractSchema(archive(map[string]string{"README.md": "# schemas"}))
+	g.Expect(err).To(MatchError(ContainSubstring("no CUE file")))
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// selectorMatches reports whether the object is selected by the selector.
+func selectorMatches(selector cuev1alpha1.Selector, obj *unstructured.Unstructured) (bool, error) {
+	gvk := obj.GroupVersionKind()
+	if selector.Group != "" && selector.Group != gvk.Group {
+		return false, nil
+	}
+	if selector.Version != "" && selector.Version != gvk.Version {
+		return false, nil
+	}
+	if selector.Kind != "" && selector.Kind != gvk.Kind {
+		return false, nil
+	}
+	if selector.Namespace != "" && selector.Namespace != obj.GetNamespace() {
+		return false, nil
+	}
+	if selector.Name != "" && selector.Name != obj.GetName() {
+		return false, nil
+	}
+
+	if selector.LabelSelector != "" {
+		sel, err := labels.Parse(selector.LabelSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid label selector '%s': %w", selector.LabelSelector, err)
+		}
+		if !sel.Matches(labels.Set(obj.GetLabels())) {
+			return false, nil
+		}
+	}
+	if selector.AnnotationSelector != "" {
+		sel, err := labels.Parse(selector.AnnotationSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid annotation selector '%s': %w", selector.AnnotationSelector, err)
+		}
+		if !sel.Matches(labels.Set(obj.GetAnnotations())) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newTestObject returns an object with the given API version, kind and name in the default namespace.
+func newTestObject(apiVersion, kind, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+func TestSelectorMatches(t *testing.T) {
+	obj := newTestObject("apps/v1", "Deployment", "frontend")
+	obj.SetLabels(map[string]string{"app": "frontend"})
+	obj.SetAnnotations(map[string]string{"autoscaling": "enabled"})
+
+	tests := []struct {
+		name     string
+		selector cuev1alpha1.Selector
+		want     bool
+		wantErr  bool
+	}{
+		{name: "empty selector", want: true},
+		{name: "group and kind", selector: cuev1alpha1.Selector{Group: "apps", Kind: "Deployment"}, want: true},
+		{name: "core group", selector: cuev1alpha1.Selector{Group: "", Version: "v1", Kind: "Deployment"}, want: true},
+		{name: "other kind", selector: cuev1alpha1.Selector{Kind: "Service"}, want: false},
+		{name: "other namespace", selector: cuev1alpha1.Selector{Namespace: "apps"}, want: false},
+		{name: "name", selector: cuev1alpha1.Selector{Name: "frontend"}, want: true},
+		{name: "label selector", selector: cuev1alpha1.Selector{LabelSelector: "app in (frontend,backend)"}, want: true},
+		{name: "annotation selector", selector: cuev1alpha1.Selector{AnnotationSelector: "autoscaling!=enabled"}, want: false},
+		{name: "invalid label selector", selector: cuev1alpha1.Selector{LabelSelector: "app in"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := selectorMatches(tt.selector, obj)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const (
+	// snapshotSecretType is the type of the Secrets holding the snapshots,
+	// which are not stored in ConfigMaps as they include the rendered Secrets.
+	snapshotSecretType corev1.SecretType = "cue.contrib.flux.io/snapshot"
+
+	snapshotKey = "manifests.yaml.gz"
+
+	// maxSnapshotSize is the maximum size of the compressed objects of a snapshot,
+	// which is kept below the 1MiB limit of the objects of the API server.
+	maxSnapshotSize = 900 * 1024
+)
+
+var (
+	snapshotRevisionAnnotation = cuev1alpha1.GroupVersion.Group + "/revision"
+	snapshotChecksumAnnotation = cuev1alpha1.GroupVersion.Group + "/checksum"
+)
+
+// snapshot holds the objects applied from a revision.
+type snapshot struct {
+	revision string
+	checksum string
+	objects  []*unstructured.Unstructured
+}
+
+// snapshotName returns the name of the Secret holding the snapshot of the object set.
+func snapshotName(cueInstance cuev1alpha1.CueInstance, checksum string) string {
+	if len(checksum) > 12 {
+		checksum = checksum[:12]
+	}
+	return fmt.Sprintf("%s-snapshot-%s", cueInstance.GetName(), checksum)
+}
+
+// writeSnapshot stores the objects applied from the revision in a Secret
+// controlled by the CueInstance, written with its impersonation. An existing
+// Secret of the same name not controlled by the CueInstance is left untouched.
+func (r *CueInstanceReconciler) writeSnapshot(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	name string,
+	snap snapshot,
+) error {
+	data, err := encodeSnapshot(snap.objects)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxSnapshotSize {
+		return fmt.Errorf("the compressed objects (%d bytes) exceed the maximum size of a snapshot (%d bytes)",
+			len(data), maxSnapshotSize)
+	}
+
+	kubeClient, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	secret.SetName(name)
+	secret.SetNamespace(cueInstance.GetNamespace())
+
+	_, err = createOrUpdateControlled(ctx, kubeClient, r.Scheme, &cueInstance, secret, func() error {
+		secret.Type = snapshotSecretType
+		secret.SetAnnotations(map[string]string{
+			snapshotRevisionAnnotation: snap.revision,
+			snapshotChecksumAnnotation: snap.checksum,
+		})
+		secret.Data = map[string][]byte{snapshotKey: data}
+		return nil
+	})
+	return err
+}
+
+// setSnapshotFailedCondition reports the failure to store the snapshot of the
+// revision in the SnapshotFailed condition, and removes it once stored.
+func setSnapshotFailedCondition(cueInstance *cuev1alpha1.CueInstance, revision string, err error) {
+	if err == nil {
+		apimeta.RemoveStatusCondition(&cueInstance.Status.Conditions, cuev1alpha1.SnapshotFailedCondition)
+		return
+	}
+
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, metav1.Condition{
+		Type:               cuev1alpha1.SnapshotFailedCondition,
+		Status:             metav1.ConditionTrue,
+		Reason:             cuev1alpha1.SnapshotFailedReason,
+		Message:            fmt.Sprintf("Unable to store the snapshot of revision %s: %s", revision, err),
+		ObservedGeneration: cueInstance.Generation,
+	})
+}
+
+// readSnapshot returns the snapshot stored in the named Secret, or nil if there is none.
+func (r *CueInstanceReconciler) readSnapshot(ctx context.Context, cueInstance cuev1alpha1.CueInstance, name string) (*snapshot, error) {
+	var secret corev1.Secret
+	key := types.NamespacedName{Name: name, Namespace: cueInstance.GetNamespace()}
+	if err := r.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if secret.Type != snapshotSecretType || !metav1.IsControlledBy(&secret, &cueInstance) {
+		return nil, fmt.Errorf("secret '%s' is not a snapshot", key)
+	}
+
+	objects, err := decodeSnapshot(secret.Data[snapshotKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the snapshot '%s': %w", key, err)
+	}
+	return &snapshot{
+		revision: secret.GetAnnotations()[snapshotRevisionAnnotation],
+		checksum: secret.GetAnnotations()[snapshotChecksumAnnotation],
+		objects:  objects,
+	}, nil
+}
+
+// encodeSnapshot returns the gzipped multi-document YAML of the objects.
+func encodeSnapshot(objects []*unstructured.Unstructured) ([]byte, error) {
+	manifests, err := ssa.ObjectsToYAML(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(gw, manifests); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshot(data []byte) ([]*unstructured.Unstructured, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return ssa.ReadObjects(gr)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// recordFailures counts the consecutive reconciliations failing with the
+// same Ready reason and message as the last one, and marks the CueInstance
+// as Stalled once StallAfterFailures is reached so that it is retried at
+// its interval instead of hot-looping.
+func (r *CueInstanceReconciler) recordFailures(cueInstance *cuev1alpha1.CueInstance,
+	lastReady *metav1.Condition,
+	reconcileErr error,
+) {
+	ready := apimeta.FindStatusCondition(cueInstance.Status.Conditions, meta.ReadyCondition)
+	if reconcileErr == nil || ready == nil || ready.Status != metav1.ConditionFalse {
+		cueInstance.Status.ConsecutiveFailures = 0
+		return
+	}
+
+	if lastReady != nil && lastReady.Status == metav1.ConditionFalse &&
+		lastReady.Reason == ready.Reason && lastReady.Message == ready.Message {
+		cueInstance.Status.ConsecutiveFailures++
+	} else {
+		cueInstance.Status.ConsecutiveFailures = 1
+	}
+
+	if r.StallAfterFailures <= 0 || cueInstance.Status.ConsecutiveFailures < r.StallAfterFailures ||
+		apimeta.IsStatusConditionTrue(cueInstance.Status.Conditions, meta.StalledCondition) {
+		return
+	}
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, metav1.Condition{
+		Type:   meta.StalledCondition,
+		Status: metav1.ConditionTrue,
+		Reason: cuev1alpha1.RetriesExhaustedReason,
+		Message: fmt.Sprintf("%d consecutive failures, retrying at the interval: %s",
+			cueInstance.Status.ConsecutiveFailures, ready.Message),
+		ObservedGeneration: cueInstance.Generation,
+	})
+}
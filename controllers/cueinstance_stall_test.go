@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordFailures(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &CueInstanceReconciler{StallAfterFailures: 3}
+	cueInstance := cuev1alpha1.CueInstance{}
+	reconcileErr := errors.New("connection refused")
+
+	attempt := func(reason, message string, err error) {
+		lastReady := apimeta.FindStatusCondition(cueInstance.Status.Conditions, meta.ReadyCondition).DeepCopy()
+		cueInstance = cuev1alpha1.CueInstanceProgressing(cueInstance, "reconciliation in progress")
+		if err != nil {
+			cueInstance = cuev1alpha1.CueInstanceNotReady(cueInstance, "main/abc", reason, message)
+		} else {
+			cueInstance = cuev1alpha1.CueInstanceReadyInventory(cueInstance, NewInventory(), "main/abc", reason, message)
+		}
+		r.recordFailures(&cueInstance, lastReady, err)
+	}
+	stalled := func() *metav1.Condition {
+		return apimeta.FindStatusCondition(cueInstance.Status.Conditions, meta.StalledCondition)
+	}
+
+	attempt(meta.ReconciliationFailedReason, "connection refused", reconcileErr)
+	attempt(meta.ReconciliationFailedReason, "connection refused", reconcileErr)
+	g.Expect(cueInstance.Status.ConsecutiveFailures).To(Equal(2))
+	g.Expect(stalled()).To(BeNil())
+
+	attempt(meta.ReconciliationFailedReason, "connection refused", reconcileErr)
+	g.Expect(cueInstance.Status.ConsecutiveFailures).To(Equal(3))
+	g.Expect(stalled()).NotTo(BeNil())
+	g.Expect(stalled().Reason).To(Equal(cuev1alpha1.RetriesExhaustedReason))
+	g.Expect(stalled().Message).To(Equal("3 consecutive failures, retrying at the interval: connection refused"))
+
+	// a different failure restarts the count
+	attempt(meta.ReconciliationFailedReason, "forbidden", reconcileErr)
+	g.Expect(cueInstance.Status.ConsecutiveFailures).To(Equal(1))
+	g.Expect(stalled()).To(BeNil())
+
+	// terminal failures keep their own Stalled reason
+	for i := 0; i < 3; i++ {
+		attempt(cuev1alpha1.BuildFailedReason, "invalid value", reconcileErr)
+	}
+	g.Expect(stalled().Reason).To(Equal(cuev1alpha1.BuildFailedReason))
+
+	attempt(meta.ReconciliationSucceededReason, "Applied revision: main/abc", nil)
+	g.Expect(cueInstance.Status.ConsecutiveFailures).To(BeZero())
+	g.Expect(stalled()).To(BeNil())
+
+	// failures are only counted when stalling is disabled
+	r.StallAfterFailures = 0
+	for i := 0; i < 5; i++ {
+		attempt(meta.ReconciliationFailedReason, "connection refused", reconcileErr)
+	}
+	g.Expect(cueInstance.Status.ConsecutiveFailures).To(Equal(5))
+	g.Expect(stalled()).To(BeNil())
+}
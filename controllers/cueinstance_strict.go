@@ -0,0 +1,130 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkUnknownFields dry-runs the objects and fails when the API server drops
+// any of their fields. The server prunes the fields unknown to the schema of
+// a custom resource, so that a misspelled field would otherwise be silently
+// ignored. The objects failing the dry-run are left to the apply, which
+// reports the error, e.g. for the unknown fields of the built-in kinds.
+func checkUnknownFields(ctx context.Context, kubeClient client.Client, fieldManager string, objects []*unstructured.Unstructured) error {
+	var failures []string
+	for _, obj := range objects {
+		dryRunObject := obj.DeepCopy()
+		if err := kubeClient.Patch(ctx, dryRunObject, client.Apply,
+			client.DryRunAll, client.ForceOwnership, client.FieldOwner(fieldManager)); err != nil {
+			continue
+		}
+
+		desired := obj.Object
+		if obj.GetKind() == "Secret" {
+			// the string data is merged into the data by the server
+			desired = obj.DeepCopy().Object
+			delete(desired, "stringData")
+		}
+
+		if fields := unknownFields("", desired, dryRunObject.Object); len(fields) > 0 {
+			failures = append(failures, fmt.Sprintf("%s: unknown fields %s",
+				ssa.FmtUnstructured(obj), strings.Join(fields, ", ")))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d objects have fields unknown to the cluster: %s",
+			len(failures), summarize(failures, maxPolicyViolations))
+	}
+	return nil
+}
+
+// unknownFields returns the paths of the fields of the desired value missing
+// from the value returned by the server. The fields set to their zero value
+// are not reported as the server omits them, nor is the status of the object.
+func unknownFields(path string, desired, actual interface{}) []string {
+	var fields []string
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if path == "" && k == "status" {
+				continue
+			}
+			fieldPath := k
+			if path != "" {
+				fieldPath = path + "." + k
+			}
+			v, ok := a[k]
+			if !ok {
+				if !isZeroValue(d[k]) {
+					fields = append(fields, fieldPath)
+				}
+				continue
+			}
+			fields = append(fields, unknownFields(fieldPath, d[k], v)...)
+		}
+	case []interface{}:
+		// the items of lists changed by the server can't be matched
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(d) {
+			return nil
+		}
+		for i := range d {
+			fields = append(fields, unknownFields(fmt.Sprintf("%s[%d]", path, i), d[i], a[i])...)
+		}
+	}
+	return fields
+}
+
+func isZeroValue(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !t
+	case string:
+		return t == ""
+	case int64:
+		return t == 0
+	case float64:
+		return t == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnknownFields(t *testing.T) {
+	g := NewWithT(t)
+
+	desired := map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":              "app",
+			"creationTimestamp": nil,
+		},
+		"spec": map[string]interface{}{
+			"replica": int64(3),
+			"paused":  false,
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80), "protocl": "TCP"},
+			},
+		},
+		"status": map[string]interface{}{"ready": true},
+	}
+	actual := map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata": map[string]interface{}{
+			"name":            "app",
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+			},
+		},
+	}
+
+	g.Expect(unknownFields("", desired, actual)).To(Equal([]string{"spec.ports[0].protocl", "spec.replica"}))
+	g.Expect(unknownFields("", actual, actual)).To(BeEmpty())
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/events"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// recordSuspendTransition updates the Suspended condition when spec.suspend
+// has been flipped and emits an event naming the actor that flipped it.
+// It reports whether the status was changed and has to be patched.
+func (r *CueInstanceReconciler) recordSuspendTransition(ctx context.Context, cueInstance *cuev1alpha1.CueInstance) bool {
+	log := ctrl.LoggerFrom(ctx)
+
+	suspended := apimeta.IsStatusConditionTrue(cueInstance.Status.Conditions, cuev1alpha1.SuspendedCondition)
+	if suspended == cueInstance.Spec.Suspend {
+		return false
+	}
+
+	// a resumed condition is only recorded after a suspension
+	if !cueInstance.Spec.Suspend &&
+		apimeta.FindStatusCondition(cueInstance.Status.Conditions, cuev1alpha1.SuspendedCondition) == nil {
+		return false
+	}
+
+	status, reason, action := metav1.ConditionTrue, meta.SuspendedReason, "suspended"
+	if !cueInstance.Spec.Suspend {
+		status, reason, action = metav1.ConditionFalse, cuev1alpha1.ResumedReason, "resumed"
+	}
+
+	msg := fmt.Sprintf("Reconciliation %s", action)
+	metadata := map[string]string{}
+	if actor := suspendActor(cueInstance.GetManagedFields()); actor != "" {
+		msg = fmt.Sprintf("Reconciliation %s by %s", action, actor)
+		metadata["actor"] = actor
+	}
+
+	apimeta.SetStatusCondition(&cueInstance.Status.Conditions, metav1.Condition{
+		Type:               cuev1alpha1.SuspendedCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            msg,
+		ObservedGeneration: cueInstance.Generation,
+	})
+
+	log.Info(msg)
+	r.event(ctx, *cueInstance, cueInstance.Status.LastAppliedRevision, events.EventSeverityInfo, msg, metadata)
+
+	return true
+}
+
+// suspendActor returns the name of the field manager that most recently
+// set spec.suspend, or an empty string if no manager owns the field.
+func suspendActor(managedFields []metav1.ManagedFieldsEntry) string {
+	var (
+		actor  string
+		latest *metav1.Time
+	)
+	for _, entry := range managedFields {
+		if entry.FieldsV1 == nil || !ownsSuspend(entry.FieldsV1.Raw) {
+			continue
+		}
+		if actor == "" || (entry.Time != nil && (latest == nil || latest.Before(entry.Time))) {
+			actor = entry.Manager
+			latest = entry.Time
+		}
+	}
+	return actor
+}
+
+func ownsSuspend(raw []byte) bool {
+	var fields map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["f:spec"]["f:suspend"]
+	return ok
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSuspendActor(t *testing.T) {
+	g := NewWithT(t)
+
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+	later := metav1.NewTime(time.Now())
+
+	fields := []metav1.ManagedFieldsEntry{
+		{
+			Manager:  "kustomize-controller",
+			Time:     &earlier,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:interval":{},"f:suspend":{}}}`)},
+		},
+		{
+			Manager:  "flux",
+			Time:     &later,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:suspend":{}}}`)},
+		},
+		{
+			Manager:  "cue-controller",
+			Time:     &later,
+			FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:conditions":{}}}`)},
+		},
+	}
+	g.Expect(suspendActor(fields)).To(Equal("flux"))
+	g.Expect(suspendActor(fields[2:])).To(BeEmpty())
+}
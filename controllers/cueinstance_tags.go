@@ -0,0 +1,115 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// resolveTags returns a copy of the CueInstance spec in which the values of
+// the tags sourced from ConfigMaps, Secrets and ImagePolicies have been filled in.
+func (r *CueInstanceReconciler) resolveTags(ctx context.Context, cueInstance cuev1alpha1.CueInstance) (cuev1alpha1.CueInstanceSpec, error) {
+	spec := *cueInstance.Spec.DeepCopy()
+
+	for _, tags := range [][]cuev1alpha1.TagVar{spec.Tags, spec.TagVars} {
+		for i, t := range tags {
+			if t.ValueFrom == nil {
+				continue
+			}
+			value, err := r.getTagValue(ctx, cueInstance.GetNamespace(), *t.ValueFrom)
+			if err != nil {
+				return spec, fmt.Errorf("unable to resolve tag '%s': %w", t.Name, err)
+			}
+			if value != nil {
+				tags[i].Value = *value
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+// getTagValue returns the value referenced by ref, or nil when
+// the reference is optional and cannot be resolved.
+func (r *CueInstanceReconciler) getTagValue(ctx context.Context, namespace string, ref cuev1alpha1.TagVarSource) (*string, error) {
+	if err := validateTagVarSource(ref); err != nil {
+		return nil, err
+	}
+	if ref.ImagePolicyRef != nil {
+		return r.getImagePolicyValue(ctx, namespace, ref)
+	}
+
+	name := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	var (
+		value string
+		found bool
+	)
+	switch ref.Kind {
+	case "ConfigMap":
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, name, &cm); err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		value, found = cm.Data[ref.Key]
+	case "Secret":
+		var secret corev1.Secret
+		if err := r.Get(ctx, name, &secret); err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				return nil, nil
+			}
+			return nil, err
+		}
+		var data []byte
+		data, found = secret.Data[ref.Key]
+		value = string(data)
+	default:
+		return nil, fmt.Errorf("unsupported kind '%s'", ref.Kind)
+	}
+
+	if !found {
+		if ref.Optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("key '%s' not found in %s '%s'", ref.Key, ref.Kind, name)
+	}
+
+	return &value, nil
+}
+
+// validateTagVarSource checks that the reference sets either the kind,
+// name and key of a ConfigMap or Secret, or an ImagePolicy.
+func validateTagVarSource(ref cuev1alpha1.TagVarSource) error {
+	keyRef := ref.Kind != "" || ref.Name != "" || ref.Key != ""
+	switch {
+	case ref.ImagePolicyRef != nil && keyRef:
+		return fmt.Errorf("invalid valueFrom: imagePolicyRef can't be set with kind, name or key")
+	case ref.ImagePolicyRef == nil && (ref.Kind == "" || ref.Name == "" || ref.Key == ""):
+		return fmt.Errorf("invalid valueFrom: either kind, name and key, or imagePolicyRef must be set")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveTags(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"env": "production"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	}
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap, secret).Build(),
+	}
+
+	tag := func(value, kind, name, key string, optional bool) cuev1alpha1.TagVar {
+		return cuev1alpha1.TagVar{
+			Name:  "tag",
+			Value: value,
+			ValueFrom: &cuev1alpha1.TagVarSource{
+				Kind:     kind,
+				Name:     name,
+				Key:      key,
+				Optional: optional,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		tag     cuev1alpha1.TagVar
+		value   string
+		wantErr bool
+	}{
+		{name: "configmap key", tag: tag("", "ConfigMap", "settings", "env", false), value: "production"},
+		{name: "secret key", tag: tag("", "Secret", "credentials", "token", false), value: "s3cr3t"},
+		{name: "missing object", tag: tag("", "ConfigMap", "missing", "env", false), wantErr: true},
+		{name: "missing key", tag: tag("", "Secret", "credentials", "missing", false), wantErr: true},
+		{name: "optional missing object", tag: tag("staging", "ConfigMap", "missing", "env", true), value: "staging"},
+		{name: "optional missing key", tag: tag("", "Secret", "credentials", "missing", true), value: ""},
+		{name: "incomplete reference", tag: tag("staging", "ConfigMap", "settings", "", true), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			instance := cuev1alpha1.CueInstance{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: cuev1alpha1.CueInstanceSpec{
+					Tags:    []cuev1alpha1.TagVar{tt.tag},
+					TagVars: []cuev1alpha1.TagVar{tt.tag},
+				},
+			}
+
+			spec, err := r.resolveTags(context.TODO(), instance)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(spec.Tags[0].Value).To(Equal(tt.value))
+			g.Expect(spec.TagVars[0].Value).To(Equal(tt.value))
+			g.Expect(instance.Spec.Tags[0].Value).To(Equal(tt.tag.Value))
+		})
+	}
+}
+
+func TestValidateTagVarSource(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := &cuev1alpha1.ImagePolicyReference{Name: "app"}
+	g.Expect(validateTagVarSource(cuev1alpha1.TagVarSource{Kind: "Secret", Name: "db", Key: "password"})).To(Succeed())
+	g.Expect(validateTagVarSource(cuev1alpha1.TagVarSource{ImagePolicyRef: policy})).To(Succeed())
+
+	g.Expect(validateTagVarSource(cuev1alpha1.TagVarSource{})).To(
+		MatchError("invalid valueFrom: either kind, name and key, or imagePolicyRef must be set"))
+	g.Expect(validateTagVarSource(cuev1alpha1.TagVarSource{Kind: "Secret", Name: "db"})).To(
+		MatchError("invalid valueFrom: either kind, name and key, or imagePolicyRef must be set"))
+	g.Expect(validateTagVarSource(cuev1alpha1.TagVarSource{Key: "tag", ImagePolicyRef: policy})).To(
+		MatchError("invalid valueFrom: imagePolicyRef can't be set with kind, name or key"))
+}
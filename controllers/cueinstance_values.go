@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/acl"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+const valuesFromIndexKey string = ".metadata.valuesFrom"
+
+// getValuesSource returns the CueInstance whose outputs are referenced,
+// once it is ready and has written its outputs. The reader is the client
+// impersonating the service account of the CueInstance.
+func (r *CueInstanceReconciler) getValuesSource(ctx context.Context,
+	reader client.Reader,
+	cueInstance cuev1alpha1.CueInstance,
+	ref cuev1alpha1.ValuesReference,
+) (*cuev1alpha1.CueInstance, error) {
+	name := valuesSourceName(cueInstance, ref)
+	if r.NoCrossNamespaceRefs && name.Namespace != cueInstance.GetNamespace() {
+		return nil, acl.AccessDeniedError(
+			fmt.Sprintf("can't access the outputs of '%s', cross-namespace references have been blocked", name))
+	}
+
+	var k cuev1alpha1.CueInstance
+	if err := reader.Get(ctx, name, &k); err != nil {
+		return nil, fmt.Errorf("unable to get the CueInstance '%s' of the values: %w", name, err)
+	}
+	if k.Spec.WriteOutputsTo == nil {
+		return nil, fmt.Errorf("CueInstance '%s' does not write outputs", name)
+	}
+	if k.Generation != k.Status.ObservedGeneration ||
+		!apimeta.IsStatusConditionTrue(k.Status.Conditions, meta.ReadyCondition) {
+		return nil, fmt.Errorf("CueInstance '%s' of the values is not ready", name)
+	}
+	if k.Status.OutputsChecksum == "" {
+		return nil, fmt.Errorf("CueInstance '%s' has not written its outputs yet", name)
+	}
+	return &k, nil
+}
+
+// checkValuesFrom checks that the outputs of all the referenced CueInstances are available.
+func (r *CueInstanceReconciler) checkValuesFrom(ctx context.Context, cueInstance cuev1alpha1.CueInstance) error {
+	if len(cueInstance.Spec.ValuesFrom) == 0 {
+		return nil
+	}
+	reader, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range cueInstance.Spec.ValuesFrom {
+		if _, err := r.getValuesSource(ctx, reader, cueInstance, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveValuesFrom returns the tag variables with the ones sourced from the
+// outputs of the referenced CueInstances appended, the tag variables which
+// are already set take precedence.
+func (r *CueInstanceReconciler) resolveValuesFrom(ctx context.Context,
+	cueInstance cuev1alpha1.CueInstance,
+	tagVars []cuev1alpha1.TagVar,
+) ([]cuev1alpha1.TagVar, error) {
+	if len(cueInstance.Spec.ValuesFrom) == 0 {
+		return tagVars, nil
+	}
+	reader, err := r.localClient(ctx, cueInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(tagVars))
+	for _, t := range tagVars {
+		set[t.Name] = true
+	}
+
+	for _, ref := range cueInstance.Spec.ValuesFrom {
+		source, err := r.getValuesSource(ctx, reader, cueInstance, ref)
+		if err != nil {
+			return nil, err
+		}
+		outputs, err := readOutputs(ctx, reader, *source)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := ref.Keys
+		if len(keys) == 0 {
+			for key := range outputs {
+				keys = append(keys, cuev1alpha1.ValuesKey{Key: key})
+			}
+			sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+		}
+
+		for _, k := range keys {
+			value, ok := outputs[k.Key]
+			if !ok {
+				return nil, fmt.Errorf("output '%s' not found in the outputs of CueInstance '%s'",
+					k.Key, client.ObjectKeyFromObject(source))
+			}
+			name := k.TagVar
+			if name == "" {
+				name = k.Key
+			}
+			if set[name] {
+				continue
+			}
+			set[name] = true
+			// the outputs written to a Secret are redacted like the tags sourced from Secrets
+			tagVars = append(tagVars, cuev1alpha1.TagVar{
+				Name:      name,
+				Value:     value,
+				Sensitive: source.Spec.WriteOutputsTo.Kind == "Secret",
+			})
+		}
+	}
+	return tagVars, nil
+}
+
+// readOutputs reads the outputs written by the CueInstance to its destination.
+func readOutputs(ctx context.Context, reader client.Reader, cueInstance cuev1alpha1.CueInstance) (map[string]string, error) {
+	dest := cueInstance.Spec.WriteOutputsTo
+	name := types.NamespacedName{Namespace: cueInstance.GetNamespace(), Name: dest.Name}
+
+	switch dest.Kind {
+	case "ConfigMap":
+		var cm corev1.ConfigMap
+		if err := reader.Get(ctx, name, &cm); err != nil {
+			return nil, fmt.Errorf("unable to read the outputs of CueInstance '%s': %w", client.ObjectKeyFromObject(&cueInstance), err)
+		}
+		return cm.Data, nil
+	case "Secret":
+		var secret corev1.Secret
+		if err := reader.Get(ctx, name, &secret); err != nil {
+			return nil, fmt.Errorf("unable to read the outputs of CueInstance '%s': %w", client.ObjectKeyFromObject(&cueInstance), err)
+		}
+		outputs := make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			outputs[k] = string(v)
+		}
+		return outputs, nil
+	default:
+		return nil, fmt.Errorf("unsupported outputs kind '%s'", dest.Kind)
+	}
+}
+
+func valuesSourceName(cueInstance cuev1alpha1.CueInstance, ref cuev1alpha1.ValuesReference) types.NamespacedName {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = cueInstance.GetNamespace()
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}
+}
+
+// indexValuesFrom returns the namespaced names of the CueInstances whose outputs are referenced.
+func (r *CueInstanceReconciler) indexValuesFrom(o client.Object) []string {
+	k, ok := o.(*cuev1alpha1.CueInstance)
+	if !ok {
+		panic(fmt.Sprintf("Expected a CueInstance, got %T", o))
+	}
+
+	names := make([]string, 0, len(k.Spec.ValuesFrom))
+	for _, ref := range k.Spec.ValuesFrom {
+		names = append(names, valuesSourceName(*k, ref).String())
+	}
+	return uniqueNames(names)
+}
+
+// requestsForOutputsOf enqueues the CueInstances which source values from the outputs of the CueInstance.
+func (r *CueInstanceReconciler) requestsForOutputsOf(obj client.Object) []reconcile.Request {
+	var list cuev1alpha1.CueInstanceList
+	if err := r.List(context.Background(), &list,
+		client.MatchingFields{valuesFromIndexKey: client.ObjectKeyFromObject(obj).String()},
+	); err != nil {
+		return nil
+	}
+
+	reqs := make([]reconcile.Request, len(list.Items))
+	for i := range list.Items {
+		reqs[i].NamespacedName = client.ObjectKeyFromObject(&list.Items[i])
+	}
+	return reqs
+}
+
+// OutputsChangePredicate triggers an update event
+// when a CueInstance writes new outputs.
+type OutputsChangePredicate struct {
+	predicate.Funcs
+}
+
+func (OutputsChangePredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return false
+	}
+
+	oldInstance, ok := e.ObjectOld.(*cuev1alpha1.CueInstance)
+	if !ok {
+		return false
+	}
+
+	newInstance, ok := e.ObjectNew.(*cuev1alpha1.CueInstance)
+	if !ok {
+		return false
+	}
+
+	return oldInstance.Status.OutputsChecksum != newInstance.Status.OutputsChecksum
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/gomega"
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestResolveValuesFrom(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(cuev1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	producer := func(name, namespace string, ready bool, checksum string) *cuev1alpha1.CueInstance {
+		status := metav1.ConditionFalse
+		if ready {
+			status = metav1.ConditionTrue
+		}
+		return &cuev1alpha1.CueInstance{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: cuev1alpha1.CueInstanceSpec{
+				WriteOutputsTo: &cuev1alpha1.OutputsDestination{Kind: "Secret", Name: name + "-outputs"},
+			},
+			Status: cuev1alpha1.CueInstanceStatus{
+				Conditions:      []metav1.Condition{{Type: meta.ReadyCondition, Status: status}},
+				OutputsChecksum: checksum,
+			},
+		}
+	}
+	outputs := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "infra-outputs", Namespace: "default"},
+		Data:       map[string][]byte{"endpoint": []byte("db:5432"), "password": []byte("s3cr3t")},
+	}
+
+	settings := producer("settings", "default", true, "abc")
+	settings.Spec.WriteOutputsTo.Kind = "ConfigMap"
+	settingsOutputs := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings-outputs", Namespace: "default"},
+		Data:       map[string]string{"level": "debug"},
+	}
+
+	r := &CueInstanceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			producer("infra", "default", true, "abc"),
+			settings,
+			settingsOutputs,
+			producer("pending", "default", true, ""),
+			producer("failing", "default", false, "abc"),
+			producer("shared", "other", true, "abc"),
+			outputs,
+		).Build(),
+	}
+
+	instance := cuev1alpha1.CueInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: cuev1alpha1.CueInstanceSpec{
+			ValuesFrom: []cuev1alpha1.ValuesReference{{Name: "infra"}},
+		},
+	}
+	tagVars := []cuev1alpha1.TagVar{{Name: "password", Value: "override"}}
+
+	g.Expect(r.checkValuesFrom(context.TODO(), instance)).To(Succeed())
+	got, err := r.resolveValuesFrom(context.TODO(), instance, tagVars)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(Equal([]cuev1alpha1.TagVar{
+		{Name: "password", Value: "override"},
+		{Name: "endpoint", Value: "db:5432", Sensitive: true},
+	}))
+
+	instance.Spec.ValuesFrom[0].Keys = []cuev1alpha1.ValuesKey{{Key: "endpoint", TagVar: "dbEndpoint"}}
+	got, err = r.resolveValuesFrom(context.TODO(), instance, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(Equal([]cuev1alpha1.TagVar{{Name: "dbEndpoint", Value: "db:5432", Sensitive: true}}))
+
+	// the outputs written to a ConfigMap are not redacted
+	instance.Spec.ValuesFrom = []cuev1alpha1.ValuesReference{{Name: "settings"}}
+	got, err = r.resolveValuesFrom(context.TODO(), instance, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(Equal([]cuev1alpha1.TagVar{{Name: "level", Value: "debug"}}))
+	instance.Spec.ValuesFrom = []cuev1alpha1.ValuesReference{{Name: "infra"}}
+
+	instance.Spec.ValuesFrom[0].Keys = []cuev1alpha1.ValuesKey{{Key: "user"}}
+	_, err = r.resolveValuesFrom(context.TODO(), instance, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("output 'user' not found")))
+
+	instance.Spec.ValuesFrom = []cuev1alpha1.ValuesReference{{Name: "pending"}}
+	g.Expect(r.checkValuesFrom(context.TODO(), instance)).To(MatchError(ContainSubstring("has not written its outputs yet")))
+	instance.Spec.ValuesFrom = []cuev1alpha1.ValuesReference{{Name: "failing"}}
+	g.Expect(r.checkValuesFrom(context.TODO(), instance)).To(MatchError(ContainSubstring("is not ready")))
+
+	instance.Spec.ValuesFrom = []cuev1alpha1.ValuesReference{{Name: "shared", Namespace: "other"}}
+	g.Expect(r.checkValuesFrom(context.TODO(), instance)).To(Succeed())
+	g.Expect(r.indexValuesFrom(&instance)).To(Equal([]string{"other/shared"}))
+	r.NoCrossNamespaceRefs = true
+	g.Expect(r.checkValuesFrom(context.TODO(), instance)).To(MatchError(ContainSubstring("cross-namespace references have been blocked")))
+
+	// without a service account the outputs are read with the controller permissions
+	reader, err := r.localClient(context.TODO(), instance)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reader).To(Equal(r.Client))
+}
+
+func TestOutputsChangePredicate(t *testing.T) {
+	g := NewWithT(t)
+
+	instance := func(checksum string) *cuev1alpha1.CueInstance {
+		return &cuev1alpha1.CueInstance{Status: cuev1alpha1.CueInstanceStatus{OutputsChecksum: checksum}}
+	}
+
+	p := OutputsChangePredicate{}
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: instance(""), ObjectNew: instance("abc")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: instance("abc"), ObjectNew: instance("def")})).To(BeTrue())
+	g.Expect(p.Update(event.UpdateEvent{ObjectOld: instance("abc"), ObjectNew: instance("abc")})).To(BeFalse())
+}
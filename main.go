@@ -22,12 +22,14 @@ import (
 	"time"
 
 	flag "github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	crtlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -69,25 +71,129 @@ func main() {
 		eventsAddr            string
 		healthAddr            string
 		concurrent            int
+		priorityQueueSize     int
+		concurrentBuilds      int
+		applyConcurrency      int
+		applyChunkSize        int
 		requeueDependency     time.Duration
+		intervalJitter        int
+		eventFilterOptions    controllers.EventFilterOptions
+		downloadOptions       controllers.ArtifactDownloadOptions
 		clientOptions         client.Options
+		instanceClientOptions controllers.ClientOptions
 		logOptions            logger.Options
 		leaderElectionOptions leaderelection.Options
 		aclOptions            acl.Options
 		watchAllNamespaces    bool
+		watchNamespaces       []string
 		httpRetry             int
 		defaultServiceAccount string
+		fieldManager          string
+		profileNamespace      string
+		allowedNamespaces     []string
+		kindPolicy            controllers.KindPolicy
+		readOnly              bool
+		validationReports     bool
+		clientSideValidation  bool
+		watchImagePolicies    bool
+		clusterScopedNs       []string
+		sandboxOptions        controllers.SandboxOptions
+		sandboxMemoryLimit    string
+		extractOptions        controllers.ExtractOptions
+		artifactMaxSize       string
+		artifactCacheOptions  controllers.ArtifactCacheOptions
+		artifactCacheMaxSize  string
+		artifactSymlinks      string
+		localSourceRoot       string
+		pruneProtection       controllers.PruneProtection
+		stallAfterFailures    int
 	)
 
+	// When invoked as a sandboxed build process, build the CUE instance and exit.
+	if len(os.Args) > 1 && os.Args[1] == controllers.SandboxBuildCommand {
+		os.Exit(controllers.RunSandboxBuild(os.Stdin, os.Stdout))
+	}
+
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&eventsAddr, "events-addr", "", "The address of the events receiver.")
 	flag.StringVar(&healthAddr, "health-addr", ":9440", "The address the health endpoint binds to.")
 	flag.IntVar(&concurrent, "concurrent", 4, "The number of concurrent cue instance reconciles.")
+	flag.IntVar(&priorityQueueSize, "priority-queue-size", 0,
+		"The number of cue instance reconciles held in addition to the concurrent ones, which are then started by order of their priority. Zero disables the priorities.")
+	flag.IntVar(&concurrentBuilds, "concurrent-builds", 0,
+		"The maximum number of CUE builds run simultaneously, the excess reconciles wait for a build to complete. Defaults to unlimited.")
+	flag.IntVar(&applyConcurrency, "apply-concurrency", 1,
+		"The number of objects of a CueInstance applied concurrently, following the reconcile order of their kinds.")
+	flag.IntVar(&applyChunkSize, "apply-chunk-size", 0,
+		"The number of objects of a CueInstance applied before the progress is reported in its status, zero applies all of them at once.")
+	flag.IntVar(&stallAfterFailures, "stall-after-failures", 0,
+		"The number of consecutive identical failures after which a CueInstance is marked as Stalled and retried at its interval, zero never stalls them.")
 	flag.DurationVar(&requeueDependency, "requeue-dependency", 30*time.Second, "The interval at which failing dependencies are reevaluated.")
+	flag.IntVar(&intervalJitter, "interval-jitter-percentage", 0,
+		"The maximum percentage by which the reconcile intervals are randomly shifted, between 0 and 100.")
+	flag.DurationVar(&eventFilterOptions.DedupWindow, "event-dedup-window", 10*time.Minute,
+		"The period during which identical failure events of a CueInstance are emitted only once, zero disables deduplication.")
+	flag.IntVar(&eventFilterOptions.RateLimit, "event-rate-limit", 30,
+		"The maximum number of events emitted per minute for each CueInstance, zero disables rate limiting.")
 	flag.BoolVar(&watchAllNamespaces, "watch-all-namespaces", true,
 		"Watch for custom resources in all namespaces, if set to false it will only watch the runtime namespace.")
+	flag.StringSliceVar(&watchNamespaces, "watch-namespaces", nil,
+		"Watch for custom resources in the listed namespaces only, overriding --watch-all-namespaces. The namespaces of the sources, secrets and profiles the CueInstances refer to must be listed as well. "+
+			"Namespaces are cluster-scoped and still require get, list and watch permissions at the cluster scope.")
 	flag.StringVar(&defaultServiceAccount, "default-service-account", "", "Default service account used for impersonation.")
+	flag.StringVar(&fieldManager, "field-manager", controllerName,
+		"The server-side apply field manager of the applied objects, which the CueInstances can suffix with their fieldManager.")
+	flag.StringSliceVar(&allowedNamespaces, "allowed-namespaces", nil,
+		"The namespaces, or shell patterns of namespaces, the objects of the CueInstances may target. Defaults to all namespaces.")
+	flag.StringSliceVar(&kindPolicy.Allowed, "allowed-kinds", nil,
+		"The kinds, in the form 'Kind.group' or shell patterns thereof, the CueInstances may apply. Defaults to all kinds.")
+	flag.StringSliceVar(&kindPolicy.Denied, "denied-kinds", nil,
+		"The kinds, in the form 'Kind.group' or shell patterns thereof, the CueInstances may not apply.")
+	flag.StringSliceVar(&clusterScopedNs, "cluster-scoped-namespaces", nil,
+		"The namespaces, or shell patterns of namespaces, of the CueInstances allowed to apply cluster-scoped objects. Defaults to all namespaces.")
+	flag.StringSliceVar(&pruneProtection.Kinds, "prune-protected-kinds", nil,
+		"The kinds, in the form 'Kind.group' or shell patterns thereof, the garbage collection never deletes, e.g. 'Namespace,PersistentVolumeClaim,CustomResourceDefinition.apiextensions.k8s.io'.")
+	flag.StringSliceVar(&pruneProtection.Namespaces, "prune-protected-namespaces", nil,
+		"The namespaces, or shell patterns of namespaces, whose objects the garbage collection never deletes, e.g. 'kube-*'.")
+	flag.BoolVar(&readOnly, "read-only", false,
+		"Build the CueInstances and report the changes they would make without ever mutating the clusters.")
+	flag.BoolVar(&validationReports, "validation-reports", false,
+		"Write a ValidationReport with the validation results of each CueInstance.")
+	flag.BoolVar(&clientSideValidation, "client-side-validation", false,
+		"Validate the objects against the cached OpenAPI schemas of the clusters before the server-side dry-runs.")
+	flag.BoolVar(&watchImagePolicies, "watch-image-policies", false,
+		"Reconcile the CueInstances whose tags are sourced from ImagePolicies when a new image is selected, requires the Flux image automation CRDs.")
+	flag.StringVar(&profileNamespace, "profile-namespace", os.Getenv("RUNTIME_NAMESPACE"),
+		"The namespace of the ProfileConfigs available to the CueInstances of all namespaces.")
 	flag.IntVar(&httpRetry, "http-retry", 9, "The maximum number of retries when failing to fetch artifacts over HTTP.")
+	flag.StringVar(&downloadOptions.CAFile, "artifact-ca-file", "",
+		"The path of a PEM bundle of certificate authorities trusted, in addition to the system ones, when fetching artifacts.")
+	flag.StringVar(&downloadOptions.Proxy, "artifact-proxy", "",
+		"The URL of the proxy artifacts are fetched through. Defaults to the HTTPS_PROXY and HTTP_PROXY environment variables.")
+	flag.StringVar(&artifactCacheOptions.Dir, "artifact-cache-dir", "",
+		"The directory where the downloaded artifacts, and the CUE modules they vendor, are cached, e.g. the mount path of a persistent volume. Defaults to no cache.")
+	flag.StringVar(&artifactCacheMaxSize, "artifact-cache-max-size", "",
+		"The maximum total size of the artifact cache, e.g. '5Gi', above which the least recently used artifacts are evicted. Defaults to unlimited.")
+	flag.BoolVar(&sandboxOptions.Enabled, "sandbox-builds", false,
+		"Run each CUE build in a separate, resource-limited process.")
+	flag.StringVar(&sandboxMemoryLimit, "sandbox-memory-limit", "",
+		"The maximum memory of a sandboxed CUE build process, e.g. '512Mi'. Defaults to unlimited. "+
+			"The process is started in a cgroup which kills it above the limit, the controller must run in a writable cgroup v2 "+
+			"which delegates the memory controller to its child cgroups, otherwise it fails to start.")
+	flag.DurationVar(&sandboxOptions.Timeout, "sandbox-timeout", 0,
+		"The maximum duration of a sandboxed CUE build. Defaults to the CueInstance timeout.")
+	flag.StringVar(&artifactMaxSize, "artifact-max-size", "",
+		"The maximum total size of the files extracted from an artifact, e.g. '1Gi'. Defaults to unlimited.")
+	flag.IntVar(&extractOptions.MaxFiles, "artifact-max-files", 0,
+		"The maximum number of files extracted from an artifact. Defaults to unlimited.")
+	flag.StringVar(&artifactSymlinks, "artifact-symlinks", string(cuev1alpha1.RejectSymlinks),
+		"How the symlinks of the artifacts are extracted, one of 'Reject', 'Skip' or 'Allow' the ones pointing inside the artifact.")
+	flag.StringVar(&localSourceRoot, "local-source-root", "",
+		"Enable the Directory sources, for development and air-gapped environments, read from the given directory of the controller filesystem.")
+	flag.Float32Var(&instanceClientOptions.RemoteQPS, "remote-kube-api-qps", 20.0,
+		"The maximum queries-per-second of requests sent to the remote clusters, can be overridden per KubeConfig.")
+	flag.IntVar(&instanceClientOptions.RemoteBurst, "remote-kube-api-burst", 50,
+		"The maximum burst queries-per-second of requests sent to the remote clusters, can be overridden per KubeConfig.")
 	clientOptions.BindFlags(flag.CommandLine)
 	logOptions.BindFlags(flag.CommandLine)
 	leaderElectionOptions.BindFlags(flag.CommandLine)
@@ -96,6 +202,53 @@ func main() {
 
 	ctrl.SetLogger(logger.NewLogger(logOptions))
 
+	instanceClientOptions.QPS = clientOptions.QPS
+	instanceClientOptions.Burst = clientOptions.Burst
+
+	if intervalJitter < 0 || intervalJitter > 100 {
+		setupLog.Error(fmt.Errorf("got %d", intervalJitter), "invalid interval jitter percentage")
+		os.Exit(1)
+	}
+
+	if sandboxMemoryLimit != "" {
+		limit, err := resource.ParseQuantity(sandboxMemoryLimit)
+		if err != nil {
+			setupLog.Error(err, "invalid sandbox memory limit")
+			os.Exit(1)
+		}
+		sandboxOptions.MemoryLimit = limit.Value()
+		if err := controllers.CheckSandboxMemoryLimit(sandboxOptions.MemoryLimit); err != nil {
+			setupLog.Error(err, "unable to enforce the sandbox memory limit")
+			os.Exit(1)
+		}
+	}
+
+	if artifactMaxSize != "" {
+		limit, err := resource.ParseQuantity(artifactMaxSize)
+		if err != nil {
+			setupLog.Error(err, "invalid artifact max size")
+			os.Exit(1)
+		}
+		extractOptions.MaxSize = limit.Value()
+	}
+
+	if artifactCacheMaxSize != "" {
+		limit, err := resource.ParseQuantity(artifactCacheMaxSize)
+		if err != nil {
+			setupLog.Error(err, "invalid artifact cache max size")
+			os.Exit(1)
+		}
+		artifactCacheOptions.MaxSize = limit.Value()
+	}
+
+	switch policy := cuev1alpha1.SymlinkPolicy(artifactSymlinks); policy {
+	case cuev1alpha1.RejectSymlinks, cuev1alpha1.SkipSymlinks, cuev1alpha1.AllowSymlinks:
+		extractOptions.Symlinks = policy
+	default:
+		setupLog.Error(fmt.Errorf("invalid symlink policy '%s'", artifactSymlinks), "invalid artifact symlinks")
+		os.Exit(1)
+	}
+
 	var eventRecorder *events.Recorder
 	if eventsAddr != "" {
 		if er, err := events.NewRecorder(eventsAddr, controllerName); err != nil {
@@ -108,12 +261,19 @@ func main() {
 
 	metricsRecorder := metrics.NewRecorder()
 	crtlmetrics.Registry.MustRegister(metricsRecorder.Collectors()...)
+	instanceMetrics := controllers.NewMetrics()
+	crtlmetrics.Registry.MustRegister(instanceMetrics.Collectors()...)
 
 	watchNamespace := ""
 	if !watchAllNamespaces {
 		watchNamespace = os.Getenv("RUNTIME_NAMESPACE")
 	}
 
+	newCache := newCacheFunc(watchNamespaces)
+	if newCache != nil {
+		watchNamespace = ""
+	}
+
 	restConfig := client.GetConfigOrDie(clientOptions)
 	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                        scheme,
@@ -127,6 +287,7 @@ func main() {
 		RetryPeriod:                   &leaderElectionOptions.RetryPeriod,
 		LeaderElectionID:              fmt.Sprintf("%s-leader-election", controllerName),
 		Namespace:                     watchNamespace,
+		NewCache:                      newCache,
 		Logger:                        ctrl.Log,
 	})
 	if err != nil {
@@ -138,25 +299,55 @@ func main() {
 	pprof.SetupHandlers(mgr, setupLog)
 
 	if err = (&controllers.CueInstanceReconciler{
-		ControllerName:        controllerName,
-		Client:                mgr.GetClient(),
-		Scheme:                mgr.GetScheme(),
-		EventRecorder:         mgr.GetEventRecorderFor(controllerName),
-		ExternalEventRecorder: eventRecorder,
-		MetricsRecorder:       metricsRecorder,
-		StatusPoller:          polling.NewStatusPoller(mgr.GetClient(), mgr.GetRESTMapper(), nil),
-		NoCrossNamespaceRefs:  aclOptions.NoCrossNamespaceRefs,
-		DefaultServiceAccount: defaultServiceAccount,
+		ControllerName:          controllerName,
+		Client:                  mgr.GetClient(),
+		APIReader:               mgr.GetAPIReader(),
+		Scheme:                  mgr.GetScheme(),
+		EventRecorder:           mgr.GetEventRecorderFor(controllerName),
+		ExternalEventRecorder:   eventRecorder,
+		MetricsRecorder:         metricsRecorder,
+		Metrics:                 instanceMetrics,
+		StatusPoller:            polling.NewStatusPoller(mgr.GetClient(), mgr.GetRESTMapper(), nil),
+		NoCrossNamespaceRefs:    aclOptions.NoCrossNamespaceRefs,
+		DefaultServiceAccount:   defaultServiceAccount,
+		ClientOptions:           instanceClientOptions,
+		FieldManager:            fieldManager,
+		ProfileNamespace:        profileNamespace,
+		AllowedNamespaces:       allowedNamespaces,
+		KindPolicy:              kindPolicy,
+		ReadOnly:                readOnly,
+		ValidationReports:       validationReports,
+		ClientSideValidation:    clientSideValidation,
+		ApplyConcurrency:        applyConcurrency,
+		ApplyChunkSize:          applyChunkSize,
+		MaxConcurrentBuilds:     concurrentBuilds,
+		ClusterScopedNamespaces: clusterScopedNs,
+		Sandbox:                 sandboxOptions,
+		Extract:                 extractOptions,
+		LocalSourceRoot:         localSourceRoot,
+		PruneProtection:         pruneProtection,
+		StallAfterFailures:      stallAfterFailures,
 	}).SetupWithManager(mgr, controllers.CueInstanceReconcilerOptions{
 		MaxConcurrentReconciles:   concurrent,
 		DependencyRequeueInterval: requeueDependency,
 		HTTPRetry:                 httpRetry,
+		IntervalJitterPercentage:  intervalJitter,
+		EventFilter:               eventFilterOptions,
+		ArtifactDownload:          downloadOptions,
+		ArtifactCache:             artifactCacheOptions,
+		WatchImagePolicies:        watchImagePolicies,
+		PriorityQueueSize:         priorityQueueSize,
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", controllerName)
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if err := mgr.AddMetricsExtraHandler(controllers.PromotionGatePath, controllers.NewPromotionGateHandler(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to set up promotion gate")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -172,3 +363,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newCacheFunc returns the cache builder restricting the manager cache to the
+// given namespaces, or nil when they are empty. The namespaced objects are only
+// listed and watched in the given namespaces, while the cluster-scoped objects,
+// such as the Namespaces read by the kind policies, are cached cluster-wide.
+func newCacheFunc(namespaces []string) cache.NewCacheFunc {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return cache.MultiNamespacedCacheBuilder(namespaces)
+}
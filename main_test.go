@@ -0,0 +1,121 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	cuev1alpha1 "github.com/phoban01/cue-flux-controller/api/v1alpha1"
+)
+
+// listRecorder is a minimal API server recording the paths of the list and
+// watch requests it serves, which are the requests the RBAC must allow.
+type listRecorder struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func (l *listRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l.mu.Lock()
+	l.paths[req.URL.Path] = true
+	l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.URL.Query().Get("watch") == "true" {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+		return
+	}
+
+	switch req.URL.Path {
+	case "/api/v1/namespaces":
+		fmt.Fprint(w, `{"apiVersion":"v1","kind":"NamespaceList","metadata":{"resourceVersion":"1"},`+
+			`"items":[{"metadata":{"name":"tenant","resourceVersion":"1"}}]}`)
+	case "/apis/cue.contrib.flux.io/v1alpha1/namespaces/tenant/cueinstances":
+		fmt.Fprint(w, `{"apiVersion":"cue.contrib.flux.io/v1alpha1","kind":"CueInstanceList","metadata":{"resourceVersion":"1"},`+
+			`"items":[{"metadata":{"name":"app","namespace":"tenant","resourceVersion":"1"}}]}`)
+	default:
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"apiVersion":"v1","kind":"Status","status":"Failure","reason":"Forbidden","code":403,"message":"%s is forbidden"}`, req.URL.Path)
+	}
+}
+
+func (l *listRecorder) listed() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var paths []string
+	for p := range l.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestNewCacheFunc(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(newCacheFunc(nil)).To(BeNil())
+
+	recorder := &listRecorder{paths: map[string]bool{}}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion, cuev1alpha1.GroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), apimeta.RESTScopeRoot)
+	mapper.Add(cuev1alpha1.GroupVersion.WithKind(cuev1alpha1.CueInstanceKind), apimeta.RESTScopeNamespace)
+
+	newCache := newCacheFunc([]string{"tenant"})
+	g.Expect(newCache).NotTo(BeNil())
+	c, err := newCache(&rest.Config{Host: server.URL}, cache.Options{Scheme: scheme, Mapper: mapper})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		_ = c.Start(ctx)
+	}()
+	g.Expect(c.WaitForCacheSync(ctx)).To(BeTrue())
+
+	var cueInstance cuev1alpha1.CueInstance
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "tenant", Name: "app"}, &cueInstance)).To(Succeed())
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "app"}, &cueInstance)).NotTo(Succeed())
+
+	// the namespaces read by the kind policies are cached cluster-wide
+	var namespace corev1.Namespace
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "tenant"}, &namespace)).To(Succeed())
+
+	g.Expect(recorder.listed()).To(Equal([]string{
+		"/api/v1/namespaces",
+		"/apis/cue.contrib.flux.io/v1alpha1/namespaces/tenant/cueinstances",
+	}))
+}